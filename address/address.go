@@ -18,26 +18,36 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package address
 
 import (
+	"net"
 	"regexp"
 	"strconv"
-	"strings"
 )
 
 const (
 	DomainPortRegex string = "^(([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\\-]*[a-zA-Z0-9])\\.)*([A-Za-z0-9]|[A-Za-z0-9][A-Za-z0-9\\-]*[A-Za-z0-9]):\\d+$"
 	IPPortRegex     string = "^(([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5])\\.){3}([0-9]|[1-9][0-9]|1[0-9]{2}|2[0-4][0-9]|25[0-5]):\\d+$"
+	// IPv6 addresses are enclosed in brackets. The address itself is checked
+	// by net.ParseIP.
+	IPv6PortRegex string = "^\\[([0-9a-fA-F.]*:[0-9a-fA-F:.]*)\\]:\\d+$"
 )
 
 func IsValid(a string) bool {
 	var domainPortRe = regexp.MustCompile(DomainPortRegex)
 	var ipPortRe = regexp.MustCompile(IPPortRegex)
+	var ipv6PortRe = regexp.MustCompile(IPv6PortRegex)
+	if m := ipv6PortRe.FindStringSubmatch(a); m != nil {
+		return net.ParseIP(m[1]) != nil
+	}
 	return domainPortRe.MatchString(a) || ipPortRe.MatchString(a)
 }
 
+// Parse splits the address into the host and the port. IPv6 addresses are
+// returned without brackets.
 func Parse(a string) (string, int, error) {
-	idx := strings.LastIndex(a, ":")
-	host := a[:idx]
-	portStr := a[idx+1:]
+	host, portStr, err := net.SplitHostPort(a)
+	if err != nil {
+		return "", 0, err
+	}
 	port, err := strconv.Atoi(portStr)
 	if err != nil {
 		return "", 0, err
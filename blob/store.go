@@ -0,0 +1,155 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package blob implements storage of the content of files attached to
+// messages. Every blob is stored in a separate file named after the hash of
+// the content.
+package blob
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// Store keeps blobs in a directory. The total size of the blobs is limited by
+// the quota.
+type Store struct {
+	dir   string
+	quota int64
+	used  int64
+	mx    sync.Mutex
+}
+
+const tmpFileSuffix = ".tmp"
+
+// OpenStore opens the store located in the dir, the directory is created if
+// it does not exist.
+func OpenStore(dir string, quota int64) (*Store, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		log.Errorf("Can't create blob directory %s: %v", dir, err)
+		return nil, errors.Filesystem
+	}
+	ff, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Errorf("Can't read blob directory %s: %v", dir, err)
+		return nil, errors.Filesystem
+	}
+	s := &Store{dir: dir, quota: quota}
+	for _, f := range ff {
+		if filepath.Ext(f.Name()) == tmpFileSuffix {
+			// Leftover of an interrupted write.
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		s.used += f.Size()
+	}
+	log.Debugf("Blob store %s uses %d of %d bytes", dir, s.used, quota)
+	return s, nil
+}
+
+func (s *Store) path(id *entity.ID) string {
+	return filepath.Join(s.dir, hex.EncodeToString(id[:]))
+}
+
+// Put adds the data to the store and returns its hash.
+func (s *Store) Put(data []byte) (*entity.ID, error) {
+	if int64(len(data)) > entity.MaxAttachmentSize {
+		log.Errorf("Attempt to store a blob of %d bytes", len(data))
+		return nil, errors.BlobSizeExceeded
+	}
+	id := entity.NewID(data)
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	path := s.path(&id)
+	if _, err := os.Stat(path); err == nil {
+		return &id, nil
+	}
+	if s.used+int64(len(data)) > s.quota {
+		log.Infof("Blob %s does not fit into the quota", id.Shorten())
+		return nil, errors.BlobQuotaExceeded
+	}
+	tmpPath := path + tmpFileSuffix
+	err := ioutil.WriteFile(tmpPath, data, 0644)
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		log.Errorf("Can't write blob %s: %v", id.Shorten(), err)
+		os.Remove(tmpPath)
+		return nil, errors.Filesystem
+	}
+	s.used += int64(len(data))
+	return &id, nil
+}
+
+// Has checks whether the store contains the blob.
+func (s *Store) Has(id *entity.ID) bool {
+	_, err := os.Stat(s.path(id))
+	return err == nil
+}
+
+// Get returns the content of the blob.
+func (s *Store) Get(id *entity.ID) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, errors.NoSuchBlob
+	} else if err != nil {
+		log.Errorf("Can't read blob %s: %v", id.Shorten(), err)
+		return nil, errors.Filesystem
+	}
+	return data, nil
+}
+
+// GetChunk returns at most size bytes of the blob starting from the offset.
+func (s *Store) GetChunk(id *entity.ID, offset int64, size int) ([]byte, error) {
+	f, err := os.Open(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, errors.NoSuchBlob
+	} else if err != nil {
+		log.Errorf("Can't open blob %s: %v", id.Shorten(), err)
+		return nil, errors.Filesystem
+	}
+	defer f.Close()
+	buf := make([]byte, size)
+	n, err := f.ReadAt(buf, offset)
+	if n == 0 && err != nil {
+		log.Infof("Can't read blob %s at %d: %v", id.Shorten(), offset, err)
+		return nil, errors.WrongArguments
+	}
+	return buf[:n], nil
+}
+
+// HasRoom checks whether a blob of the size fits into the quota.
+func (s *Store) HasRoom(size int64) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.used+size <= s.quota
+}
+
+// Usage returns the total size of the stored blobs and the quota.
+func (s *Store) Usage() (used, quota int64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.used, s.quota
+}
@@ -0,0 +1,181 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package cbor implements the deterministic subset of CBOR (RFC 8949, section
+// 4.2) used for hashing and signing entities. Only encoding is supported,
+// because the encoded data is never transferred as is: it's recomputed from
+// the entity fields on both sides.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"time"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// Map is encoded as a CBOR map with text keys. The keys are sorted in the
+// bytewise lexicographic order of their encodings.
+type Map map[string]interface{}
+
+// Array is encoded as a CBOR array.
+type Array []interface{}
+
+const (
+	majorUint   byte = 0
+	majorNegInt byte = 1
+	majorBytes  byte = 2
+	majorText   byte = 3
+	majorArray  byte = 4
+	majorMap    byte = 5
+	majorTag    byte = 6
+	majorSimple byte = 7
+
+	tagDateTimeString uint64 = 0
+
+	simpleFalse byte = 20
+	simpleTrue  byte = 21
+	simpleNull  byte = 22
+)
+
+// Marshal returns the canonical CBOR encoding of v. Supported types are
+// bool, signed and unsigned integers, string, []byte, []string, time.Time,
+// Map, Array and nil.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := encode(&buf, v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeHead writes the initial byte of a data item and its argument in the
+// shortest possible form.
+func writeHead(buf *bytes.Buffer, major byte, arg uint64) {
+	m := major << 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(m | byte(arg))
+	case arg <= 0xff:
+		buf.WriteByte(m | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= 0xffff:
+		buf.WriteByte(m | 25)
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(arg))
+		buf.Write(b[:])
+	case arg <= 0xffffffff:
+		buf.WriteByte(m | 26)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(arg))
+		buf.Write(b[:])
+	default:
+		buf.WriteByte(m | 27)
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], arg)
+		buf.Write(b[:])
+	}
+}
+
+func writeInt(buf *bytes.Buffer, i int64) {
+	if i < 0 {
+		writeHead(buf, majorNegInt, uint64(-(i + 1)))
+	} else {
+		writeHead(buf, majorUint, uint64(i))
+	}
+}
+
+func writeText(buf *bytes.Buffer, s string) {
+	writeHead(buf, majorText, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		buf.WriteByte(majorSimple<<5 | simpleNull)
+	case bool:
+		if x {
+			buf.WriteByte(majorSimple<<5 | simpleTrue)
+		} else {
+			buf.WriteByte(majorSimple<<5 | simpleFalse)
+		}
+	case int:
+		writeInt(buf, int64(x))
+	case int64:
+		writeInt(buf, x)
+	case uint:
+		writeHead(buf, majorUint, uint64(x))
+	case uint64:
+		writeHead(buf, majorUint, x)
+	case string:
+		writeText(buf, x)
+	case []byte:
+		writeHead(buf, majorBytes, uint64(len(x)))
+		buf.Write(x)
+	case []string:
+		writeHead(buf, majorArray, uint64(len(x)))
+		for _, s := range x {
+			writeText(buf, s)
+		}
+	case time.Time:
+		// Timestamps are normalized to UTC, so the encoding does not
+		// depend on the time zone of the author.
+		writeHead(buf, majorTag, tagDateTimeString)
+		writeText(buf, x.UTC().Format(time.RFC3339Nano))
+	case Array:
+		writeHead(buf, majorArray, uint64(len(x)))
+		for _, e := range x {
+			if err := encode(buf, e); err != nil {
+				return err
+			}
+		}
+	case Map:
+		return encodeMap(buf, x)
+	default:
+		log.Errorf("Can't encode value of type %T to CBOR", v)
+		return errors.WrongArguments
+	}
+	return nil
+}
+
+func encodeMap(buf *bytes.Buffer, m Map) error {
+	type pair struct {
+		key   []byte
+		value interface{}
+	}
+	pairs := make([]pair, 0, len(m))
+	for k, v := range m {
+		var kbuf bytes.Buffer
+		writeText(&kbuf, k)
+		pairs = append(pairs, pair{kbuf.Bytes(), v})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(pairs[i].key, pairs[j].key) < 0
+	})
+	writeHead(buf, majorMap, uint64(len(pairs)))
+	for _, p := range pairs {
+		buf.Write(p.key)
+		if err := encode(buf, p.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
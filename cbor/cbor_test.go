@@ -0,0 +1,121 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cbor
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		// Vectors from RFC 8949, Appendix A.
+		{"zero", 0, "00"},
+		{"small uint", uint(23), "17"},
+		{"one byte uint", 24, "1818"},
+		{"two byte uint", 1000, "1903e8"},
+		{"four byte uint", 1000000, "1a000f4240"},
+		{"eight byte uint", uint64(1000000000000), "1b000000e8d4a51000"},
+		{"max uint64", uint64(18446744073709551615), "1bffffffffffffffff"},
+		{"negative", -1, "20"},
+		{"negative 1000", int64(-1000), "3903e7"},
+		{"false", false, "f4"},
+		{"true", true, "f5"},
+		{"null", nil, "f6"},
+		{"empty text", "", "60"},
+		{"text", "IETF", "6449455446"},
+		{"unicode text", "ü", "62c3bc"},
+		{"bytes", []byte{1, 2, 3, 4}, "4401020304"},
+		{"strings", []string{"a", "b"}, "8261616162"},
+		{"array", Array{1, Array{2, 3}}, "8201820203"},
+		{"empty map", Map{}, "a0"},
+		{
+			"time",
+			time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC),
+			"c074323031332d30332d32315432303a30343a30305a",
+		},
+		{
+			"time in other zone",
+			time.Date(2013, 3, 21, 22, 4, 0, 0, time.FixedZone("", 2*3600)),
+			"c074323031332d30332d32315432303a30343a30305a",
+		},
+		// Shorter keys go first, keys of the same length are sorted
+		// bytewise.
+		{
+			"map key order",
+			Map{"aa": 3, "b": 2, "a": 1},
+			"a361610161620262616103",
+		},
+		{
+			"nested map key order",
+			Map{"z": Map{"y": 1, "x": 2}},
+			"a1617aa2617802617901",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.in)
+			if err != nil {
+				t.Fatalf("Marshal() returned error: %v", err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("Marshal() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalIsDeterministic(t *testing.T) {
+	m := Map{}
+	for _, k := range []string{"delta", "a", "charlie", "bravo", "echo", "b"} {
+		m[k] = k
+	}
+	want, err := Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal() returned error: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		got, _ := Marshal(m)
+		if string(got) != string(want) {
+			t.Fatalf("Marshal() = %x, want %x", got, want)
+		}
+	}
+}
+
+func TestMarshalUnsupportedType(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+	}{
+		{"float", 1.5},
+		{"struct", struct{}{}},
+		{"nested", Map{"a": Array{1.5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Marshal(tt.in); err == nil {
+				t.Errorf("Marshal() returned no error")
+			}
+		})
+	}
+}
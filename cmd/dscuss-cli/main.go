@@ -23,25 +23,32 @@ import (
 	"flag"
 	"fmt"
 	"github.com/abiosoft/ishell"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 	"vminko.org/dscuss"
+	"vminko.org/dscuss/crypto"
 	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
+	"vminko.org/dscuss/markup"
 	"vminko.org/dscuss/p2p/peer"
+	dstrings "vminko.org/dscuss/strings"
 	"vminko.org/dscuss/subs"
 	"vminko.org/dscuss/thread"
 )
 
 const (
 	cliVersion string = "1.0"
+	// quoteExcerptLen is the maximum length of quoted text displayed.
+	quoteExcerptLen = 256
 )
 
 var (
@@ -80,12 +87,17 @@ var commandList = []*ishell.Cmd{
 	},
 	{
 		Name: "mkthread",
-		Help: "start a new thread",
+		Help: "[ref...] [file...], start a new thread (referring to messages like quote:<id>, see:<id> or dup:<id>, with the files attached)",
 		Func: doMakeThread,
 	},
+	{
+		Name: "mkpoll",
+		Help: "[ref...] [file...], start a new thread with a poll (with references and files like in mkthread)",
+		Func: doMakePoll,
+	},
 	{
 		Name: "mkreply",
-		Help: "<id>, publish a new reply to message <id>",
+		Help: "<id> [ref...] [file...], publish a new reply to message <id> (with references and files like in mkthread)",
 		Func: doMakeReply,
 	},
 	{
@@ -98,6 +110,26 @@ var commandList = []*ishell.Cmd{
 		Help: "<id>, display a particular thread",
 		Func: doListThread,
 	},
+	{
+		Name: "react",
+		Help: "<id> <reaction>, react to message <id> (up, down, heart, laugh, wow or none to withdraw)",
+		Func: doReact,
+	},
+	{
+		Name: "vote",
+		Help: "<id> <option>, vote for option number <option> of poll <id>",
+		Func: doVote,
+	},
+	{
+		Name: "mkpm",
+		Help: "<id>, send a private message to user <id>",
+		Func: doMakePrivateMessage,
+	},
+	{
+		Name: "inbox",
+		Help: "list private messages sent to the current user",
+		Func: doListInbox,
+	},
 	{
 		Name: "sub",
 		Help: "<topic>. subscribe to <topic>",
@@ -115,7 +147,7 @@ var commandList = []*ishell.Cmd{
 	},
 	{
 		Name: "addmdr",
-		Help: "<id>, make user <id> a moderator",
+		Help: "<id> [topic], make user <id> a moderator (of the threads in <topic> only)",
 		Func: doAddModerator,
 	},
 	{
@@ -128,21 +160,66 @@ var commandList = []*ishell.Cmd{
 		Help: "list the current user's moderators",
 		Func: doListModerators,
 	},
+	{
+		Name: "quorum",
+		Help: "[type] [quorum], display or set the number of moderators required for operations of <type> (like 2 or 50%)",
+		Func: doQuorum,
+	},
 	{
 		Name: "rmmsg",
 		Help: "<id> <reason>, remove message <id> because of <reason>",
 		Func: doRemoveMessage,
 	},
+	{
+		Name: "edtopic",
+		Help: "<id> <reason>, change topic of thread <id> because of <reason>",
+		Func: doEditMessageTopic,
+	},
+	{
+		Name: "edsubj",
+		Help: "<id> <reason>, change subject of message <id> because of <reason>",
+		Func: doEditMessageSubject,
+	},
+	{
+		Name: "edtext",
+		Help: "<id> <reason>, change text of message <id> because of <reason>",
+		Func: doEditMessageText,
+	},
 	{
 		Name: "ban",
-		Help: "<id> <reason>, ban user <id> because of <reason>",
+		Help: "<id> <reason> [duration], ban user <id> because of <reason> (for <duration>, like 12h or 7d)",
 		Func: doBanUser,
 	},
+	{
+		Name: "revoke",
+		Help: "<id> <reason>, revoke operation <id> because of <reason>",
+		Func: doRevokeOperation,
+	},
 	{
 		Name: "lsop",
-		Help: "(user|msg) <id>, list operations on user or message <id>",
+		Help: "(user|msg|oper) <id>, list operations on user, message or operation <id>",
 		Func: doListOperations,
 	},
+	{
+		Name: "edinfo",
+		Help: "change additional info of the current user",
+		Func: doEditInfo,
+	},
+	{
+		Name: "passwd",
+		Help: "set or change the passphrase protecting the private key of the current user",
+		Func: doChangePassphrase,
+	},
+	{
+		Name: "rotkey",
+		Help: "replace the key of the current user with a new one",
+		Func: doRotateKey,
+	},
+	{
+		Name: "revkey",
+		Help: "[file], publish revocation certificate of the current key (or the one from <file>)",
+		Func: doRevokeKey,
+	},
 	{
 		Name: "whoami",
 		Help: "display nickname of the current user",
@@ -200,9 +277,21 @@ func doRegister(c *ishell.Context) {
 		return
 	}
 
+	passphrase, ok := readNewPassphrase(c)
+	if !ok {
+		return
+	}
+
 	c.Println("Registering new user. Do not interrupt the process.")
 	c.Println("Otherwise you'll have to remove the user directory manually.")
-	err = dscuss.Register(username, info, s)
+	reported := false
+	err = dscuss.Register(username, info, passphrase, s, func(p crypto.Progress) {
+		c.Printf("\rComputing proof-of-work: %-32s", p.String())
+		reported = true
+	})
+	if reported {
+		c.Println()
+	}
 	if err != nil {
 		c.Println("Could not register new user: " + err.Error() + ".")
 		return
@@ -214,6 +303,21 @@ func doRegister(c *ishell.Context) {
 		addrPath)
 }
 
+// readNewPassphrase asks the user to enter a new passphrase twice.
+func readNewPassphrase(c *ishell.Context) (string, bool) {
+	c.Print("Enter passphrase for the private key (empty for no encryption): ")
+	passphrase := c.ReadPassword()
+	if passphrase == "" {
+		return "", true
+	}
+	c.Print("Repeat the passphrase: ")
+	if c.ReadPassword() != passphrase {
+		c.Println("The passphrases don't match.")
+		return "", false
+	}
+	return passphrase, true
+}
+
 func doLogin(c *ishell.Context) {
 	if loginHandle != nil {
 		c.Println("You are already logged into the network." +
@@ -226,7 +330,14 @@ func doLogin(c *ishell.Context) {
 	}
 	nickname := c.Args[0]
 	var err error
-	loginHandle, err = dscuss.Login(nickname)
+	loginHandle, err = dscuss.Login(nickname, "")
+	if err == errors.PassphraseRequired {
+		c.ShowPrompt(false)
+		c.Print("Passphrase: ")
+		passphrase := c.ReadPassword()
+		c.ShowPrompt(true)
+		loginHandle, err = dscuss.Login(nickname, passphrase)
+	}
 	if err != nil {
 		c.Printf("Failed to log in as %s: %v\n", nickname, err)
 		return
@@ -351,7 +462,118 @@ func readMultiLines(c *ishell.Context, prompt string) string {
 	return text
 }
 
+// postMessage posts the message and displays the progress of computing its
+// stamp.
+func postMessage(c *ishell.Context, m *entity.Message) error {
+	done := loginHandle.PostMessage(m)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	reported := false
+	for {
+		select {
+		case err := <-done:
+			if reported {
+				c.Println()
+			}
+			return err
+		case <-ticker.C:
+			for _, pm := range loginHandle.ListPendingMessages() {
+				if pm.Message == m {
+					c.Printf("\rComputing the stamp of the message: %-32s", pm.Progress.String())
+					reported = true
+				}
+			}
+		}
+	}
+}
+
+// readReferences separates references (like quote:<id>) from the other
+// arguments.
+func readReferences(c *ishell.Context, args []string) ([]entity.Reference, []string, bool) {
+	var refs []entity.Reference
+	var rest []string
+	for _, a := range args {
+		var t entity.ReferenceType
+		parts := strings.SplitN(a, ":", 2)
+		if len(parts) != 2 || t.ParseString(parts[0]) != nil {
+			rest = append(rest, a)
+			continue
+		}
+		var r entity.Reference
+		err := r.ParseString(a)
+		if err != nil {
+			c.Println(a + " is not a valid reference.")
+			return nil, nil, false
+		}
+		refs = append(refs, r)
+	}
+	if len(refs) > entity.MaxReferencesNum {
+		c.Printf("Error: you can refer to at most %d messages.\n", entity.MaxReferencesNum)
+		return nil, nil, false
+	}
+	return refs, rest, true
+}
+
+// attachFiles puts the files into the blob store.
+func attachFiles(c *ishell.Context, paths []string) ([]entity.Attachment, bool) {
+	if len(paths) > entity.MaxAttachmentsNum {
+		c.Printf("Error: you can attach at most %d files.\n", entity.MaxAttachmentsNum)
+		return nil, false
+	}
+	var res []entity.Attachment
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			c.Println("Can't read " + path + ": " + err.Error() + ".")
+			return nil, false
+		}
+		a, err := loginHandle.AttachFile(filepath.Base(path), data)
+		if err != nil {
+			c.Println("Can't attach " + path + ": " + err.Error() + ".")
+			return nil, false
+		}
+		res = append(res, *a)
+	}
+	return res, true
+}
+
 func doMakeThread(c *ishell.Context) {
+	makeThread(c, false)
+}
+
+func doMakePoll(c *ishell.Context) {
+	makeThread(c, true)
+}
+
+// readPoll prompts for the options and the duration of a poll.
+func readPoll(c *ishell.Context) *entity.Poll {
+	optStr := readMultiLines(c, "Enter poll options (one per line)")
+	var options []string
+	for _, o := range strings.Split(optStr, "\n") {
+		if o = strings.TrimSpace(o); o != "" {
+			options = append(options, o)
+		}
+	}
+	if len(options) < entity.MinPollOptionsNum || len(options) > entity.MaxPollOptionsNum {
+		c.Printf("Error: a poll must have from %d to %d options.\n",
+			entity.MinPollOptionsNum, entity.MaxPollOptionsNum)
+		return nil
+	}
+	c.Print("Enter poll duration (like 12h or 7d, empty for 7d): ")
+	durStr := c.ReadLine()
+	d := entity.DefaultPollTimeout
+	if durStr != "" {
+		var err error
+		d, err = dstrings.ParseDuration(durStr)
+		if err != nil || d <= 0 || d > entity.MaxPollDuration {
+			c.Println(durStr + " is not a valid poll duration.")
+			return nil
+		}
+	}
+	return &entity.Poll{Options: options, DateCloses: time.Now().Add(d)}
+}
+
+func makeThread(c *ishell.Context, withPoll bool) {
 	c.ShowPrompt(false)
 	defer c.ShowPrompt(true)
 
@@ -359,8 +581,12 @@ func doMakeThread(c *ishell.Context) {
 		c.Println("You are not logged in.")
 		return
 	}
-	if len(c.Args) != 0 {
-		c.Println(c.Cmd.Help)
+	refs, paths, ok := readReferences(c, c.Args)
+	if !ok {
+		return
+	}
+	attachments, ok := attachFiles(c, paths)
+	if !ok {
 		return
 	}
 
@@ -385,12 +611,20 @@ func doMakeThread(c *ishell.Context) {
 		return
 	}
 
-	t, err := loginHandle.NewThread(subj, text, topic)
+	var poll *entity.Poll
+	if withPoll {
+		poll = readPoll(c)
+		if poll == nil {
+			return
+		}
+	}
+
+	t, err := loginHandle.NewThread(subj, text, topic, attachments, poll, refs)
 	if err != nil {
 		c.Println("Error making new thread: " + err.Error() + ".")
 		return
 	}
-	err = loginHandle.PostEntity((entity.Entity)(t))
+	err = postMessage(c, t)
 	if err != nil {
 		c.Println("Error posting new thread: " + err.Error() + ".")
 	} else {
@@ -443,7 +677,224 @@ func doListBoard(c *ishell.Context) {
 			c.Printf("Topic: %s\n", msg.Topic.String())
 		}
 		c.Printf("Subject: %s\n", msg.Subject)
-		c.Println(msg.Text)
+		c.Println(markup.ToANSI(msg.Text))
+		if s := reactionsSummary(msg.ID()); s != "" {
+			c.Println(s)
+		}
+	}
+}
+
+// reactionsSummary composes a line with the numbers of reactions to the
+// message. The result is empty if there are no reactions.
+func reactionsSummary(id *entity.ID) string {
+	rs, err := loginHandle.GetReactions(id)
+	if err != nil {
+		return "Reactions: [error fetching reactions from db]"
+	}
+	var parts []string
+	for _, t := range entity.ReactionTypes {
+		if rs.Counts[t] != 0 {
+			parts = append(parts, fmt.Sprintf("%s %s %d", t.Symbol(), t, rs.Counts[t]))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Reactions: %s (score %d)", strings.Join(parts, ", "), rs.Score)
+}
+
+func doReact(c *ishell.Context) {
+	if loginHandle == nil {
+		c.Println("You are not logged in.")
+		return
+	}
+	if len(c.Args) != 2 {
+		c.Println(c.Cmd.Help)
+		return
+	}
+	idStr := c.Args[0]
+	var id entity.ID
+	err := id.ParseString(idStr)
+	if err != nil {
+		c.Println(idStr + " is not a valid entity ID.")
+		return
+	}
+	var kind entity.ReactionType
+	err = kind.ParseString(c.Args[1])
+	if err != nil {
+		c.Println(c.Args[1] + " is not a valid reaction.")
+		return
+	}
+	_, err = loginHandle.GetMessage(&id)
+	if err != nil {
+		c.Println("Error fetching message " + idStr + ": " + err.Error() + ".")
+		return
+	}
+	r, err := loginHandle.NewReaction(kind, &id)
+	if err != nil {
+		c.Println("Error making new reaction: " + err.Error() + ".")
+		return
+	}
+	err = loginHandle.PostEntity((entity.Entity)(r))
+	if err != nil {
+		c.Println("Error posting new reaction: " + err.Error() + ".")
+	} else {
+		c.Println("Reaction '" + r.String() + "' posted successfully.")
+	}
+}
+
+// referenceSummary describes the reference. Quotes are followed by an excerpt
+// of the quoted text.
+func referenceSummary(r *entity.Reference) []string {
+	m, err := loginHandle.GetReferencedMessage(r)
+	if err == errors.NoSuchEntity {
+		return []string{fmt.Sprintf("Reference: %s [unavailable]", r)}
+	} else if err != nil {
+		return []string{"Reference: [error fetching message from db]"}
+	}
+	res := []string{fmt.Sprintf("Reference: %s (%s)", r, m.Subject)}
+	if r.Type == entity.ReferenceQuote {
+		for _, l := range strings.Split(dstrings.Truncate(m.Text, quoteExcerptLen), "\n") {
+			res = append(res, "> "+l)
+		}
+	}
+	return res
+}
+
+// backlinksSummary lists the messages referring to the message. The result is
+// empty if there are no such messages.
+func backlinksSummary(id *entity.ID) string {
+	mm, err := loginHandle.ListBacklinks(id)
+	if err != nil {
+		return "Referenced by: [error fetching messages from db]"
+	}
+	var parts []string
+	for _, m := range mm {
+		parts = append(parts, fmt.Sprintf("%s (%s)", m.ID().Shorten(), m.Subject))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "Referenced by: " + strings.Join(parts, ", ")
+}
+
+// pollSummary composes a multi-line human-readable summary of the votes on
+// the poll of the message.
+func pollSummary(m *entity.Message) string {
+	pt, err := loginHandle.GetPollTally(m)
+	if err != nil {
+		return "Poll: [error fetching votes from db]"
+	}
+	status := "closes " + m.Poll.DateCloses.Format(time.RFC3339)
+	if m.Poll.IsClosed(time.Now()) {
+		status = "closed"
+	}
+	res := fmt.Sprintf("Poll (%s, %d votes):", status, pt.Total)
+	for i, o := range m.Poll.Options {
+		res += fmt.Sprintf("\n  #%d %s: %d", i+1, o, pt.Counts[i])
+	}
+	return res
+}
+
+func doVote(c *ishell.Context) {
+	if loginHandle == nil {
+		c.Println("You are not logged in.")
+		return
+	}
+	if len(c.Args) != 2 {
+		c.Println(c.Cmd.Help)
+		return
+	}
+	idStr := c.Args[0]
+	var id entity.ID
+	err := id.ParseString(idStr)
+	if err != nil {
+		c.Println(idStr + " is not a valid entity ID.")
+		return
+	}
+	choice, err := strconv.Atoi(c.Args[1])
+	if err != nil || choice < 1 {
+		c.Println(c.Args[1] + " is not a valid option number.")
+		return
+	}
+	v, err := loginHandle.NewVote(choice-1, &id)
+	if err != nil {
+		c.Println("Error making new vote: " + err.Error() + ".")
+		return
+	}
+	err = loginHandle.PostEntity((entity.Entity)(v))
+	if err != nil {
+		c.Println("Error posting new vote: " + err.Error() + ".")
+	} else {
+		c.Println("Vote '" + v.String() + "' posted successfully.")
+	}
+}
+
+func doMakePrivateMessage(c *ishell.Context) {
+	c.ShowPrompt(false)
+	defer c.ShowPrompt(true)
+
+	if loginHandle == nil {
+		c.Println("You are not logged in.")
+		return
+	}
+	if len(c.Args) != 1 {
+		c.Println(c.Cmd.Help)
+		return
+	}
+	idStr := c.Args[0]
+	var id entity.ID
+	err := id.ParseString(idStr)
+	if err != nil {
+		c.Println(idStr + " is not a valid entity ID.")
+		return
+	}
+	text := readMultiLines(c, "Enter message text")
+	if text == "" {
+		c.Println("Error: message text can not be empty.")
+		return
+	}
+	pm, err := loginHandle.NewPrivateMessage(text, &id)
+	if err != nil {
+		c.Println("Error making new private message: " + err.Error() + ".")
+		return
+	}
+	err = loginHandle.PostEntity((entity.Entity)(pm))
+	if err != nil {
+		c.Println("Error posting new private message: " + err.Error() + ".")
+	} else {
+		c.Println("Private message '" + pm.String() + "' sent successfully.")
+	}
+}
+
+func doListInbox(c *ishell.Context) {
+	if loginHandle == nil {
+		c.Println("You are not logged in.")
+		return
+	}
+	if len(c.Args) != 0 {
+		c.Println(c.Cmd.Help)
+		return
+	}
+	const inboxSize = 20
+	mm, err := loginHandle.ListInbox(0, inboxSize)
+	if err != nil {
+		c.Println("Error fetching private messages: " + err.Error() + ".")
+		return
+	}
+	if len(mm) == 0 {
+		c.Println("There are no private messages.")
+		return
+	}
+	for i, pm := range mm {
+		c.Printf("#%d from %s, %s\n", i, userSummary(&pm.AuthorID),
+			pm.DateWritten.Format(time.RFC3339))
+		text, err := loginHandle.ReadPrivateMessage(pm)
+		if err != nil {
+			c.Println("Can't decrypt the message: " + err.Error() + ".")
+			continue
+		}
+		c.Println(text)
 	}
 }
 
@@ -466,11 +917,35 @@ func (tp *ThreadPrinter) Handle(n *thread.Node) bool {
 		tp.c.Println()
 	}
 	tp.c.Printf("%sSubject: %s\n", tp.composeIndentation(n), m.Subject)
-	lines := strings.Split(m.Text, "\n")
+	lines := strings.Split(markup.ToANSI(m.Text), "\n")
 	indentedText := strings.Join(lines, "\n"+tp.composeIndentation(n))
 	tp.c.Printf("%s%s\n", tp.composeIndentation(n), indentedText)
 	tp.c.Printf("%sby %s, %s\n", tp.composeIndentation(n), userSummary(&m.AuthorID),
 		m.DateWritten.Format(time.RFC3339))
+	for i := range m.Attachments {
+		a := &m.Attachments[i]
+		status := ""
+		if !loginHandle.HasBlob(&a.Hash) {
+			status = " [not downloaded]"
+		}
+		tp.c.Printf("%sAttachment: %s%s\n", tp.composeIndentation(n), a, status)
+	}
+	for i := range m.References {
+		for _, l := range referenceSummary(&m.References[i]) {
+			tp.c.Printf("%s%s\n", tp.composeIndentation(n), l)
+		}
+	}
+	if s := backlinksSummary(m.ID()); s != "" {
+		tp.c.Printf("%s%s\n", tp.composeIndentation(n), s)
+	}
+	if m.Poll != nil {
+		lines := strings.Split(pollSummary(m), "\n")
+		tp.c.Printf("%s%s\n", tp.composeIndentation(n),
+			strings.Join(lines, "\n"+tp.composeIndentation(n)))
+	}
+	if s := reactionsSummary(m.ID()); s != "" {
+		tp.c.Printf("%s%s\n", tp.composeIndentation(n), s)
+	}
 	tp.c.Printf("%sID: %s\n", tp.composeIndentation(n), m.ID().String())
 	return true
 }
@@ -512,7 +987,7 @@ func doMakeReply(c *ishell.Context) {
 		c.Println("You are not logged in.")
 		return
 	}
-	if len(c.Args) != 1 {
+	if len(c.Args) < 1 {
 		c.Println(c.Cmd.Help)
 		return
 	}
@@ -523,6 +998,14 @@ func doMakeReply(c *ishell.Context) {
 		c.Println(idStr + " is not a valid entity ID.")
 		return
 	}
+	refs, paths, ok := readReferences(c, c.Args[1:])
+	if !ok {
+		return
+	}
+	attachments, ok := attachFiles(c, paths)
+	if !ok {
+		return
+	}
 
 	c.Print("Enter reply subject: ")
 	subj := c.ReadLine()
@@ -537,12 +1020,12 @@ func doMakeReply(c *ishell.Context) {
 		return
 	}
 
-	r, err := loginHandle.NewReply(subj, text, &pid)
+	r, err := loginHandle.NewReply(subj, text, &pid, attachments, refs)
 	if err != nil {
 		c.Println("Error making new reply: " + err.Error() + ".")
 		return
 	}
-	err = loginHandle.PostEntity((entity.Entity)(r))
+	err = postMessage(c, r)
 	if err != nil {
 		c.Println("Error posting new reply: " + err.Error() + ".")
 	} else {
@@ -612,7 +1095,7 @@ func doAddModerator(c *ishell.Context) {
 		c.Println("You are not logged in.")
 		return
 	}
-	if len(c.Args) != 1 {
+	if len(c.Args) != 1 && len(c.Args) != 2 {
 		c.Println(c.Cmd.Help)
 		return
 	}
@@ -623,7 +1106,15 @@ func doAddModerator(c *ishell.Context) {
 		c.Println(idStr + " is not a valid entity ID.")
 		return
 	}
-	err = loginHandle.AddModerator(&id)
+	var scope subs.Topic
+	if len(c.Args) == 2 {
+		scope, err = subs.NewTopic(c.Args[1])
+		if err != nil {
+			c.Println("Unacceptable topic: " + err.Error() + ".")
+			return
+		}
+	}
+	err = loginHandle.AddModerator(&id, scope)
 	if err != nil {
 		c.Println("Error making new moderator: " + err.Error() + ".")
 	}
@@ -662,11 +1153,54 @@ func doListModerators(c *ishell.Context) {
 	}
 	mm := loginHandle.ListModerators()
 	for i, mdr := range mm {
-		c.Printf("#%d %s\n", i, userSummary(mdr))
+		if mdr.Scope == nil {
+			c.Printf("#%d %s\n", i, userSummary(&mdr.ID))
+		} else {
+			c.Printf("#%d %s in %s\n", i, userSummary(&mdr.ID), mdr.Scope)
+		}
+	}
+}
+
+func doQuorum(c *ishell.Context) {
+	if loginHandle == nil {
+		c.Println("You are not logged in.")
+		return
+	}
+	if len(c.Args) > 2 {
+		c.Println(c.Cmd.Help)
+		return
+	}
+	if len(c.Args) == 0 {
+		for _, t := range entity.QuorumOperationTypes {
+			q := loginHandle.GetQuorum(t)
+			c.Printf("%-20s %s\n", t, q.String())
+		}
+		return
+	}
+	var t entity.OperationType
+	err := t.ParseString(c.Args[0])
+	if err != nil {
+		c.Println(c.Args[0] + " is not a valid operation type.")
+		return
+	}
+	if len(c.Args) == 1 {
+		q := loginHandle.GetQuorum(t)
+		c.Println(q.String())
+		return
+	}
+	var q entity.Quorum
+	err = q.ParseString(c.Args[1])
+	if err != nil {
+		c.Println(c.Args[1] + " is not a valid quorum.")
+		return
+	}
+	err = loginHandle.SetQuorum(t, &q)
+	if err != nil {
+		c.Println("Could not set the quorum: " + err.Error() + ".")
 	}
 }
 
-func makeOperation(c *ishell.Context, typ entity.OperationType) {
+func makeOperation(c *ishell.Context, typ entity.OperationType, dateExpires *time.Time) {
 	if loginHandle == nil {
 		c.Println("You are not logged in.")
 		return
@@ -689,11 +1223,23 @@ func makeOperation(c *ishell.Context, typ entity.OperationType) {
 		c.Println(idStr + " is not a valid operation reason.")
 		return
 	}
+	var replacement string
+	switch typ {
+	case entity.OperationTypeEditMessageTopic:
+		c.Print("Enter new topic: ")
+		replacement = c.ReadLine()
+	case entity.OperationTypeEditMessageSubject:
+		c.Print("Enter new subject: ")
+		replacement = c.ReadLine()
+	case entity.OperationTypeEditMessageText:
+		replacement = readMultiLines(c, "Enter new message text")
+	}
 	c.Print("Enter optional comment: ")
 	comment := c.ReadLine()
-	op, err := loginHandle.NewOperation(typ, reason, comment, &id)
+	op, err := loginHandle.NewOperation(typ, reason, comment, replacement, dateExpires, &id)
 	if err != nil {
 		c.Println("Error making new operation: " + err.Error() + ".")
+		return
 	}
 	err = loginHandle.PostEntity((entity.Entity)(op))
 	if err != nil {
@@ -704,11 +1250,38 @@ func makeOperation(c *ishell.Context, typ entity.OperationType) {
 }
 
 func doBanUser(c *ishell.Context) {
-	makeOperation(c, entity.OperationTypeBanUser)
+	if len(c.Args) != 3 {
+		makeOperation(c, entity.OperationTypeBanUser, nil)
+		return
+	}
+	d, err := dstrings.ParseDuration(c.Args[2])
+	if err != nil || d <= 0 {
+		c.Println(c.Args[2] + " is not a valid ban duration.")
+		return
+	}
+	expires := time.Now().Add(d)
+	c.Args = c.Args[:2]
+	makeOperation(c, entity.OperationTypeBanUserTemporarily, &expires)
 }
 
 func doRemoveMessage(c *ishell.Context) {
-	makeOperation(c, entity.OperationTypeRemoveMessage)
+	makeOperation(c, entity.OperationTypeRemoveMessage, nil)
+}
+
+func doEditMessageTopic(c *ishell.Context) {
+	makeOperation(c, entity.OperationTypeEditMessageTopic, nil)
+}
+
+func doEditMessageSubject(c *ishell.Context) {
+	makeOperation(c, entity.OperationTypeEditMessageSubject, nil)
+}
+
+func doEditMessageText(c *ishell.Context) {
+	makeOperation(c, entity.OperationTypeEditMessageText, nil)
+}
+
+func doRevokeOperation(c *ishell.Context) {
+	makeOperation(c, entity.OperationTypeRevokeOperation, nil)
 }
 
 func doListOperations(c *ishell.Context) {
@@ -734,9 +1307,11 @@ func doListOperations(c *ishell.Context) {
 		ops, err = loginHandle.ListOperationsOnUser(&id)
 	case "msg":
 		ops, err = loginHandle.ListOperationsOnMessage(&id)
+	case "oper":
+		ops, err = loginHandle.ListOperationsOnOperation(&id)
 	default:
 		c.Println(entType + " is not a valid entity type.")
-		c.Println("Expected: 'user' or 'msg'")
+		c.Println("Expected: 'user', 'msg' or 'oper'")
 		return
 	}
 	if err != nil {
@@ -755,9 +1330,121 @@ func doListOperations(c *ishell.Context) {
 		if op.Comment != "" {
 			c.Printf("Comment: %s\n", op.Comment)
 		}
+		if op.Replacement != "" {
+			c.Printf("Replacement: %s\n", op.Replacement)
+		}
+		if op.DateExpires != nil {
+			c.Printf("Expires: %s\n", op.DateExpires.Format(time.RFC3339))
+		}
+	}
+}
+
+func doEditInfo(c *ishell.Context) {
+	if loginHandle == nil {
+		c.Println("You are not logged in.")
+		return
+	}
+	if len(c.Args) != 0 {
+		c.Println(c.Cmd.Help)
+		return
+	}
+	c.Print("Enter new additional info: ")
+	info := c.ReadLine()
+	uu, err := loginHandle.NewUserUpdate(info)
+	if err != nil {
+		c.Println("Error making new user update: " + err.Error() + ".")
+		return
+	}
+	err = loginHandle.PostEntity((entity.Entity)(uu))
+	if err != nil {
+		c.Println("Error posting new user update: " + err.Error() + ".")
+	} else {
+		c.Println("Additional info updated successfully.")
 	}
 }
 
+func doChangePassphrase(c *ishell.Context) {
+	if loginHandle == nil {
+		c.Println("You are not logged in.")
+		return
+	}
+	if len(c.Args) != 0 {
+		c.Println(c.Cmd.Help)
+		return
+	}
+	c.ShowPrompt(false)
+	defer c.ShowPrompt(true)
+	c.Print("Enter the current passphrase (empty if not set): ")
+	oldPassphrase := c.ReadPassword()
+	newPassphrase, ok := readNewPassphrase(c)
+	if !ok {
+		return
+	}
+	err := loginHandle.ChangePassphrase(oldPassphrase, newPassphrase)
+	if err != nil {
+		c.Println("Error changing the passphrase: " + err.Error() + ".")
+		return
+	}
+	if newPassphrase == "" {
+		c.Println("The private key is stored unencrypted now.")
+	} else {
+		c.Println("The passphrase is changed successfully.")
+	}
+}
+
+func doRotateKey(c *ishell.Context) {
+	if loginHandle == nil {
+		c.Println("You are not logged in.")
+		return
+	}
+	if len(c.Args) != 0 {
+		c.Println(c.Cmd.Help)
+		return
+	}
+	c.Println("The current key will be retired. It's kept in the user directory in order")
+	c.Println("to read the private messages sent to it, don't delete it unless you don't")
+	c.Println("need the messages anymore. Nodes stop accepting entities signed by the")
+	c.Println("current key 30 days after they receive the rotation.")
+	c.Print("Rotate the key? (yes/no): ")
+	if c.ReadLine() != "yes" {
+		c.Println("The key is not rotated.")
+		return
+	}
+	kr, err := loginHandle.RotateKey()
+	if err != nil {
+		c.Println("Error rotating the key: " + err.Error() + ".")
+		return
+	}
+	c.Printf("The key is rotated successfully, new key version is %d.\n", kr.Seq)
+	c.Println("The revocation certificate is regenerated for the new key.")
+}
+
+func doRevokeKey(c *ishell.Context) {
+	if loginHandle == nil {
+		c.Println("You are not logged in.")
+		return
+	}
+	if len(c.Args) > 1 {
+		c.Println(c.Cmd.Help)
+		return
+	}
+	var path string
+	if len(c.Args) == 1 {
+		path = c.Args[0]
+	} else {
+		c.Print("The current key will become unusable. Continue? (yes/no): ")
+		if c.ReadLine() != "yes" {
+			return
+		}
+	}
+	kr, err := loginHandle.RevokeKey(path)
+	if err != nil {
+		c.Println("Error revoking the key: " + err.Error() + ".")
+		return
+	}
+	c.Printf("Key version %d of user %s is revoked.\n", kr.KeySeq, userSummary(&kr.UserID))
+}
+
 func doWhoAmI(c *ishell.Context) {
 	if len(c.Args) != 0 {
 		c.Println(c.Cmd.Help)
@@ -769,6 +1456,16 @@ func doWhoAmI(c *ishell.Context) {
 	}
 	u := loginHandle.GetLoggedUser()
 	c.Printf("%s (%s)\n", u.Nickname, u.ID())
+	kc, err := loginHandle.GetKeyChain(u.ID())
+	if err != nil {
+		c.Println("Error fetching the key chain: " + err.Error() + ".")
+		return
+	}
+	c.Printf("Key version: %d", kc.CurrentSeq())
+	if kc.IsCompromised() {
+		c.Print(" (revoked)")
+	}
+	c.Println()
 }
 
 func doVersion(c *ishell.Context) {
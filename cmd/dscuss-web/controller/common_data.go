@@ -35,6 +35,13 @@ type CommonData struct {
 	CurrentURL         template.URL
 	ShowLogin          bool
 	IsWritingPermitted bool
+	PendingMessages    []PendingMessage
+}
+
+// PendingMessage is a message of the owner waiting for its stamp.
+type PendingMessage struct {
+	Subject  string
+	Progress string
 }
 
 func readCommonData(r *http.Request, s *Session, l *dscuss.LoginHandle) *CommonData {
@@ -50,6 +57,12 @@ func readCommonData(r *http.Request, s *Session, l *dscuss.LoginHandle) *CommonD
 		u := l.GetLoggedUser()
 		res.Owner.Assign(u)
 		res.IsWritingPermitted = true
+		for _, pm := range l.ListPendingMessages() {
+			res.PendingMessages = append(res.PendingMessages, PendingMessage{
+				Subject:  pm.Message.Subject,
+				Progress: pm.Progress.String(),
+			})
+		}
 	}
 	if r.URL.Path != "" {
 		currentURL := r.URL.Path
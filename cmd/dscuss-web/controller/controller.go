@@ -21,8 +21,12 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package controller
 
 import (
+	"fmt"
+	"html/template"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"runtime/debug"
 	"strings"
 	"time"
@@ -31,9 +35,15 @@ import (
 	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
+	"vminko.org/dscuss/markup"
 	"vminko.org/dscuss/p2p/peer"
+	dstrings "vminko.org/dscuss/strings"
 )
 
+// previewAction is the value of the submit button requesting a preview of the
+// composed message.
+const previewAction = "Preview"
+
 func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
@@ -125,15 +135,117 @@ func (u *User) Assign(eu *entity.User) {
 	u.RegDate = eu.RegDate.Format(time.RFC3339)
 }
 
+// Moderator is a user moderating the threads in Scope (all threads if the
+// scope is empty).
+type Moderator struct {
+	User
+	Scope string
+}
+
+type Attachment struct {
+	Name        string
+	Hash        string
+	Size        int64
+	IsAvailable bool
+	IsImage     bool
+}
+
+func (a *Attachment) Assign(ea *entity.Attachment, l *dscuss.LoginHandle) {
+	a.Name = ea.Name
+	a.Hash = ea.Hash.String()
+	a.Size = ea.Size
+	a.IsAvailable = l.HasBlob(&ea.Hash)
+	a.IsImage = isImageName(ea.Name)
+}
+
+type Reaction struct {
+	Name   string
+	Symbol string
+	Count  int
+}
+
 type Message struct {
 	ID            string
 	ShortID       string
 	Subject       string
 	Text          string
+	FormattedText template.HTML
 	DateWritten   string
 	AuthorName    string
 	AuthorID      string
 	AuthorShortID string
+	Attachments   []Attachment
+	Reactions     []Reaction
+	Score         int
+	RemovalVotes  int
+	RemovalQuorum int
+	Poll          *Poll
+	References    []MessageReference
+	Backlinks     []MessageReference
+}
+
+// MessageReference is a link to another message. Excerpt is only set for
+// quotes.
+type MessageReference struct {
+	Relation    string
+	ID          string
+	ShortID     string
+	Subject     string
+	Excerpt     string
+	IsAvailable bool
+}
+
+// quoteExcerptLen is the maximum length of quoted text displayed.
+const quoteExcerptLen = 256
+
+func (mr *MessageReference) Assign(r *entity.Reference, l *dscuss.LoginHandle) {
+	mr.Relation = r.Type.Description()
+	mr.ID = r.ID.String()
+	mr.ShortID = r.ID.Shorten()
+	m, err := l.GetReferencedMessage(r)
+	if err != nil {
+		if err != errors.NoSuchEntity {
+			log.Errorf("Failed to get referenced message %s: %v", mr.ShortID, err)
+		}
+		return
+	}
+	mr.IsAvailable = true
+	mr.Subject = m.Subject
+	if r.Type == entity.ReferenceQuote {
+		mr.Excerpt = dstrings.Truncate(m.Text, quoteExcerptLen)
+	}
+}
+
+// Poll is the state of the poll of a message.
+type Poll struct {
+	ID         string
+	Options    []PollOption
+	Total      int
+	DateCloses string
+	IsClosed   bool
+}
+
+type PollOption struct {
+	Index int
+	Text  string
+	Votes int
+}
+
+func (p *Poll) Assign(em *entity.Message, pt *entity.PollTally) {
+	p.ID = em.ID().String()
+	p.Options = make([]PollOption, len(em.Poll.Options))
+	for i, o := range em.Poll.Options {
+		p.Options[i] = PollOption{Index: i, Text: o, Votes: pt.Counts[i]}
+	}
+	p.Total = pt.Total
+	p.DateCloses = em.Poll.DateCloses.Format(time.RFC3339)
+	p.IsClosed = em.Poll.IsClosed(time.Now())
+}
+
+// Quorum is the number of moderators required for operations of Type.
+type Quorum struct {
+	Type  string
+	Value string
 }
 
 func (m *Message) Assign(em *entity.Message, l *dscuss.LoginHandle) {
@@ -141,10 +253,59 @@ func (m *Message) Assign(em *entity.Message, l *dscuss.LoginHandle) {
 	m.ShortID = em.ID().Shorten()
 	m.Subject = em.Subject
 	m.Text = em.Text
+	m.FormattedText = template.HTML(markup.ToHTML(em.Text))
 	m.DateWritten = em.DateWritten.Format(time.RFC3339)
 	m.AuthorID = em.AuthorID.String()
 	m.AuthorShortID = em.AuthorID.Shorten()
 	m.AuthorName = userName(&em.AuthorID, l)
+	m.Attachments = make([]Attachment, len(em.Attachments))
+	for i := range em.Attachments {
+		m.Attachments[i].Assign(&em.Attachments[i], l)
+	}
+	m.References = make([]MessageReference, len(em.References))
+	for i := range em.References {
+		m.References[i].Assign(&em.References[i], l)
+	}
+	m.Backlinks = nil
+	bb, err := l.ListBacklinks(em.ID())
+	if err != nil {
+		log.Errorf("Failed to get messages referring to %s: %v", m.ShortID, err)
+	}
+	for _, b := range bb {
+		m.Backlinks = append(m.Backlinks, MessageReference{
+			Relation:    "referenced by",
+			ID:          b.ID().String(),
+			ShortID:     b.ID().Shorten(),
+			Subject:     b.Subject,
+			IsAvailable: true,
+		})
+	}
+	m.Poll = nil
+	if em.Poll != nil {
+		pt, err := l.GetPollTally(em)
+		if err != nil {
+			log.Errorf("Failed to count votes on poll %s: %v", m.ShortID, err)
+		} else {
+			m.Poll = &Poll{}
+			m.Poll.Assign(em, pt)
+		}
+	}
+	rs, err := l.GetReactions(em.ID())
+	if err != nil {
+		log.Errorf("Failed to get reactions to message %s: %v", m.ShortID, err)
+		return
+	}
+	m.Score = rs.Score
+	m.Reactions = nil
+	for _, t := range entity.ReactionTypes {
+		if rs.Counts[t] != 0 {
+			m.Reactions = append(m.Reactions, Reaction{t.String(), t.Symbol(), rs.Counts[t]})
+		}
+	}
+	m.RemovalVotes, m.RemovalQuorum, err = l.CountRemovalVotes(em)
+	if err != nil {
+		log.Errorf("Failed to count removal votes for message %s: %v", m.ShortID, err)
+	}
 }
 
 type RootMessage struct {
@@ -163,8 +324,14 @@ type Thread struct {
 }
 
 type ComposedReply struct {
-	Subject string
-	Text    string
+	Subject    string
+	Text       string
+	References string
+}
+
+type EditedMessage struct {
+	Field       string
+	Replacement string
 }
 
 type ComposedRootMessage struct {
@@ -179,7 +346,9 @@ type Operation struct {
 	Type          string
 	Reason        string
 	Comment       string
+	Replacement   string
 	DatePerformed string
+	DateExpires   string
 	AuthorName    string
 	AuthorID      string
 	AuthorShortID string
@@ -191,7 +360,11 @@ func (o *Operation) Assign(eo *entity.Operation, l *dscuss.LoginHandle) {
 	o.Type = eo.OperationType().String()
 	o.Reason = eo.Reason.String()
 	o.Comment = eo.Comment
+	o.Replacement = eo.Replacement
 	o.DatePerformed = eo.DatePerformed.Format(time.RFC3339)
+	if eo.DateExpires != nil {
+		o.DateExpires = eo.DateExpires.Format(time.RFC3339)
+	}
 	o.AuthorID = eo.AuthorID.String()
 	o.AuthorShortID = eo.AuthorID.Shorten()
 	o.AuthorName = userName(&eo.AuthorID, l)
@@ -231,3 +404,72 @@ func (ph *PeerHistory) Assign(uh *entity.UserHistory) {
 	}
 
 }
+
+// isImageName checks whether the file is an image, which can be displayed
+// inline. SVG is not included, because it may contain scripts.
+func isImageName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+		return true
+	default:
+		return false
+	}
+}
+
+// readReferences parses the references submitted via the form (one per line,
+// like quote:<id>). Returns a message for the user in case of failure.
+func readReferences(s string) ([]entity.Reference, string) {
+	var res []entity.Reference
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var r entity.Reference
+		err := r.ParseString(line)
+		if err != nil {
+			return nil, "'" + line + "' is not a valid reference."
+		}
+		res = append(res, r)
+	}
+	if len(res) > entity.MaxReferencesNum {
+		return nil, fmt.Sprintf("You can refer to at most %d messages.", entity.MaxReferencesNum)
+	}
+	return res, ""
+}
+
+// readAttachments puts the files uploaded via the form into the blob store.
+// Returns a message for the user in case of failure.
+func readAttachments(r *http.Request, l *dscuss.LoginHandle) ([]entity.Attachment, string) {
+	if r.MultipartForm == nil {
+		return nil, ""
+	}
+	var res []entity.Attachment
+	for _, fh := range r.MultipartForm.File["attachment"] {
+		if fh.Filename == "" && fh.Size == 0 {
+			// Browsers send an empty part if no file is selected.
+			continue
+		}
+		if len(res) == entity.MaxAttachmentsNum {
+			return nil, fmt.Sprintf("You can attach at most %d files.", entity.MaxAttachmentsNum)
+		}
+		if fh.Size > entity.MaxAttachmentSize {
+			return nil, "File " + fh.Filename + " is too big."
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, "Can't read " + fh.Filename + ": " + err.Error() + "."
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, "Can't read " + fh.Filename + ": " + err.Error() + "."
+		}
+		a, err := l.AttachFile(filepath.Base(fh.Filename), data)
+		if err != nil {
+			return nil, "Can't attach " + fh.Filename + ": " + err.Error() + "."
+		}
+		res = append(res, *a)
+	}
+	return res, ""
+}
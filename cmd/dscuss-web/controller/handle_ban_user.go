@@ -20,10 +20,12 @@ package controller
 import (
 	"net/http"
 	"net/url"
+	"time"
 	"vminko.org/dscuss"
 	"vminko.org/dscuss/cmd/dscuss-web/view"
 	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
+	dstrings "vminko.org/dscuss/strings"
 )
 
 func handleBanUser(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s *Session) {
@@ -76,7 +78,19 @@ func handleBanUser(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle
 			BadRequestHandler(w, r, op.Reason+" is not a valid operation reason.")
 			return
 		}
-		oper, err := l.NewOperation(entity.OperationTypeBanUser, reason, op.Comment, &tid)
+		typ := entity.OperationTypeBanUser
+		var dateExpires *time.Time
+		if durStr := r.PostFormValue("duration"); durStr != "" {
+			d, err := dstrings.ParseDuration(durStr)
+			if err != nil || d <= 0 {
+				BadRequestHandler(w, r, durStr+" is not a valid ban duration.")
+				return
+			}
+			typ = entity.OperationTypeBanUserTemporarily
+			expires := time.Now().Add(d)
+			dateExpires = &expires
+		}
+		oper, err := l.NewOperation(typ, reason, op.Comment, "", dateExpires, &tid)
 		if err != nil {
 			panic("Error making new operation: " + err.Error() + ".")
 		}
@@ -0,0 +1,61 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"vminko.org/dscuss"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+)
+
+func handleBlob(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s *Session) {
+	if len(r.URL.Query()) != 2 {
+		BadRequestHandler(w, r, "Wrong number of query parameters")
+		return
+	}
+	idStr := r.URL.Query().Get("id")
+	var id entity.ID
+	err := id.ParseString(idStr)
+	if err != nil {
+		BadRequestHandler(w, r, idStr+" is not a valid blob ID.")
+		return
+	}
+	name := r.URL.Query().Get("name")
+	data, err := l.GetBlob(&id)
+	if err == errors.NoSuchBlob {
+		NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		panic("Got an error while fetching blob " + id.Shorten() + ": " + err.Error())
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "max-age=31536000, public")
+	ct := http.DetectContentType(data)
+	if isImageName(name) && strings.HasPrefix(ct, "image/") {
+		w.Header().Set("Content-Type", ct)
+	} else {
+		// Other files are never rendered by the browser.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+	w.Write(data)
+}
@@ -27,7 +27,7 @@ import (
 )
 
 func handleBoard(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s *Session) {
-	if len(r.URL.Query()) > 1 {
+	if len(r.URL.Query()) > 2 {
 		BadRequestHandler(w, r, "Wrong number of query parameters")
 		return
 	}
@@ -48,11 +48,20 @@ func handleBoard(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle,
 		}
 	}
 
+	sortStr := r.URL.Query().Get("sort")
+	if sortStr != "" && sortStr != "score" {
+		BadRequestHandler(w, r, "Unknown sort order '"+sortStr+"'.")
+		return
+	}
+
 	const boardSize = 10
 	var messages []*entity.Message
-	if topic != nil {
+	switch {
+	case sortStr == "score":
+		messages, err = l.ListBoardByScore(topic, 0, boardSize)
+	case topic != nil:
 		messages, err = l.ListTopic(topic, 0, boardSize)
-	} else {
+	default:
 		messages, err = l.ListBoard(0, boardSize)
 	}
 	if err != nil {
@@ -72,5 +81,6 @@ func handleBoard(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle,
 	view.Render(w, "board.html", map[string]interface{}{
 		"Common":  cd,
 		"Threads": threads,
+		"Sort":    sortStr,
 	})
 }
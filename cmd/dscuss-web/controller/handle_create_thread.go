@@ -18,11 +18,17 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package controller
 
 import (
+	"fmt"
+	"html/template"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 	"vminko.org/dscuss"
 	"vminko.org/dscuss/cmd/dscuss-web/view"
 	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/markup"
 	"vminko.org/dscuss/subs"
 )
 
@@ -46,14 +52,25 @@ func handleCreateThread(w http.ResponseWriter, r *http.Request, l *dscuss.LoginH
 	var msg string
 	var subj string
 	var text string
+	var refsStr string
+	var options string
+	duration := strconv.Itoa(int(entity.DefaultPollTimeout / (24 * time.Hour)))
+	var preview template.HTML
 	if r.Method == "POST" {
+		subj = r.PostFormValue("subject")
+		text = r.PostFormValue("text")
+		refsStr = r.PostFormValue("references")
+		options = r.PostFormValue("options")
+		duration = r.PostFormValue("duration")
+		if r.PostFormValue("action") == previewAction {
+			preview = template.HTML(markup.ToHTML(text))
+			goto render
+		}
 		t, err := subs.NewTopic(topic)
 		if err != nil {
 			msg = "Specified topic is unacceptable: " + err.Error()
 			goto render
 		}
-		subj = r.PostFormValue("subject")
-		text = r.PostFormValue("text")
 		if (subj == "") || (len(subj) > entity.MaxMessageSubjectLen) {
 			msg = "Specified subject is unacceptable: empty or too long."
 			goto render
@@ -62,16 +79,29 @@ func handleCreateThread(w http.ResponseWriter, r *http.Request, l *dscuss.LoginH
 			msg = "Specified message text is unacceptable: empty or too long."
 			goto render
 		}
-		thread, err := l.NewThread(subj, text, t)
-		if err != nil {
-			msg = "Error making new dscussion: " + err.Error() + "."
+		refs, rmsg := readReferences(refsStr)
+		if rmsg != "" {
+			msg = rmsg
+			goto render
+		}
+		poll, pmsg := readPoll(options, duration)
+		if pmsg != "" {
+			msg = pmsg
 			goto render
 		}
-		err = l.PostEntity((entity.Entity)(thread))
+		attachments, amsg := readAttachments(r, l)
+		if amsg != "" {
+			msg = amsg
+			goto render
+		}
+		thread, err := l.NewThread(subj, text, t, attachments, poll, refs)
 		if err != nil {
-			msg = "Error posting new dscussion: " + err.Error() + "."
+			msg = "Error making new dscussion: " + err.Error() + "."
 			goto render
 		}
+		// The stamp is computed in background, the progress is displayed
+		// on every page.
+		l.PostMessage(thread)
 		http.Redirect(w, r, "/board", http.StatusSeeOther)
 		return
 	}
@@ -80,9 +110,37 @@ render:
 	cd.PageTitle = "Start new dscussion"
 	cd.Topic = topic
 	view.Render(w, "thread_create.html", map[string]interface{}{
-		"Common":  cd,
-		"Subject": subj,
-		"Text":    text,
-		"Message": msg,
+		"Common":     cd,
+		"Subject":    subj,
+		"Text":       text,
+		"References": refsStr,
+		"Options":    options,
+		"Duration":   duration,
+		"Preview":    preview,
+		"Message":    msg,
 	})
 }
+
+// readPoll composes a poll from the submitted form. The poll is nil if no
+// options are specified.
+func readPoll(options, duration string) (*entity.Poll, string) {
+	var oo []string
+	for _, o := range strings.Split(options, "\n") {
+		if o = strings.TrimSpace(o); o != "" {
+			oo = append(oo, o)
+		}
+	}
+	if len(oo) == 0 {
+		return nil, ""
+	}
+	if len(oo) < entity.MinPollOptionsNum || len(oo) > entity.MaxPollOptionsNum {
+		return nil, fmt.Sprintf("A poll must have from %d to %d options.",
+			entity.MinPollOptionsNum, entity.MaxPollOptionsNum)
+	}
+	days, err := strconv.Atoi(duration)
+	d := time.Duration(days) * 24 * time.Hour
+	if err != nil || d <= 0 || d > entity.MaxPollDuration {
+		return nil, "Specified poll duration is unacceptable."
+	}
+	return &entity.Poll{Options: oo, DateCloses: time.Now().Add(d)}, ""
+}
@@ -0,0 +1,152 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"vminko.org/dscuss"
+	"vminko.org/dscuss/cmd/dscuss-web/view"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/subs"
+)
+
+func handleEditMessage(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s *Session) {
+	if len(r.URL.Query()) > 2 {
+		BadRequestHandler(w, r, "Wrong number of query parameters")
+		return
+	}
+	if !s.IsAuthenticated {
+		ForbiddenHandler(w, r)
+		return
+	}
+	tidStr := r.FormValue("id")
+	if r.Method == "POST" {
+		// FormValue() returns URL-decoded value for GET methods
+		tidStr, err := url.QueryUnescape(tidStr)
+		if err != nil {
+			BadRequestHandler(w, r, tidStr+" is not a valid URL-encoded string.")
+			return
+		}
+	}
+	var tid entity.ID
+	err := tid.ParseString(tidStr)
+	if err != nil {
+		BadRequestHandler(w, r, "'"+tidStr+"' is not a valid entity ID.")
+		return
+	}
+
+	var msg string
+	var tg RootMessage
+	var op Operation
+	var ed EditedMessage
+	var typ entity.OperationType
+	m, err := l.GetMessage(&tid)
+	if err == errors.NoSuchEntity {
+		NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		panic("Got an error while fetching msg " + tid.Shorten() +
+			" from DB: " + err.Error())
+	}
+	tg.Assign(m, l)
+	root, err := l.GetRootMessage(m)
+	if err != nil {
+		panic("Got an error while fetching root for msg " + tid.Shorten() +
+			" from DB:" + err.Error())
+	}
+
+	ed.Field = r.FormValue("field")
+	switch ed.Field {
+	case "topic":
+		if m.IsReply() {
+			BadRequestHandler(w, r, "Topic of a reply can not be changed.")
+			return
+		}
+		typ = entity.OperationTypeEditMessageTopic
+		ed.Replacement = tg.Topic
+	case "subject":
+		typ = entity.OperationTypeEditMessageSubject
+		ed.Replacement = tg.Subject
+	case "text":
+		typ = entity.OperationTypeEditMessageText
+		ed.Replacement = tg.Text
+	default:
+		BadRequestHandler(w, r, "'"+ed.Field+"' is not a valid message field.")
+		return
+	}
+
+	if r.Method == "POST" {
+		op.Reason = r.PostFormValue("reason")
+		op.Comment = r.PostFormValue("comment")
+		ed.Replacement = r.PostFormValue("replacement")
+		if len(op.Comment) > entity.MaxOperationCommentLen {
+			msg = "Specified comment is too long."
+			goto render
+		}
+		switch typ {
+		case entity.OperationTypeEditMessageTopic:
+			if _, err := subs.NewTopic(ed.Replacement); err != nil {
+				msg = "Unacceptable topic: " + err.Error() + "."
+				goto render
+			}
+		case entity.OperationTypeEditMessageSubject:
+			if ed.Replacement == "" || len(ed.Replacement) > entity.MaxMessageSubjectLen {
+				msg = "Subject is empty or too long."
+				goto render
+			}
+		case entity.OperationTypeEditMessageText:
+			if ed.Replacement == "" || len(ed.Replacement) > entity.MaxMessageTextLen {
+				msg = "Text is empty or too long."
+				goto render
+			}
+		}
+		var reason entity.OperationReason
+		err = reason.ParseString(op.Reason)
+		if err != nil {
+			BadRequestHandler(w, r, op.Reason+" is not a valid operation reason.")
+			return
+		}
+		oper, err := l.NewOperation(typ, reason, op.Comment, ed.Replacement, nil, &tid)
+		if err != nil {
+			panic("Error making new operation: " + err.Error() + ".")
+		}
+		err = l.PostEntity((entity.Entity)(oper))
+		if err != nil {
+			panic("Error posting new operation: " + err.Error() + ".")
+		}
+		http.Redirect(
+			w, r,
+			"/thread?id="+url.QueryEscape(root.ID().String()),
+			http.StatusSeeOther,
+		)
+		return
+	}
+render:
+	cd := readCommonData(r, s, l)
+	cd.PageTitle = "Editing " + ed.Field + " of message #" + tg.ShortID
+	cd.Topic = root.Topic.String()
+	view.Render(w, "oper_edit.html", map[string]interface{}{
+		"Common":    cd,
+		"Target":    tg,
+		"Operation": op,
+		"Edited":    ed,
+		"Message":   msg,
+	})
+}
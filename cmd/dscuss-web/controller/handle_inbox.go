@@ -0,0 +1,159 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+	"vminko.org/dscuss"
+	"vminko.org/dscuss/cmd/dscuss-web/view"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+	"vminko.org/dscuss/markup"
+)
+
+const (
+	inboxSize int = 50
+)
+
+// PrivateMessage is a decrypted private message sent to the owner.
+type PrivateMessage struct {
+	ID            string
+	AuthorName    string
+	AuthorID      string
+	AuthorShortID string
+	DateWritten   string
+	FormattedText template.HTML
+	IsDecrypted   bool
+}
+
+func (m *PrivateMessage) Assign(pm *entity.PrivateMessage, l *dscuss.LoginHandle) {
+	m.ID = pm.ID().String()
+	m.AuthorID = pm.AuthorID.String()
+	m.AuthorShortID = pm.AuthorID.Shorten()
+	m.AuthorName = userName(&pm.AuthorID, l)
+	m.DateWritten = pm.DateWritten.Format(time.RFC3339)
+	text, err := l.ReadPrivateMessage(pm)
+	if err != nil {
+		log.Debugf("Failed to decrypt private message %s: %v", pm.ShortID(), err)
+		return
+	}
+	m.IsDecrypted = true
+	m.FormattedText = template.HTML(markup.ToHTML(text))
+}
+
+func handleInbox(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s *Session) {
+	if len(r.URL.Query()) != 0 {
+		BadRequestHandler(w, r, "Wrong number of query parameters")
+		return
+	}
+	if !s.IsAuthenticated {
+		ForbiddenHandler(w, r)
+		return
+	}
+	mm, err := l.ListInbox(0, inboxSize)
+	if err != nil {
+		panic("Can't list inbox: " + err.Error() + ".")
+	}
+	var messages []PrivateMessage
+	for _, pm := range mm {
+		messages = append(messages, PrivateMessage{})
+		messages[len(messages)-1].Assign(pm, l)
+	}
+	cd := readCommonData(r, s, l)
+	cd.PageTitle = "Private messages"
+	view.Render(w, "inbox.html", map[string]interface{}{
+		"Common":   cd,
+		"Messages": messages,
+	})
+}
+
+func handleSendPrivateMessage(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s *Session) {
+	if len(r.URL.Query()) > 1 {
+		BadRequestHandler(w, r, "Wrong number of query parameters")
+		return
+	}
+	if !s.IsAuthenticated {
+		ForbiddenHandler(w, r)
+		return
+	}
+	uidStr := r.FormValue("id")
+	if r.Method == "POST" {
+		// FormValue() returns URL-decoded value for GET methods
+		uidStr, err := url.QueryUnescape(uidStr)
+		if err != nil {
+			BadRequestHandler(w, r, uidStr+" is not a valid URL-encoded string.")
+			return
+		}
+	}
+	var uid entity.ID
+	err := uid.ParseString(uidStr)
+	if err != nil {
+		BadRequestHandler(w, r, "'"+uidStr+"' is not a valid entity ID.")
+		return
+	}
+	eu, err := l.GetUser(&uid)
+	if err == errors.NoSuchEntity {
+		NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		panic("Got an error while fetching user " + uid.Shorten() +
+			" from DB: " + err.Error())
+	}
+	var u User
+	u.Assign(eu)
+
+	var msg string
+	var text string
+	var preview template.HTML
+	if r.Method == "POST" {
+		text = r.PostFormValue("text")
+		if r.PostFormValue("action") == previewAction {
+			preview = template.HTML(markup.ToHTML(text))
+			goto render
+		}
+		if (text == "") || (len(text) > entity.MaxPrivateMessageTextLen) {
+			msg = "Specified message text is unacceptable: empty or too long."
+			goto render
+		}
+		pm, err := l.NewPrivateMessage(text, &uid)
+		if err != nil {
+			msg = "Error making new private message: " + err.Error() + "."
+			goto render
+		}
+		err = l.PostEntity((entity.Entity)(pm))
+		if err != nil {
+			panic("Error posting new private message: " + err.Error() + ".")
+		}
+		http.Redirect(w, r, "/user?id="+url.QueryEscape(uidStr), http.StatusSeeOther)
+		return
+	}
+render:
+	cd := readCommonData(r, s, l)
+	cd.PageTitle = "Private message to " + u.Nickname + "-" + u.ShortID
+	view.Render(w, "private_message.html", map[string]interface{}{
+		"Common":    cd,
+		"Recipient": u,
+		"Text":      text,
+		"Preview":   preview,
+		"Message":   msg,
+	})
+}
@@ -44,6 +44,8 @@ func handleListOperations(w http.ResponseWriter, r *http.Request, l *dscuss.Logi
 		operEntities, err = l.ListOperationsOnUser(&id)
 	case "msg":
 		operEntities, err = l.ListOperationsOnMessage(&id)
+	case "oper":
+		operEntities, err = l.ListOperationsOnOperation(&id)
 	default:
 		BadRequestHandler(w, r, "'"+entType+"' is not a valid entity type.")
 		return
@@ -67,6 +69,8 @@ func handleListOperations(w http.ResponseWriter, r *http.Request, l *dscuss.Logi
 		t = "user"
 	case "msg":
 		t = "message"
+	case "oper":
+		t = "operation"
 	}
 	cd.PageTitle = "Operations on " + t + " #" + id.Shorten()
 	view.Render(w, "oper_list.html", map[string]interface{}{
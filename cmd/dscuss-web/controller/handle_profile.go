@@ -41,21 +41,39 @@ func handleProfile(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle
 	for _, t := range ss {
 		subs = append(subs, t.String())
 	}
-	var moders []User
+	var moders []Moderator
 	mm := l.ListModerators()
 	for _, mdr := range mm {
-		u, err := l.GetUser(mdr)
+		u, err := l.GetUser(&mdr.ID)
 		if err != nil {
 			panic("Failed to fetch user: " + err.Error())
 		}
-		moders = append(moders, User{})
+		moders = append(moders, Moderator{})
 		m := &moders[len(moders)-1]
 		m.Assign(u)
+		m.Scope = mdr.Scope.String()
+	}
+	var quorums []Quorum
+	for _, t := range entity.QuorumOperationTypes {
+		q := l.GetQuorum(t)
+		quorums = append(quorums, Quorum{t.String(), q.String()})
 	}
 	var msg string
 	if r.Method == "POST" {
-		http.Redirect(w, r, "/board", http.StatusSeeOther)
-		goto render
+		info := r.PostFormValue("info")
+		if len(info) > entity.MaxUserInfoLen {
+			msg = "Specified info is too long."
+			goto render
+		}
+		uu, err := l.NewUserUpdate(info)
+		if err != nil {
+			panic("Error making new user update: " + err.Error() + ".")
+		}
+		err = l.PostEntity((entity.Entity)(uu))
+		if err != nil {
+			panic("Error posting new user update: " + err.Error() + ".")
+		}
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
 		return
 	}
 render:
@@ -65,6 +83,7 @@ render:
 		"Common":        cd,
 		"Moderators":    moders,
 		"Subscriptions": subs,
+		"Quorums":       quorums,
 		"Message":       msg,
 	})
 }
@@ -90,7 +109,13 @@ func handleAddModerator(w http.ResponseWriter, r *http.Request, l *dscuss.LoginH
 		BadRequestHandler(w, r, "'"+idStr+"' is not a valid entity ID.")
 		return
 	}
-	err = l.AddModerator(&id)
+	scopeStr := r.FormValue("scope")
+	scope, err := subs.NewTopic(scopeStr)
+	if err != nil {
+		BadRequestHandler(w, r, "'"+scopeStr+"' is not a valid topic string.")
+		return
+	}
+	err = l.AddModerator(&id, scope)
 	if err == errors.AlreadyModerator {
 		BadRequestHandler(w, r, "Can't add new moderator: "+err.Error()+".")
 	} else if err != nil {
@@ -122,6 +147,34 @@ func handleDelModerator(w http.ResponseWriter, r *http.Request, l *dscuss.LoginH
 	http.Redirect(w, r, "/profile", http.StatusSeeOther)
 }
 
+func handleSetQuorums(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s *Session) {
+	if len(r.URL.Query()) != 0 {
+		BadRequestHandler(w, r, "Wrong number of query parameters")
+		return
+	}
+	if !s.IsAuthenticated {
+		ForbiddenHandler(w, r)
+		return
+	}
+	for _, t := range entity.QuorumOperationTypes {
+		qStr := r.PostFormValue(t.String())
+		if qStr == "" {
+			continue
+		}
+		var q entity.Quorum
+		err := q.ParseString(qStr)
+		if err != nil {
+			BadRequestHandler(w, r, "'"+qStr+"' is not a valid quorum.")
+			return
+		}
+		err = l.SetQuorum(t, &q)
+		if err != nil {
+			panic("Error setting quorum: " + err.Error() + ".")
+		}
+	}
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
+
 func handleSubscribe(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s *Session) {
 	if len(r.URL.Query()) != 0 {
 		BadRequestHandler(w, r, "Wrong number of query parameters")
@@ -81,7 +81,7 @@ func handleRemoveMessage(w http.ResponseWriter, r *http.Request, l *dscuss.Login
 			BadRequestHandler(w, r, op.Reason+" is not a valid operation reason.")
 			return
 		}
-		oper, err := l.NewOperation(entity.OperationTypeRemoveMessage, reason, op.Comment, &tid)
+		oper, err := l.NewOperation(entity.OperationTypeRemoveMessage, reason, op.Comment, "", nil, &tid)
 		if err != nil {
 			panic("Error making new operation: " + err.Error() + ".")
 		}
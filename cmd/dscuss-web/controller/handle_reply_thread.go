@@ -18,16 +18,18 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package controller
 
 import (
+	"html/template"
 	"net/http"
 	"net/url"
 	"vminko.org/dscuss"
 	"vminko.org/dscuss/cmd/dscuss-web/view"
 	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/markup"
 )
 
 func handleReplyThread(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s *Session) {
-	if len(r.URL.Query()) > 1 {
+	if len(r.URL.Query()) > 2 {
 		BadRequestHandler(w, r, "Wrong number of query parameters")
 		return
 	}
@@ -56,6 +58,7 @@ func handleReplyThread(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHa
 	var rm RootMessage
 	var pm Message
 	var rpl ComposedReply
+	var preview template.HTML
 	m, err := l.GetMessage(&pid)
 	if err == errors.NoSuchEntity {
 		NotFoundHandler(w, r)
@@ -73,9 +76,17 @@ func handleReplyThread(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHa
 	}
 	rm.Assign(root, l)
 
+	if r.Method == "GET" && r.FormValue("quote") != "" {
+		rpl.References = entity.ReferenceQuoteStr + ":" + pid.String()
+	}
 	if r.Method == "POST" {
 		rpl.Subject = r.PostFormValue("subject")
 		rpl.Text = r.PostFormValue("text")
+		rpl.References = r.PostFormValue("references")
+		if r.PostFormValue("action") == previewAction {
+			preview = template.HTML(markup.ToHTML(rpl.Text))
+			goto render
+		}
 		if (rpl.Subject == "") || (len(rpl.Subject) > entity.MaxMessageSubjectLen) {
 			msg = "Specified subject is unacceptable: empty or too long."
 			goto render
@@ -84,16 +95,24 @@ func handleReplyThread(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHa
 			msg = "Specified message text is unacceptable: empty or too long."
 			goto render
 		}
-		rplMsg, err := l.NewReply(rpl.Subject, rpl.Text, &pid)
-		if err != nil {
-			msg = "Error making new reply: " + err.Error() + "."
+		refs, rmsg := readReferences(rpl.References)
+		if rmsg != "" {
+			msg = rmsg
+			goto render
+		}
+		attachments, amsg := readAttachments(r, l)
+		if amsg != "" {
+			msg = amsg
 			goto render
 		}
-		err = l.PostEntity((entity.Entity)(rplMsg))
+		rplMsg, err := l.NewReply(rpl.Subject, rpl.Text, &pid, attachments, refs)
 		if err != nil {
-			msg = "Error posting new reply: " + err.Error() + "."
+			msg = "Error making new reply: " + err.Error() + "."
 			goto render
 		}
+		// The stamp is computed in background, the progress is displayed
+		// on every page.
+		l.PostMessage(rplMsg)
 		http.Redirect(w, r, "/thread?id="+url.QueryEscape(rm.ID), http.StatusSeeOther)
 		return
 	}
@@ -106,6 +125,7 @@ render:
 		"Thread":            rm,
 		"Parent":            pm,
 		"Reply":             rpl,
+		"Preview":           preview,
 		"ShowParentSubject": showSubj,
 		"Message":           msg,
 	})
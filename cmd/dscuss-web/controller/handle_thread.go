@@ -79,10 +79,18 @@ func handleThread(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle,
 		"ID":            idStr,
 		"Subject":       t.Subject,
 		"Text":          t.Text,
+		"FormattedText": t.FormattedText,
 		"DateWritten":   t.DateWritten,
 		"AuthorName":    t.AuthorName,
 		"AuthorID":      t.AuthorID,
 		"AuthorShortID": t.AuthorShortID,
+		"Attachments":   t.Attachments,
+		"Reactions":     t.Reactions,
+		"RemovalVotes":  t.RemovalVotes,
+		"RemovalQuorum": t.RemovalQuorum,
+		"Poll":          t.Poll,
+		"References":    t.References,
+		"Backlinks":     t.Backlinks,
 		"Replies":       t.Replies,
 	})
 }
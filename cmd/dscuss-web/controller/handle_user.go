@@ -46,10 +46,16 @@ func handleUser(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s
 	}
 	var u User
 	u.Assign(ent)
+	trust, err := l.GetModeratorTrust(&uid)
+	if err != nil {
+		panic("Got an error while computing trust to user " + uid.Shorten() +
+			": " + err.Error())
+	}
 	cd := readCommonData(r, s, l)
 	cd.PageTitle = "Profile of " + u.Nickname + "-" + u.ShortID
 	view.Render(w, "user.html", map[string]interface{}{
 		"Common": cd,
 		"User":   u,
+		"Trust":  trust,
 	})
 }
@@ -0,0 +1,84 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"vminko.org/dscuss"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+)
+
+func handleVote(w http.ResponseWriter, r *http.Request, l *dscuss.LoginHandle, s *Session) {
+	if len(r.URL.Query()) != 0 {
+		BadRequestHandler(w, r, "Wrong number of query parameters")
+		return
+	}
+	if !s.IsAuthenticated {
+		ForbiddenHandler(w, r)
+		return
+	}
+	pidStr, err := url.QueryUnescape(r.PostFormValue("id"))
+	if err != nil {
+		BadRequestHandler(w, r, pidStr+" is not a valid URL-encoded string.")
+		return
+	}
+	var pid entity.ID
+	err = pid.ParseString(pidStr)
+	if err != nil {
+		BadRequestHandler(w, r, "'"+pidStr+"' is not a valid entity ID.")
+		return
+	}
+	choiceStr := r.PostFormValue("choice")
+	choice, err := strconv.Atoi(choiceStr)
+	if err != nil {
+		BadRequestHandler(w, r, "'"+choiceStr+"' is not a valid option number.")
+		return
+	}
+	m, err := l.GetMessage(&pid)
+	if err == errors.NoSuchEntity {
+		NotFoundHandler(w, r)
+		return
+	} else if err != nil {
+		panic("Got an error while fetching msg " + pid.Shorten() +
+			" from DB: " + err.Error())
+	}
+	root, err := l.GetRootMessage(m)
+	if err != nil {
+		panic("Got an error while fetching root for msg " + pid.Shorten() +
+			" from DB:" + err.Error())
+	}
+	v, err := l.NewVote(choice, &pid)
+	if err == errors.WrongArguments || err == errors.NoSuchPoll || err == errors.PollClosed {
+		BadRequestHandler(w, r, "Can't vote: "+err.Error()+".")
+		return
+	} else if err != nil {
+		panic("Error making new vote: " + err.Error() + ".")
+	}
+	err = l.PostEntity((entity.Entity)(v))
+	if err != nil {
+		panic("Error posting new vote: " + err.Error() + ".")
+	}
+	http.Redirect(
+		w, r,
+		"/thread?id="+url.QueryEscape(root.ID().String()),
+		http.StatusSeeOther,
+	)
+}
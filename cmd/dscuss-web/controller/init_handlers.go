@@ -24,8 +24,9 @@ import (
 
 var LoginHandler, ProfileHandler, BoardHandler, ThreadHandler, CreateThread, ReplyThreadHandler,
 	AddModeratorHandler, DelModeratorHandler, SubscribeHandler, UnsubscribeHandler, UserHandler,
-	RemoveMessageHandler, BanUserHandler, ListOperationsHandler, ListPeersHandler,
-	PeerHistoryHandler func(w http.ResponseWriter, r *http.Request)
+	RemoveMessageHandler, EditMessageHandler, BanUserHandler, RevokeOperationHandler,
+	ListOperationsHandler, ListPeersHandler, PeerHistoryHandler, BlobHandler, ReactHandler, SetQuorumsHandler,
+	InboxHandler, SendPrivateMessageHandler, VoteHandler func(w http.ResponseWriter, r *http.Request)
 
 func InitHandlers(l *dscuss.LoginHandle) {
 	LoginHandler = makeHandler(handleLogin, l)
@@ -40,8 +41,16 @@ func InitHandlers(l *dscuss.LoginHandle) {
 	UnsubscribeHandler = makeHandler(handleUnsubscribe, l)
 	UserHandler = makeHandler(handleUser, l)
 	RemoveMessageHandler = makeHandler(handleRemoveMessage, l)
+	EditMessageHandler = makeHandler(handleEditMessage, l)
 	BanUserHandler = makeHandler(handleBanUser, l)
+	RevokeOperationHandler = makeHandler(handleRevokeOperation, l)
 	ListOperationsHandler = makeHandler(handleListOperations, l)
 	ListPeersHandler = makeHandler(handleListPeers, l)
 	PeerHistoryHandler = makeHandler(handlePeerHistory, l)
+	BlobHandler = makeHandler(handleBlob, l)
+	ReactHandler = makeHandler(handleReact, l)
+	SetQuorumsHandler = makeHandler(handleSetQuorums, l)
+	InboxHandler = makeHandler(handleInbox, l)
+	SendPrivateMessageHandler = makeHandler(handleSendPrivateMessage, l)
+	VoteHandler = makeHandler(handleVote, l)
 }
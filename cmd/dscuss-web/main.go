@@ -21,16 +21,20 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/abiosoft/readline"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 	"vminko.org/dscuss"
 	"vminko.org/dscuss/cmd/dscuss-web/controller"
+	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
 )
 
@@ -46,6 +50,7 @@ var (
 	argUser     = flag.String("user", "", "Name of the user to login as")
 	argPassword = flag.String("password", "", "Password to protect access to the Web UI")
 	argPort     = flag.Int("port", webDefaultPort, "Web UI port to listen on")
+	argPassFile = flag.String("passphrase-file", "", "File with the passphrase of the user's private key")
 	// Looks like there is no way to pass LoginHandle via ishell.Context.
 	loginHandle *dscuss.LoginHandle
 )
@@ -85,6 +90,25 @@ func setupSignalHandlers() {
 	setupTermSignalHandler()
 }
 
+// readPassphrase reads the passphrase of the private key either from the file
+// specified via command line or from the terminal.
+func readPassphrase() (string, error) {
+	if *argPassFile != "" {
+		b, err := ioutil.ReadFile(*argPassFile)
+		if err != nil {
+			fmt.Printf("Can't read passphrase from %s: %v\n", *argPassFile, err)
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	b, err := readline.Password("Passphrase: ")
+	if err != nil {
+		fmt.Printf("Can't read passphrase: %v\n", err)
+		return "", err
+	}
+	return string(b), nil
+}
+
 func main() {
 	setupSignalHandlers()
 	rand.Seed(time.Now().UnixNano())
@@ -121,7 +145,14 @@ func main() {
 	}
 	log.Debugf("Using Web UI version %s.", webVersion)
 
-	loginHandle, err = dscuss.Login(*argUser)
+	loginHandle, err = dscuss.Login(*argUser, "")
+	if err == errors.PassphraseRequired {
+		var passphrase string
+		passphrase, err = readPassphrase()
+		if err == nil {
+			loginHandle, err = dscuss.Login(*argUser, passphrase)
+		}
+	}
 	if err != nil {
 		log.Errorf("Failed to log in as %s: %v\n", *argUser, err)
 		return
@@ -142,12 +173,20 @@ func main() {
 	http.HandleFunc("/moder/del", controller.DelModeratorHandler)
 	http.HandleFunc("/sub/add", controller.SubscribeHandler)
 	http.HandleFunc("/sub/del", controller.UnsubscribeHandler)
+	http.HandleFunc("/quorum/set", controller.SetQuorumsHandler)
 	http.HandleFunc("/user", controller.UserHandler)
 	http.HandleFunc("/oper/del", controller.RemoveMessageHandler)
+	http.HandleFunc("/oper/edit", controller.EditMessageHandler)
 	http.HandleFunc("/oper/ban", controller.BanUserHandler)
+	http.HandleFunc("/oper/revoke", controller.RevokeOperationHandler)
 	http.HandleFunc("/oper/list", controller.ListOperationsHandler)
 	http.HandleFunc("/peer/list", controller.ListPeersHandler)
 	http.HandleFunc("/peer/history", controller.PeerHistoryHandler)
+	http.HandleFunc("/blob", controller.BlobHandler)
+	http.HandleFunc("/react", controller.ReactHandler)
+	http.HandleFunc("/vote", controller.VoteHandler)
+	http.HandleFunc("/inbox", controller.InboxHandler)
+	http.HandleFunc("/pm", controller.SendPrivateMessageHandler)
 
 	log.Debugf("Starting HTTP server on port %d\n", *argPort)
 	http.ListenAndServe(":"+strconv.Itoa(*argPort), nil)
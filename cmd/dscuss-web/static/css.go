@@ -168,9 +168,45 @@ textarea {
 	white-space: pre-wrap;
 	font-family: monospace;
 }
+.message-text p, .message-text pre, .message-text blockquote {
+	margin: 0 0 10px 0;
+}
+.message-text blockquote {
+	padding-left: 10px;
+	border-left: 3px solid #ccc;
+}
+.message-text code {
+	background-color: #f0f0f0;
+}
+.reactions span {
+	margin-right: 10px;
+}
+.references {
+	margin-top: 10px;
+}
+.references blockquote {
+	margin: 5px 0;
+	padding-left: 10px;
+	border-left: 3px solid #ccc;
+	white-space: pre-wrap;
+	font-family: monospace;
+}
+.preview {
+	padding: 5px;
+	border: 1px dashed #ccc;
+}
 .subs {
 	white-space: pre-wrap;
 }
+.attachments {
+	margin-top: 10px;
+	font-size: 75%;
+}
+.attachments img {
+	display: block;
+	max-width: 100%;
+	max-height: 480px;
+}
 .message-row, .thread-row, .operation-row, .peer-row, .history-row, .profile-block {
 	margin-bottom: 30px;
 }
@@ -0,0 +1,42 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package view
+
+// attachmentsHTML displays attachments of a message. Images are displayed
+// inline, other files are offered for downloading.
+const attachmentsHTML = `
+{{ if . }}
+	<div class="attachments">
+	{{ range . }}
+		<div>
+		{{ if .IsAvailable }}
+			{{ if .IsImage }}
+				<a href="/blob?id={{ .Hash }}&name={{ .Name }}"><img src="/blob?id={{ .Hash }}&name={{ .Name }}" alt="{{ .Name }}"></a>
+			{{ else }}
+				<a href="/blob?id={{ .Hash }}&name={{ .Name }}">{{ .Name }}</a> ({{ .Size }} bytes)
+			{{ end }}
+		{{ else }}
+			<span class="dimmed">{{ .Name }} ({{ .Size }} bytes, not downloaded yet)</span>
+		{{ end }}
+		</div>
+	{{ end }}
+	</div>
+{{ end }}
+`
+
+/* vim: set filetype=html tabstop=2: */
@@ -47,6 +47,7 @@ const baseHTML = `
 			<div id="navright">
 				{{ if .Common.Owner.Nickname }}
 					<a class="headline" href="/profile">{{ .Common.Owner.Nickname }}-{{ .Common.Owner.ShortID }}</a>
+					<a class="headline" href="/inbox">Inbox</a>
 					<a class="headline" href="/peer/list">Peers</a>
 					<a class="headline" href="/logout">Logout</a>
 				{{ else }}
@@ -57,6 +58,13 @@ const baseHTML = `
 			</div>
 		</div>
 		<hr>
+		{{ if .Common.PendingMessages }}
+			<div class="row dimmed">
+				{{ range .Common.PendingMessages }}
+					<div>Computing the stamp of '{{ .Subject }}': {{ .Progress }}</div>
+				{{ end }}
+			</div>
+		{{ end }}
 		<div id="content">
 			{{ block "content" . }}{{ end }}
 		</div>
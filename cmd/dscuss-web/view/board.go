@@ -34,6 +34,15 @@ const boardHTML = `
 	{{ end }}
 </h1>
 
+<div class="dimmed">
+	Sort by:
+	{{ if .Sort }}
+		<a href="/board{{ if $.Common.Topic }}?topic={{ $.Common.Topic }}{{ end }}">date</a> | score
+	{{ else }}
+		date | <a href="/board?{{ if $.Common.Topic }}topic={{ $.Common.Topic }}&{{ end }}sort=score">score</a>
+	{{ end }}
+</div>
+
 {{ if .Threads }}
 	{{ range .Threads }}
 		<hr class="sep">
@@ -44,9 +53,11 @@ const boardHTML = `
 					<span class="topic">in <a class="topic" href="/board?topic={{ .Topic }}">{{ .Topic }}</a></span>
 				{{ end }}
 			</div>
-			<div class="message-text">{{ .Text }}</div>
+			<div class="message-text">{{ .FormattedText }}</div>
+			{{ template "reactions" .Reactions }}
 			<div class="dimmed underline">
 				by {{ .AuthorName }}-{{ .AuthorShortID }} {{ .DateWritten }}
+				{{ if .Reactions }}| score {{ .Score }}{{ end }}
 			</div>
 		</div>
 	{{ end }}
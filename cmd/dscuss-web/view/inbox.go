@@ -0,0 +1,48 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package view
+
+const inboxHTML = `
+{{ define "content" }}
+
+<h1 id="title">{{ .Common.PageTitle }}</h1>
+{{ if .Messages }}
+	{{ range .Messages }}
+		<div class="message-row">
+			{{ if .IsDecrypted }}
+				<div class="message-text">{{ .FormattedText }}</div>
+			{{ else }}
+				<div class="dimmed">The message is encrypted to one of your previous keys, which is not available.</div>
+			{{ end }}
+			<div class="dimmed underline">
+				from <a href="/user?id={{ .AuthorID }}">{{ .AuthorName }}-{{ .AuthorShortID }}</a>
+				{{ .DateWritten }}
+				| <a href="/pm?id={{ .AuthorID }}">reply</a>
+			</div>
+		</div>
+		<hr class="sep">
+	{{ end }}
+{{ else }}
+	<div class="row">
+		<div class="dimmed">No private messages to show.</div>
+	</div>
+{{ end }}
+
+{{ end }}`
+
+/* vim: set filetype=html tabstop=2: */
@@ -40,6 +40,18 @@ const operBanHTML = `
 				</select>
 			</td>
 		</tr>
+		<tr>
+			<th>Duration:</th>
+			<td>
+				<select name="duration" >
+					<option value="">Permanent</option>
+					<option value="1d">1 day</option>
+					<option value="7d">1 week</option>
+					<option value="30d">30 days</option>
+					<option value="365d">1 year</option>
+				</select>
+			</td>
+		</tr>
 		<tr>
 			<th>Comment:</th>
 			<td><textarea name="comment" rows="4" placeholder="Why do you want to do that?">{{ .Reply.Text }}</textarea></td>
@@ -28,7 +28,7 @@ const operDelHTML = `
 		<tr>
 			<td colspan="2">
 				<b>{{ .Target.Subject }}</b>
-				<div class="message-text">{{ .Target.Text }}</div>
+				<div class="message-text">{{ .Target.FormattedText }}</div>
 				<div class="dimmed underline">
 					by <a href="/user?id={{ .Target.AuthorID }}">{{ .Target.AuthorName }}-{{ .Target.AuthorShortID }}</a>
 					{{ .Target.DateWritten }}
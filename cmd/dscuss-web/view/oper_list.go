@@ -28,13 +28,23 @@ const operListHTML = `
 		<div>
 			<b>Operation {{ .Type }}</b><br>
 			Reason: {{ .Reason }}<br>
+			{{ if .DateExpires }}
+				Expires: {{ .DateExpires }}<br>
+			{{ end }}
 		</div>
+		{{ if .Replacement }}
+			<div class="message-text">{{ .Replacement }}</div>
+		{{ end }}
 		{{ if .Comment }}
 			<div class="comment">{{ .Comment }}</div>
 		{{ end }}
 		<div class="dimmed underline">
 			by <a href="/user?id={{ .AuthorID }}">{{ .AuthorName }}-{{ .AuthorShortID }}</a>
 			{{ .DatePerformed }}
+			{{ if $.Common.IsWritingPermitted }}
+				| <a href="/oper/revoke?id={{ .ID }}">revoke</a>
+				| <a href="/oper/list?type=oper&id={{ .ID }}">operations</a>
+			{{ end }}
 		</div>
 	</div>
 {{ end }}
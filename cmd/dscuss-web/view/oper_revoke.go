@@ -0,0 +1,71 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package view
+
+const operRevokeHTML = `
+{{ define "content" }}
+
+<h1 id="title">{{ .Common.PageTitle }}</h1>
+<form action="/oper/revoke" method="POST" enctype="multipart/form-data">
+	<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+	<input type="hidden" name="id" value="{{ .Target.ID }}">
+	<table class="form">
+		<tr><th>Full ID</th><td>{{ .Target.ID }}</td></tr>
+		<tr><th>Type</th><td>{{ .Target.Type }}</td></tr>
+		<tr><th>Reason</th><td>{{ .Target.Reason }}</td></tr>
+		{{ if .Target.Comment }}
+			<tr><th>Comment</th><td>{{ .Target.Comment }}</td></tr>
+		{{ end }}
+		<tr>
+			<th>Performed by</th>
+			<td>
+				<a href="/user?id={{ .Target.AuthorID }}">{{ .Target.AuthorName }}-{{ .Target.AuthorShortID }}</a>
+				{{ .Target.DatePerformed }}
+			</td>
+		</tr>
+		<tr>
+			<th>Reason:</th>
+			<td>
+				<select name="reason" >
+					<option value="Mistake">Mistake</option>
+					<option value="SPAM">SPAM</option>
+					<option value="Offtopic">Off-topic</option>
+					<option value="Abuse">Abuse</option>
+					<option value="Duplicate">Duplicate</option>
+				</select>
+			</td>
+		</tr>
+		<tr>
+			<th>Comment:</th>
+			<td><textarea name="comment" rows="4" placeholder="Why do you want to do that?">{{ .Operation.Comment }}</textarea></td>
+		</tr>
+		<tr>
+			<th></th>
+			<td>
+				{{ if .Message }}
+					<span class="alert">{{ .Message }}</span><br>
+				{{ end }}
+				<input type="submit" name="action" class="btn" value="Submit">
+			</td>
+		</tr>
+	</table>
+</form>
+
+{{ end }}`
+
+/* vim: set filetype=html tabstop=2: */
@@ -0,0 +1,50 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package view
+
+// pollHTML displays the options of the poll of a thread with the numbers of
+// votes. The options are voting buttons if the poll is open and writing is
+// permitted.
+const pollHTML = `
+{{ if .Poll }}
+	<form class="poll" action="/vote" method="POST">
+		<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+		<input type="hidden" name="id" value="{{ .Poll.ID }}">
+		<table class="form">
+		{{ range .Poll.Options }}
+			<tr>
+				<td>
+					{{ if and $.Common.IsWritingPermitted (not $.Poll.IsClosed) }}
+						<button type="submit" name="choice" class="btn" value="{{ .Index }}">{{ .Text }}</button>
+					{{ else }}
+						{{ .Text }}
+					{{ end }}
+				</td>
+				<td>{{ .Votes }}</td>
+			</tr>
+		{{ end }}
+		</table>
+		<div class="dimmed">
+			{{ .Poll.Total }} vote(s),
+			{{ if .Poll.IsClosed }}closed{{ else }}closes {{ .Poll.DateCloses }}{{ end }}
+		</div>
+	</form>
+{{ end }}
+`
+
+/* vim: set filetype=html tabstop=2: */
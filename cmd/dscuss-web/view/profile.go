@@ -22,12 +22,22 @@ const profileHTML = `
 
 <h1 id="title">{{ .Common.PageTitle }}</h1>
 <div class="profile-block">
-	<table class="form">
-		<tr><th>Full ID</th><td>{{ .Common.Owner.ID }}</td></tr>
-		<tr><th>Nickname</th><td>{{ .Common.Owner.Nickname }}</td></tr>
-		<tr><th>Additional info</th><td>{{ .Common.Owner.Info }}</td></tr>
-		<tr><th>Registration date</th><td>{{ .Common.Owner.RegDate }}</td></tr>
-	</table>
+	<form action="/profile" method="POST" enctype="multipart/form-data">
+		<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+		<table class="form">
+			<tr><th>Full ID</th><td>{{ .Common.Owner.ID }}</td></tr>
+			<tr><th>Nickname</th><td>{{ .Common.Owner.Nickname }}</td></tr>
+			<tr>
+				<th>Additional info</th>
+				<td><textarea name="info" rows="4">{{ .Common.Owner.Info }}</textarea></td>
+			</tr>
+			<tr><th>Registration date</th><td>{{ .Common.Owner.RegDate }}</td></tr>
+			<tr>
+				<th></th>
+				<td><input type="submit" name="action" class="btn" value="Update info"></td>
+			</tr>
+		</table>
+	</form>
 </div>
 <div class="profile-block">
 	<hr class="sep">
@@ -59,10 +69,11 @@ const profileHTML = `
 	<form action="/moder/add" method="POST" enctype="multipart/form-data">
 		<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
 		<table class="editable">
-			<tr><th>User</th><th>Action</th></tr>
+			<tr><th>User</th><th>Scope</th><th>Action</th></tr>
 			{{ range .Moderators }}
 				<tr>
 					<td><a href="/user?id={{ .ID }}">{{ .Nickname }}-{{ .ShortID }}</a></td>
+					<td>{{ if .Scope }}{{ .Scope }}{{ else }}all threads{{ end }}</td>
 					<td class="btn-cell"><a class="link-btn" href="/moder/del?id={{ .ID }}">Remove</a></td>
 				</tr>
 			{{ end }}
@@ -70,6 +81,9 @@ const profileHTML = `
 				<td>
 					<input type="text" name="id" placeholder="Enter new full ID...">
 				</td>
+				<td>
+					<input type="text" name="scope" placeholder="Topic (empty for all threads)...">
+				</td>
 				<td>
 					<input type="submit" name="action" class="btn" value="Add">
 				</td>
@@ -77,6 +91,28 @@ const profileHTML = `
 		</table>
 	</form>
 </div>
+<div class="profile-block">
+	<hr class="sep">
+	<span class="subtitle">Quorums</span>
+	<form action="/quorum/set" method="POST" enctype="multipart/form-data">
+		<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+		<table class="editable">
+			<tr><th>Operation</th><th>Moderators required (like 2 or 50%)</th></tr>
+			{{ range .Quorums }}
+				<tr>
+					<td>{{ .Type }}</td>
+					<td><input type="text" name="{{ .Type }}" value="{{ .Value }}"></td>
+				</tr>
+			{{ end }}
+			<tr>
+				<td></td>
+				<td>
+					<input type="submit" name="action" class="btn" value="Save">
+				</td>
+			</tr>
+		</table>
+	</form>
+</div>
 {{ if .Message }}
 	<span class="alert">{{ .Message }}</span><br>
 {{ end }}
@@ -0,0 +1,53 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package view
+
+const reactHTML = `
+{{ define "content" }}
+
+<h1 id="title">{{ .Common.PageTitle }}</h1>
+<form action="/react" method="POST" enctype="multipart/form-data">
+	<input type="hidden" name="csrf" value="{{ .Common.CSRF }}">
+	<input type="hidden" name="id" value="{{ .Target.ID }}">
+	<table class="form">
+		<tr>
+			<td colspan="2">
+				<b>{{ .Target.Subject }}</b>
+				<div class="message-text">{{ .Target.FormattedText }}</div>
+				{{ template "reactions" .Target.Reactions }}
+				<div class="dimmed underline">
+					by <a href="/user?id={{ .Target.AuthorID }}">{{ .Target.AuthorName }}-{{ .Target.AuthorShortID }}</a>
+					{{ .Target.DateWritten }}
+				</div>
+			</td>
+		</tr>
+		<tr>
+			<th>Reaction:</th>
+			<td>
+				{{ range .Kinds }}
+					<button type="submit" name="kind" class="btn" value="{{ .Name }}">{{ .Symbol }} {{ .Name }}</button>
+				{{ end }}
+				<button type="submit" name="kind" class="btn" value="none">Withdraw</button>
+			</td>
+		</tr>
+	</table>
+</form>
+
+{{ end }}`
+
+/* vim: set filetype=html tabstop=2: */
@@ -0,0 +1,31 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package view
+
+// reactionsHTML displays the numbers of reactions to a message.
+const reactionsHTML = `
+{{ if . }}
+	<div class="reactions">
+	{{ range . }}
+		<span title="{{ .Name }}">{{ .Symbol }} {{ .Count }}</span>
+	{{ end }}
+	</div>
+{{ end }}
+`
+
+/* vim: set filetype=html tabstop=2: */
@@ -0,0 +1,50 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package view
+
+// referencesHTML displays the references of a message to other messages
+// (with excerpts of the quoted ones) and the messages referring to it.
+const referencesHTML = `
+{{ if or .References .Backlinks }}
+	<div class="references">
+	{{ range .References }}
+		<div>
+			{{ .Relation }}
+			{{ if .IsAvailable }}
+				<a href="/thread?id={{ .ID }}">{{ .Subject }}</a>
+			{{ else }}
+				<span class="dimmed">{{ .ShortID }} (unavailable)</span>
+			{{ end }}
+		</div>
+		{{ if .Excerpt }}
+			<blockquote>{{ .Excerpt }}</blockquote>
+		{{ end }}
+	{{ end }}
+	{{ if .Backlinks }}
+		<div>
+			referenced by
+			{{ range $i, $b := .Backlinks -}}
+				{{ if $i }}, {{ end }}<a href="/thread?id={{ $b.ID }}">{{ $b.Subject }}</a>
+			{{- end }}
+		</div>
+	{{ end }}
+	</div>
+{{ end }}
+`
+
+/* vim: set filetype=html tabstop=2: */
@@ -36,6 +36,10 @@ var templates templateMap = make(map[string]*template.Template)
 
 func init() {
 	base := template.Must(template.New("base").Parse(baseHTML))
+	template.Must(base.New("attachments").Parse(attachmentsHTML))
+	template.Must(base.New("reactions").Parse(reactionsHTML))
+	template.Must(base.New("poll").Parse(pollHTML))
+	template.Must(base.New("references").Parse(referencesHTML))
 	templates.Add(base, "login", loginHTML)
 	templates.Add(base, "board", boardHTML)
 	templates.Add(base, "thread", threadHTML)
@@ -44,8 +48,13 @@ func init() {
 	templates.Add(base, "profile", profileHTML)
 	templates.Add(base, "oper_del", operDelHTML)
 	templates.Add(base, "oper_ban", operBanHTML)
+	templates.Add(base, "oper_edit", operEditHTML)
+	templates.Add(base, "oper_revoke", operRevokeHTML)
 	templates.Add(base, "oper_list", operListHTML)
+	templates.Add(base, "react", reactHTML)
 	templates.Add(base, "user", userHTML)
+	templates.Add(base, "inbox", inboxHTML)
+	templates.Add(base, "private_message", privateMessageHTML)
 	templates.Add(base, "peer_list", peerListHTML)
 	templates.Add(base, "peer_history", peerHistoryHTML)
 }
@@ -29,13 +29,23 @@ const threadHTML = `
 {{ if .IsFound }}
 	<h1 id="title"><a href="/thread?id={{ .ID }}">{{ .Subject }}</a></h1>
 	<div class="message-row">
-		<div class="message-text">{{ .Text }}</div>
+		<div class="message-text">{{ .FormattedText }}</div>
+		{{ template "attachments" .Attachments }}
+		{{ template "references" . }}
+		{{ template "poll" . }}
+		{{ template "reactions" .Reactions }}
 		<div class="dimmed underline">
 			by <a href="/user?id={{ .AuthorID }}">{{ .AuthorName }}-{{ .AuthorShortID }}</a> {{ .DateWritten }}
+			{{ if .RemovalVotes }}
+				| removal votes: {{ .RemovalVotes }} of {{ .RemovalQuorum }}
+			{{ end }}
 			{{ if .Common.IsWritingPermitted }}
 				| <a href="/thread/reply?id={{ .ID }}">reply</a>
+				| <a href="/thread/reply?id={{ .ID }}&quote=1">quote</a>
+				| <a href="/react?id={{ .ID }}">react</a>
 				| <a href="/oper/ban?id={{ .AuthorID }}">ban</a>
 				| <a href="/oper/del?id={{ .ID }}">delete</a>
+				| <a href="/oper/edit?field=text&id={{ .ID }}">edit</a>
 				| <a href="/oper/list?type=msg&id={{ .ID }}">operations</a>
 			{{ end }}
 		</div>
@@ -52,14 +62,23 @@ const threadHTML = `
 		<hr class="sep">
 		<div class="message-row" id="message-{{ .ID }}">
 			<b>{{ .Subject }}</b>
-			<div class="message-text">{{ .Text }}</div>
+			<div class="message-text">{{ .FormattedText }}</div>
+			{{ template "attachments" .Attachments }}
+			{{ template "references" . }}
+			{{ template "reactions" .Reactions }}
 			<div class="dimmed underline">
 				by <a href="/user?id={{ .AuthorID }}">{{ .AuthorName }}-{{ .AuthorShortID }}</a>
 				{{ .DateWritten }}
+				{{ if .RemovalVotes }}
+					| removal votes: {{ .RemovalVotes }} of {{ .RemovalQuorum }}
+				{{ end }}
 				{{ if $.Common.IsWritingPermitted }}
 					| <a href="/thread/reply?id={{ .ID }}">reply</a>
+					| <a href="/thread/reply?id={{ .ID }}&quote=1">quote</a>
+					| <a href="/react?id={{ .ID }}">react</a>
 					| <a href="/oper/ban?id={{ .AuthorID }}">ban</a>
 					| <a href="/oper/del?id={{ .ID }}">delete</a>
+					| <a href="/oper/edit?field=text&id={{ .ID }}">edit</a>
 					| <a href="/oper/list?type=msg&id={{ .ID }}">operations</a>
 				{{ end }}
 			</div>
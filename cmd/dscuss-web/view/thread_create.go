@@ -36,12 +36,35 @@ const threadCreateHTML = `
 			<th>Text:</th>
 			<td><textarea name="text" rows="12">{{ .Text }}</textarea></td>
 		</tr>
+		{{ if .Preview }}
+		<tr>
+			<th>Preview:</th>
+			<td><div class="message-text preview">{{ .Preview }}</div></td>
+		</tr>
+		{{ end }}
+		<tr>
+			<th>References:</th>
+			<td><textarea name="references" rows="2" placeholder="One per line: quote:&lt;id&gt;, see:&lt;id&gt; or dup:&lt;id&gt;">{{ .References }}</textarea></td>
+		</tr>
+		<tr>
+			<th>Poll options:</th>
+			<td><textarea name="options" rows="4" placeholder="One option per line, leave empty for no poll">{{ .Options }}</textarea></td>
+		</tr>
+		<tr>
+			<th>Poll duration:</th>
+			<td><input type="text" name="duration" value="{{ .Duration }}"> days</td>
+		</tr>
+		<tr>
+			<th>Attach:</th>
+			<td><input type="file" name="attachment" multiple></td>
+		</tr>
 		<tr>
 			<th></th>
 			<td>
 				{{ if .Message }}
 					<span class="alert">{{ .Message }}</span><br>
 				{{ end }}
+				<input type="submit" name="action" class="btn" value="Preview">
 				<input type="submit" name="action" class="btn" value="Start">
 			</td>
 		</tr>
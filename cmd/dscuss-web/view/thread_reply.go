@@ -30,7 +30,8 @@ const threadReplyHTML = `
 				{{ if .ShowParentSubject }}
 					<b>{{ .Parent.Subject }}</b>
 				{{ end }}
-				<div class="message-text">{{ .Parent.Text }}</div>
+				<div class="message-text">{{ .Parent.FormattedText }}</div>
+				{{ template "attachments" .Parent.Attachments }}
 				<div class="dimmed underline">
 					by <a href="/user?id={{ .Parent.AuthorID }}">{{ .Parent.AuthorName }}-{{ .Parent.AuthorShortID }}</a>
 					{{ .Parent.DateWritten }}
@@ -39,18 +40,33 @@ const threadReplyHTML = `
 		</tr>
 		<tr>
 			<th>Subject:</th>
-			<td><input type="text" name="subject" value="Re: {{.Parent.Subject}}"></td>
+			<td><input type="text" name="subject" value="{{ if .Reply.Subject }}{{ .Reply.Subject }}{{ else }}Re: {{ .Parent.Subject }}{{ end }}"></td>
 		</tr>
 		<tr>
 			<th>Text:</th>
 			<td><textarea name="text" rows="12">{{ .Reply.Text }}</textarea></td>
 		</tr>
+		{{ if .Preview }}
+		<tr>
+			<th>Preview:</th>
+			<td><div class="message-text preview">{{ .Preview }}</div></td>
+		</tr>
+		{{ end }}
+		<tr>
+			<th>References:</th>
+			<td><textarea name="references" rows="2" placeholder="One per line: quote:&lt;id&gt;, see:&lt;id&gt; or dup:&lt;id&gt;">{{ .Reply.References }}</textarea></td>
+		</tr>
+		<tr>
+			<th>Attach:</th>
+			<td><input type="file" name="attachment" multiple></td>
+		</tr>
 		<tr>
 			<th></th>
 			<td>
 				{{ if .Message }}
 					<span class="alert">{{ .Message }}</span><br>
 				{{ end }}
+				<input type="submit" name="action" class="btn" value="Preview">
 				<input type="submit" name="action" class="btn" value="Submit reply">
 			</td>
 		</tr>
@@ -26,10 +26,14 @@ const userHTML = `
 	<tr><th>Nickname</th><td>{{ .User.Nickname }}</td></tr>
 	<tr><th>Additional info</th><td>{{ .User.Info }}</td></tr>
 	<tr><th>Registration date</th><td>{{ .User.RegDate }}</td></tr>
+	<tr><th>Trust as moderator</th><td>{{ .Trust }}</td></tr>
 </table>
 <hr class="sep">
 <div>
 	<a href="/oper/list?type=user&id={{ .User.ID }}">Show operations</a> on this user.
+	{{ if .Common.IsWritingPermitted }}
+		<br><a href="/pm?id={{ .User.ID }}">Send a private message</a> to this user.
+	{{ end }}
 </div>
 
 {{ end }}`
@@ -24,8 +24,11 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
+	"vminko.org/dscuss/owner"
 )
 
 type NetworkConfig struct {
@@ -36,10 +39,52 @@ type NetworkConfig struct {
 	DHTBootstrap    string
 	MaxInConnCount  uint32
 	MaxOutConnCount uint32
+	// Compression allows to compress packets exchanged with peers.
+	Compression bool
+	// RequireEncryption forbids connections with the peers, which do
+	// not support encryption.
+	RequireEncryption bool
+	// RelayPort is the port of the relay server. Zero disables relaying
+	// connections for other peers.
+	RelayPort int
+	// UseRelay makes the peer accept connections through relays (useful
+	// behind NAT).
+	UseRelay bool
+}
+
+type AntispamConfig struct {
+	// The difficulty of stamps computed for the owner's messages.
+	MessageStampBits int
+	// The minimal difficulty of stamps of the messages received from
+	// peers. Zero makes stamps optional.
+	MinMessageStampBits int
+	// The difficulty of the proof-of-work computed for new users.
+	RegistrationPowBits int
+	// The minimal difficulty of proofs-of-work of the users received from
+	// peers.
+	MinRegistrationPowBits int
+}
+
+type BlobsConfig struct {
+	// The maximum total size of the stored attachments (in bytes).
+	Quota int64
+}
+
+type ModerationConfig struct {
+	// The maximum length of the chain of moderators starting from the owner.
+	// 1 means that only the owner's own moderators are trusted.
+	TrustDepth int
+	// The factor the trust is multiplied by on each hop of the chain.
+	HopWeight float64
+	// The minimal trust making operations of a moderator effective.
+	MinTrust float64
 }
 
 type config struct {
-	Network NetworkConfig
+	Network    NetworkConfig
+	Antispam   AntispamConfig
+	Blobs      BlobsConfig
+	Moderation ModerationConfig
 }
 
 var defaultConfig = config{
@@ -50,6 +95,21 @@ var defaultConfig = config{
 		DHTBootstrap:    "dscuss.org:6881",
 		MaxInConnCount:  10,
 		MaxOutConnCount: 10,
+		Compression:     true,
+	},
+	Antispam: AntispamConfig{
+		MessageStampBits:       20,
+		MinMessageStampBits:    0,
+		RegistrationPowBits:    entity.LegacyProofBits,
+		MinRegistrationPowBits: entity.LegacyProofBits,
+	},
+	Blobs: BlobsConfig{
+		Quota: 256 * 1024 * 1024,
+	},
+	Moderation: ModerationConfig{
+		TrustDepth: 1,
+		HopWeight:  0.5,
+		MinTrust:   0.25,
 	},
 }
 
@@ -87,7 +147,41 @@ func newConfig(path string) (*config, error) {
 		return nil, errors.Config
 	}
 
-	/* TBD: validate parameters */
+	/* TBD: validate other parameters */
+	isStampBitsValid := func(b int) bool {
+		return b >= 0 && b <= crypto.MaxStampBits
+	}
+	if !isStampBitsValid(c.Antispam.MessageStampBits) ||
+		!isStampBitsValid(c.Antispam.MinMessageStampBits) {
+		log.Errorf("Stamp difficulty must be between 0 and %d", crypto.MaxStampBits)
+		return nil, errors.Config
+	}
+	isPowBitsValid := func(b int) bool {
+		return b > 0 && b <= crypto.MaxPowBits
+	}
+	if !isPowBitsValid(c.Antispam.RegistrationPowBits) ||
+		!isPowBitsValid(c.Antispam.MinRegistrationPowBits) {
+		log.Errorf("Proof-of-work difficulty must be between 1 and %d", crypto.MaxPowBits)
+		return nil, errors.Config
+	}
+	if c.Network.RelayPort < 0 || c.Network.RelayPort > 65535 ||
+		(c.Network.RelayPort != 0 && c.Network.RelayPort == c.Network.Port) {
+		log.Errorf("Relay port must be between 0 and 65535 and differ from the port")
+		return nil, errors.Config
+	}
+	if c.Blobs.Quota < 0 {
+		log.Errorf("Blob quota must not be negative")
+		return nil, errors.Config
+	}
+	if c.Moderation.TrustDepth < 1 || c.Moderation.TrustDepth > owner.MaxTrustDepth {
+		log.Errorf("Trust depth must be between 1 and %d", owner.MaxTrustDepth)
+		return nil, errors.Config
+	}
+	if c.Moderation.HopWeight <= 0 || c.Moderation.HopWeight > 1 ||
+		c.Moderation.MinTrust <= 0 || c.Moderation.MinTrust > 1 {
+		log.Errorf("Hop weight and minimal trust must be greater than 0 and not greater than 1")
+		return nil, errors.Config
+	}
 
 	return &c, nil
 }
@@ -0,0 +1,68 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package crypto
+
+import (
+	"strings"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// Algorithm identifies the signature scheme of a key or a signature.
+type Algorithm string
+
+const (
+	// ECDSA on the P-224 curve with SHA-256. It was the only algorithm
+	// supported by the first versions of Dscuss, so keys and signatures of
+	// this algorithm are serialized without the algorithm tag.
+	AlgorithmP224 Algorithm = "p224"
+	// Ed25519 as defined in RFC 8032.
+	AlgorithmEd25519 Algorithm = "ed25519"
+	// The algorithm used for new keys.
+	DefaultAlgorithm Algorithm = AlgorithmEd25519
+
+	algorithmTagSeparator string = ":"
+)
+
+func (a Algorithm) IsValid() bool {
+	return a == AlgorithmP224 || a == AlgorithmEd25519
+}
+
+// tag prepends the algorithm identifier to the encoded data. P-224 data is
+// left untagged.
+func (a Algorithm) tag(encoded string) string {
+	if a == AlgorithmP224 {
+		return encoded
+	}
+	return string(a) + algorithmTagSeparator + encoded
+}
+
+// untag splits tagged data into the algorithm identifier and the encoded
+// data. Untagged data is considered to be P-224.
+func untag(tagged string) (Algorithm, string, error) {
+	i := strings.Index(tagged, algorithmTagSeparator)
+	if i < 0 {
+		return AlgorithmP224, tagged, nil
+	}
+	a := Algorithm(tagged[:i])
+	if !a.IsValid() || a == AlgorithmP224 {
+		log.Warningf("Unsupported algorithm '%s'", a)
+		return "", "", errors.Parsing
+	}
+	return a, tagged[i+len(algorithmTagSeparator):], nil
+}
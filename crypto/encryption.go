@@ -0,0 +1,167 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"filippo.io/edwards25519"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// Data is encrypted to a public key using ECIES: an ephemeral X25519 key is
+// agreed with the public key and the hash of the shared secret is used as the
+// AES-256-GCM key. Ed25519 keys are converted to X25519 keys for that (P-224
+// keys don't support encryption). The encrypted data consists of the
+// ephemeral public key, the nonce and the ciphertext.
+
+const (
+	encryptionKDFLabel string = "dscuss-ecies"
+)
+
+// edPublicToX25519 converts an Ed25519 public key to the Montgomery form.
+func edPublicToX25519(pub ed25519.PublicKey) (*ecdh.PublicKey, error) {
+	p, err := new(edwards25519.Point).SetBytes(pub)
+	if err != nil {
+		log.Errorf("Can't decode Ed25519 public key: %v", err)
+		return nil, errors.Parsing
+	}
+	res, err := ecdh.X25519().NewPublicKey(p.BytesMontgomery())
+	if err != nil {
+		log.Errorf("Can't convert Ed25519 public key to X25519: %v", err)
+		return nil, errors.Parsing
+	}
+	return res, nil
+}
+
+// edPrivateToX25519 converts an Ed25519 private key to the X25519 one.
+func edPrivateToX25519(priv ed25519.PrivateKey) (*ecdh.PrivateKey, error) {
+	h := sha512.Sum512(priv.Seed())
+	res, err := ecdh.X25519().NewPrivateKey(h[:32])
+	if err != nil {
+		log.Errorf("Can't convert Ed25519 private key to X25519: %v", err)
+		return nil, errors.Internal
+	}
+	return res, nil
+}
+
+func newSharedAEAD(shared, ephemeral []byte) (cipher.AEAD, error) {
+	h := sha256.New()
+	h.Write([]byte(encryptionKDFLabel))
+	h.Write(shared)
+	h.Write(ephemeral)
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		log.Errorf("Can't create AES cipher: %v", err)
+		return nil, errors.Internal
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		log.Errorf("Can't create GCM cipher: %v", err)
+		return nil, errors.Internal
+	}
+	return aead, nil
+}
+
+// agree generates an ephemeral key and computes the secret shared with the
+// public key.
+func (key *PublicKey) agree() (ephemeral, shared []byte, err error) {
+	if key.alg != AlgorithmEd25519 {
+		log.Errorf("Keys of algorithm '%s' don't support encryption", key.alg)
+		return nil, nil, errors.CantEncrypt
+	}
+	peer, err := edPublicToX25519(key.edKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		log.Errorf("Can't generate ephemeral key: %v", err)
+		return nil, nil, errors.Internal
+	}
+	shared, err = eph.ECDH(peer)
+	if err != nil {
+		log.Errorf("Can't compute shared secret: %v", err)
+		return nil, nil, errors.WrongArguments
+	}
+	return eph.PublicKey().Bytes(), shared, nil
+}
+
+// Encrypt encrypts the plaintext, so that only the owner of the private key
+// could decrypt it. The additional data is authenticated, but not encrypted.
+func (key *PublicKey) Encrypt(plaintext, ad []byte) ([]byte, error) {
+	ephemeral, shared, err := key.agree()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newSharedAEAD(shared, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		log.Errorf("Can't generate nonce: %v", err)
+		return nil, errors.Internal
+	}
+	res := append(ephemeral, nonce...)
+	return aead.Seal(res, nonce, plaintext, ad), nil
+}
+
+// decrypt opens data encrypted to the public key of the private key.
+func (key *PrivateKey) decrypt(data, ad []byte) ([]byte, error) {
+	if key.alg != AlgorithmEd25519 {
+		return nil, errors.CantDecrypt
+	}
+	priv, err := edPrivateToX25519(key.edKey)
+	if err != nil {
+		return nil, err
+	}
+	size := len(priv.PublicKey().Bytes())
+	if len(data) < size {
+		return nil, errors.CantDecrypt
+	}
+	ephemeral := data[:size]
+	pub, err := ecdh.X25519().NewPublicKey(ephemeral)
+	if err != nil {
+		return nil, errors.CantDecrypt
+	}
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, errors.CantDecrypt
+	}
+	aead, err := newSharedAEAD(shared, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	data = data[size:]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.CantDecrypt
+	}
+	res, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], ad)
+	if err != nil {
+		return nil, errors.CantDecrypt
+	}
+	return res, nil
+}
@@ -0,0 +1,129 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package crypto
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+	"vminko.org/dscuss/errors"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Malformed hex string %s: %v", s, err)
+	}
+	return b
+}
+
+// newTestEdKey returns the key of the test 1 from RFC 8032.
+func newTestEdKey(t *testing.T) *PrivateKey {
+	seed := mustDecodeHex(t, "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	return &PrivateKey{alg: AlgorithmEd25519, edKey: ed25519.NewKeyFromSeed(seed)}
+}
+
+func TestEdToX25519(t *testing.T) {
+	key := newTestEdKey(t)
+	pub := key.Public().edKey
+	if hex.EncodeToString(pub) != "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a" {
+		t.Fatalf("Unexpected Ed25519 public key %x", pub)
+	}
+	xpub, err := edPublicToX25519(pub)
+	if err != nil {
+		t.Fatalf("Failed to convert public key: %v", err)
+	}
+	expected := "d85e07ec22b0ad881537c2f44d662d1a143cf830c57aca4305d85c7a90f6b62e"
+	if hex.EncodeToString(xpub.Bytes()) != expected {
+		t.Errorf("Expected X25519 public key %s, got %x", expected, xpub.Bytes())
+	}
+	xpriv, err := edPrivateToX25519(key.edKey)
+	if err != nil {
+		t.Fatalf("Failed to convert private key: %v", err)
+	}
+	expected = "357c83864f2833cb427a2ef1c00a013cfdff2768d980c0a3a520f006904de90f"
+	if hex.EncodeToString(xpriv.Bytes()) != expected {
+		t.Errorf("Expected X25519 private key %s, got %x", expected, xpriv.Bytes())
+	}
+	if !xpriv.PublicKey().Equal(xpub) {
+		t.Errorf("Converted keys don't match: %x vs %x", xpriv.PublicKey().Bytes(), xpub.Bytes())
+	}
+	// y = 2 is not on the curve.
+	invalid := make(ed25519.PublicKey, ed25519.PublicKeySize)
+	invalid[0] = 2
+	_, err = edPublicToX25519(invalid)
+	if err == nil {
+		t.Errorf("Invalid Ed25519 public key is converted")
+	}
+}
+
+func TestDecryptKnownAnswer(t *testing.T) {
+	key := newTestEdKey(t)
+	data := mustDecodeHex(t, "f1b742e7f0572f2500794104ab758932d32171695b529d3bfa7123cdac701142"+
+		"eb92c8a36ef7351ff7f6dac88250c80f7328ab65cc91dafed41194bd4b56ba87242d")
+	pt, err := key.decrypt(data, []byte("ad"))
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if string(pt) != "dscuss" {
+		t.Errorf("Expected 'dscuss', got '%s'", pt)
+	}
+	_, err = key.decrypt(data, []byte("da"))
+	if err != errors.CantDecrypt {
+		t.Errorf("Expected CantDecrypt for wrong additional data, got %v", err)
+	}
+	data[len(data)-1] ^= 1
+	_, err = key.decrypt(data, []byte("ad"))
+	if err != errors.CantDecrypt {
+		t.Errorf("Expected CantDecrypt for corrupted data, got %v", err)
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	key := newTestEdKey(t)
+	other, err := NewPrivateKey(AlgorithmEd25519)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	ct, err := key.Public().Encrypt([]byte("dscuss"), []byte("ad"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	pt, err := key.decrypt(ct, []byte("ad"))
+	if err != nil || string(pt) != "dscuss" {
+		t.Errorf("Failed to decrypt: '%s', %v", pt, err)
+	}
+	_, err = other.decrypt(ct, []byte("ad"))
+	if err != errors.CantDecrypt {
+		t.Errorf("Expected CantDecrypt for another key, got %v", err)
+	}
+	for _, d := range [][]byte{nil, ct[:31], ct[:40]} {
+		_, err = key.decrypt(d, []byte("ad"))
+		if err != errors.CantDecrypt {
+			t.Errorf("Expected CantDecrypt for truncated data, got %v", err)
+		}
+	}
+	p224, err := NewPrivateKey(AlgorithmP224)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	_, err = p224.Public().Encrypt([]byte("dscuss"), nil)
+	if err != errors.CantEncrypt {
+		t.Errorf("Expected CantEncrypt for P-224 key, got %v", err)
+	}
+}
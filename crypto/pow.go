@@ -26,13 +26,16 @@ import (
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 	"vminko.org/dscuss/log"
 )
 
 const (
-	powTargetBits  = 8 /*TBD: must be set to 16 in release version */
 	powKeyLenBytes = 32
 	powSalt        = "dscuss-proof-of-work"
+	// MaxPowBits limits the difficulty of proofs-of-work, otherwise
+	// finding a proof may take forever.
+	MaxPowBits = 32
 )
 
 type ProofOfWork uint64
@@ -41,26 +44,24 @@ type ProofOfWork uint64
 // Proof-of-work is used in Dscuss to protect against Sybil attack.
 type PowFinder struct {
 	data    []byte
+	bits    int
 	target  *big.Int
 	counter uint64
+	started time.Time
 }
 
-func NewPowFinder(data []byte) *PowFinder {
+// NewPowFinder creates a finder of proofs-of-work for the data. The higher
+// number of target bits you set, the harder it will be to find PoW.
+func NewPowFinder(data []byte, targetBits int) *PowFinder {
+	if targetBits > MaxPowBits {
+		log.Fatalf("Requested PoW difficulty (%d) exceeds the limit", targetBits)
+	}
 	target := big.NewInt(1)
-	target.Lsh(target, uint(powKeyLenBytes*8-powTargetBits))
-	pf := &PowFinder{data, target, 0}
+	target.Lsh(target, uint(powKeyLenBytes*8-targetBits))
+	pf := &PowFinder{data, targetBits, target, 0, time.Now()}
 	return pf
 }
 
-// setComplexity changes number of target bits in the proof-of-work.
-// The higher value you set, the harder it will be to find PoW.
-// The maximum value of TargetBitNum is powKeyLenBytes*8.
-// Should only be used for benchmarking.
-func (pf *PowFinder) setComplexity(targetBitNum int) {
-	pf.target = big.NewInt(1)
-	pf.target.Lsh(pf.target, uint(powKeyLenBytes*8-targetBitNum))
-}
-
 func (pf *PowFinder) worker(
 	workerID int,
 	resultChan chan uint64,
@@ -107,6 +108,16 @@ func (pf *PowFinder) Find() ProofOfWork {
 	return ProofOfWork(proof)
 }
 
+// Progress returns the state of the search. It's safe to call it while Find
+// is running.
+func (pf *PowFinder) Progress() Progress {
+	return Progress{
+		Attempts: atomic.LoadUint64(&pf.counter),
+		Expected: uint64(1) << uint(pf.bits),
+		Elapsed:  time.Since(pf.started),
+	}
+}
+
 func (pf *PowFinder) Validate(nonce ProofOfWork) bool {
 	var keyInt big.Int
 	var key []byte
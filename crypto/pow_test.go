@@ -22,9 +22,8 @@ import "testing"
 func BenchmarkPoW8(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()
-		privKey, _ := NewPrivateKey()
-		pow := NewPowFinder(privKey.Public().EncodeToDER())
-		pow.setComplexity(8)
+		privKey, _ := NewPrivateKey(DefaultAlgorithm)
+		pow := NewPowFinder(privKey.Public().EncodeToDER(), 8)
 		b.StartTimer()
 		_ = pow.Find()
 	}
@@ -33,9 +32,8 @@ func BenchmarkPoW8(b *testing.B) {
 func BenchmarkPoW16(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()
-		privKey, _ := NewPrivateKey()
-		pow := NewPowFinder(privKey.Public().EncodeToDER())
-		pow.setComplexity(16)
+		privKey, _ := NewPrivateKey(DefaultAlgorithm)
+		pow := NewPowFinder(privKey.Public().EncodeToDER(), 16)
 		b.StartTimer()
 		_ = pow.Find()
 	}
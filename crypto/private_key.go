@@ -19,6 +19,7 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
@@ -27,63 +28,116 @@ import (
 	"vminko.org/dscuss/log"
 )
 
-type PrivateKey ecdsa.PrivateKey
+// PrivateKey is either a P-224 ECDSA or an Ed25519 private key.
+type PrivateKey struct {
+	alg      Algorithm
+	ecdsaKey *ecdsa.PrivateKey
+	edKey    ed25519.PrivateKey
+}
+
+const (
+	ecPrivateKeyPEMType    string = "EC PRIVATE KEY"
+	pkcs8PrivateKeyPEMType string = "PRIVATE KEY"
+)
 
 // Some parts copied from github.com/gtank/cryptopasta/.
 
-// NewPrivateKey generates a random P-224 ECDSA private key.
-func NewPrivateKey() (*PrivateKey, error) {
-	key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
-	return (*PrivateKey)(key), err
+// NewPrivateKey generates a random private key for the specified algorithm.
+func NewPrivateKey(alg Algorithm) (*PrivateKey, error) {
+	switch alg {
+	case AlgorithmP224:
+		key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &PrivateKey{alg: alg, ecdsaKey: key}, nil
+	case AlgorithmEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &PrivateKey{alg: alg, edKey: key}, nil
+	default:
+		log.Errorf("Unsupported algorithm '%s'", alg)
+		return nil, errors.WrongArguments
+	}
 }
 
-// ParsePrivateKeyFromDER decodes a PEM-encoded ECDSA private key.
+// ParsePrivateKeyFromDER decodes a DER-encoded private key. P-224 keys are
+// expected in SEC 1 format, Ed25519 keys are expected in PKCS #8 format.
 func ParsePrivateKeyFromDER(der []byte) (*PrivateKey, error) {
-	privkey, err := x509.ParseECPrivateKey(der)
+	ecKey, err := x509.ParseECPrivateKey(der)
+	if err == nil {
+		if ecKey.Curve != elliptic.P224() {
+			log.Errorf("Unsupported curve of the private key: %s", ecKey.Curve.Params().Name)
+			return nil, errors.Parsing
+		}
+		return &PrivateKey{alg: AlgorithmP224, ecdsaKey: ecKey}, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
 	if err != nil {
 		log.Errorf("Can't parse private key %v", err)
 		return nil, errors.Parsing
 	}
-	return (*PrivateKey)(privkey), nil
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		log.Errorf("Unsupported type of the private key: %T", key)
+		return nil, errors.Parsing
+	}
+	return &PrivateKey{alg: AlgorithmEd25519, edKey: edKey}, nil
 }
 
-// ParsePrivateKeyFromPEM decodes a PEM-encoded ECDSA private key.
+// ParsePrivateKeyFromPEM decodes a PEM-encoded private key.
 func ParsePrivateKeyFromPEM(encodedKey []byte) (*PrivateKey, error) {
-	block, encodedKey := pem.Decode(encodedKey)
-	if block.Type != "EC PRIVATE KEY" {
-		log.Error("Failed to find EC PRIVATE KEY in PEM data")
+	block, _ := pem.Decode(encodedKey)
+	if block == nil || (block.Type != ecPrivateKeyPEMType && block.Type != pkcs8PrivateKeyPEMType) {
+		log.Error("Failed to find private key in PEM data")
 		return nil, errors.Parsing
 	}
 	return ParsePrivateKeyFromDER(block.Bytes)
 }
 
-// EncodeToDER encodes an ECDSA private key to DER format.
+func (key *PrivateKey) Algorithm() Algorithm {
+	return key.alg
+}
+
+// EncodeToDER encodes a private key to DER format.
 func (key *PrivateKey) EncodeToDER() []byte {
-	der, err := x509.MarshalECPrivateKey((*ecdsa.PrivateKey)(key))
+	var der []byte
+	var err error
+	if key.alg == AlgorithmP224 {
+		der, err = x509.MarshalECPrivateKey(key.ecdsaKey)
+	} else {
+		der, err = x509.MarshalPKCS8PrivateKey(key.edKey)
+	}
 	if err != nil {
-		log.Fatalf("MarshalECPrivateKey failed to encode private key %v", err)
+		log.Fatalf("Failed to encode private key %v", err)
 	}
 	return der
 }
 
-// EncodeToPEM encodes an ECDSA private key to PEM format.
+// EncodeToPEM encodes a private key to PEM format.
 func (key *PrivateKey) EncodeToPEM() []byte {
+	typ := pkcs8PrivateKeyPEMType
+	if key.alg == AlgorithmP224 {
+		typ = ecPrivateKeyPEMType
+	}
 	return pem.EncodeToMemory(
 		&pem.Block{
-			Type:  "EC PRIVATE KEY",
+			Type:  typ,
 			Bytes: key.EncodeToDER(),
 		},
 	)
 }
 
-// public returns the public key corresponding to the private key.
+// Public returns the public key corresponding to the private key.
 func (key *PrivateKey) Public() *PublicKey {
-	var pubKey *PublicKey
-	cryptoPub := (*ecdsa.PrivateKey)(key).Public()
-	ecdsaPub, ok := (cryptoPub).(*ecdsa.PublicKey)
+	if key.alg == AlgorithmP224 {
+		return &PublicKey{alg: key.alg, ecdsaKey: &key.ecdsaKey.PublicKey}
+	}
+	edPub, ok := key.edKey.Public().(ed25519.PublicKey)
 	if !ok {
-		log.Fatalf("Wrong cryptoPub type: %T", cryptoPub)
+		log.Fatalf("Wrong type of Ed25519 public key: %T", key.edKey.Public())
 	}
-	pubKey = (*PublicKey)(ecdsaPub)
-	return pubKey
+	return &PublicKey{alg: key.alg, edKey: edPub}
 }
@@ -0,0 +1,143 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"golang.org/x/crypto/scrypt"
+	"strconv"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+const (
+	encryptedKeyPEMType  string = "ENCRYPTED PRIVATE KEY"
+	encryptedKeyCipher   string = "scrypt-aes-256-gcm"
+	encryptedKeySaltLen  int    = 16
+	encryptedKeyLenBytes int    = 32
+	encryptedKeyScryptN  int    = 1 << 15
+	encryptedKeyScryptR  int    = 8
+	encryptedKeyScryptP  int    = 1
+)
+
+func newPassphraseAEAD(passphrase, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	dk, err := scrypt.Key(passphrase, salt, n, r, p, encryptedKeyLenBytes)
+	if err != nil {
+		log.Errorf("Can't derive key from the passphrase: %v", err)
+		return nil, errors.Internal
+	}
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		log.Errorf("Can't create AES cipher: %v", err)
+		return nil, errors.Internal
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		log.Errorf("Can't create GCM cipher: %v", err)
+		return nil, errors.Internal
+	}
+	return aead, nil
+}
+
+// EncodeToEncryptedPEM encrypts a private key with a key derived from
+// the passphrase (using scrypt) and encodes the result to PEM format.
+func (key *PrivateKey) EncodeToEncryptedPEM(passphrase []byte) ([]byte, error) {
+	salt := make([]byte, encryptedKeySaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		log.Errorf("Can't generate salt: %v", err)
+		return nil, errors.Internal
+	}
+	aead, err := newPassphraseAEAD(
+		passphrase,
+		salt,
+		encryptedKeyScryptN,
+		encryptedKeyScryptR,
+		encryptedKeyScryptP,
+	)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		log.Errorf("Can't generate nonce: %v", err)
+		return nil, errors.Internal
+	}
+	return pem.EncodeToMemory(
+		&pem.Block{
+			Type: encryptedKeyPEMType,
+			Headers: map[string]string{
+				"Cipher":   encryptedKeyCipher,
+				"Scrypt-N": strconv.Itoa(encryptedKeyScryptN),
+				"Scrypt-R": strconv.Itoa(encryptedKeyScryptR),
+				"Scrypt-P": strconv.Itoa(encryptedKeyScryptP),
+				"Salt":     hex.EncodeToString(salt),
+				"Nonce":    hex.EncodeToString(nonce),
+			},
+			Bytes: aead.Seal(nil, nonce, key.EncodeToDER(), nil),
+		},
+	), nil
+}
+
+// IsPEMEncrypted checks whether the PEM data contains an encrypted private key.
+func IsPEMEncrypted(encodedKey []byte) bool {
+	block, _ := pem.Decode(encodedKey)
+	return block != nil && block.Type == encryptedKeyPEMType
+}
+
+// ParsePrivateKeyFromEncryptedPEM decrypts and decodes a PEM-encoded private
+// key, which was encrypted by EncodeToEncryptedPEM.
+func ParsePrivateKeyFromEncryptedPEM(encodedKey, passphrase []byte) (*PrivateKey, error) {
+	block, _ := pem.Decode(encodedKey)
+	if block == nil || block.Type != encryptedKeyPEMType {
+		log.Error("Failed to find " + encryptedKeyPEMType + " in PEM data")
+		return nil, errors.Parsing
+	}
+	if block.Headers["Cipher"] != encryptedKeyCipher {
+		log.Errorf("Unsupported cipher of the private key: %s", block.Headers["Cipher"])
+		return nil, errors.Parsing
+	}
+	n, errN := strconv.Atoi(block.Headers["Scrypt-N"])
+	r, errR := strconv.Atoi(block.Headers["Scrypt-R"])
+	p, errP := strconv.Atoi(block.Headers["Scrypt-P"])
+	salt, errS := hex.DecodeString(block.Headers["Salt"])
+	nonce, errNonce := hex.DecodeString(block.Headers["Nonce"])
+	if errN != nil || errR != nil || errP != nil || errS != nil || errNonce != nil {
+		log.Error("Failed to parse headers of the encrypted private key")
+		return nil, errors.Parsing
+	}
+	aead, err := newPassphraseAEAD(passphrase, salt, n, r, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		log.Errorf("Encrypted private key has nonce of wrong size (%d)", len(nonce))
+		return nil, errors.Parsing
+	}
+	der, err := aead.Open(nil, nonce, block.Bytes, nil)
+	if err != nil {
+		log.Debugf("Can't decrypt the private key: %v", err)
+		return nil, errors.WrongPassphrase
+	}
+	return ParsePrivateKeyFromDER(der)
+}
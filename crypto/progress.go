@@ -0,0 +1,63 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package crypto
+
+import (
+	"fmt"
+	"time"
+)
+
+// Progress describes the state of a proof-of-work search. The search is
+// probabilistic, so the completion percentage and the ETA are just estimations
+// based on the expected number of attempts.
+type Progress struct {
+	Attempts uint64        // The number of nonces checked so far.
+	Expected uint64        // The expected number of attempts.
+	Elapsed  time.Duration // The time spent on the search.
+}
+
+// Percent returns the estimated completion percentage. It never reaches 100,
+// because the search may take longer than expected.
+func (p *Progress) Percent() int {
+	if p.Expected == 0 {
+		return 0
+	}
+	res := float64(p.Attempts) / float64(p.Expected) * 100
+	if res > 99 {
+		return 99
+	}
+	return int(res)
+}
+
+// ETA returns the estimated time left. It's zero if the estimation is not
+// possible yet or the search already took longer than expected.
+func (p *Progress) ETA() time.Duration {
+	if p.Attempts == 0 || p.Attempts >= p.Expected {
+		return 0
+	}
+	perAttempt := float64(p.Elapsed) / float64(p.Attempts)
+	return time.Duration(perAttempt * float64(p.Expected-p.Attempts))
+}
+
+func (p *Progress) String() string {
+	eta := p.ETA()
+	if eta < time.Second {
+		return fmt.Sprintf("%d%%", p.Percent())
+	}
+	return fmt.Sprintf("%d%%, about %s left", p.Percent(), eta.Round(time.Second))
+}
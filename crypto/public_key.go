@@ -20,6 +20,8 @@ package crypto
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
@@ -29,11 +31,21 @@ import (
 	"vminko.org/dscuss/log"
 )
 
-type PublicKey ecdsa.PublicKey
+// PublicKey is either a P-224 ECDSA or an Ed25519 public key.
+type PublicKey struct {
+	alg      Algorithm
+	ecdsaKey *ecdsa.PublicKey
+	edKey    ed25519.PublicKey
+}
+
+const (
+	ecPublicKeyPEMType   string = "EC PUBLIC KEY"
+	pkixPublicKeyPEMType string = "PUBLIC KEY"
+)
 
 // Some parts copied from github.com/gtank/cryptopasta/.
 
-// ParsePublicKeyFromDER decodes a DER-encoded ECDSA public key.
+// ParsePublicKeyFromDER decodes a DER-encoded public key.
 func ParsePublicKeyFromDER(encodedKey []byte) (*PublicKey, error) {
 	pub, err := x509.ParsePKIXPublicKey(encodedKey)
 	if err != nil {
@@ -41,75 +53,115 @@ func ParsePublicKeyFromDER(encodedKey []byte) (*PublicKey, error) {
 		return nil, errors.Parsing
 	}
 
-	ecdsaPub, ok := pub.(*ecdsa.PublicKey)
-	if !ok {
-		log.Fatal("Data was not an ECDSA public key")
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P224() {
+			log.Warningf("Unsupported curve of the public key: %s", k.Curve.Params().Name)
+			return nil, errors.Parsing
+		}
+		return &PublicKey{alg: AlgorithmP224, ecdsaKey: k}, nil
+	case ed25519.PublicKey:
+		return &PublicKey{alg: AlgorithmEd25519, edKey: k}, nil
+	default:
+		log.Warningf("Unsupported type of the public key: %T", pub)
+		return nil, errors.Parsing
 	}
-
-	return (*PublicKey)(ecdsaPub), nil
 }
 
-// ParsePublicKeyFromPEM decodes a PEM-encoded ECDSA public key.
+// ParsePublicKeyFromPEM decodes a PEM-encoded public key.
 func ParsePublicKeyFromPEM(encodedKey []byte) (*PublicKey, error) {
-	block, encodedKey := pem.Decode(encodedKey)
-	if block.Type != "EC PUBLIC KEY" {
-		log.Error("Failed to find EC PUBLIC KEY in PEM data")
+	block, _ := pem.Decode(encodedKey)
+	if block == nil || (block.Type != ecPublicKeyPEMType && block.Type != pkixPublicKeyPEMType) {
+		log.Error("Failed to find public key in PEM data")
 		return nil, errors.Parsing
 	}
 	return ParsePublicKeyFromDER(block.Bytes)
 }
 
-// EncodeToDER encodes an ECDSA public key to DER format.
+func (key *PublicKey) Algorithm() Algorithm {
+	return key.alg
+}
+
+// EncodeToDER encodes a public key to DER format.
 func (key *PublicKey) EncodeToDER() []byte {
-	derBytes, err := x509.MarshalPKIXPublicKey((*ecdsa.PublicKey)(key))
+	var pub interface{} = key.edKey
+	if key.alg == AlgorithmP224 {
+		pub = key.ecdsaKey
+	}
+	derBytes, err := x509.MarshalPKIXPublicKey(pub)
 	if err != nil {
 		log.Fatalf("MarshalPKIXPublicKey failed to encode public key: : %v", err)
 	}
 	return derBytes
 }
 
-// EncodeToPEM encodes an ECDSA public key to PEM format.
+// EncodeToPEM encodes a public key to PEM format.
 func (key *PublicKey) EncodeToPEM() []byte {
+	typ := pkixPublicKeyPEMType
+	if key.alg == AlgorithmP224 {
+		typ = ecPublicKeyPEMType
+	}
 	return pem.EncodeToMemory(
 		&pem.Block{
-			Type:  "EC PUBLIC KEY",
+			Type:  typ,
 			Bytes: key.EncodeToDER(),
 		},
 	)
 }
 
-// MarshalJSON returns the JSON encoded key.
+// MarshalJSON returns the JSON encoded key tagged with the algorithm
+// identifier.
 func (key *PublicKey) MarshalJSON() ([]byte, error) {
 	der := key.EncodeToDER()
 	b64der := base64.RawURLEncoding.EncodeToString(der)
-	return []byte(`"` + string(b64der) + `"`), nil
+	return []byte(`"` + key.alg.tag(b64der) + `"`), nil
 }
 
 // UnmarshalJSON decodes b and sets result to *key.
 func (key *PublicKey) UnmarshalJSON(b []byte) error {
 	trimmed := bytes.Trim(b, "\"")
-	der := make([]byte, base64.RawURLEncoding.DecodedLen(len(trimmed)))
-	_, err := base64.RawURLEncoding.Decode(der, trimmed)
+	alg, b64der, err := untag(string(trimmed))
+	if err != nil {
+		return err
+	}
+	der, err := base64.RawURLEncoding.DecodeString(b64der)
 	if err != nil {
 		log.Warningf("Can't decode base64-encoded pubkey '%s'", trimmed)
 		return errors.Parsing
 	}
 	res, err := ParsePublicKeyFromDER(der)
-	if res != nil {
-		*key = *res
+	if err != nil {
+		return err
+	}
+	if res.alg != alg {
+		log.Warningf("Algorithm of pubkey '%s' does not match its tag", trimmed)
+		return errors.Parsing
 	}
-	return err
+	*key = *res
+	return nil
 }
 
 // Verify checks whether the sig of the data corresponds the public key.
 func (key *PublicKey) Verify(data []byte, sig Signature) bool {
+	if sig.Algorithm != key.alg {
+		log.Debugf("Algorithm of the signature (%s) does not match the key (%s)",
+			sig.Algorithm, key.alg)
+		return false
+	}
+	if key.alg == AlgorithmEd25519 {
+		return ed25519.Verify(key.edKey, data, sig.Bytes)
+	}
+
 	digest := sha256.Sum256(data)
 
-	curveOrderByteLen := key.Curve.Params().P.BitLen() / 8
+	curveOrderByteLen := key.ecdsaKey.Curve.Params().P.BitLen() / 8
+	if len(sig.Bytes) != curveOrderByteLen*2 {
+		return false
+	}
 
 	r, s := new(big.Int), new(big.Int)
-	r.SetBytes(sig[:curveOrderByteLen])
-	s.SetBytes(sig[curveOrderByteLen:])
+	r.SetBytes(sig.Bytes[:curveOrderByteLen])
+	s.SetBytes(sig.Bytes[curveOrderByteLen:])
 
-	return ecdsa.Verify((*ecdsa.PublicKey)(key), digest[:], r, s)
+	return ecdsa.Verify(key.ecdsaKey, digest[:], r, s)
 }
@@ -0,0 +1,79 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// legacyPubKey is the untagged P-224 key of a user registered by the first
+// versions of Dscuss.
+const legacyPubKey = "ME4wEAYHKoZIzj0CAQYFK4EEACEDOgAESejz_p7FyIi1gmNgfPSMH64SSPxsjg9qAUYB_R7Ll9B" +
+	"FIN6nYrDk1T1gLawEP6LmGvw-Ej-RTKQ"
+
+func TestPublicKeyJSON(t *testing.T) {
+	priv, err := NewPrivateKey(AlgorithmEd25519)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	pub := priv.Public()
+	j, err := pub.MarshalJSON()
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	if !strings.HasPrefix(string(j), `"ed25519:`) {
+		t.Errorf("Ed25519 key is not tagged: %s", j)
+	}
+	var res PublicKey
+	err = res.UnmarshalJSON(j)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal key %s: %v", j, err)
+	}
+	if res.Algorithm() != AlgorithmEd25519 || !bytes.Equal(res.EncodeToDER(), pub.EncodeToDER()) {
+		t.Errorf("Ed25519 key %s is changed by marshaling", j)
+	}
+
+	legacy := `"` + legacyPubKey + `"`
+	err = res.UnmarshalJSON([]byte(legacy))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal legacy key: %v", err)
+	}
+	if res.Algorithm() != AlgorithmP224 {
+		t.Errorf("Expected P-224 legacy key, got %s", res.Algorithm())
+	}
+	j, err = res.MarshalJSON()
+	if err != nil || string(j) != legacy {
+		t.Errorf("Legacy key is marshaled as %s (%v)", j, err)
+	}
+
+	for _, s := range []string{
+		"rsa:" + legacyPubKey,
+		// P-224 keys are never tagged.
+		"p224:" + legacyPubKey,
+		// The tag does not match the key.
+		"ed25519:" + legacyPubKey,
+		"ed25519:",
+	} {
+		err = res.UnmarshalJSON([]byte(`"` + s + `"`))
+		if err == nil {
+			t.Errorf("Malformed key %s is accepted", s)
+		}
+	}
+}
@@ -24,24 +24,31 @@ import (
 	"vminko.org/dscuss/log"
 )
 
-type Signature []byte
+// Signature is a signature created by a key of the specified algorithm.
+type Signature struct {
+	Algorithm Algorithm
+	Bytes     []byte
+}
 
-// Encode encodes an ECDSA signature according to
+// Encode encodes a signature according to
 // https://tools.ietf.org/html/rfc7515#appendix-A.3.1
+// and tags it with the algorithm identifier.
 func (sig Signature) Encode() string {
-	return base64.RawURLEncoding.EncodeToString(sig)
+	return sig.Algorithm.tag(base64.RawURLEncoding.EncodeToString(sig.Bytes))
 }
 
-// ParseSignature decodes an ECDSA signature according to
-// https://tools.ietf.org/html/rfc7515#appendix-A.3.1
+// ParseSignature decodes a signature encoded by Encode.
 func ParseSignature(b64sig []byte) (Signature, error) {
-	sig := make([]byte, base64.RawURLEncoding.DecodedLen(len(b64sig)))
-	_, err := base64.RawURLEncoding.Decode(sig, b64sig)
+	alg, encoded, err := untag(string(b64sig))
+	if err != nil {
+		return Signature{}, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encoded)
 	if err != nil {
 		log.Errorf("Can't decode base64-encoded signture %x", b64sig)
-		return nil, errors.Parsing
+		return Signature{}, errors.Parsing
 	}
-	return sig, nil
+	return Signature{Algorithm: alg, Bytes: sig}, nil
 }
 
 // MarshalJSON returns the JSON-encoded key.
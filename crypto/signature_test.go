@@ -0,0 +1,90 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// legacySig is the untagged P-224 signature made by the first versions of
+// Dscuss.
+const legacySig = "dSrlWDimX8FzxUJJ7Au7THwE4vi_4_dE6x_AA5D-TL1uS4bIAwEoGUR4uWP8bFiscl6AF0X9aaI"
+
+func TestSignature(t *testing.T) {
+	data := []byte("dscuss")
+	keys := make(map[Algorithm]*PrivateKey)
+	sigs := make(map[Algorithm]Signature)
+	for _, alg := range []Algorithm{AlgorithmEd25519, AlgorithmP224} {
+		priv, err := NewPrivateKey(alg)
+		if err != nil {
+			t.Fatalf("Failed to generate %s key: %v", alg, err)
+		}
+		sig, err := NewSigner(priv).Sign(data)
+		if err != nil {
+			t.Fatalf("Failed to sign with %s key: %v", alg, err)
+		}
+		enc := sig.Encode()
+		isTagged := strings.HasPrefix(enc, string(alg)+":")
+		if isTagged != (alg == AlgorithmEd25519) {
+			t.Errorf("Unexpected tagging of %s signature %s", alg, enc)
+		}
+		res, err := ParseSignature([]byte(enc))
+		if err != nil {
+			t.Fatalf("Failed to parse %s signature %s: %v", alg, enc, err)
+		}
+		if res.Algorithm != alg || !bytes.Equal(res.Bytes, sig.Bytes) {
+			t.Errorf("Signature %s is changed by encoding", enc)
+		}
+		if !priv.Public().Verify(data, res) {
+			t.Errorf("Parsed %s signature is not valid", alg)
+		}
+		keys[alg], sigs[alg] = priv, sig
+	}
+
+	sig, err := ParseSignature([]byte(legacySig))
+	if err != nil {
+		t.Fatalf("Failed to parse legacy signature: %v", err)
+	}
+	if sig.Algorithm != AlgorithmP224 || len(sig.Bytes) != 56 {
+		t.Errorf("Unexpected legacy signature: %s, %d bytes", sig.Algorithm, len(sig.Bytes))
+	}
+	if sig.Encode() != legacySig {
+		t.Errorf("Legacy signature is encoded as %s", sig.Encode())
+	}
+
+	for _, s := range []string{"rsa:" + legacySig, "p224:" + legacySig, "ed25519:%%%"} {
+		_, err = ParseSignature([]byte(s))
+		if err == nil {
+			t.Errorf("Malformed signature %s is accepted", s)
+		}
+	}
+
+	// Signatures of another algorithm are rejected even if the bytes match.
+	if keys[AlgorithmEd25519].Public().Verify(data, sigs[AlgorithmP224]) {
+		t.Errorf("P-224 signature is accepted by Ed25519 key")
+	}
+	if keys[AlgorithmP224].Public().Verify(data, sigs[AlgorithmEd25519]) {
+		t.Errorf("Ed25519 signature is accepted by P-224 key")
+	}
+	relabeled := Signature{Algorithm: AlgorithmP224, Bytes: sigs[AlgorithmEd25519].Bytes}
+	if keys[AlgorithmEd25519].Public().Verify(data, relabeled) {
+		t.Errorf("Ed25519 signature labeled as P-224 is accepted")
+	}
+}
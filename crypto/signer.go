@@ -19,6 +19,7 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
 	"vminko.org/dscuss/errors"
@@ -39,24 +40,37 @@ func (s *Signer) Public() *PublicKey {
 	return s.privkey.Public()
 }
 
+// Decrypt opens the data encrypted to the Signer's public key (see
+// PublicKey.Encrypt).
+func (s *Signer) Decrypt(data, ad []byte) ([]byte, error) {
+	return s.privkey.decrypt(data, ad)
+}
+
 // Sign creates a signature for the data using the Signer's private key.
 func (s *Signer) Sign(data []byte) (Signature, error) {
+	if s.privkey.alg == AlgorithmEd25519 {
+		return Signature{
+			Algorithm: AlgorithmEd25519,
+			Bytes:     ed25519.Sign(s.privkey.edKey, data),
+		}, nil
+	}
+
 	digest := sha256.Sum256(data)
 
-	r, t, err := ecdsa.Sign(rand.Reader, (*ecdsa.PrivateKey)(s.privkey), digest[:])
+	r, t, err := ecdsa.Sign(rand.Reader, s.privkey.ecdsaKey, digest[:])
 	if err != nil {
-		log.Errorf("Can't sign data using private key %s %v", s.privkey, err)
-		return nil, errors.Internal
+		log.Errorf("Can't sign data using private key: %v", err)
+		return Signature{}, errors.Internal
 	}
 
 	// Encode the signature {R, S}
 	// big.Int.Bytes() will need padding in the case of leading zero bytes
-	params := s.privkey.Curve.Params()
+	params := s.privkey.ecdsaKey.Curve.Params()
 	curveOrderByteLen := params.P.BitLen() / 8
 	rBytes, tBytes := r.Bytes(), t.Bytes()
-	Signature := make([]byte, curveOrderByteLen*2)
-	copy(Signature[curveOrderByteLen-len(rBytes):], rBytes)
-	copy(Signature[curveOrderByteLen*2-len(tBytes):], tBytes)
+	sig := make([]byte, curveOrderByteLen*2)
+	copy(sig[curveOrderByteLen-len(rBytes):], rBytes)
+	copy(sig[curveOrderByteLen*2-len(tBytes):], tBytes)
 
-	return Signature, nil
+	return Signature{Algorithm: AlgorithmP224, Bytes: sig}, nil
 }
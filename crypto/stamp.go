@@ -0,0 +1,147 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"vminko.org/dscuss/log"
+)
+
+const (
+	// MaxStampBits limits the difficulty of stamps, otherwise finding a
+	// stamp may take forever.
+	MaxStampBits = 40
+)
+
+// Stamp is a hashcash stamp proving that some work was done for particular
+// data. The difficulty of the stamp is the number of leading zero bits in
+// SHA-256 of the data followed by the stamp. Unlike ProofOfWork, stamps are
+// cheap to validate, so they are suitable for every message. Zero value means
+// no stamp.
+type Stamp uint64
+
+// Bits returns the difficulty of the stamp for the data.
+func (s Stamp) Bits(data []byte) int {
+	if s == 0 {
+		return 0
+	}
+	return stampBits(data, uint64(s))
+}
+
+func stampBits(data []byte, nonce uint64) int {
+	buf := make([]byte, len(data)+8)
+	copy(buf, data)
+	binary.BigEndian.PutUint64(buf[len(data):], nonce)
+	sum := sha256.Sum256(buf)
+	res := 0
+	for i := 0; i < len(sum); i += 8 {
+		z := bits.LeadingZeros64(binary.BigEndian.Uint64(sum[i : i+8]))
+		res += z
+		if z < 64 {
+			break
+		}
+	}
+	return res
+}
+
+// StampFinder searches for a stamp of the required difficulty using all
+// available CPUs. The search can be stopped and its progress can be
+// monitored from other goroutines.
+type StampFinder struct {
+	data     []byte
+	bits     int
+	counter  uint64
+	started  time.Time
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func NewStampFinder(data []byte, difficulty int) *StampFinder {
+	if difficulty > MaxStampBits {
+		log.Fatalf("Requested stamp difficulty (%d) exceeds the limit", difficulty)
+	}
+	return &StampFinder{
+		data:     data,
+		bits:     difficulty,
+		started:  time.Now(),
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (sf *StampFinder) worker(resultChan chan<- uint64, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		select {
+		case <-sf.stopChan:
+			return
+		default:
+		}
+		nonce := atomic.AddUint64(&sf.counter, 1)
+		if stampBits(sf.data, nonce) >= sf.bits {
+			select {
+			case resultChan <- nonce:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// Find blocks until the stamp is found. It returns false if the search was
+// stopped.
+func (sf *StampFinder) Find() (Stamp, bool) {
+	log.Debugf("Looking for a %d-bit stamp for %x", sf.bits, sf.data)
+	resultChan := make(chan uint64, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go sf.worker(resultChan, &wg)
+	}
+	var stamp uint64
+	select {
+	case stamp = <-resultChan:
+	case <-sf.stopChan:
+	}
+	sf.Stop()
+	wg.Wait()
+	if stamp == 0 {
+		log.Debugf("The search for a stamp for %x was stopped", sf.data)
+		return 0, false
+	}
+	log.Debugf("Stamp is found: %d", stamp)
+	return Stamp(stamp), true
+}
+
+// Stop interrupts the search.
+func (sf *StampFinder) Stop() {
+	sf.stopOnce.Do(func() { close(sf.stopChan) })
+}
+
+func (sf *StampFinder) Progress() Progress {
+	return Progress{
+		Attempts: atomic.LoadUint64(&sf.counter),
+		Expected: uint64(1) << uint(sf.bits),
+		Elapsed:  time.Since(sf.started),
+	}
+}
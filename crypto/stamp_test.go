@@ -0,0 +1,67 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package crypto
+
+import "testing"
+
+func TestStampBits(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		stamp Stamp
+		want  int
+	}{
+		{"no stamp", "dscuss", 0, 0},
+		{"no leading zeros", "dscuss", 1, 0},
+		{"one leading zero", "dscuss", 2, 1},
+		{"valid stamp", "dscuss", 19208, 14},
+		{"stamp for other data", "other", 19208, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.stamp.Bits([]byte(tt.data)); got != tt.want {
+				t.Errorf("Bits() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStampFinder(t *testing.T) {
+	data := []byte("dscuss")
+	for _, bits := range []int{0, 1, 8, 12} {
+		sf := NewStampFinder(data, bits)
+		stamp, ok := sf.Find()
+		if !ok {
+			t.Fatalf("Find() failed for %d bits", bits)
+		}
+		if stamp == 0 {
+			t.Errorf("Find() returned zero stamp for %d bits", bits)
+		}
+		if got := stamp.Bits(data); got < bits {
+			t.Errorf("Find() returned %d-bit stamp, want at least %d", got, bits)
+		}
+	}
+}
+
+func TestStampFinderStop(t *testing.T) {
+	sf := NewStampFinder([]byte("dscuss"), MaxStampBits)
+	sf.Stop()
+	if _, ok := sf.Find(); ok {
+		t.Errorf("Find() succeeded after Stop()")
+	}
+}
@@ -23,13 +23,17 @@ package dscuss
 
 import (
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"vminko.org/dscuss/crypto"
 	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
@@ -43,8 +47,10 @@ import (
 
 // LoginHandle implements API exposed to a logged user.
 type LoginHandle struct {
-	owner *owner.Owner
-	pp    *p2p.PeerPool
+	owner      *owner.Owner
+	pp         *p2p.PeerPool
+	passphrase string
+	stamper    *stamper
 }
 
 // ByNickname implements sort.Interface for []*peer.Info based on
@@ -63,6 +69,9 @@ const (
 	cfgFileName         string = "config.json"
 	AddressListFileName string = "addresses.txt"
 	debug               bool   = true
+	// topicBatchSize is the number of threads fetched at once while
+	// listing a topic.
+	topicBatchSize int = 100
 )
 
 var (
@@ -143,11 +152,22 @@ func IsLoggedIn() bool {
 	return login != nil
 }
 
-func Register(nickname, info string, s subs.Subscriptions) error {
-	return owner.Register(dir, nickname, info, s)
+// Register creates a new user. The private key of the user is encrypted using
+// the passphrase unless it's empty. Computing the proof-of-work may take a
+// while, its progress is periodically passed to the progress function (if
+// it's not nil).
+func Register(
+	nickname, info, passphrase string,
+	s subs.Subscriptions,
+	progress func(crypto.Progress),
+) error {
+	return owner.Register(dir, nickname, info, passphrase, cfg.Antispam.RegistrationPowBits, s, progress)
 }
 
-func Login(nickname string) (*LoginHandle, error) {
+// Login connects to the network as the specified user. The passphrase is only
+// required if the private key of the user is encrypted. If it's encrypted and
+// the passphrase is empty, errors.PassphraseRequired is returned.
+func Login(nickname, passphrase string) (*LoginHandle, error) {
 	if IsLoggedIn() {
 		log.Errorf("Login attempt when %s is already logged in", login.owner.User.Nickname)
 		return nil, errors.AlreadyLoggedIn
@@ -157,7 +177,12 @@ func Login(nickname string) (*LoginHandle, error) {
 		return nil, errors.WrongNickname
 	}
 
-	ownr, err := owner.New(dir, nickname)
+	trust := owner.TrustPolicy{
+		Depth:     cfg.Moderation.TrustDepth,
+		HopWeight: cfg.Moderation.HopWeight,
+		MinTrust:  cfg.Moderation.MinTrust,
+	}
+	ownr, err := owner.New(dir, nickname, passphrase, cfg.Blobs.Quota, trust)
 	if err != nil {
 		log.Errorf("Failed to open %s's data: %v", nickname, err)
 		return nil, err
@@ -180,6 +205,7 @@ func Login(nickname string) (*LoginHandle, error) {
 				cfg.Network.DHTPort,
 				cfg.Network.DHTBootstrap,
 				cfg.Network.Port,
+				cfg.Network.RelayPort,
 				ownr.Profile.GetSubscriptions(),
 			)
 			aps = append(aps, ap)
@@ -190,14 +216,34 @@ func Login(nickname string) (*LoginHandle, error) {
 	if len(aps) == 0 {
 		log.Fatal("Could not found any valid address provider in " + cfg.Network.AddressProvider)
 	}
+	pex := p2p.NewPexProvider(cfg.Network.Port)
+	aps = append(aps, pex)
 
 	hp := net.JoinHostPort(cfg.Network.Address, strconv.Itoa(cfg.Network.Port))
-	cp := p2p.NewConnectionProvider(aps, hp, cfg.Network.MaxInConnCount, cfg.Network.MaxOutConnCount)
+	var rhp string
+	if cfg.Network.RelayPort != 0 {
+		rhp = net.JoinHostPort(cfg.Network.Address, strconv.Itoa(cfg.Network.RelayPort))
+	}
+	cp := p2p.NewConnectionProvider(
+		aps,
+		hp,
+		rhp,
+		cfg.Network.UseRelay,
+		cfg.Network.MaxInConnCount,
+		cfg.Network.MaxOutConnCount,
+	)
 
-	pp := p2p.NewPeerPool(cp, ownr)
+	policy := &peer.Policy{
+		MinMessageStampBits: cfg.Antispam.MinMessageStampBits,
+		MinUserProofBits:    cfg.Antispam.MinRegistrationPowBits,
+		Compression:         cfg.Network.Compression,
+		RequireEncryption:   cfg.Network.RequireEncryption,
+	}
+	pp := p2p.NewPeerPool(cp, ownr, policy, pex)
 	pp.Start()
 
-	login = &LoginHandle{ownr, pp}
+	st := newStamper(ownr, cfg.Antispam.MessageStampBits)
+	login = &LoginHandle{ownr, pp, passphrase, st}
 	return login, nil
 }
 
@@ -206,6 +252,7 @@ func (lh *LoginHandle) Logout() {
 		log.Fatal("Invalid LoginHandle")
 	}
 	login = nil
+	lh.stamper.stop()
 	lh.pp.Stop()
 	lh.owner.Close()
 }
@@ -215,7 +262,7 @@ func (lh *LoginHandle) Relogin() error {
 	nick := u.Nickname
 	lh.Logout()
 
-	newLoginHandle, err := Login(nick)
+	newLoginHandle, err := Login(nick, lh.passphrase)
 	if err != nil {
 		log.Errorf("Failed to log in as %s: %v\n", nick, err)
 		return err
@@ -229,15 +276,31 @@ func (lh *LoginHandle) IsValid() bool {
 	return (lh != nil) && (lh == login)
 }
 
+// GetLoggedUser returns the latest version of the logged user's profile.
 func (lh *LoginHandle) GetLoggedUser() *entity.User {
-	return lh.owner.User
+	u, err := lh.owner.Storage.GetProfile(lh.owner.User.ID())
+	if err != nil {
+		log.Errorf("Failed to fetch the latest profile of the logged user: %v", err)
+		return lh.owner.User
+	}
+	return u
 }
 
 func (lh *LoginHandle) ListPeers() []*peer.Info {
 	return lh.pp.ListPeers()
 }
 
-func (lh *LoginHandle) NewThread(subj, text string, topic subs.Topic) (*entity.Message, error) {
+func (lh *LoginHandle) NewThread(
+	subj, text string,
+	topic subs.Topic,
+	attachments []entity.Attachment,
+	poll *entity.Poll,
+	references []entity.Reference,
+) (*entity.Message, error) {
+	err := lh.checkReferences(references)
+	if err != nil {
+		return nil, err
+	}
 	return entity.EmergeMessage(
 		subj,
 		text,
@@ -245,10 +308,18 @@ func (lh *LoginHandle) NewThread(subj, text string, topic subs.Topic) (*entity.M
 		&entity.ZeroID,
 		lh.owner.Signer,
 		topic,
+		attachments,
+		poll,
+		references,
 	)
 }
 
-func (lh *LoginHandle) NewReply(subj, text string, parentID *entity.ID) (*entity.Message, error) {
+func (lh *LoginHandle) NewReply(
+	subj, text string,
+	parentID *entity.ID,
+	attachments []entity.Attachment,
+	references []entity.Reference,
+) (*entity.Message, error) {
 	p, err := lh.owner.Storage.GetMessage(parentID)
 	if err != nil {
 		log.Errorf("Failed to get parent message %s: %v", parentID, err)
@@ -263,31 +334,282 @@ func (lh *LoginHandle) NewReply(subj, text string, parentID *entity.ID) (*entity
 		log.Errorf("Attempt to violate the thread depth limit by replying to %s", parentID)
 		return nil, errors.MsgDepthExceeded
 	}
-	return entity.EmergeMessage(subj, text, lh.owner.User.ID(), parentID, lh.owner.Signer, nil)
+	err = lh.checkReferences(references)
+	if err != nil {
+		return nil, err
+	}
+	return entity.EmergeMessage(subj, text, lh.owner.User.ID(), parentID, lh.owner.Signer,
+		nil, attachments, nil, references)
+}
+
+// checkReferences makes sure that all the referenced messages are known, so
+// that other peers could get them from this peer.
+func (lh *LoginHandle) checkReferences(references []entity.Reference) error {
+	for i := range references {
+		has, err := lh.owner.Storage.HasMessage(&references[i].ID)
+		if err != nil {
+			log.Errorf("Failed to look for message %s: %v", references[i].ID.Shorten(), err)
+			return err
+		}
+		if !has {
+			log.Errorf("Attempt to refer to unknown message %s", references[i].ID.Shorten())
+			return errors.NoSuchEntity
+		}
+	}
+	return nil
+}
+
+// AttachFile puts the content of a file into the blob store. The resulting
+// attachment can be passed to NewThread or NewReply.
+func (lh *LoginHandle) AttachFile(name string, data []byte) (*entity.Attachment, error) {
+	if len(data) == 0 {
+		log.Errorf("Attempt to attach empty file %s", name)
+		return nil, errors.WrongArguments
+	}
+	_, err := lh.owner.Blobs.Put(data)
+	if err != nil {
+		log.Errorf("Failed to store the content of %s: %v", name, err)
+		return nil, err
+	}
+	return entity.NewAttachment(name, data), nil
+}
+
+// GetBlob returns the content of an attachment. errors.NoSuchBlob means that
+// the blob has not been downloaded yet.
+func (lh *LoginHandle) GetBlob(id *entity.ID) ([]byte, error) {
+	return lh.owner.Blobs.Get(id)
+}
+
+// HasBlob checks whether the content of an attachment is available.
+func (lh *LoginHandle) HasBlob(id *entity.ID) bool {
+	return lh.owner.Blobs.Has(id)
 }
 
 func (lh *LoginHandle) NewOperation(
 	typ entity.OperationType,
 	reason entity.OperationReason,
 	comment string,
+	replacement string,
+	dateExpires *time.Time,
 	objectID *entity.ID,
 ) (*entity.Operation, error) {
 	return entity.EmergeOperation(
 		typ,
 		reason,
 		comment,
+		replacement,
+		dateExpires,
 		lh.owner.User.ID(),
 		objectID,
 		lh.owner.Signer,
 	)
 }
 
+// NewReaction creates a reaction of the logged user to the message.
+// ReactionNone withdraws the previous reaction.
+func (lh *LoginHandle) NewReaction(kind entity.ReactionType, messageID *entity.ID) (*entity.Reaction, error) {
+	return entity.EmergeReaction(kind, lh.owner.User.ID(), messageID, lh.owner.Signer)
+}
+
+// GetReactions aggregates the reactions to the message.
+func (lh *LoginHandle) GetReactions(id *entity.ID) (*entity.ReactionSummary, error) {
+	return lh.owner.View.SummarizeReactions(id)
+}
+
+// NewVote creates a vote of the logged user for the option number choice
+// (starting from 0) of the poll. A later vote replaces the previous one.
+func (lh *LoginHandle) NewVote(choice int, pollID *entity.ID) (*entity.Vote, error) {
+	m, err := lh.owner.Storage.GetMessage(pollID)
+	if err != nil {
+		log.Errorf("Failed to get poll %s: %v", pollID.Shorten(), err)
+		return nil, err
+	}
+	if m.Poll == nil {
+		log.Errorf("Attempt to vote on message %s, which is not a poll", pollID.Shorten())
+		return nil, errors.NoSuchPoll
+	}
+	if choice < 0 || choice >= len(m.Poll.Options) {
+		log.Errorf("Attempt to vote for nonexistent option %d of poll %s", choice, pollID.Shorten())
+		return nil, errors.WrongArguments
+	}
+	if m.Poll.IsClosed(time.Now()) {
+		log.Errorf("Attempt to vote on closed poll %s", pollID.Shorten())
+		return nil, errors.PollClosed
+	}
+	return entity.EmergeVote(lh.owner.User.ID(), pollID, choice, lh.owner.Signer)
+}
+
+// GetPollTally counts the votes on the poll of the message.
+func (lh *LoginHandle) GetPollTally(m *entity.Message) (*entity.PollTally, error) {
+	return lh.owner.View.TallyPoll(m)
+}
+
+// NewPrivateMessage creates a new private message encrypted to the current key
+// of the recipient. The message is not posted.
+func (lh *LoginHandle) NewPrivateMessage(text string, recipientID *entity.ID) (*entity.PrivateMessage, error) {
+	kc, err := lh.owner.Storage.GetKeyChain(recipientID)
+	if err == errors.NoSuchEntity {
+		return nil, errors.NoSuchUser
+	} else if err != nil {
+		log.Errorf("Failed to get key chain of %s: %v", recipientID.Shorten(), err)
+		return nil, err
+	}
+	if kc.IsCompromised() {
+		return nil, errors.KeyRevoked
+	}
+	return entity.EmergePrivateMessage(
+		text,
+		lh.owner.User.ID(),
+		recipientID,
+		kc.CurrentKey(),
+		lh.owner.Signer,
+	)
+}
+
+// ListInbox returns the private messages sent to the logged user, the newest
+// first. Messages of banned users are omitted.
+func (lh *LoginHandle) ListInbox(offset, limit int) ([]*entity.PrivateMessage, error) {
+	if offset < 0 || limit < 0 {
+		return nil, errors.WrongArguments
+	}
+	mm, err := lh.owner.Storage.GetPrivateMessagesTo(lh.owner.User.ID(), offset, limit)
+	if err != nil {
+		log.Errorf("Failed to fetch private messages from the storage: %v", err)
+		return nil, err
+	}
+	var res []*entity.PrivateMessage
+	for _, m := range mm {
+		isBanned, err := lh.owner.View.IsUserBanned(&m.AuthorID)
+		if err != nil {
+			return nil, err
+		}
+		if !isBanned {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+// ReadPrivateMessage decrypts the text of the private message sent to the
+// logged user. Messages encrypted to the keys replaced by the key rotation
+// are decrypted using the retired keys kept in the user directory.
+func (lh *LoginHandle) ReadPrivateMessage(pm *entity.PrivateMessage) (string, error) {
+	return lh.owner.ReadPrivateMessage(pm)
+}
+
+// SortByScore sorts the messages by the score of the reactions to them, the
+// highest score goes first. Messages with equal scores keep their order.
+func (lh *LoginHandle) SortByScore(mm []*entity.Message) error {
+	scores := make(map[entity.ID]int)
+	for _, m := range mm {
+		rs, err := lh.owner.View.SummarizeReactions(m.ID())
+		if err != nil {
+			return err
+		}
+		scores[*m.ID()] = rs.Score
+	}
+	sort.SliceStable(mm, func(i, j int) bool {
+		return scores[*mm[i].ID()] > scores[*mm[j].ID()]
+	})
+	return nil
+}
+
+// NewUserUpdate creates a new version of the logged user's profile.
+func (lh *LoginHandle) NewUserUpdate(info string) (*entity.UserUpdate, error) {
+	var seq uint64 = 1
+	uu, err := lh.owner.Storage.GetLatestUserUpdate(lh.owner.User.ID())
+	if err == nil {
+		seq = uu.Seq + 1
+	} else if err != errors.NoSuchEntity {
+		log.Errorf("Failed to get the latest update of the logged user: %v", err)
+		return nil, err
+	}
+	return entity.EmergeUserUpdate(lh.owner.User.ID(), seq, info, lh.owner.Signer)
+}
+
+// ChangePassphrase re-encrypts the private key of the logged user. If the new
+// passphrase is empty, the key will be stored unencrypted.
+func (lh *LoginHandle) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	err := lh.owner.ChangePassphrase(oldPassphrase, newPassphrase)
+	if err != nil {
+		log.Errorf("Failed to change the passphrase: %v", err)
+		return err
+	}
+	lh.passphrase = newPassphrase
+	return nil
+}
+
+// RotateKey replaces the key of the logged user with a new one. The user is
+// logged in again in order to switch to the new key, so the connections to
+// peers are reestablished and they learn about the new key.
+func (lh *LoginHandle) RotateKey() (*entity.KeyRotation, error) {
+	kr, err := lh.owner.RotateKey()
+	if err != nil {
+		log.Errorf("Failed to rotate the key: %v", err)
+		return nil, err
+	}
+	err = lh.Relogin()
+	if err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// RevokeKey publishes the revocation certificate stored in the file. If the
+// path is empty, the certificate of the logged user's current key is used.
+func (lh *LoginHandle) RevokeKey(path string) (*entity.KeyRevocation, error) {
+	var kr *entity.KeyRevocation
+	var err error
+	if path == "" {
+		kr, err = lh.owner.LoadKeyRevocation()
+	} else {
+		kr, err = owner.ReadKeyRevocation(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	kc, err := lh.owner.Storage.GetKeyChain(&kr.UserID)
+	if err != nil {
+		log.Errorf("Failed to get key chain of %s: %v", kr.UserID.Shorten(), err)
+		return nil, err
+	}
+	key := kc.Key(kr.KeySeq)
+	if key == nil || !kr.IsSigValid(key) {
+		log.Errorf("Key revocation %s does not match any key of the user", kr.ShortID())
+		return nil, errors.WrongArguments
+	}
+	err = lh.owner.Storage.PutEntity(kr, nil)
+	if err != nil {
+		log.Errorf("Failed to put key revocation %s into the storage: %v", kr.ShortID(), err)
+		return nil, err
+	}
+	return kr, nil
+}
+
+// GetKeyChain returns the chain of keys of the user.
+func (lh *LoginHandle) GetKeyChain(id *entity.ID) (*entity.KeyChain, error) {
+	return lh.owner.Storage.GetKeyChain(id)
+}
+
 func (lh *LoginHandle) PostEntity(e entity.Entity) error {
 	return lh.owner.Storage.PutEntity(e, nil)
 }
 
+// PostMessage computes the stamp of the message in background and posts the
+// message when the stamp is found. The result of posting is sent to the
+// returned channel. Pending messages are dropped on logout.
+func (lh *LoginHandle) PostMessage(m *entity.Message) <-chan error {
+	return lh.stamper.post(m)
+}
+
+// ListPendingMessages returns the messages waiting for their stamps.
+func (lh *LoginHandle) ListPendingMessages() []*PendingMessage {
+	return lh.stamper.list()
+}
+
+// GetUser returns the latest version of the user's profile.
 func (lh *LoginHandle) GetUser(id *entity.ID) (*entity.User, error) {
-	return lh.owner.Storage.GetUser(id)
+	return lh.owner.Storage.GetProfile(id)
 }
 
 func (lh *LoginHandle) GetMessage(id *entity.ID) (*entity.Message, error) {
@@ -298,6 +620,34 @@ func (lh *LoginHandle) GetRootMessage(m *entity.Message) (*entity.Message, error
 	return lh.owner.Storage.GetRoot(m)
 }
 
+// GetReferencedMessage returns the moderated version of the message referred
+// to by the reference. errors.NoSuchEntity means that the message is unknown
+// or removed.
+func (lh *LoginHandle) GetReferencedMessage(r *entity.Reference) (*entity.Message, error) {
+	m, err := lh.owner.Storage.GetMessage(&r.ID)
+	if err != nil {
+		return nil, err
+	}
+	m, err = lh.owner.View.ModerateMessage(m)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errors.NoSuchEntity
+	}
+	return m, nil
+}
+
+// ListBacklinks returns the messages referring to the message (moderated).
+func (lh *LoginHandle) ListBacklinks(id *entity.ID) ([]*entity.Message, error) {
+	mm, err := lh.owner.Storage.GetReferringMessages(id)
+	if err != nil {
+		log.Errorf("Failed to get messages referring to %s: %v", id.Shorten(), err)
+		return nil, err
+	}
+	return lh.owner.View.ModerateMessages(mm)
+}
+
 func (lh *LoginHandle) ListOperationsOnUser(id *entity.ID) ([]*entity.Operation, error) {
 	return lh.owner.Storage.GetOperationsOnUser(id)
 }
@@ -306,6 +656,14 @@ func (lh *LoginHandle) ListOperationsOnMessage(id *entity.ID) ([]*entity.Operati
 	return lh.owner.Storage.GetOperationsOnMessage(id)
 }
 
+func (lh *LoginHandle) ListOperationsOnOperation(id *entity.ID) ([]*entity.Operation, error) {
+	return lh.owner.Storage.GetOperationsOnOperation(id)
+}
+
+func (lh *LoginHandle) GetOperation(id *entity.ID) (*entity.Operation, error) {
+	return lh.owner.Storage.GetOperation(id)
+}
+
 func (lh *LoginHandle) ListBoard(offset, limit int) ([]*entity.Message, error) {
 	if offset < 0 || limit < 0 {
 		return nil, errors.WrongArguments
@@ -322,12 +680,69 @@ func (lh *LoginHandle) ListTopic(topic subs.Topic, offset, limit int) ([]*entity
 	if offset < 0 || limit < 0 {
 		return nil, errors.WrongArguments
 	}
-	mm, err := lh.owner.Storage.GetTopicMessages(topic, offset, limit)
+	// Moderators may move threads between topics, so the effective topics
+	// are resolved before paging.
+	var res []*entity.Message
+	skipped := 0
+	for batch := 0; len(res) < limit; batch += topicBatchSize {
+		mm, err := lh.owner.Storage.GetTopicMessages(topic, batch, topicBatchSize)
+		if err != nil {
+			log.Error("Failed to get topic from the storage " + err.Error())
+			return nil, err
+		}
+		moderated, err := lh.owner.View.ModerateMessages(mm)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range moderated {
+			if !topic.ContainsTopic(m.Topic) {
+				continue
+			}
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			res = append(res, m)
+			if len(res) == limit {
+				break
+			}
+		}
+		if len(mm) < topicBatchSize {
+			break
+		}
+	}
+	return res, nil
+}
+
+// ListBoardByScore lists the threads of the topic (or all threads if the topic
+// is nil) ordered by the score of the reactions to them. All the threads are
+// scored before paging, so the page is not limited to the newest threads.
+func (lh *LoginHandle) ListBoardByScore(topic subs.Topic, offset, limit int) ([]*entity.Message, error) {
+	if offset < 0 || limit < 0 {
+		return nil, errors.WrongArguments
+	}
+	var mm []*entity.Message
+	var err error
+	if topic != nil {
+		mm, err = lh.ListTopic(topic, 0, math.MaxInt32)
+	} else {
+		mm, err = lh.ListBoard(0, math.MaxInt32)
+	}
 	if err != nil {
-		log.Error("Failed to get topic from the storage " + err.Error())
 		return nil, err
 	}
-	return lh.owner.View.ModerateMessages(mm)
+	err = lh.SortByScore(mm)
+	if err != nil {
+		return nil, err
+	}
+	if offset >= len(mm) {
+		return nil, nil
+	}
+	mm = mm[offset:]
+	if limit < len(mm) {
+		mm = mm[:limit]
+	}
+	return mm, nil
 }
 
 // TBD: add offset and limit
@@ -352,7 +767,9 @@ func (lh *LoginHandle) ListSubscriptions() subs.Subscriptions {
 	return lh.owner.Profile.GetSubscriptions()
 }
 
-func (lh *LoginHandle) AddModerator(id *entity.ID) error {
+// AddModerator makes the user a moderator of the threads in the scope (nil
+// scope means all threads).
+func (lh *LoginHandle) AddModerator(id *entity.ID, scope subs.Topic) error {
 	has, err := lh.owner.Storage.HasUser(id)
 	if err != nil {
 		log.Errorf("Failed to check if storage contains %s: %v", id.Shorten(), err)
@@ -362,15 +779,76 @@ func (lh *LoginHandle) AddModerator(id *entity.ID) error {
 		log.Errorf("Attempt to make unknown user %s a moderator", id.Shorten())
 		return errors.NoSuchUser
 	}
-	return lh.owner.Profile.PutModerator(id)
+	err = lh.owner.Profile.PutModerator(id, scope)
+	if err != nil {
+		return err
+	}
+	return lh.publishModerators()
 }
 
 func (lh *LoginHandle) RemoveModerator(id *entity.ID) error {
-	return lh.owner.Profile.RemoveModerator(id)
+	err := lh.owner.Profile.RemoveModerator(id)
+	if err != nil {
+		return err
+	}
+	return lh.publishModerators()
+}
+
+// publishModerators publishes the current list of the logged user's
+// moderators, so that other users could trust them transitively.
+func (lh *LoginHandle) publishModerators() error {
+	uid := lh.owner.User.ID()
+	var seq uint64 = 1
+	ml, err := lh.owner.Storage.GetLatestModeratorList(uid)
+	if err == nil {
+		seq = ml.Seq + 1
+	} else if err != errors.NoSuchEntity {
+		log.Errorf("Failed to get the latest moderator list of the logged user: %v", err)
+		return err
+	}
+	var mm []*entity.ID
+	for _, m := range lh.owner.Profile.GetModerators() {
+		if *m != *uid {
+			mm = append(mm, m)
+		}
+	}
+	ml, err = entity.EmergeModeratorList(uid, seq, mm, lh.owner.Signer)
+	if err != nil {
+		log.Errorf("Failed to create a new moderator list: %v", err)
+		return err
+	}
+	err = lh.owner.Storage.PutEntity(ml, nil)
+	if err != nil {
+		log.Errorf("Failed to put moderator list %s into the storage: %v", ml.ShortID(), err)
+		return err
+	}
+	return nil
+}
+
+// GetModeratorTrust returns the trust of the logged user to the user as a
+// moderator.
+func (lh *LoginHandle) GetModeratorTrust(id *entity.ID) (float64, error) {
+	return lh.owner.View.ModeratorTrust(id)
+}
+
+func (lh *LoginHandle) ListModerators() []*entity.Moderator {
+	return lh.owner.Profile.GetScopedModerators()
+}
+
+// SetQuorum sets the number of the logged user's moderators, who must agree on
+// operations of the type in order to make them effective.
+func (lh *LoginHandle) SetQuorum(t entity.OperationType, q *entity.Quorum) error {
+	return lh.owner.Profile.PutQuorum(t, q)
+}
+
+func (lh *LoginHandle) GetQuorum(t entity.OperationType) entity.Quorum {
+	return lh.owner.Profile.GetQuorum(t)
 }
 
-func (lh *LoginHandle) ListModerators() []*entity.ID {
-	return lh.owner.Profile.GetModerators()
+// CountRemovalVotes returns the number of moderators, who removed the message,
+// and the number of moderators required to hide it.
+func (lh *LoginHandle) CountRemovalVotes(m *entity.Message) (votes, required int, err error) {
+	return lh.owner.View.CountRemovalVotes(m)
 }
 
 func (lh *LoginHandle) ListUserHistory() []*entity.UserHistory {
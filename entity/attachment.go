@@ -0,0 +1,77 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"strings"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/log"
+)
+
+// Attachment refers to a file attached to a message. The content of the file
+// is a blob, which is transferred separately and identified by its hash.
+type Attachment struct {
+	Name string
+	Size int64
+	Hash ID
+}
+
+const (
+	MaxAttachmentsNum    = 4
+	MaxAttachmentNameLen = 128
+	// MaxAttachmentSize limits the size of a single blob.
+	MaxAttachmentSize int64 = 1024 * 1024
+)
+
+// NewAttachment composes an attachment referring to the data.
+func NewAttachment(name string, data []byte) *Attachment {
+	return &Attachment{
+		Name: name,
+		Size: int64(len(data)),
+		Hash: NewID(data),
+	}
+}
+
+func (a *Attachment) String() string {
+	return fmt.Sprintf("%s (%s, %d bytes)", a.Name, a.Hash.Shorten(), a.Size)
+}
+
+func (a *Attachment) isValid() bool {
+	if a.Name == "" || len(a.Name) > MaxAttachmentNameLen {
+		log.Debugf("Attachment %s has empty or too long name", a)
+		return false
+	}
+	if strings.ContainsAny(a.Name, "/\\\x00") {
+		log.Debugf("Attachment %s has forbidden characters in the name", a)
+		return false
+	}
+	if a.Size <= 0 || a.Size > MaxAttachmentSize {
+		log.Debugf("Attachment %s has unacceptable size", a)
+		return false
+	}
+	return true
+}
+
+func (a *Attachment) toCBOR() cbor.Map {
+	return cbor.Map{
+		"name": a.Name,
+		"size": a.Size,
+		"hash": a.Hash[:],
+	}
+}
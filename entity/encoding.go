@@ -0,0 +1,114 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"encoding/json"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/log"
+)
+
+// Encoding defines how entities are serialized in order to compute their IDs
+// and signatures.
+type Encoding int
+
+const (
+	// JSON encoding of the Go structs. It's not canonical, so it's kept
+	// only for verifying entities created by the earlier versions of Dscuss.
+	EncodingJSON Encoding = iota
+	// Canonical CBOR encoding of the entity fields.
+	EncodingCBOR
+)
+
+const (
+	// DefaultEncoding is used for all new entities.
+	DefaultEncoding = EncodingCBOR
+)
+
+func (e Encoding) IsValid() bool {
+	return e == EncodingJSON || e == EncodingCBOR
+}
+
+func (e Encoding) String() string {
+	switch e {
+	case EncodingJSON:
+		return "JSON"
+	case EncodingCBOR:
+		return "CBOR"
+	default:
+		return "unknown encoding"
+	}
+}
+
+// content is implemented by the contents of all entities.
+type content interface {
+	// toCBOR returns the fields of the content for the canonical encoding.
+	// Keys and types of the fields must never change, otherwise IDs and
+	// signatures of the existing entities become invalid.
+	toCBOR() cbor.Map
+}
+
+func (d *Descriptor) toCBOR() cbor.Map {
+	return cbor.Map{
+		"type": int(d.Type),
+		"id":   d.ID[:],
+		"enc":  int(d.Enc),
+	}
+}
+
+// encodeContent serializes the content of an entity for computing its ID.
+func encodeContent(enc Encoding, c content) []byte {
+	var res []byte
+	var err error
+	switch enc {
+	case EncodingJSON:
+		res, err = json.Marshal(c)
+	case EncodingCBOR:
+		res, err = cbor.Marshal(c.toCBOR())
+	default:
+		log.Debugf("Attempt to encode entity content using %s", enc)
+		return nil
+	}
+	if err != nil {
+		log.Fatalf("Can't encode entity content using %s: %v", enc, err)
+	}
+	return res
+}
+
+// encodeUnsigned serializes the unsigned part u (consisting of the descriptor
+// d and the content c) of an entity for signing.
+func encodeUnsigned(d *Descriptor, c content, u interface{}) []byte {
+	var res []byte
+	var err error
+	switch d.Enc {
+	case EncodingJSON:
+		res, err = json.Marshal(u)
+	case EncodingCBOR:
+		res, err = cbor.Marshal(cbor.Map{
+			"descriptor": d.toCBOR(),
+			"content":    c.toCBOR(),
+		})
+	default:
+		log.Debugf("Attempt to encode unsigned entity using %s", d.Enc)
+		return nil
+	}
+	if err != nil {
+		log.Fatalf("Can't encode unsigned entity using %s: %v", d.Enc, err)
+	}
+	return res
+}
@@ -33,8 +33,22 @@ const (
 	TypeUser Type = iota
 	// Some information published by a user.
 	TypeMessage
-	// An action performed on a user or a message.
+	// An action performed on a user, a message or another operation.
 	TypeOperation
+	// A new version of the user's profile.
+	TypeUserUpdate
+	// A new key of the user endorsed by the previous one.
+	TypeKeyRotation
+	// A statement declaring one of the user's keys compromised.
+	TypeKeyRevocation
+	// A response of a user to a message, like a vote.
+	TypeReaction
+	// A published list of the user's moderators.
+	TypeModeratorList
+	// A text encrypted to another user.
+	TypePrivateMessage
+	// An answer of a user to a poll.
+	TypeVote
 )
 
 type ID [32]byte
@@ -45,6 +59,7 @@ type Entity interface {
 	ID() *ID
 	ShortID() string
 	String() string
+	Encoding() Encoding
 }
 
 type EntityProvider interface {
@@ -55,6 +70,13 @@ type EntityProvider interface {
 type Descriptor struct {
 	Type Type `json:"type"`
 	ID   ID   `json:"id"`
+	// Enc is omitted for EncodingJSON in order to keep signatures of the
+	// entities created before the canonical encoding appeared.
+	Enc Encoding `json:"enc,omitempty"`
+}
+
+func (d *Descriptor) Encoding() Encoding {
+	return d.Enc
 }
 
 var ZeroID ID
@@ -0,0 +1,190 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"sort"
+	"time"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/log"
+)
+
+// KeyChain is the sequence of keys of a user. It starts with the key the user
+// was registered with and follows the rotations, which are endorsed by the
+// previous keys. A revoked key can't be rotated anymore unless the rotation was
+// stored before the revocation. Competing rotations of a key (the ones with the
+// same sequence number) mean that the key is leaked, so such key is considered
+// revoked since the second rotation was stored, and none of the rotations is
+// followed.
+type KeyChain struct {
+	user      *User
+	rotations []*KeyRotation
+	// The time each rotation was stored.
+	rotStored []time.Time
+	// The time the revocation of each key was stored, nil if the key is not
+	// revoked.
+	revoked []*time.Time
+}
+
+// KeyRotationGracePeriod limits the time entities signed by a replaced key are
+// accepted after the rotation is stored.
+const KeyRotationGracePeriod = 30 * 24 * time.Hour
+
+// NewKeyChain builds the chain of keys of the user u. Rotations and
+// revocations with invalid signatures are ignored. So are the rotations, which
+// don't continue the chain.
+func NewKeyChain(u *User, rr []*StoredKeyRotation, vv []*StoredKeyRevocation) *KeyChain {
+	kc := &KeyChain{user: u}
+	sort.SliceStable(rr, func(i, j int) bool {
+		return rr[i].Stored.Before(rr[j].Stored)
+	})
+	for {
+		seq := uint64(len(kc.rotations))
+		key := kc.Key(seq)
+		var revStored *time.Time
+		for _, v := range vv {
+			if v.R.UserID != *u.ID() || v.R.KeySeq != seq || !v.R.IsSigValid(key) {
+				continue
+			}
+			if revStored == nil || v.Stored.Before(*revStored) {
+				revStored = &v.Stored
+			}
+		}
+		var next *StoredKeyRotation
+		isForked := false
+		for _, r := range rr {
+			if r.R.UserID != *u.ID() || r.R.Seq != seq+1 || !r.R.IsSigValid(key) {
+				continue
+			}
+			if revStored != nil && !r.Stored.Before(*revStored) {
+				log.Debugf("Ignoring rotation %s of revoked key", r.R.ShortID())
+				continue
+			}
+			if next == nil {
+				next = r
+				continue
+			}
+			if *r.R.ID() != *next.R.ID() {
+				log.Debugf("Rotations %s and %s compete for key %d of %s",
+					next.R.ShortID(), r.R.ShortID(), seq, u.ID().Shorten())
+				// rr is sorted, so that's the moment the fork became
+				// known.
+				if revStored == nil || r.Stored.Before(*revStored) {
+					stored := r.Stored
+					revStored = &stored
+				}
+				isForked = true
+				break
+			}
+		}
+		kc.revoked = append(kc.revoked, revStored)
+		if next == nil || isForked {
+			break
+		}
+		kc.rotations = append(kc.rotations, next.R)
+		kc.rotStored = append(kc.rotStored, next.Stored)
+	}
+	return kc
+}
+
+func (kc *KeyChain) User() *User {
+	return kc.user
+}
+
+// Rotations returns the rotations forming the chain ordered by sequence numbers.
+func (kc *KeyChain) Rotations() []*KeyRotation {
+	res := make([]*KeyRotation, len(kc.rotations))
+	copy(res, kc.rotations)
+	return res
+}
+
+// Key returns the key with the specified sequence number or nil if the chain
+// is shorter.
+func (kc *KeyChain) Key(seq uint64) *crypto.PublicKey {
+	switch {
+	case seq == 0:
+		return &kc.user.PubKey
+	case seq <= uint64(len(kc.rotations)):
+		return &kc.rotations[seq-1].NewPubKey
+	default:
+		return nil
+	}
+}
+
+func (kc *KeyChain) CurrentSeq() uint64 {
+	return uint64(len(kc.rotations))
+}
+
+func (kc *KeyChain) CurrentKey() *crypto.PublicKey {
+	return kc.Key(kc.CurrentSeq())
+}
+
+func (kc *KeyChain) IsRevoked(seq uint64) bool {
+	return seq < uint64(len(kc.revoked)) && kc.revoked[seq] != nil
+}
+
+// IsCompromised reports whether the current key of the user is revoked. Such
+// user can't sign anything anymore.
+func (kc *KeyChain) IsCompromised() bool {
+	return kc.IsRevoked(kc.CurrentSeq())
+}
+
+// KeySeqAt returns the sequence number of the key, which was in use at the
+// time t.
+func (kc *KeyChain) KeySeqAt(t time.Time) uint64 {
+	seq := uint64(0)
+	for _, r := range kc.rotations {
+		if r.DateRotated.After(t) {
+			break
+		}
+		seq = r.Seq
+	}
+	return seq
+}
+
+// KeyAt returns the key, which was in use at the time t. Entities signed by a
+// revoked key are only accepted if the key was rotated afterwards, otherwise
+// nil is returned.
+func (kc *KeyChain) KeyAt(t time.Time) *crypto.PublicKey {
+	seq := kc.KeySeqAt(t)
+	if seq == kc.CurrentSeq() && kc.IsCompromised() {
+		return nil
+	}
+	return kc.Key(seq)
+}
+
+// KeyFor returns the key, which an entity dated t and received at the time
+// received must be signed with, or nil if the entity is not acceptable. Unlike
+// the date of an entity, the time of receipt can't be forged, so a leaked key
+// can't be used to sign backdated entities once the key is revoked. Entities
+// signed by a replaced key are only accepted during KeyRotationGracePeriod
+// after the rotation was stored.
+func (kc *KeyChain) KeyFor(t, received time.Time) *crypto.PublicKey {
+	key := kc.KeyAt(t)
+	if key == nil {
+		return nil
+	}
+	seq := kc.KeySeqAt(t)
+	if rev := kc.revoked[seq]; rev != nil && !received.Before(*rev) {
+		return nil
+	}
+	if seq < kc.CurrentSeq() && received.After(kc.rotStored[seq].Add(KeyRotationGracePeriod)) {
+		return nil
+	}
+	return key
+}
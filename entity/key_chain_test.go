@@ -0,0 +1,223 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"testing"
+	"time"
+	"vminko.org/dscuss/crypto"
+)
+
+type testKey struct {
+	priv   *crypto.PrivateKey
+	signer *crypto.Signer
+}
+
+func newTestKey(t *testing.T) *testKey {
+	priv, err := crypto.NewPrivateKey(crypto.DefaultAlgorithm)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return &testKey{priv: priv, signer: crypto.NewSigner(priv)}
+}
+
+func newTestUser(t *testing.T, k *testKey) *User {
+	pow := crypto.NewPowFinder(k.priv.Public().EncodeToDER(), 1)
+	u, err := EmergeUser("Tester", "", pow.Find(), 1, k.signer)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return u
+}
+
+func newTestRotation(t *testing.T, u *User, seq uint64, next, prev *testKey, date time.Time) *KeyRotation {
+	ukr := newUnsignedKeyRotation(u.ID(), seq, next.priv.Public(), date, DefaultEncoding)
+	sig, err := prev.signer.Sign(ukr.encode())
+	if err != nil {
+		t.Fatalf("Failed to sign key rotation: %v", err)
+	}
+	return &KeyRotation{UnsignedKeyRotation: *ukr, Sig: sig}
+}
+
+func newTestRevocation(t *testing.T, u *User, seq uint64, k *testKey) *KeyRevocation {
+	kr, err := EmergeKeyRevocation(u.ID(), seq, k.signer)
+	if err != nil {
+		t.Fatalf("Failed to create key revocation: %v", err)
+	}
+	return kr
+}
+
+func TestKeyChain(t *testing.T) {
+	k0, k1, k2 := newTestKey(t), newTestKey(t), newTestKey(t)
+	u := newTestUser(t, k0)
+	rotated := u.RegDate.Add(time.Hour)
+	before := rotated.Add(-time.Minute)
+	after := rotated.Add(time.Minute)
+	stored := time.Now()
+	rot1 := newTestRotation(t, u, 1, k1, k0, rotated)
+	rot1b := newTestRotation(t, u, 1, k2, k0, rotated)
+	rev0 := newTestRevocation(t, u, 0, k0)
+	rev1 := newTestRevocation(t, u, 1, k1)
+	key0, key1 := k0.priv.Public(), k1.priv.Public()
+
+	tests := []struct {
+		name      string
+		rr        []*StoredKeyRotation
+		vv        []*StoredKeyRevocation
+		date      time.Time
+		received  time.Time
+		keyAt     *crypto.PublicKey
+		keyFor    *crypto.PublicKey
+		isRevoked bool
+	}{
+		{
+			name:     "registration key",
+			date:     after,
+			received: stored,
+			keyAt:    key0,
+			keyFor:   key0,
+		},
+		{
+			name:     "before rotation",
+			rr:       []*StoredKeyRotation{{rot1, stored}},
+			date:     before,
+			received: stored.Add(time.Hour),
+			keyAt:    key0,
+			keyFor:   key0,
+		},
+		{
+			name:     "after rotation",
+			rr:       []*StoredKeyRotation{{rot1, stored}},
+			date:     after,
+			received: stored.Add(time.Hour),
+			keyAt:    key1,
+			keyFor:   key1,
+		},
+		{
+			name:     "replaced key after grace period",
+			rr:       []*StoredKeyRotation{{rot1, stored}},
+			date:     before,
+			received: stored.Add(KeyRotationGracePeriod + time.Hour),
+			keyAt:    key0,
+			keyFor:   nil,
+		},
+		{
+			name:      "revoked current key",
+			vv:        []*StoredKeyRevocation{{rev0, stored}},
+			date:      before,
+			received:  stored.Add(-time.Hour),
+			keyAt:     nil,
+			keyFor:    nil,
+			isRevoked: true,
+		},
+		{
+			name:     "revoked key received before revocation",
+			rr:       []*StoredKeyRotation{{rot1, stored}},
+			vv:       []*StoredKeyRevocation{{rev0, stored.Add(time.Hour)}},
+			date:     before,
+			received: stored.Add(time.Minute),
+			keyAt:    key0,
+			keyFor:   key0,
+		},
+		{
+			name:     "backdated entity signed by revoked key",
+			rr:       []*StoredKeyRotation{{rot1, stored}},
+			vv:       []*StoredKeyRevocation{{rev0, stored.Add(time.Hour)}},
+			date:     before,
+			received: stored.Add(2 * time.Hour),
+			keyAt:    key0,
+			keyFor:   nil,
+		},
+		{
+			name:      "rotation stored after revocation",
+			rr:        []*StoredKeyRotation{{rot1, stored.Add(time.Hour)}},
+			vv:        []*StoredKeyRevocation{{rev0, stored}},
+			date:      after,
+			received:  stored.Add(-time.Hour),
+			keyAt:     nil,
+			keyFor:    nil,
+			isRevoked: true,
+		},
+		{
+			name:      "revoked rotated key",
+			rr:        []*StoredKeyRotation{{rot1, stored}},
+			vv:        []*StoredKeyRevocation{{rev1, stored}},
+			date:      after,
+			received:  stored.Add(-time.Minute),
+			keyAt:     nil,
+			keyFor:    nil,
+			isRevoked: true,
+		},
+		{
+			name: "competing rotations",
+			rr: []*StoredKeyRotation{
+				{rot1, stored},
+				{rot1b, stored.Add(time.Hour)},
+			},
+			date:      after,
+			received:  stored.Add(time.Minute),
+			keyAt:     nil,
+			keyFor:    nil,
+			isRevoked: true,
+		},
+		{
+			name: "competing rotations stored in other order",
+			rr: []*StoredKeyRotation{
+				{rot1b, stored.Add(time.Hour)},
+				{rot1, stored},
+			},
+			date:      before,
+			received:  stored.Add(time.Minute),
+			keyAt:     nil,
+			keyFor:    nil,
+			isRevoked: true,
+		},
+		{
+			name: "duplicate rotation",
+			rr: []*StoredKeyRotation{
+				{rot1, stored},
+				{rot1, stored.Add(time.Hour)},
+			},
+			date:     after,
+			received: stored.Add(time.Minute),
+			keyAt:    key1,
+			keyFor:   key1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := NewKeyChain(u, tt.rr, tt.vv)
+			if got := kc.KeyAt(tt.date); !isSameKey(got, tt.keyAt) {
+				t.Errorf("KeyAt() returned unexpected key")
+			}
+			if got := kc.KeyFor(tt.date, tt.received); !isSameKey(got, tt.keyFor) {
+				t.Errorf("KeyFor() returned unexpected key")
+			}
+			if got := kc.IsCompromised(); got != tt.isRevoked {
+				t.Errorf("IsCompromised() = %v, want %v", got, tt.isRevoked)
+			}
+		})
+	}
+}
+
+func isSameKey(a, b *crypto.PublicKey) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return string(a.EncodeToDER()) == string(b.EncodeToDER())
+}
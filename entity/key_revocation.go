@@ -0,0 +1,188 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"time"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// KeyRevocation declares one of the user's keys compromised. It's signed by
+// the revoked key itself, so it can be generated in advance (for instance,
+// during registration) and published later, when the key is lost or stolen.
+// Implements Entity interface.
+type KeyRevocation struct {
+	UnsignedKeyRevocation
+	Sig crypto.Signature
+}
+
+type UnsignedKeyRevocation struct {
+	Descriptor
+	KeyRevocationContent
+}
+
+type KeyRevocationContent struct {
+	UserID      ID
+	KeySeq      uint64
+	DateCreated time.Time
+}
+
+type StoredKeyRevocation struct {
+	R      *KeyRevocation
+	Stored time.Time
+}
+
+func (ukr *UnsignedKeyRevocation) ShortID() string {
+	return ukr.Descriptor.ID.Shorten()
+}
+
+func (ukr *UnsignedKeyRevocation) Type() Type {
+	return ukr.Descriptor.Type
+}
+
+func (ukr *UnsignedKeyRevocation) ID() *ID {
+	return &ukr.Descriptor.ID
+}
+
+func (ukr *UnsignedKeyRevocation) String() string {
+	return fmt.Sprintf("%s (%s revoked key version %d)",
+		ukr.ShortID(), ukr.UserID.Shorten(), ukr.KeySeq)
+}
+
+func (ukr *UnsignedKeyRevocation) isValid() bool {
+	if !ukr.Enc.IsValid() {
+		log.Debugf("Key revocation %s has unknown encoding", ukr)
+		return false
+	}
+	correctID := ukr.KeyRevocationContent.ToID(ukr.Enc)
+	if ukr.Descriptor.ID != *correctID {
+		log.Debugf("Key revocation %s has invalid ID", ukr)
+		return false
+	}
+	if ukr.UserID.IsZero() {
+		log.Debugf("Key revocation %s has empty user ID", ukr)
+		return false
+	}
+	if ukr.DateCreated.Before(Epoch) {
+		log.Debugf("Key revocation %s was created before the Dscuss Epoch", ukr)
+		return false
+	}
+	return true
+}
+
+func (ukr *UnsignedKeyRevocation) encode() []byte {
+	return encodeUnsigned(&ukr.Descriptor, &ukr.KeyRevocationContent, ukr)
+}
+
+func (kr *KeyRevocation) IsUnsignedPartValid() bool {
+	return kr.UnsignedKeyRevocation.isValid()
+}
+
+// IsSigValid checks the signature against the revoked key.
+func (kr *KeyRevocation) IsSigValid(revokedKey *crypto.PublicKey) bool {
+	res := revokedKey.Verify(kr.encode(), kr.Sig)
+	if !res {
+		log.Debugf("Key revocation %s has invalid signature", kr)
+	}
+	return res
+}
+
+func (kr *KeyRevocation) IsValid(revokedKey *crypto.PublicKey) bool {
+	return kr.IsUnsignedPartValid() && kr.IsSigValid(revokedKey)
+}
+
+// EmergeKeyRevocation creates a new key revocation entity. It should only be
+// called when signature is not known yet. Signature will be created using the
+// provided signer, which must hold the key being revoked.
+func EmergeKeyRevocation(
+	userID *ID,
+	keySeq uint64,
+	signer *crypto.Signer,
+) (*KeyRevocation, error) {
+	ukr := newUnsignedKeyRevocation(userID, keySeq, time.Now(), DefaultEncoding)
+	if !ukr.isValid() {
+		return nil, errors.WrongArguments
+	}
+	sig, err := signer.Sign(ukr.encode())
+	if err != nil {
+		log.Fatal("Can't sign encoded KeyRevocation entity: " + err.Error())
+	}
+	return &KeyRevocation{UnsignedKeyRevocation: *ukr, Sig: sig}, nil
+}
+
+// NewKeyRevocation composes a new key revocation entity object from the
+// specified data.
+func NewKeyRevocation(
+	userID *ID,
+	keySeq uint64,
+	dateCreated time.Time,
+	sig crypto.Signature,
+	enc Encoding,
+) (*KeyRevocation, error) {
+	ukr := newUnsignedKeyRevocation(userID, keySeq, dateCreated, enc)
+	if !ukr.isValid() {
+		return nil, errors.WrongArguments
+	}
+	return &KeyRevocation{UnsignedKeyRevocation: *ukr, Sig: sig}, nil
+}
+
+func newKeyRevocationContent(
+	userID *ID,
+	keySeq uint64,
+	dateCreated time.Time,
+) *KeyRevocationContent {
+	return &KeyRevocationContent{
+		UserID:      *userID,
+		KeySeq:      keySeq,
+		DateCreated: dateCreated,
+	}
+}
+
+func (krc *KeyRevocationContent) ToID(enc Encoding) *ID {
+	id := NewID(encodeContent(enc, krc))
+	return &id
+}
+
+func (krc *KeyRevocationContent) toCBOR() cbor.Map {
+	return cbor.Map{
+		"user_id":      krc.UserID[:],
+		"key_seq":      krc.KeySeq,
+		"date_created": krc.DateCreated,
+	}
+}
+
+func newUnsignedKeyRevocation(
+	userID *ID,
+	keySeq uint64,
+	dateCreated time.Time,
+	enc Encoding,
+) *UnsignedKeyRevocation {
+	krc := newKeyRevocationContent(userID, keySeq, dateCreated)
+	return &UnsignedKeyRevocation{
+		Descriptor: Descriptor{
+			Type: TypeKeyRevocation,
+			ID:   *krc.ToID(enc),
+			Enc:  enc,
+		},
+		KeyRevocationContent: *krc,
+	}
+}
@@ -0,0 +1,201 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"time"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// KeyRotation replaces the current key of the user with a new one. It's signed
+// by the key being replaced, so the ID of the user is preserved. Rotations of
+// the same user form a chain ordered by sequence numbers. The rotation with
+// sequence number N replaces the key number N-1 (the key number 0 is the one
+// the user was registered with).
+// Implements Entity interface.
+type KeyRotation struct {
+	UnsignedKeyRotation
+	Sig crypto.Signature
+}
+
+type UnsignedKeyRotation struct {
+	Descriptor
+	KeyRotationContent
+}
+
+type KeyRotationContent struct {
+	UserID      ID
+	Seq         uint64
+	NewPubKey   crypto.PublicKey
+	DateRotated time.Time
+}
+
+type StoredKeyRotation struct {
+	R      *KeyRotation
+	Stored time.Time
+}
+
+func (ukr *UnsignedKeyRotation) ShortID() string {
+	return ukr.Descriptor.ID.Shorten()
+}
+
+func (ukr *UnsignedKeyRotation) Type() Type {
+	return ukr.Descriptor.Type
+}
+
+func (ukr *UnsignedKeyRotation) ID() *ID {
+	return &ukr.Descriptor.ID
+}
+
+func (ukr *UnsignedKeyRotation) String() string {
+	return fmt.Sprintf("%s (%s rotated key to version %d)",
+		ukr.ShortID(), ukr.UserID.Shorten(), ukr.Seq)
+}
+
+func (ukr *UnsignedKeyRotation) isValid() bool {
+	if !ukr.Enc.IsValid() {
+		log.Debugf("Key rotation %s has unknown encoding", ukr)
+		return false
+	}
+	correctID := ukr.KeyRotationContent.ToID(ukr.Enc)
+	if ukr.Descriptor.ID != *correctID {
+		log.Debugf("Key rotation %s has invalid ID", ukr)
+		return false
+	}
+	if ukr.UserID.IsZero() {
+		log.Debugf("Key rotation %s has empty user ID", ukr)
+		return false
+	}
+	if ukr.Seq == 0 {
+		log.Debugf("Key rotation %s has zero sequence number", ukr)
+		return false
+	}
+	if ukr.DateRotated.Before(Epoch) {
+		log.Debugf("Key rotation %s was performed before the Dscuss Epoch", ukr)
+		return false
+	}
+	return true
+}
+
+func (ukr *UnsignedKeyRotation) encode() []byte {
+	return encodeUnsigned(&ukr.Descriptor, &ukr.KeyRotationContent, ukr)
+}
+
+func (kr *KeyRotation) IsUnsignedPartValid() bool {
+	return kr.UnsignedKeyRotation.isValid()
+}
+
+// IsSigValid checks the signature against the key being replaced.
+func (kr *KeyRotation) IsSigValid(prevKey *crypto.PublicKey) bool {
+	res := prevKey.Verify(kr.encode(), kr.Sig)
+	if !res {
+		log.Debugf("Key rotation %s has invalid signature", kr)
+	}
+	return res
+}
+
+func (kr *KeyRotation) IsValid(prevKey *crypto.PublicKey) bool {
+	return kr.IsUnsignedPartValid() && kr.IsSigValid(prevKey)
+}
+
+// EmergeKeyRotation creates a new key rotation entity. It should only be
+// called when signature is not known yet. Signature will be created using the
+// provided signer, which must hold the key being replaced.
+func EmergeKeyRotation(
+	userID *ID,
+	seq uint64,
+	newPubKey *crypto.PublicKey,
+	signer *crypto.Signer,
+) (*KeyRotation, error) {
+	ukr := newUnsignedKeyRotation(userID, seq, newPubKey, time.Now(), DefaultEncoding)
+	if !ukr.isValid() {
+		return nil, errors.WrongArguments
+	}
+	sig, err := signer.Sign(ukr.encode())
+	if err != nil {
+		log.Fatal("Can't sign encoded KeyRotation entity: " + err.Error())
+	}
+	return &KeyRotation{UnsignedKeyRotation: *ukr, Sig: sig}, nil
+}
+
+// NewKeyRotation composes a new key rotation entity object from the specified
+// data.
+func NewKeyRotation(
+	userID *ID,
+	seq uint64,
+	newPubKey *crypto.PublicKey,
+	dateRotated time.Time,
+	sig crypto.Signature,
+	enc Encoding,
+) (*KeyRotation, error) {
+	ukr := newUnsignedKeyRotation(userID, seq, newPubKey, dateRotated, enc)
+	if !ukr.isValid() {
+		return nil, errors.WrongArguments
+	}
+	return &KeyRotation{UnsignedKeyRotation: *ukr, Sig: sig}, nil
+}
+
+func newKeyRotationContent(
+	userID *ID,
+	seq uint64,
+	newPubKey *crypto.PublicKey,
+	dateRotated time.Time,
+) *KeyRotationContent {
+	return &KeyRotationContent{
+		UserID:      *userID,
+		Seq:         seq,
+		NewPubKey:   *newPubKey,
+		DateRotated: dateRotated,
+	}
+}
+
+func (krc *KeyRotationContent) ToID(enc Encoding) *ID {
+	id := NewID(encodeContent(enc, krc))
+	return &id
+}
+
+func (krc *KeyRotationContent) toCBOR() cbor.Map {
+	return cbor.Map{
+		"user_id":      krc.UserID[:],
+		"seq":          krc.Seq,
+		"new_pub_key":  krc.NewPubKey.EncodeToDER(),
+		"date_rotated": krc.DateRotated,
+	}
+}
+
+func newUnsignedKeyRotation(
+	userID *ID,
+	seq uint64,
+	newPubKey *crypto.PublicKey,
+	dateRotated time.Time,
+	enc Encoding,
+) *UnsignedKeyRotation {
+	krc := newKeyRotationContent(userID, seq, newPubKey, dateRotated)
+	return &UnsignedKeyRotation{
+		Descriptor: Descriptor{
+			Type: TypeKeyRotation,
+			ID:   *krc.ToID(enc),
+			Enc:  enc,
+		},
+		KeyRotationContent: *krc,
+	}
+}
@@ -18,10 +18,10 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package entity
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
+	"vminko.org/dscuss/cbor"
 	"vminko.org/dscuss/crypto"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
@@ -33,6 +33,9 @@ import (
 type Message struct {
 	UnsignedMessage
 	Sig crypto.Signature
+	// Stamp is an optional hashcash stamp over the ID of the message. It's
+	// not signed, because it's bound to the ID anyway.
+	Stamp crypto.Stamp `json:",omitempty"`
 }
 
 type UnsignedMessage struct {
@@ -48,6 +51,10 @@ type MessageContent struct {
 	ParentID    ID
 	DateWritten time.Time
 	Topic       subs.Topic
+	Attachments []Attachment `json:",omitempty"`
+	// Poll is nil for regular messages.
+	Poll       *Poll       `json:",omitempty"`
+	References []Reference `json:",omitempty"`
 }
 
 type StoredMessage struct {
@@ -57,9 +64,13 @@ type StoredMessage struct {
 
 const (
 	MaxMessageSubjectLen = 128
-	MaxMessageTextLen    = 1024
+	MaxMessageTextLen    = 64 * 1024
 	MaxMessageDepth      = 1024
 	MinMessagePostDelay  = 1 * time.Minute
+	// MaxShortMessageTextLen is the limit of the text length used by the
+	// earlier versions of Dscuss. Longer texts are not allowed in the legacy
+	// encoding.
+	MaxShortMessageTextLen = 1024
 )
 
 var lastMsgTimestamp time.Time
@@ -73,6 +84,9 @@ func EmergeMessage(
 	parentID *ID,
 	signer *crypto.Signer,
 	topic subs.Topic,
+	attachments []Attachment,
+	poll *Poll,
+	references []Reference,
 ) (*Message, error) {
 	if time.Since(lastMsgTimestamp) < MinMessagePostDelay {
 		log.Errorf("Attempt to create a message violating the limit of the message post rate")
@@ -80,17 +94,14 @@ func EmergeMessage(
 	} else {
 		lastMsgTimestamp = time.Now()
 	}
-	um := newUnsignedMessage(subject, text, authorID, parentID, time.Now(), topic)
+	um := newUnsignedMessage(subject, text, authorID, parentID, time.Now(),
+		topic, attachments, poll, references, DefaultEncoding)
 	if !um.isValid() {
 		return nil, errors.WrongArguments
 	}
-	jmsg, err := json.Marshal(um)
+	sig, err := signer.Sign(um.encode())
 	if err != nil {
-		log.Fatal("Can't marshal unsigned Message: " + err.Error())
-	}
-	sig, err := signer.Sign(jmsg)
-	if err != nil {
-		log.Fatal("Can't sign JSON-encoded Message entity: " + err.Error())
+		log.Fatal("Can't sign encoded Message entity: " + err.Error())
 	}
 	return &Message{UnsignedMessage: *um, Sig: sig}, nil
 }
@@ -104,8 +115,13 @@ func NewMessage(
 	dateWritten time.Time,
 	sig crypto.Signature,
 	topic subs.Topic,
+	attachments []Attachment,
+	poll *Poll,
+	references []Reference,
+	enc Encoding,
 ) (*Message, error) {
-	um := newUnsignedMessage(subject, text, authorID, parentID, dateWritten, topic)
+	um := newUnsignedMessage(subject, text, authorID, parentID, dateWritten,
+		topic, attachments, poll, references, enc)
 	if !um.isValid() {
 		return nil, errors.WrongArguments
 	}
@@ -117,6 +133,15 @@ func (m *Message) Copy() *Message {
 	if m.Topic != nil {
 		res.Topic = m.Topic.Copy()
 	}
+	if m.Attachments != nil {
+		res.Attachments = append([]Attachment(nil), m.Attachments...)
+	}
+	if m.Poll != nil {
+		res.Poll = m.Poll.copy()
+	}
+	if m.References != nil {
+		res.References = append([]Reference(nil), m.References...)
+	}
 	return &res
 }
 
@@ -138,7 +163,11 @@ func (um *UnsignedMessage) String() string {
 }
 
 func (um *UnsignedMessage) isValid() bool {
-	correctID := um.MessageContent.ToID()
+	if !um.Enc.IsValid() {
+		log.Debugf("Message %s has unknown encoding", um)
+		return false
+	}
+	correctID := um.MessageContent.ToID(um.Enc)
 	if um.Descriptor.ID != *correctID {
 		log.Debugf("Message %s has invalid ID", um)
 		return false
@@ -151,6 +180,10 @@ func (um *UnsignedMessage) isValid() bool {
 		log.Debugf("Message %s has too long text (%d)", um, len(um.Text))
 		return false
 	}
+	if len(um.Text) > MaxShortMessageTextLen && um.Enc == EncodingJSON {
+		log.Debugf("Message %s has long text, but uses legacy encoding", um)
+		return false
+	}
 	if um.Subject == "" || um.Text == "" {
 		log.Debugf("Message %s has empty subject or text", um)
 		return false
@@ -163,19 +196,60 @@ func (um *UnsignedMessage) isValid() bool {
 		log.Debugf("Message %s is a reply with non-nil topic", um)
 		return false
 	}
+	if len(um.Attachments) > MaxAttachmentsNum {
+		log.Debugf("Message %s has too many attachments (%d)", um, len(um.Attachments))
+		return false
+	}
+	if len(um.Attachments) != 0 && um.Enc == EncodingJSON {
+		log.Debugf("Message %s has attachments, but uses legacy encoding", um)
+		return false
+	}
+	for i := range um.Attachments {
+		if !um.Attachments[i].isValid() {
+			return false
+		}
+	}
+	if um.Poll != nil {
+		if um.Enc == EncodingJSON {
+			log.Debugf("Message %s has a poll, but uses legacy encoding", um)
+			return false
+		}
+		if !um.Poll.isValid(um.DateWritten) {
+			return false
+		}
+	}
+	if len(um.References) > MaxReferencesNum {
+		log.Debugf("Message %s has too many references (%d)", um, len(um.References))
+		return false
+	}
+	if len(um.References) != 0 && um.Enc == EncodingJSON {
+		log.Debugf("Message %s has references, but uses legacy encoding", um)
+		return false
+	}
+	for i := range um.References {
+		if !um.References[i].isValid() {
+			return false
+		}
+		for j := 0; j < i; j++ {
+			if um.References[j].ID == um.References[i].ID {
+				log.Debugf("Message %s refers to %s twice", um, um.References[i].ID.Shorten())
+				return false
+			}
+		}
+	}
 	return true
 }
 
+func (um *UnsignedMessage) encode() []byte {
+	return encodeUnsigned(&um.Descriptor, &um.MessageContent, um)
+}
+
 func (m *Message) IsUnsignedPartValid() bool {
 	return m.UnsignedMessage.isValid()
 }
 
 func (m *Message) IsSigValid(pubKey *crypto.PublicKey) bool {
-	jmsg, err := json.Marshal(&m.UnsignedMessage)
-	if err != nil {
-		log.Fatal("Can't marshal UnsignedMessage: " + err.Error())
-	}
-	res := pubKey.Verify(jmsg, m.Sig)
+	res := pubKey.Verify(m.encode(), m.Sig)
 	if !res {
 		log.Debugf("Message %s has invalid signature", m)
 	}
@@ -186,6 +260,11 @@ func (m *Message) IsValid(pubKey *crypto.PublicKey) bool {
 	return m.IsUnsignedPartValid() && m.IsSigValid(pubKey)
 }
 
+// StampBits returns the difficulty of the message stamp.
+func (m *Message) StampBits() int {
+	return m.Stamp.Bits(m.ID()[:])
+}
+
 func (m *Message) IsReply() bool {
 	return !m.ParentID.IsZero()
 }
@@ -197,6 +276,9 @@ func newMessageContent(
 	parentID *ID,
 	dateWritten time.Time,
 	topic subs.Topic,
+	attachments []Attachment,
+	poll *Poll,
+	references []Reference,
 ) *MessageContent {
 	mc := &MessageContent{
 		Subject:     subject,
@@ -208,18 +290,54 @@ func newMessageContent(
 	if topic != nil {
 		mc.Topic = topic.Copy()
 	}
+	if len(attachments) != 0 {
+		mc.Attachments = append([]Attachment(nil), attachments...)
+	}
+	if poll != nil {
+		mc.Poll = poll.copy()
+	}
+	if len(references) != 0 {
+		mc.References = append([]Reference(nil), references...)
+	}
 	return mc
 }
 
-func (mc *MessageContent) ToID() *ID {
-	jmc, err := json.Marshal(mc)
-	if err != nil {
-		log.Fatal("Can't marshal MessageContent: " + err.Error())
-	}
-	id := NewID(jmc)
+func (mc *MessageContent) ToID(enc Encoding) *ID {
+	id := NewID(encodeContent(enc, mc))
 	return &id
 }
 
+func (mc *MessageContent) toCBOR() cbor.Map {
+	m := cbor.Map{
+		"subject":      mc.Subject,
+		"text":         mc.Text,
+		"author_id":    mc.AuthorID[:],
+		"parent_id":    mc.ParentID[:],
+		"date_written": mc.DateWritten,
+	}
+	if mc.Topic != nil {
+		m["topic"] = []string(mc.Topic)
+	}
+	if len(mc.Attachments) != 0 {
+		aa := make(cbor.Array, len(mc.Attachments))
+		for i := range mc.Attachments {
+			aa[i] = mc.Attachments[i].toCBOR()
+		}
+		m["attachments"] = aa
+	}
+	if mc.Poll != nil {
+		m["poll"] = mc.Poll.toCBOR()
+	}
+	if len(mc.References) != 0 {
+		rr := make(cbor.Array, len(mc.References))
+		for i := range mc.References {
+			rr[i] = mc.References[i].toCBOR()
+		}
+		m["references"] = rr
+	}
+	return m
+}
+
 func newUnsignedMessage(
 	subject string,
 	text string,
@@ -227,12 +345,18 @@ func newUnsignedMessage(
 	parentID *ID,
 	dateWritten time.Time,
 	topic subs.Topic,
+	attachments []Attachment,
+	poll *Poll,
+	references []Reference,
+	enc Encoding,
 ) *UnsignedMessage {
-	mc := newMessageContent(subject, text, authorID, parentID, dateWritten, topic)
+	mc := newMessageContent(subject, text, authorID, parentID, dateWritten,
+		topic, attachments, poll, references)
 	return &UnsignedMessage{
 		Descriptor: Descriptor{
 			Type: TypeMessage,
-			ID:   *mc.ToID(),
+			ID:   *mc.ToID(enc),
+			Enc:  enc,
 		},
 		MessageContent: *mc,
 	}
@@ -0,0 +1,249 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"time"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+	"vminko.org/dscuss/subs"
+)
+
+// ModeratorList is the published list of the user's moderators. It allows
+// other users to trust moderators of their moderators. The list with the
+// highest sequence number wins.
+// Implements Entity interface.
+type ModeratorList struct {
+	UnsignedModeratorList
+	Sig crypto.Signature
+}
+
+type UnsignedModeratorList struct {
+	Descriptor
+	ModeratorListContent
+}
+
+type ModeratorListContent struct {
+	UserID      ID
+	Seq         uint64
+	Moderators  []ID
+	DateUpdated time.Time
+}
+
+// Moderator is a user chosen by the owner to moderate content. Operations of
+// the moderator on messages are only applied to the threads in Scope. Nil
+// scope means all threads.
+type Moderator struct {
+	ID    ID
+	Scope subs.Topic
+}
+
+// Covers checks whether the moderator is allowed to moderate threads in the
+// topic.
+func (m *Moderator) Covers(topic subs.Topic) bool {
+	return m.Scope == nil || m.Scope.ContainsTopic(topic)
+}
+
+type StoredModeratorList struct {
+	L      *ModeratorList
+	Stored time.Time
+}
+
+const (
+	MaxModeratorsNum int = 256
+)
+
+func (uml *UnsignedModeratorList) ShortID() string {
+	return uml.Descriptor.ID.Shorten()
+}
+
+func (uml *UnsignedModeratorList) Type() Type {
+	return uml.Descriptor.Type
+}
+
+func (uml *UnsignedModeratorList) ID() *ID {
+	return &uml.Descriptor.ID
+}
+
+func (uml *UnsignedModeratorList) String() string {
+	return fmt.Sprintf("%s (%s has %d moderator(s) in version %d)",
+		uml.ShortID(), uml.UserID.Shorten(), len(uml.Moderators), uml.Seq)
+}
+
+// HasModerator checks whether the user is in the list.
+func (uml *UnsignedModeratorList) HasModerator(id *ID) bool {
+	for i := range uml.Moderators {
+		if uml.Moderators[i] == *id {
+			return true
+		}
+	}
+	return false
+}
+
+func (uml *UnsignedModeratorList) isValid() bool {
+	// Moderator lists appeared after the canonical encoding.
+	if uml.Enc != EncodingCBOR {
+		log.Debugf("Moderator list %s has unsupported encoding", uml)
+		return false
+	}
+	correctID := uml.ModeratorListContent.ToID(uml.Enc)
+	if uml.Descriptor.ID != *correctID {
+		log.Debugf("Moderator list %s has invalid ID", uml)
+		return false
+	}
+	if uml.UserID.IsZero() {
+		log.Debugf("Moderator list %s has empty user ID", uml)
+		return false
+	}
+	if uml.Seq == 0 {
+		log.Debugf("Moderator list %s has zero sequence number", uml)
+		return false
+	}
+	if len(uml.Moderators) > MaxModeratorsNum {
+		log.Debugf("Moderator list %s is too long", uml)
+		return false
+	}
+	seen := make(map[ID]bool)
+	for i := range uml.Moderators {
+		m := &uml.Moderators[i]
+		if m.IsZero() || *m == uml.UserID || seen[*m] {
+			log.Debugf("Moderator list %s has invalid moderator %s", uml, m.Shorten())
+			return false
+		}
+		seen[*m] = true
+	}
+	if uml.DateUpdated.Before(Epoch) {
+		log.Debugf("Moderator list %s was updated before the Dscuss Epoch", uml)
+		return false
+	}
+	return true
+}
+
+func (uml *UnsignedModeratorList) encode() []byte {
+	return encodeUnsigned(&uml.Descriptor, &uml.ModeratorListContent, uml)
+}
+
+func (ml *ModeratorList) IsUnsignedPartValid() bool {
+	return ml.UnsignedModeratorList.isValid()
+}
+
+func (ml *ModeratorList) IsSigValid(pubKey *crypto.PublicKey) bool {
+	res := pubKey.Verify(ml.encode(), ml.Sig)
+	if !res {
+		log.Debugf("Moderator list %s has invalid signature", ml)
+	}
+	return res
+}
+
+func (ml *ModeratorList) IsValid(pubKey *crypto.PublicKey) bool {
+	return ml.IsUnsignedPartValid() && ml.IsSigValid(pubKey)
+}
+
+// EmergeModeratorList creates a new moderator list entity. It should only be
+// called when signature is not known yet. Signature will be created using the
+// provided signer.
+func EmergeModeratorList(
+	userID *ID,
+	seq uint64,
+	moderators []*ID,
+	signer *crypto.Signer,
+) (*ModeratorList, error) {
+	uml := newUnsignedModeratorList(userID, seq, moderators, time.Now(), DefaultEncoding)
+	if !uml.isValid() {
+		return nil, errors.WrongArguments
+	}
+	sig, err := signer.Sign(uml.encode())
+	if err != nil {
+		log.Fatal("Can't sign encoded ModeratorList entity: " + err.Error())
+	}
+	return &ModeratorList{UnsignedModeratorList: *uml, Sig: sig}, nil
+}
+
+// NewModeratorList composes a new moderator list entity object from the
+// specified data.
+func NewModeratorList(
+	userID *ID,
+	seq uint64,
+	moderators []*ID,
+	dateUpdated time.Time,
+	sig crypto.Signature,
+	enc Encoding,
+) (*ModeratorList, error) {
+	uml := newUnsignedModeratorList(userID, seq, moderators, dateUpdated, enc)
+	if !uml.isValid() {
+		return nil, errors.WrongArguments
+	}
+	return &ModeratorList{UnsignedModeratorList: *uml, Sig: sig}, nil
+}
+
+func newModeratorListContent(
+	userID *ID,
+	seq uint64,
+	moderators []*ID,
+	dateUpdated time.Time,
+) *ModeratorListContent {
+	mm := make([]ID, len(moderators))
+	for i, m := range moderators {
+		mm[i] = *m
+	}
+	return &ModeratorListContent{
+		UserID:      *userID,
+		Seq:         seq,
+		Moderators:  mm,
+		DateUpdated: dateUpdated,
+	}
+}
+
+func (mlc *ModeratorListContent) ToID(enc Encoding) *ID {
+	id := NewID(encodeContent(enc, mlc))
+	return &id
+}
+
+func (mlc *ModeratorListContent) toCBOR() cbor.Map {
+	mm := make(cbor.Array, len(mlc.Moderators))
+	for i := range mlc.Moderators {
+		mm[i] = mlc.Moderators[i][:]
+	}
+	return cbor.Map{
+		"user_id":      mlc.UserID[:],
+		"seq":          mlc.Seq,
+		"moderators":   mm,
+		"date_updated": mlc.DateUpdated,
+	}
+}
+
+func newUnsignedModeratorList(
+	userID *ID,
+	seq uint64,
+	moderators []*ID,
+	dateUpdated time.Time,
+	enc Encoding,
+) *UnsignedModeratorList {
+	mlc := newModeratorListContent(userID, seq, moderators, dateUpdated)
+	return &UnsignedModeratorList{
+		Descriptor: Descriptor{
+			Type: TypeModeratorList,
+			ID:   *mlc.ToID(enc),
+			Enc:  enc,
+		},
+		ModeratorListContent: *mlc,
+	}
+}
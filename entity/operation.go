@@ -18,12 +18,13 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package entity
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
+	"vminko.org/dscuss/cbor"
 	"vminko.org/dscuss/crypto"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
+	"vminko.org/dscuss/subs"
 )
 
 type OperationType int
@@ -32,15 +33,21 @@ type OperationReason int
 const (
 	OperationTypeRemoveMessage OperationType = iota
 	OperationTypeBanUser
-	// TBD: OperationTypeBanUserTemporarily
-	// TBD: OperationTypeEditMessageTopic
-	// TBD: OperationTypeEditMessageSubject
-	// TBD: OperationTypeEditMessageText
+	OperationTypeEditMessageTopic
+	OperationTypeEditMessageSubject
+	OperationTypeEditMessageText
+	OperationTypeBanUserTemporarily
+	OperationTypeRevokeOperation
 )
 
 const (
-	OperationTypeRemoveMessageStr string = "RemoveMessage"
-	OperationTypeBanUserStr       string = "BanUser"
+	OperationTypeRemoveMessageStr      string = "RemoveMessage"
+	OperationTypeBanUserStr            string = "BanUser"
+	OperationTypeEditMessageTopicStr   string = "EditMessageTopic"
+	OperationTypeEditMessageSubjectStr string = "EditMessageSubject"
+	OperationTypeEditMessageTextStr    string = "EditMessageText"
+	OperationTypeBanUserTemporarilyStr string = "BanUserTemporarily"
+	OperationTypeRevokeOperationStr    string = "RevokeOperation"
 )
 
 const (
@@ -49,6 +56,7 @@ const (
 	OperationReasonOfftopic
 	OperationReasonAbuse
 	OperationReasonDuplicate
+	OperationReasonMistake
 )
 
 const (
@@ -57,6 +65,7 @@ const (
 	OperationReasonOfftopicStr          string = "Offtopic"
 	OperationReasonAbuseStr             string = "Abuse"
 	OperationReasonDuplicateStr         string = "Duplicate"
+	OperationReasonMistakeStr           string = "Mistake"
 )
 
 const (
@@ -66,7 +75,7 @@ const (
 
 var lastOperTimestamp time.Time
 
-// Operation is an action performed on a user or a message.
+// Operation is an action performed on a user, a message or another operation.
 type Operation struct {
 	UnsignedOperation
 	Sig crypto.Signature
@@ -84,6 +93,13 @@ type OperationContent struct {
 	AuthorID      ID
 	ObjectID      ID
 	DatePerformed time.Time
+	// Replacement is the new content for the edit-message operations.
+	// It's omitted when empty in order to keep IDs and signatures of
+	// the operations created before the edit-message operations appeared.
+	Replacement string `json:",omitempty"`
+	// DateExpires is the date when the temporary ban expires. It's nil for
+	// all other types of operations.
+	DateExpires *time.Time `json:",omitempty"`
 }
 
 type StoredOperation struct {
@@ -97,11 +113,69 @@ func (ot OperationType) String() string {
 		return OperationTypeRemoveMessageStr
 	case OperationTypeBanUser:
 		return OperationTypeBanUserStr
+	case OperationTypeEditMessageTopic:
+		return OperationTypeEditMessageTopicStr
+	case OperationTypeEditMessageSubject:
+		return OperationTypeEditMessageSubjectStr
+	case OperationTypeEditMessageText:
+		return OperationTypeEditMessageTextStr
+	case OperationTypeBanUserTemporarily:
+		return OperationTypeBanUserTemporarilyStr
+	case OperationTypeRevokeOperation:
+		return OperationTypeRevokeOperationStr
 	default:
 		return "unknown operation type"
 	}
 }
 
+func (ot *OperationType) ParseString(s string) error {
+	switch s {
+	case OperationTypeRemoveMessageStr:
+		*ot = OperationTypeRemoveMessage
+	case OperationTypeBanUserStr:
+		*ot = OperationTypeBanUser
+	case OperationTypeEditMessageTopicStr:
+		*ot = OperationTypeEditMessageTopic
+	case OperationTypeEditMessageSubjectStr:
+		*ot = OperationTypeEditMessageSubject
+	case OperationTypeEditMessageTextStr:
+		*ot = OperationTypeEditMessageText
+	case OperationTypeBanUserTemporarilyStr:
+		*ot = OperationTypeBanUserTemporarily
+	case OperationTypeRevokeOperationStr:
+		*ot = OperationTypeRevokeOperation
+	default:
+		return errors.Parsing
+	}
+	return nil
+}
+
+// ObjectType returns type of the entities which operations of this type can
+// be performed on.
+func (ot OperationType) ObjectType() Type {
+	switch ot {
+	case OperationTypeBanUser, OperationTypeBanUserTemporarily:
+		return TypeUser
+	case OperationTypeRevokeOperation:
+		return TypeOperation
+	default:
+		return TypeMessage
+	}
+}
+
+// IsUserBanning reports whether the operation type bans the target user
+// permanently or temporarily.
+func (ot OperationType) IsUserBanning() bool {
+	return ot == OperationTypeBanUser || ot == OperationTypeBanUserTemporarily
+}
+
+// IsMessageEditing reports whether the operation type replaces a part of
+// the target message.
+func (ot OperationType) IsMessageEditing() bool {
+	return ot == OperationTypeEditMessageTopic || ot == OperationTypeEditMessageSubject ||
+		ot == OperationTypeEditMessageText
+}
+
 func (or OperationReason) String() string {
 	switch or {
 	case OperationReasonProtocolViolation:
@@ -114,6 +188,8 @@ func (or OperationReason) String() string {
 		return OperationReasonAbuseStr
 	case OperationReasonDuplicate:
 		return OperationReasonDuplicateStr
+	case OperationReasonMistake:
+		return OperationReasonMistakeStr
 	default:
 		return "unknown operation reason"
 	}
@@ -131,6 +207,8 @@ func (or *OperationReason) ParseString(s string) error {
 		*or = OperationReasonAbuse
 	case OperationReasonDuplicateStr:
 		*or = OperationReasonDuplicate
+	case OperationReasonMistakeStr:
+		*or = OperationReasonMistake
 	default:
 		return errors.Parsing
 	}
@@ -160,19 +238,30 @@ func (uo *UnsignedOperation) String() string {
 }
 
 func (uo *UnsignedOperation) isValid() bool {
-	correctID := uo.OperationContent.ToID()
+	if !uo.Enc.IsValid() {
+		log.Debugf("Operation %s has unknown encoding", uo)
+		return false
+	}
+	correctID := uo.OperationContent.ToID(uo.Enc)
 	if uo.Descriptor.ID != *correctID {
 		log.Debugf("Operation %s has invalid ID", uo)
 		return false
 	}
-	t := uo.OperationContent.Type
-	if t != OperationTypeRemoveMessage && t != OperationTypeBanUser {
-		log.Debugf("Operation %s has invalid type %d", uo, t)
+	if !uo.isReplacementValid() {
+		return false
+	}
+	isTemporary := uo.OperationContent.Type == OperationTypeBanUserTemporarily
+	if isTemporary != (uo.DateExpires != nil) {
+		log.Debugf("Operation %s has unexpected or missing expiry date", uo)
+		return false
+	}
+	if isTemporary && !uo.DateExpires.After(uo.DatePerformed) {
+		log.Debugf("Operation %s expires before it's performed", uo)
 		return false
 	}
 	isReasonOK := uo.Reason == OperationReasonSpam || uo.Reason == OperationReasonOfftopic ||
 		uo.Reason == OperationReasonAbuse || uo.Reason == OperationReasonDuplicate ||
-		uo.Reason == OperationReasonProtocolViolation
+		uo.Reason == OperationReasonProtocolViolation || uo.Reason == OperationReasonMistake
 	if !isReasonOK {
 		log.Debugf("Operation %s has invalid reason %d", uo, uo.Reason)
 		return false
@@ -188,16 +277,51 @@ func (uo *UnsignedOperation) isValid() bool {
 	return true
 }
 
+func (uo *UnsignedOperation) isReplacementValid() bool {
+	switch uo.OperationContent.Type {
+	case OperationTypeRemoveMessage, OperationTypeBanUser, OperationTypeBanUserTemporarily,
+		OperationTypeRevokeOperation:
+		if uo.Replacement != "" {
+			log.Debugf("Operation %s has unexpected replacement", uo)
+			return false
+		}
+	case OperationTypeEditMessageTopic:
+		t, err := subs.NewTopic(uo.Replacement)
+		if err != nil || t == nil {
+			log.Debugf("Operation %s has invalid replacement topic", uo)
+			return false
+		}
+	case OperationTypeEditMessageSubject:
+		if uo.Replacement == "" || len(uo.Replacement) > MaxMessageSubjectLen {
+			log.Debugf("Operation %s has empty or too long replacement subject", uo)
+			return false
+		}
+	case OperationTypeEditMessageText:
+		if uo.Replacement == "" || len(uo.Replacement) > MaxMessageTextLen {
+			log.Debugf("Operation %s has empty or too long replacement text", uo)
+			return false
+		}
+		if len(uo.Replacement) > MaxShortMessageTextLen && uo.Enc == EncodingJSON {
+			log.Debugf("Operation %s has long replacement text, but uses legacy encoding", uo)
+			return false
+		}
+	default:
+		log.Debugf("Operation %s has invalid type %d", uo, uo.OperationContent.Type)
+		return false
+	}
+	return true
+}
+
+func (uo *UnsignedOperation) encode() []byte {
+	return encodeUnsigned(&uo.Descriptor, &uo.OperationContent, uo)
+}
+
 func (o *Operation) IsUnsignedPartValid() bool {
 	return o.UnsignedOperation.isValid()
 }
 
 func (o *Operation) IsSigValid(pubKey *crypto.PublicKey) bool {
-	jop, err := json.Marshal(&o.UnsignedOperation)
-	if err != nil {
-		log.Fatal("Can't marshal UnsignedOperation: " + err.Error())
-	}
-	res := pubKey.Verify(jop, o.Sig)
+	res := pubKey.Verify(o.encode(), o.Sig)
 	if !res {
 		log.Debugf("Operation %s has invalid signature", o)
 	}
@@ -216,6 +340,8 @@ func EmergeOperation(
 	typ OperationType,
 	reason OperationReason,
 	comment string,
+	replacement string,
+	dateExpires *time.Time,
 	authorID *ID,
 	objectID *ID,
 	signer *crypto.Signer,
@@ -226,17 +352,15 @@ func EmergeOperation(
 	} else {
 		lastOperTimestamp = time.Now()
 	}
-	uo := newUnsignedOperation(typ, reason, comment, authorID, objectID, time.Now())
+	uo := newUnsignedOperation(
+		typ, reason, comment, replacement, dateExpires, authorID, objectID, time.Now(),
+		DefaultEncoding)
 	if !uo.isValid() {
 		return nil, errors.WrongArguments
 	}
-	joper, err := json.Marshal(uo)
-	if err != nil {
-		log.Fatal("Can't marshal unsigned Operation: " + err.Error())
-	}
-	sig, err := signer.Sign(joper)
+	sig, err := signer.Sign(uo.encode())
 	if err != nil {
-		log.Fatal("Can't sign JSON-encoded Operation entity: " + err.Error())
+		log.Fatal("Can't sign encoded Operation entity: " + err.Error())
 	}
 	return &Operation{UnsignedOperation: *uo, Sig: sig}, nil
 }
@@ -246,12 +370,16 @@ func NewOperation(
 	typ OperationType,
 	reason OperationReason,
 	comment string,
+	replacement string,
+	dateExpires *time.Time,
 	authorID *ID,
 	objectID *ID,
 	datePerformed time.Time,
 	sig crypto.Signature,
+	enc Encoding,
 ) (*Operation, error) {
-	uo := newUnsignedOperation(typ, reason, comment, authorID, objectID, datePerformed)
+	uo := newUnsignedOperation(
+		typ, reason, comment, replacement, dateExpires, authorID, objectID, datePerformed, enc)
 	if !uo.isValid() {
 		return nil, errors.WrongArguments
 	}
@@ -262,6 +390,8 @@ func newOperationContent(
 	typ OperationType,
 	reason OperationReason,
 	comment string,
+	replacement string,
+	dateExpires *time.Time,
 	authorID *ID,
 	objectID *ID,
 	datePerformed time.Time,
@@ -273,31 +403,52 @@ func newOperationContent(
 		AuthorID:      *authorID,
 		ObjectID:      *objectID,
 		DatePerformed: datePerformed,
+		Replacement:   replacement,
+		DateExpires:   dateExpires,
 	}
 }
 
-func (oc *OperationContent) ToID() *ID {
-	joc, err := json.Marshal(oc)
-	if err != nil {
-		log.Fatal("Can't marshal OperationContent: " + err.Error())
-	}
-	id := NewID(joc)
+func (oc *OperationContent) ToID(enc Encoding) *ID {
+	id := NewID(encodeContent(enc, oc))
 	return &id
 }
 
+func (oc *OperationContent) toCBOR() cbor.Map {
+	m := cbor.Map{
+		"type":           int(oc.Type),
+		"reason":         int(oc.Reason),
+		"comment":        oc.Comment,
+		"author_id":      oc.AuthorID[:],
+		"object_id":      oc.ObjectID[:],
+		"date_performed": oc.DatePerformed,
+	}
+	if oc.Replacement != "" {
+		m["replacement"] = oc.Replacement
+	}
+	if oc.DateExpires != nil {
+		m["date_expires"] = *oc.DateExpires
+	}
+	return m
+}
+
 func newUnsignedOperation(
 	typ OperationType,
 	reason OperationReason,
 	comment string,
+	replacement string,
+	dateExpires *time.Time,
 	authorID *ID,
 	objectID *ID,
 	datePerformed time.Time,
+	enc Encoding,
 ) *UnsignedOperation {
-	oc := newOperationContent(typ, reason, comment, authorID, objectID, datePerformed)
+	oc := newOperationContent(
+		typ, reason, comment, replacement, dateExpires, authorID, objectID, datePerformed)
 	return &UnsignedOperation{
 		Descriptor: Descriptor{
 			Type: TypeOperation,
-			ID:   *oc.ToID(),
+			ID:   *oc.ToID(enc),
+			Enc:  enc,
 		},
 		OperationContent: *oc,
 	}
@@ -0,0 +1,133 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/log"
+)
+
+// Poll turns a message into a question with a fixed set of options. Users
+// answer polls by publishing votes. Votes published after the poll closes are
+// ignored.
+type Poll struct {
+	Options    []string
+	DateCloses time.Time
+}
+
+const (
+	MinPollOptionsNum  = 2
+	MaxPollOptionsNum  = 16
+	MaxPollOptionLen   = 128
+	MaxPollDuration    = 365 * 24 * time.Hour
+	DefaultPollTimeout = 7 * 24 * time.Hour
+	// PollVoteGracePeriod is the time votes published before the poll
+	// closes are accepted after closing, so that they could reach all the
+	// nodes. It also limits backdating votes after closing.
+	PollVoteGracePeriod = 3 * 24 * time.Hour
+)
+
+func (p *Poll) String() string {
+	return fmt.Sprintf("poll with %d options closing at %s",
+		len(p.Options), p.DateCloses.Format(time.RFC3339))
+}
+
+// IsClosed checks whether the poll is closed at the time t.
+func (p *Poll) IsClosed(t time.Time) bool {
+	return t.After(p.DateCloses)
+}
+
+// IsAccepting checks whether a vote dated dateVoted and received at the time
+// received is acceptable (see PollVoteGracePeriod).
+func (p *Poll) IsAccepting(dateVoted, received time.Time) bool {
+	return !p.IsClosed(dateVoted) && !received.After(p.DateCloses.Add(PollVoteGracePeriod))
+}
+
+func (p *Poll) isValid(dateWritten time.Time) bool {
+	if len(p.Options) < MinPollOptionsNum || len(p.Options) > MaxPollOptionsNum {
+		log.Debugf("The %s has wrong number of options", p)
+		return false
+	}
+	seen := make(map[string]bool)
+	for _, o := range p.Options {
+		if o == "" || len(o) > MaxPollOptionLen || seen[o] {
+			log.Debugf("The %s has empty, too long or duplicate option", p)
+			return false
+		}
+		seen[o] = true
+	}
+	if !p.DateCloses.After(dateWritten) || p.DateCloses.Sub(dateWritten) > MaxPollDuration {
+		log.Debugf("The %s has unacceptable closing date", p)
+		return false
+	}
+	return true
+}
+
+func (p *Poll) copy() *Poll {
+	res := *p
+	res.Options = append([]string(nil), p.Options...)
+	return &res
+}
+
+func (p *Poll) toCBOR() cbor.Map {
+	return cbor.Map{
+		"options":     p.Options,
+		"date_closes": p.DateCloses,
+	}
+}
+
+// PollTally is the number of effective votes for each option of a poll.
+type PollTally struct {
+	Counts []int
+	Total  int
+}
+
+// TallyVotes counts the votes for the poll taking only the latest vote of
+// each user into account (votes of the same date are ordered by IDs). Votes
+// dated after the poll closed and votes for nonexistent options are ignored.
+// The tally doesn't depend on the time the votes were received, so that all
+// the nodes having the same votes get the same result. Late votes are rejected
+// on receipt (see IsAccepting).
+func TallyVotes(p *Poll, vv []*Vote) *PollTally {
+	latest := make(map[ID]*Vote)
+	for _, v := range vv {
+		if p.IsClosed(v.DateVoted) || v.Choice < 0 || v.Choice >= len(p.Options) {
+			continue
+		}
+		l, ok := latest[v.AuthorID]
+		if !ok || isVoteLater(v, l) {
+			latest[v.AuthorID] = v
+		}
+	}
+	res := &PollTally{Counts: make([]int, len(p.Options))}
+	for _, v := range latest {
+		res.Counts[v.Choice]++
+		res.Total++
+	}
+	return res
+}
+
+func isVoteLater(v, than *Vote) bool {
+	if !v.DateVoted.Equal(than.DateVoted) {
+		return v.DateVoted.After(than.DateVoted)
+	}
+	return bytes.Compare(v.ID()[:], than.ID()[:]) > 0
+}
@@ -0,0 +1,136 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"testing"
+	"time"
+	"vminko.org/dscuss/crypto"
+)
+
+func newTestVote(t *testing.T, author *ID, choice int, date time.Time) *Vote {
+	pid := ID{9}
+	v, err := NewVote(author, &pid, choice, date, crypto.Signature{}, DefaultEncoding)
+	if err != nil {
+		t.Fatalf("Failed to create vote: %v", err)
+	}
+	return v
+}
+
+func TestTallyVotes(t *testing.T) {
+	closes := time.Now().Truncate(time.Second)
+	p := &Poll{Options: []string{"yes", "no"}, DateCloses: closes}
+	early, late := closes.Add(-time.Hour), closes.Add(time.Hour)
+	alice, bob := &ID{1}, &ID{2}
+
+	v1 := newTestVote(t, alice, 0, early)
+	v2 := newTestVote(t, alice, 1, early)
+	tie := []int{0, 0}
+	if isVoteLater(v2, v1) {
+		tie[1]++
+	} else {
+		tie[0]++
+	}
+
+	tests := []struct {
+		name   string
+		vv     []*Vote
+		counts []int
+	}{
+		{
+			"latest vote of each user",
+			[]*Vote{
+				newTestVote(t, alice, 0, early),
+				newTestVote(t, alice, 1, early.Add(time.Minute)),
+				newTestVote(t, bob, 1, early),
+			},
+			[]int{0, 2},
+		},
+		{
+			"vote dated after closing",
+			[]*Vote{
+				newTestVote(t, alice, 0, early),
+				newTestVote(t, alice, 1, late),
+			},
+			[]int{1, 0},
+		},
+		{
+			"nonexistent option",
+			[]*Vote{
+				newTestVote(t, alice, 5, early),
+			},
+			[]int{0, 0},
+		},
+		{
+			"latest vote for nonexistent option",
+			[]*Vote{
+				newTestVote(t, alice, 1, early),
+				newTestVote(t, alice, 5, early.Add(time.Minute)),
+			},
+			[]int{0, 1},
+		},
+		{
+			"same date in any order",
+			[]*Vote{v1, v2},
+			tie,
+		},
+		{
+			"same date in reverse order",
+			[]*Vote{v2, v1},
+			tie,
+		},
+	}
+	for _, test := range tests {
+		pt := TallyVotes(p, test.vv)
+		total := 0
+		for i, c := range test.counts {
+			if pt.Counts[i] != c {
+				t.Errorf("%s: expected counts %v, got %v", test.name, test.counts, pt.Counts)
+				break
+			}
+			total += c
+		}
+		if pt.Total != total {
+			t.Errorf("%s: expected total %d, got %d", test.name, total, pt.Total)
+		}
+	}
+}
+
+func TestPollIsAccepting(t *testing.T) {
+	closes := time.Now().Truncate(time.Second)
+	p := &Poll{Options: []string{"yes", "no"}, DateCloses: closes}
+	early, late := closes.Add(-time.Hour), closes.Add(time.Hour)
+	tooLate := closes.Add(PollVoteGracePeriod + time.Hour)
+
+	tests := []struct {
+		name      string
+		dateVoted time.Time
+		received  time.Time
+		accepted  bool
+	}{
+		{"received before closing", early, early, true},
+		{"received within grace period", early, late, true},
+		{"received after grace period", early, tooLate, false},
+		{"dated after closing", late, late, false},
+	}
+	for _, test := range tests {
+		if res := p.IsAccepting(test.dateVoted, test.received); res != test.accepted {
+			t.Errorf("%s: expected %t, got %t", test.name, test.accepted, res)
+		}
+	}
+}
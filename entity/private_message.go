@@ -0,0 +1,239 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// PrivateMessage is a text sent by one user to another one. The text is
+// encrypted to the recipient's public key, so only the IDs of the author and
+// the recipient are public. Peers forward private messages regardless of
+// their subscriptions.
+// Implements Entity interface.
+type PrivateMessage struct {
+	UnsignedPrivateMessage
+	Sig crypto.Signature
+}
+
+type UnsignedPrivateMessage struct {
+	Descriptor
+	PrivateMessageContent
+}
+
+type PrivateMessageContent struct {
+	AuthorID    ID
+	RecipientID ID
+	// Ciphertext is the text encrypted by PublicKey.Encrypt with the IDs of
+	// the author and the recipient as the additional data.
+	Ciphertext  []byte
+	DateWritten time.Time
+}
+
+type StoredPrivateMessage struct {
+	M      *PrivateMessage
+	Stored time.Time
+}
+
+const (
+	MaxPrivateMessageTextLen int = 4096
+	// maxCiphertextOverhead covers the ephemeral key, the nonce and the
+	// authentication tag.
+	maxCiphertextOverhead int = 128
+)
+
+func (upm *UnsignedPrivateMessage) ShortID() string {
+	return upm.Descriptor.ID.Shorten()
+}
+
+func (upm *UnsignedPrivateMessage) Type() Type {
+	return upm.Descriptor.Type
+}
+
+func (upm *UnsignedPrivateMessage) ID() *ID {
+	return &upm.Descriptor.ID
+}
+
+func (upm *UnsignedPrivateMessage) String() string {
+	return fmt.Sprintf("%s (private message from %s to %s)",
+		upm.ShortID(), upm.AuthorID.Shorten(), upm.RecipientID.Shorten())
+}
+
+func (upm *UnsignedPrivateMessage) isValid() bool {
+	// Private messages appeared after the canonical encoding.
+	if upm.Enc != EncodingCBOR {
+		log.Debugf("Private message %s has unsupported encoding", upm)
+		return false
+	}
+	correctID := upm.PrivateMessageContent.ToID(upm.Enc)
+	if upm.Descriptor.ID != *correctID {
+		log.Debugf("Private message %s has invalid ID", upm)
+		return false
+	}
+	if upm.AuthorID.IsZero() || upm.RecipientID.IsZero() {
+		log.Debugf("Private message %s has empty author or recipient", upm)
+		return false
+	}
+	if upm.AuthorID == upm.RecipientID {
+		log.Debugf("Private message %s is sent to its author", upm)
+		return false
+	}
+	if len(upm.Ciphertext) == 0 ||
+		len(upm.Ciphertext) > MaxPrivateMessageTextLen+maxCiphertextOverhead {
+		log.Debugf("Private message %s has ciphertext of wrong length", upm)
+		return false
+	}
+	if upm.DateWritten.Before(Epoch) {
+		log.Debugf("Private message %s was written before the Dscuss Epoch", upm)
+		return false
+	}
+	return true
+}
+
+func (upm *UnsignedPrivateMessage) encode() []byte {
+	return encodeUnsigned(&upm.Descriptor, &upm.PrivateMessageContent, upm)
+}
+
+func (pm *PrivateMessage) IsUnsignedPartValid() bool {
+	return pm.UnsignedPrivateMessage.isValid()
+}
+
+func (pm *PrivateMessage) IsSigValid(pubKey *crypto.PublicKey) bool {
+	res := pubKey.Verify(pm.encode(), pm.Sig)
+	if !res {
+		log.Debugf("Private message %s has invalid signature", pm)
+	}
+	return res
+}
+
+func (pm *PrivateMessage) IsValid(pubKey *crypto.PublicKey) bool {
+	return pm.IsUnsignedPartValid() && pm.IsSigValid(pubKey)
+}
+
+// Decrypt returns the text of the message. It's only possible for the
+// recipient.
+func (pm *PrivateMessage) Decrypt(signer *crypto.Signer) (string, error) {
+	text, err := signer.Decrypt(pm.Ciphertext, privateMessageAD(&pm.AuthorID, &pm.RecipientID))
+	if err != nil {
+		log.Debugf("Can't decrypt private message %s: %v", pm, err)
+		return "", err
+	}
+	return string(text), nil
+}
+
+func privateMessageAD(authorID, recipientID *ID) []byte {
+	return append(append([]byte{}, authorID[:]...), recipientID[:]...)
+}
+
+// EmergePrivateMessage encrypts the text to the recipient's key and creates a
+// new private message. It should only be called when signature is not known
+// yet. Signature will be created using the provided signer.
+func EmergePrivateMessage(
+	text string,
+	authorID *ID,
+	recipientID *ID,
+	recipientKey *crypto.PublicKey,
+	signer *crypto.Signer,
+) (*PrivateMessage, error) {
+	if text == "" || len(text) > MaxPrivateMessageTextLen || !utf8.ValidString(text) {
+		return nil, errors.WrongArguments
+	}
+	ct, err := recipientKey.Encrypt([]byte(text), privateMessageAD(authorID, recipientID))
+	if err != nil {
+		log.Errorf("Can't encrypt private message: %v", err)
+		return nil, err
+	}
+	upm := newUnsignedPrivateMessage(authorID, recipientID, ct, time.Now(), DefaultEncoding)
+	if !upm.isValid() {
+		return nil, errors.WrongArguments
+	}
+	sig, err := signer.Sign(upm.encode())
+	if err != nil {
+		log.Fatal("Can't sign encoded PrivateMessage entity: " + err.Error())
+	}
+	return &PrivateMessage{UnsignedPrivateMessage: *upm, Sig: sig}, nil
+}
+
+// NewPrivateMessage composes a new private message entity object from the
+// specified data.
+func NewPrivateMessage(
+	authorID *ID,
+	recipientID *ID,
+	ciphertext []byte,
+	dateWritten time.Time,
+	sig crypto.Signature,
+	enc Encoding,
+) (*PrivateMessage, error) {
+	upm := newUnsignedPrivateMessage(authorID, recipientID, ciphertext, dateWritten, enc)
+	if !upm.isValid() {
+		return nil, errors.WrongArguments
+	}
+	return &PrivateMessage{UnsignedPrivateMessage: *upm, Sig: sig}, nil
+}
+
+func newPrivateMessageContent(
+	authorID *ID,
+	recipientID *ID,
+	ciphertext []byte,
+	dateWritten time.Time,
+) *PrivateMessageContent {
+	return &PrivateMessageContent{
+		AuthorID:    *authorID,
+		RecipientID: *recipientID,
+		Ciphertext:  ciphertext,
+		DateWritten: dateWritten,
+	}
+}
+
+func (pmc *PrivateMessageContent) ToID(enc Encoding) *ID {
+	id := NewID(encodeContent(enc, pmc))
+	return &id
+}
+
+func (pmc *PrivateMessageContent) toCBOR() cbor.Map {
+	return cbor.Map{
+		"author_id":    pmc.AuthorID[:],
+		"recipient_id": pmc.RecipientID[:],
+		"ciphertext":   pmc.Ciphertext,
+		"date_written": pmc.DateWritten,
+	}
+}
+
+func newUnsignedPrivateMessage(
+	authorID *ID,
+	recipientID *ID,
+	ciphertext []byte,
+	dateWritten time.Time,
+	enc Encoding,
+) *UnsignedPrivateMessage {
+	pmc := newPrivateMessageContent(authorID, recipientID, ciphertext, dateWritten)
+	return &UnsignedPrivateMessage{
+		Descriptor: Descriptor{
+			Type: TypePrivateMessage,
+			ID:   *pmc.ToID(enc),
+			Enc:  enc,
+		},
+		PrivateMessageContent: *pmc,
+	}
+}
@@ -0,0 +1,102 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"vminko.org/dscuss/errors"
+)
+
+// Quorum defines how many of the owner's moderators must agree on an
+// operation in order to make it effective. It's either an absolute number of
+// moderators or a percentage of all the owner's moderators, whichever is
+// greater. Quorums are personal settings of the owner, they are not
+// published.
+type Quorum struct {
+	Count   int
+	Percent int
+}
+
+// QuorumOperationTypes lists the types of operations which may require
+// agreement of several moderators. Revocations require the agreement for the
+// revoked operations.
+var QuorumOperationTypes = []OperationType{
+	OperationTypeRemoveMessage,
+	OperationTypeBanUser,
+	OperationTypeBanUserTemporarily,
+	OperationTypeEditMessageTopic,
+	OperationTypeEditMessageSubject,
+	OperationTypeEditMessageText,
+}
+
+// DefaultQuorum makes an operation effective when any moderator performs it.
+var DefaultQuorum = Quorum{Count: 1}
+
+// Required returns the number of agreeing moderators required when the owner
+// has moderatorsNum moderators.
+func (q *Quorum) Required(moderatorsNum int) int {
+	res := q.Count
+	byPercent := (q.Percent*moderatorsNum + 99) / 100
+	if byPercent > res {
+		res = byPercent
+	}
+	if res < 1 {
+		res = 1
+	}
+	return res
+}
+
+func (q *Quorum) IsValid() bool {
+	return q.Count >= 0 && q.Percent >= 0 && q.Percent <= 100 && (q.Count > 0 || q.Percent > 0)
+}
+
+func (q *Quorum) String() string {
+	switch {
+	case q.Percent == 0:
+		return strconv.Itoa(q.Count)
+	case q.Count == 0:
+		return fmt.Sprintf("%d%%", q.Percent)
+	default:
+		return fmt.Sprintf("%d,%d%%", q.Count, q.Percent)
+	}
+}
+
+// ParseString parses quorums like "2", "50%" or "2,50%" (2 moderators, but
+// not less than 50% of them).
+func (q *Quorum) ParseString(s string) error {
+	var res Quorum
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		var err error
+		if strings.HasSuffix(p, "%") {
+			res.Percent, err = strconv.Atoi(strings.TrimSuffix(p, "%"))
+		} else {
+			res.Count, err = strconv.Atoi(p)
+		}
+		if err != nil {
+			return errors.Parsing
+		}
+	}
+	if !res.IsValid() {
+		return errors.Parsing
+	}
+	*q = res
+	return nil
+}
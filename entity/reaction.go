@@ -0,0 +1,328 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"time"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+type ReactionType int
+
+const (
+	// ReactionNone withdraws the previous reaction of the user.
+	ReactionNone ReactionType = iota
+	ReactionUp
+	ReactionDown
+	ReactionHeart
+	ReactionLaugh
+	ReactionWow
+)
+
+const (
+	ReactionNoneStr  string = "none"
+	ReactionUpStr    string = "up"
+	ReactionDownStr  string = "down"
+	ReactionHeartStr string = "heart"
+	ReactionLaughStr string = "laugh"
+	ReactionWowStr   string = "wow"
+)
+
+// ReactionTypes lists all reactions users can show, in the order they are
+// displayed.
+var ReactionTypes = []ReactionType{
+	ReactionUp, ReactionDown, ReactionHeart, ReactionLaugh, ReactionWow,
+}
+
+// Reaction is a lightweight response of a user to a message, like a vote.
+// Only the latest reaction of the user to a message is effective.
+// Implements Entity interface.
+type Reaction struct {
+	UnsignedReaction
+	Sig crypto.Signature
+}
+
+type UnsignedReaction struct {
+	Descriptor
+	ReactionContent
+}
+
+type ReactionContent struct {
+	Kind        ReactionType
+	AuthorID    ID
+	MessageID   ID
+	DateReacted time.Time
+}
+
+type StoredReaction struct {
+	R      *Reaction
+	Stored time.Time
+}
+
+func (rt ReactionType) String() string {
+	switch rt {
+	case ReactionNone:
+		return ReactionNoneStr
+	case ReactionUp:
+		return ReactionUpStr
+	case ReactionDown:
+		return ReactionDownStr
+	case ReactionHeart:
+		return ReactionHeartStr
+	case ReactionLaugh:
+		return ReactionLaughStr
+	case ReactionWow:
+		return ReactionWowStr
+	default:
+		return "unknown reaction type"
+	}
+}
+
+func (rt *ReactionType) ParseString(s string) error {
+	switch s {
+	case ReactionNoneStr:
+		*rt = ReactionNone
+	case ReactionUpStr:
+		*rt = ReactionUp
+	case ReactionDownStr:
+		*rt = ReactionDown
+	case ReactionHeartStr:
+		*rt = ReactionHeart
+	case ReactionLaughStr:
+		*rt = ReactionLaugh
+	case ReactionWowStr:
+		*rt = ReactionWow
+	default:
+		return errors.Parsing
+	}
+	return nil
+}
+
+// Symbol returns the emoji representing the reaction.
+func (rt ReactionType) Symbol() string {
+	switch rt {
+	case ReactionUp:
+		return "\U0001F44D"
+	case ReactionDown:
+		return "\U0001F44E"
+	case ReactionHeart:
+		return "❤"
+	case ReactionLaugh:
+		return "\U0001F604"
+	case ReactionWow:
+		return "\U0001F62E"
+	default:
+		return ""
+	}
+}
+
+// Score returns the contribution of the reaction to the score of the message.
+func (rt ReactionType) Score() int {
+	switch rt {
+	case ReactionUp:
+		return 1
+	case ReactionDown:
+		return -1
+	default:
+		return 0
+	}
+}
+
+func (rt ReactionType) IsValid() bool {
+	return rt >= ReactionNone && rt <= ReactionWow
+}
+
+func (ur *UnsignedReaction) ShortID() string {
+	return ur.Descriptor.ID.Shorten()
+}
+
+func (ur *UnsignedReaction) Type() Type {
+	return ur.Descriptor.Type
+}
+
+func (ur *UnsignedReaction) ID() *ID {
+	return &ur.Descriptor.ID
+}
+
+func (ur *UnsignedReaction) String() string {
+	return fmt.Sprintf("%s (%s reacted '%s' to %s)",
+		ur.ShortID(), ur.AuthorID.Shorten(), ur.Kind, ur.MessageID.Shorten())
+}
+
+func (ur *UnsignedReaction) isValid() bool {
+	// Reactions appeared after the canonical encoding.
+	if ur.Enc != EncodingCBOR {
+		log.Debugf("Reaction %s has unsupported encoding", ur)
+		return false
+	}
+	correctID := ur.ReactionContent.ToID(ur.Enc)
+	if ur.Descriptor.ID != *correctID {
+		log.Debugf("Reaction %s has invalid ID", ur)
+		return false
+	}
+	if !ur.Kind.IsValid() {
+		log.Debugf("Reaction %s has invalid type %d", ur, ur.Kind)
+		return false
+	}
+	if ur.AuthorID.IsZero() {
+		log.Debugf("Reaction %s has empty author", ur)
+		return false
+	}
+	if ur.MessageID.IsZero() {
+		log.Debugf("Reaction %s has empty message", ur)
+		return false
+	}
+	if ur.DateReacted.Before(Epoch) {
+		log.Debugf("Reaction %s was performed before the Dscuss Epoch", ur)
+		return false
+	}
+	return true
+}
+
+func (ur *UnsignedReaction) encode() []byte {
+	return encodeUnsigned(&ur.Descriptor, &ur.ReactionContent, ur)
+}
+
+func (r *Reaction) IsUnsignedPartValid() bool {
+	return r.UnsignedReaction.isValid()
+}
+
+func (r *Reaction) IsSigValid(pubKey *crypto.PublicKey) bool {
+	res := pubKey.Verify(r.encode(), r.Sig)
+	if !res {
+		log.Debugf("Reaction %s has invalid signature", r)
+	}
+	return res
+}
+
+func (r *Reaction) IsValid(pubKey *crypto.PublicKey) bool {
+	return r.IsUnsignedPartValid() && r.IsSigValid(pubKey)
+}
+
+// EmergeReaction creates a new reaction. It should only be called when
+// signature is not known yet. Signature will be created using the provided
+// signer.
+func EmergeReaction(
+	kind ReactionType,
+	authorID *ID,
+	messageID *ID,
+	signer *crypto.Signer,
+) (*Reaction, error) {
+	ur := newUnsignedReaction(kind, authorID, messageID, time.Now(), DefaultEncoding)
+	if !ur.isValid() {
+		return nil, errors.WrongArguments
+	}
+	sig, err := signer.Sign(ur.encode())
+	if err != nil {
+		log.Fatal("Can't sign encoded Reaction entity: " + err.Error())
+	}
+	return &Reaction{UnsignedReaction: *ur, Sig: sig}, nil
+}
+
+// NewReaction composes a new reaction entity object from the specified data.
+func NewReaction(
+	kind ReactionType,
+	authorID *ID,
+	messageID *ID,
+	dateReacted time.Time,
+	sig crypto.Signature,
+	enc Encoding,
+) (*Reaction, error) {
+	ur := newUnsignedReaction(kind, authorID, messageID, dateReacted, enc)
+	if !ur.isValid() {
+		return nil, errors.WrongArguments
+	}
+	return &Reaction{UnsignedReaction: *ur, Sig: sig}, nil
+}
+
+func newReactionContent(
+	kind ReactionType,
+	authorID *ID,
+	messageID *ID,
+	dateReacted time.Time,
+) *ReactionContent {
+	return &ReactionContent{
+		Kind:        kind,
+		AuthorID:    *authorID,
+		MessageID:   *messageID,
+		DateReacted: dateReacted,
+	}
+}
+
+func (rc *ReactionContent) ToID(enc Encoding) *ID {
+	id := NewID(encodeContent(enc, rc))
+	return &id
+}
+
+func (rc *ReactionContent) toCBOR() cbor.Map {
+	return cbor.Map{
+		"kind":         int(rc.Kind),
+		"author_id":    rc.AuthorID[:],
+		"message_id":   rc.MessageID[:],
+		"date_reacted": rc.DateReacted,
+	}
+}
+
+func newUnsignedReaction(
+	kind ReactionType,
+	authorID *ID,
+	messageID *ID,
+	dateReacted time.Time,
+	enc Encoding,
+) *UnsignedReaction {
+	rc := newReactionContent(kind, authorID, messageID, dateReacted)
+	return &UnsignedReaction{
+		Descriptor: Descriptor{
+			Type: TypeReaction,
+			ID:   *rc.ToID(enc),
+			Enc:  enc,
+		},
+		ReactionContent: *rc,
+	}
+}
+
+// ReactionSummary aggregates reactions to a message.
+type ReactionSummary struct {
+	Counts map[ReactionType]int
+	Score  int
+}
+
+// SummarizeReactions counts the reactions taking only the latest reaction of
+// each user into account.
+func SummarizeReactions(rr []*Reaction) *ReactionSummary {
+	latest := make(map[ID]*Reaction)
+	for _, r := range rr {
+		l, ok := latest[r.AuthorID]
+		if !ok || r.DateReacted.After(l.DateReacted) {
+			latest[r.AuthorID] = r
+		}
+	}
+	res := &ReactionSummary{Counts: make(map[ReactionType]int)}
+	for _, r := range latest {
+		if r.Kind == ReactionNone {
+			continue
+		}
+		res.Counts[r.Kind]++
+		res.Score += r.Kind.Score()
+	}
+	return res
+}
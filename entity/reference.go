@@ -0,0 +1,131 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"strings"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+type ReferenceType int
+
+const (
+	// ReferenceQuote means that the message quotes the referenced one.
+	ReferenceQuote ReferenceType = iota
+	ReferenceSeeAlso
+	ReferenceDuplicate
+)
+
+const (
+	ReferenceQuoteStr     string = "quote"
+	ReferenceSeeAlsoStr   string = "see"
+	ReferenceDuplicateStr string = "dup"
+)
+
+// Reference links a message to another message.
+type Reference struct {
+	Type ReferenceType
+	ID   ID
+}
+
+const MaxReferencesNum = 8
+
+func (rt ReferenceType) String() string {
+	switch rt {
+	case ReferenceQuote:
+		return ReferenceQuoteStr
+	case ReferenceSeeAlso:
+		return ReferenceSeeAlsoStr
+	case ReferenceDuplicate:
+		return ReferenceDuplicateStr
+	default:
+		return "unknown reference type"
+	}
+}
+
+func (rt *ReferenceType) ParseString(s string) error {
+	switch s {
+	case ReferenceQuoteStr:
+		*rt = ReferenceQuote
+	case ReferenceSeeAlsoStr:
+		*rt = ReferenceSeeAlso
+	case ReferenceDuplicateStr:
+		*rt = ReferenceDuplicate
+	default:
+		return errors.Parsing
+	}
+	return nil
+}
+
+// Description returns a human-readable description of the relation.
+func (rt ReferenceType) Description() string {
+	switch rt {
+	case ReferenceQuote:
+		return "quote of"
+	case ReferenceSeeAlso:
+		return "see also"
+	case ReferenceDuplicate:
+		return "duplicate of"
+	default:
+		return "unknown reference type"
+	}
+}
+
+func (rt ReferenceType) IsValid() bool {
+	return rt >= ReferenceQuote && rt <= ReferenceDuplicate
+}
+
+func (r *Reference) String() string {
+	return fmt.Sprintf("%s %s", r.Type.Description(), r.ID.Shorten())
+}
+
+// ParseString parses references in the form of "<type>:<id>", like
+// "quote:<id>".
+func (r *Reference) ParseString(s string) error {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return errors.Parsing
+	}
+	err := r.Type.ParseString(parts[0])
+	if err != nil {
+		return err
+	}
+	return r.ID.ParseString(parts[1])
+}
+
+func (r *Reference) isValid() bool {
+	if !r.Type.IsValid() {
+		log.Debugf("Reference to %s has invalid type", r.ID.Shorten())
+		return false
+	}
+	if r.ID.IsZero() {
+		log.Debugf("Reference of type %s has empty ID", r.Type)
+		return false
+	}
+	return true
+}
+
+func (r *Reference) toCBOR() cbor.Map {
+	return cbor.Map{
+		"type": int(r.Type),
+		"id":   r.ID[:],
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"regexp"
 	"time"
+	"vminko.org/dscuss/cbor"
 	"vminko.org/dscuss/crypto"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
@@ -41,11 +42,14 @@ type UnsignedUser struct {
 }
 
 type UserContent struct {
-	PubKey   crypto.PublicKey
-	Proof    crypto.ProofOfWork
-	Nickname string
-	Info     string
-	RegDate  time.Time
+	PubKey crypto.PublicKey
+	Proof  crypto.ProofOfWork
+	// ProofBits is the difficulty of the Proof. Zero means that the user
+	// was registered before the difficulty became configurable.
+	ProofBits int `json:",omitempty"`
+	Nickname  string
+	Info      string
+	RegDate   time.Time
 }
 
 type StoredUser struct {
@@ -63,6 +67,9 @@ const (
 	MaxUsernameLen        = 64
 	EpochTimestamp        = 1546300800000000000 // 2019 Jan 01
 	nicknameRegex  string = "^[a-zA-Z0-9_]+$"
+	// LegacyProofBits is the difficulty of the proofs of the users, which
+	// do not specify it explicitly.
+	LegacyProofBits = 8
 )
 
 var (
@@ -81,19 +88,16 @@ func EmergeUser(
 	nickname string,
 	info string,
 	proof crypto.ProofOfWork,
+	proofBits int,
 	signer *crypto.Signer,
 ) (*User, error) {
-	uu := newUnsignedUser(nickname, info, signer.Public(), proof, time.Now())
+	uu := newUnsignedUser(nickname, info, signer.Public(), proof, proofBits, time.Now(), DefaultEncoding)
 	if !uu.isValid() {
 		return nil, errors.WrongNickname
 	}
-	juser, err := json.Marshal(uu)
+	sig, err := signer.Sign(uu.encode())
 	if err != nil {
-		log.Fatal("Can't marshal UnsignedUser: " + err.Error())
-	}
-	sig, err := signer.Sign(juser)
-	if err != nil {
-		log.Fatal("Can't sign JSON-encoded user: " + err.Error())
+		log.Fatal("Can't sign encoded user: " + err.Error())
 	}
 
 	return &User{UnsignedUser: *uu, Sig: sig}, nil
@@ -104,10 +108,12 @@ func NewUser(
 	info string,
 	pubkey *crypto.PublicKey,
 	proof crypto.ProofOfWork,
+	proofBits int,
 	regdate time.Time,
 	sig crypto.Signature,
+	enc Encoding,
 ) *User {
-	uu := newUnsignedUser(nickname, info, pubkey, proof, regdate)
+	uu := newUnsignedUser(nickname, info, pubkey, proof, proofBits, regdate, enc)
 	return &User{UnsignedUser: *uu, Sig: sig}
 }
 
@@ -137,6 +143,10 @@ func (uu *UnsignedUser) String() string {
 }
 
 func (uu *UnsignedUser) isValid() bool {
+	if !uu.Enc.IsValid() {
+		log.Debugf("User %s has unknown encoding", uu)
+		return false
+	}
 	correctID := uu.UserContent.ToID()
 	if uu.Descriptor.ID != *correctID {
 		log.Debugf("User %s has invalid ID. Expected: %s, Actual: %s",
@@ -147,7 +157,11 @@ func (uu *UnsignedUser) isValid() bool {
 		log.Debugf("User %s was registered before the Dscuss Epoch", uu)
 		return false
 	}
-	pow := crypto.NewPowFinder(uu.PubKey.EncodeToDER())
+	if uu.ProofBits < 0 || uu.ProofBits > crypto.MaxPowBits {
+		log.Debugf("User %s has invalid Proof-of-Work difficulty %d", uu, uu.ProofBits)
+		return false
+	}
+	pow := crypto.NewPowFinder(uu.PubKey.EncodeToDER(), uu.ProofDifficulty())
 	if !pow.Validate(uu.Proof) {
 		log.Debugf("User %s has invalid Proof-of-Work", uu)
 		return false
@@ -159,12 +173,21 @@ func (uu *UnsignedUser) isValid() bool {
 	return true
 }
 
-func (u *User) IsValid() bool {
-	juser, err := json.Marshal(&u.UnsignedUser)
-	if err != nil {
-		log.Fatal("Can't marshal UnsignedUser: " + err.Error())
+// ProofDifficulty returns the number of target bits of the user's
+// Proof-of-Work.
+func (uc *UserContent) ProofDifficulty() int {
+	if uc.ProofBits == 0 {
+		return LegacyProofBits
 	}
-	if !u.PubKey.Verify(juser, u.Sig) {
+	return uc.ProofBits
+}
+
+func (uu *UnsignedUser) encode() []byte {
+	return encodeUnsigned(&uu.Descriptor, &uu.UserContent, uu)
+}
+
+func (u *User) IsValid() bool {
+	if !u.PubKey.Verify(u.encode(), u.Sig) {
 		log.Debugf("User %s has invalid signature", u)
 		return false
 	}
@@ -176,34 +199,54 @@ func newUserContent(
 	info string,
 	pubkey *crypto.PublicKey,
 	proof crypto.ProofOfWork,
+	proofBits int,
 	regdate time.Time,
 ) *UserContent {
 	return &UserContent{
-		PubKey:   *pubkey,
-		Proof:    proof,
-		Nickname: nickname,
-		Info:     info,
-		RegDate:  regdate,
+		PubKey:    *pubkey,
+		Proof:     proof,
+		ProofBits: proofBits,
+		Nickname:  nickname,
+		Info:      info,
+		RegDate:   regdate,
 	}
 }
 
+// ToID returns ID of the user, which does not depend on the encoding.
 func (uc *UserContent) ToID() *ID {
 	id := NewID(uc.PubKey.EncodeToDER())
 	return &id
 }
 
+func (uc *UserContent) toCBOR() cbor.Map {
+	m := cbor.Map{
+		"pub_key":  uc.PubKey.EncodeToDER(),
+		"proof":    uint64(uc.Proof),
+		"nickname": uc.Nickname,
+		"info":     uc.Info,
+		"reg_date": uc.RegDate,
+	}
+	if uc.ProofBits != 0 {
+		m["proof_bits"] = uc.ProofBits
+	}
+	return m
+}
+
 func newUnsignedUser(
 	nickname string,
 	info string,
 	pubkey *crypto.PublicKey,
 	proof crypto.ProofOfWork,
+	proofBits int,
 	regdate time.Time,
+	enc Encoding,
 ) *UnsignedUser {
-	uc := newUserContent(nickname, info, pubkey, proof, regdate)
+	uc := newUserContent(nickname, info, pubkey, proof, proofBits, regdate)
 	return &UnsignedUser{
 		Descriptor: Descriptor{
 			Type: TypeUser,
 			ID:   *uc.ToID(),
+			Enc:  enc,
 		},
 		UserContent: *uc,
 	}
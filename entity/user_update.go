@@ -0,0 +1,217 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+	dstrings "vminko.org/dscuss/strings"
+)
+
+// UserUpdate is a new version of the user's profile. The user entity itself
+// is immutable, so the profile is changed by publishing updates signed by the
+// user. The update with the highest sequence number wins.
+// Implements Entity interface.
+type UserUpdate struct {
+	UnsignedUserUpdate
+	Sig crypto.Signature
+}
+
+type UnsignedUserUpdate struct {
+	Descriptor
+	UserUpdateContent
+}
+
+type UserUpdateContent struct {
+	UserID      ID
+	Seq         uint64
+	Info        string
+	DateUpdated time.Time
+}
+
+type StoredUserUpdate struct {
+	U      *UserUpdate
+	Stored time.Time
+}
+
+const (
+	MaxUserInfoLen int = 1024
+)
+
+func (uuu *UnsignedUserUpdate) ShortID() string {
+	return uuu.Descriptor.ID.Shorten()
+}
+
+func (uuu *UnsignedUserUpdate) Type() Type {
+	return uuu.Descriptor.Type
+}
+
+func (uuu *UnsignedUserUpdate) ID() *ID {
+	return &uuu.Descriptor.ID
+}
+
+func (uuu *UnsignedUserUpdate) String() string {
+	shortInfo := strings.Replace(dstrings.Truncate(uuu.Info, 24), "\n", " ", -1)
+	return fmt.Sprintf("%s (%s updated to version %d: %s)",
+		uuu.ShortID(), uuu.UserID.Shorten(), uuu.Seq, shortInfo)
+}
+
+func (uuu *UnsignedUserUpdate) isValid() bool {
+	if !uuu.Enc.IsValid() {
+		log.Debugf("User update %s has unknown encoding", uuu)
+		return false
+	}
+	correctID := uuu.UserUpdateContent.ToID(uuu.Enc)
+	if uuu.Descriptor.ID != *correctID {
+		log.Debugf("User update %s has invalid ID", uuu)
+		return false
+	}
+	if uuu.UserID.IsZero() {
+		log.Debugf("User update %s has empty user ID", uuu)
+		return false
+	}
+	if uuu.Seq == 0 {
+		log.Debugf("User update %s has zero sequence number", uuu)
+		return false
+	}
+	if len(uuu.Info) > MaxUserInfoLen {
+		log.Debugf("User update %s has too long info (%d)", uuu, len(uuu.Info))
+		return false
+	}
+	if uuu.DateUpdated.Before(Epoch) {
+		log.Debugf("User update %s was performed before the Dscuss Epoch", uuu)
+		return false
+	}
+	return true
+}
+
+func (uuu *UnsignedUserUpdate) encode() []byte {
+	return encodeUnsigned(&uuu.Descriptor, &uuu.UserUpdateContent, uuu)
+}
+
+func (uu *UserUpdate) IsUnsignedPartValid() bool {
+	return uu.UnsignedUserUpdate.isValid()
+}
+
+func (uu *UserUpdate) IsSigValid(pubKey *crypto.PublicKey) bool {
+	res := pubKey.Verify(uu.encode(), uu.Sig)
+	if !res {
+		log.Debugf("User update %s has invalid signature", uu)
+	}
+	return res
+}
+
+func (uu *UserUpdate) IsValid(pubKey *crypto.PublicKey) bool {
+	return uu.IsUnsignedPartValid() && uu.IsSigValid(pubKey)
+}
+
+// EmergeUserUpdate creates a new user update entity. It should only be called
+// when signature is not known yet. Signature will be created using the provided
+// signer.
+func EmergeUserUpdate(
+	userID *ID,
+	seq uint64,
+	info string,
+	signer *crypto.Signer,
+) (*UserUpdate, error) {
+	uuu := newUnsignedUserUpdate(userID, seq, info, time.Now(), DefaultEncoding)
+	if !uuu.isValid() {
+		return nil, errors.WrongArguments
+	}
+	sig, err := signer.Sign(uuu.encode())
+	if err != nil {
+		log.Fatal("Can't sign encoded UserUpdate entity: " + err.Error())
+	}
+	return &UserUpdate{UnsignedUserUpdate: *uuu, Sig: sig}, nil
+}
+
+// NewUserUpdate composes a new user update entity object from the specified
+// data.
+func NewUserUpdate(
+	userID *ID,
+	seq uint64,
+	info string,
+	dateUpdated time.Time,
+	sig crypto.Signature,
+	enc Encoding,
+) (*UserUpdate, error) {
+	uuu := newUnsignedUserUpdate(userID, seq, info, dateUpdated, enc)
+	if !uuu.isValid() {
+		return nil, errors.WrongArguments
+	}
+	return &UserUpdate{UnsignedUserUpdate: *uuu, Sig: sig}, nil
+}
+
+func newUserUpdateContent(
+	userID *ID,
+	seq uint64,
+	info string,
+	dateUpdated time.Time,
+) *UserUpdateContent {
+	return &UserUpdateContent{
+		UserID:      *userID,
+		Seq:         seq,
+		Info:        info,
+		DateUpdated: dateUpdated,
+	}
+}
+
+func (uuc *UserUpdateContent) ToID(enc Encoding) *ID {
+	id := NewID(encodeContent(enc, uuc))
+	return &id
+}
+
+func (uuc *UserUpdateContent) toCBOR() cbor.Map {
+	return cbor.Map{
+		"user_id":      uuc.UserID[:],
+		"seq":          uuc.Seq,
+		"info":         uuc.Info,
+		"date_updated": uuc.DateUpdated,
+	}
+}
+
+func newUnsignedUserUpdate(
+	userID *ID,
+	seq uint64,
+	info string,
+	dateUpdated time.Time,
+	enc Encoding,
+) *UnsignedUserUpdate {
+	uuc := newUserUpdateContent(userID, seq, info, dateUpdated)
+	return &UnsignedUserUpdate{
+		Descriptor: Descriptor{
+			Type: TypeUserUpdate,
+			ID:   *uuc.ToID(enc),
+			Enc:  enc,
+		},
+		UserUpdateContent: *uuc,
+	}
+}
+
+// ApplyUpdate returns a copy of the user with the profile replaced by the one
+// from the update.
+func (u *User) ApplyUpdate(uu *UserUpdate) *User {
+	res := *u
+	res.Info = uu.Info
+	return &res
+}
@@ -0,0 +1,201 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entity
+
+import (
+	"fmt"
+	"time"
+	"vminko.org/dscuss/cbor"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// Vote is an answer of a user to a poll. Only the latest vote of the user
+// published before the poll closes is effective.
+// Implements Entity interface.
+type Vote struct {
+	UnsignedVote
+	Sig crypto.Signature
+}
+
+type UnsignedVote struct {
+	Descriptor
+	VoteContent
+}
+
+type VoteContent struct {
+	AuthorID ID
+	PollID   ID
+	// Choice is the index of the chosen option of the poll.
+	Choice    int
+	DateVoted time.Time
+}
+
+type StoredVote struct {
+	V      *Vote
+	Stored time.Time
+}
+
+func (uv *UnsignedVote) ShortID() string {
+	return uv.Descriptor.ID.Shorten()
+}
+
+func (uv *UnsignedVote) Type() Type {
+	return uv.Descriptor.Type
+}
+
+func (uv *UnsignedVote) ID() *ID {
+	return &uv.Descriptor.ID
+}
+
+func (uv *UnsignedVote) String() string {
+	return fmt.Sprintf("%s (%s voted for option #%d of %s)",
+		uv.ShortID(), uv.AuthorID.Shorten(), uv.Choice+1, uv.PollID.Shorten())
+}
+
+func (uv *UnsignedVote) isValid() bool {
+	// Votes appeared after the canonical encoding.
+	if uv.Enc != EncodingCBOR {
+		log.Debugf("Vote %s has unsupported encoding", uv)
+		return false
+	}
+	correctID := uv.VoteContent.ToID(uv.Enc)
+	if uv.Descriptor.ID != *correctID {
+		log.Debugf("Vote %s has invalid ID", uv)
+		return false
+	}
+	if uv.Choice < 0 || uv.Choice >= MaxPollOptionsNum {
+		log.Debugf("Vote %s has invalid choice", uv)
+		return false
+	}
+	if uv.AuthorID.IsZero() {
+		log.Debugf("Vote %s has empty author", uv)
+		return false
+	}
+	if uv.PollID.IsZero() {
+		log.Debugf("Vote %s has empty poll", uv)
+		return false
+	}
+	if uv.DateVoted.Before(Epoch) {
+		log.Debugf("Vote %s was performed before the Dscuss Epoch", uv)
+		return false
+	}
+	return true
+}
+
+func (uv *UnsignedVote) encode() []byte {
+	return encodeUnsigned(&uv.Descriptor, &uv.VoteContent, uv)
+}
+
+func (v *Vote) IsUnsignedPartValid() bool {
+	return v.UnsignedVote.isValid()
+}
+
+func (v *Vote) IsSigValid(pubKey *crypto.PublicKey) bool {
+	res := pubKey.Verify(v.encode(), v.Sig)
+	if !res {
+		log.Debugf("Vote %s has invalid signature", v)
+	}
+	return res
+}
+
+func (v *Vote) IsValid(pubKey *crypto.PublicKey) bool {
+	return v.IsUnsignedPartValid() && v.IsSigValid(pubKey)
+}
+
+// EmergeVote creates a new vote. It should only be called when signature is
+// not known yet. Signature will be created using the provided signer.
+func EmergeVote(
+	authorID *ID,
+	pollID *ID,
+	choice int,
+	signer *crypto.Signer,
+) (*Vote, error) {
+	uv := newUnsignedVote(authorID, pollID, choice, time.Now(), DefaultEncoding)
+	if !uv.isValid() {
+		return nil, errors.WrongArguments
+	}
+	sig, err := signer.Sign(uv.encode())
+	if err != nil {
+		log.Fatal("Can't sign encoded Vote entity: " + err.Error())
+	}
+	return &Vote{UnsignedVote: *uv, Sig: sig}, nil
+}
+
+// NewVote composes a new vote entity object from the specified data.
+func NewVote(
+	authorID *ID,
+	pollID *ID,
+	choice int,
+	dateVoted time.Time,
+	sig crypto.Signature,
+	enc Encoding,
+) (*Vote, error) {
+	uv := newUnsignedVote(authorID, pollID, choice, dateVoted, enc)
+	if !uv.isValid() {
+		return nil, errors.WrongArguments
+	}
+	return &Vote{UnsignedVote: *uv, Sig: sig}, nil
+}
+
+func newVoteContent(
+	authorID *ID,
+	pollID *ID,
+	choice int,
+	dateVoted time.Time,
+) *VoteContent {
+	return &VoteContent{
+		AuthorID:  *authorID,
+		PollID:    *pollID,
+		Choice:    choice,
+		DateVoted: dateVoted,
+	}
+}
+
+func (vc *VoteContent) ToID(enc Encoding) *ID {
+	id := NewID(encodeContent(enc, vc))
+	return &id
+}
+
+func (vc *VoteContent) toCBOR() cbor.Map {
+	return cbor.Map{
+		"author_id":  vc.AuthorID[:],
+		"poll_id":    vc.PollID[:],
+		"choice":     vc.Choice,
+		"date_voted": vc.DateVoted,
+	}
+}
+
+func newUnsignedVote(
+	authorID *ID,
+	pollID *ID,
+	choice int,
+	dateVoted time.Time,
+	enc Encoding,
+) *UnsignedVote {
+	vc := newVoteContent(authorID, pollID, choice, dateVoted)
+	return &UnsignedVote{
+		Descriptor: Descriptor{
+			Type: TypeVote,
+			ID:   *vc.ToID(enc),
+			Enc:  enc,
+		},
+		VoteContent: *vc,
+	}
+}
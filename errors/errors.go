@@ -45,13 +45,26 @@ var (
 	ProtocolViolation   = errors.New("protocol violation detected")
 	UnsupportedProtocol = errors.New("requested version of the protocol is not supported")
 	ClosedConnection    = errors.New("use of closed connection")
+	NotEncrypted        = errors.New("the connection is not encrypted")
 	InvalidPeer         = errors.New("peer validation failed")
 	WrongArguments      = errors.New("wrong arguments")
 	AlreadySubscribed   = errors.New("you are already subscribed to the specified topic")
 	NotSubscribed       = errors.New("you are not subscribed to the specified topic")
 	ForbiddenOperation  = errors.New("forbidden operation")
 	UserBanned          = errors.New("user is banned")
+	KeyRevoked          = errors.New("the key of the user is revoked")
+	WeakProof           = errors.New("proof-of-work of the user is too weak")
+	PassphraseRequired  = errors.New("the private key is encrypted, passphrase is required")
+	WrongPassphrase     = errors.New("wrong passphrase")
+	CantDecrypt         = errors.New("can't decrypt the data")
+	CantEncrypt         = errors.New("the key doesn't support encryption")
+	Interrupted         = errors.New("the operation was interrupted")
 	NoSuchTag           = errors.New("can't find requested tag")
+	NoSuchBlob          = errors.New("can't find requested blob")
+	NoSuchPoll          = errors.New("the specified message is not a poll")
+	PollClosed          = errors.New("the poll is closed")
+	BlobSizeExceeded    = errors.New("the blob size exceeded the limit")
+	BlobQuotaExceeded   = errors.New("the blob store quota is exceeded")
 	PacketSizeExceeded  = errors.New("the packet size exceeded the limit")
 	MsgDepthExceeded    = errors.New("the thread depth exceeded the limit")
 	MsgPostRateErr      = errors.New("attempt to violate the limit of the message post rate")
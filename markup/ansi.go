@@ -0,0 +1,85 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package markup
+
+import (
+	"bytes"
+	"strings"
+)
+
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiCyan      = "\x1b[36m"
+)
+
+// ToANSI renders the text for terminals supporting ANSI escape sequences.
+// Plain text without formatting is returned unchanged (except for redundant
+// blank lines).
+func ToANSI(text string) string {
+	var b bytes.Buffer
+	for i, bl := range Parse(text) {
+		if i != 0 {
+			b.WriteString("\n\n")
+		}
+		switch bl.Type {
+		case BlockParagraph:
+			writeInlineANSI(&b, bl.Text)
+		case BlockQuote:
+			var q bytes.Buffer
+			writeInlineANSI(&q, bl.Text)
+			for j, l := range strings.Split(q.String(), "\n") {
+				if j != 0 {
+					b.WriteString("\n")
+				}
+				b.WriteString(ansiDim + "> " + ansiReset + l)
+			}
+		case BlockCode:
+			for j, l := range strings.Split(bl.Text, "\n") {
+				if j != 0 {
+					b.WriteString("\n")
+				}
+				b.WriteString(ansiCyan + l + ansiReset)
+			}
+		}
+	}
+	return b.String()
+}
+
+func writeInlineANSI(b *bytes.Buffer, text string) {
+	for _, s := range ParseInline(text) {
+		switch s.Type {
+		case SpanText:
+			b.WriteString(s.Text)
+		case SpanEmphasis:
+			b.WriteString(ansiItalic + s.Text + ansiReset)
+		case SpanStrong:
+			b.WriteString(ansiBold + s.Text + ansiReset)
+		case SpanCode:
+			b.WriteString(ansiCyan + s.Text + ansiReset)
+		case SpanLink:
+			b.WriteString(ansiUnderline + s.Text + ansiReset)
+			if s.Text != s.URL {
+				b.WriteString(" <" + s.URL + ">")
+			}
+		}
+	}
+}
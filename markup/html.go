@@ -0,0 +1,65 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package markup
+
+import (
+	"bytes"
+	"html"
+)
+
+// ToHTML renders the text as HTML. The text is escaped, so the result is safe
+// to embed into a page.
+func ToHTML(text string) string {
+	var b bytes.Buffer
+	for _, bl := range Parse(text) {
+		switch bl.Type {
+		case BlockParagraph:
+			b.WriteString("<p>")
+			writeInlineHTML(&b, bl.Text)
+			b.WriteString("</p>")
+		case BlockQuote:
+			b.WriteString("<blockquote>")
+			writeInlineHTML(&b, bl.Text)
+			b.WriteString("</blockquote>")
+		case BlockCode:
+			b.WriteString("<pre><code>")
+			b.WriteString(html.EscapeString(bl.Text))
+			b.WriteString("</code></pre>")
+		}
+	}
+	return b.String()
+}
+
+func writeInlineHTML(b *bytes.Buffer, text string) {
+	for _, s := range ParseInline(text) {
+		t := html.EscapeString(s.Text)
+		switch s.Type {
+		case SpanText:
+			b.WriteString(t)
+		case SpanEmphasis:
+			b.WriteString("<em>" + t + "</em>")
+		case SpanStrong:
+			b.WriteString("<strong>" + t + "</strong>")
+		case SpanCode:
+			b.WriteString("<code>" + t + "</code>")
+		case SpanLink:
+			b.WriteString(`<a href="` + html.EscapeString(s.URL) + `" rel="nofollow noreferrer">`)
+			b.WriteString(t + "</a>")
+		}
+	}
+}
@@ -0,0 +1,58 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package markup
+
+import "testing"
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "a", "<p>a</p>"},
+		{"html is escaped", "<script>alert('x')</script>", "<p>&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt;</p>"},
+		{"ampersand", "a & b", "<p>a &amp; b</p>"},
+		{"escaped emphasis", "*<b>*", "<p><em>&lt;b&gt;</em></p>"},
+		{"escaped code", "`<b>`", "<p><code>&lt;b&gt;</code></p>"},
+		{"escaped code block", "```\n<b>\n```", "<pre><code>&lt;b&gt;</code></pre>"},
+		{"escaped quote", "> <b>", "<blockquote>&lt;b&gt;</blockquote>"},
+		{
+			"link",
+			"[<b>](https://example.org/?a=1&b=2)",
+			`<p><a href="https://example.org/?a=1&amp;b=2" rel="nofollow noreferrer">&lt;b&gt;</a></p>`,
+		},
+		{
+			"attribute injection",
+			`[x](https://example.org/"onmouseover="alert(1))`,
+			`<p>[x](https://example.org/&#34;onmouseover=&#34;alert(1))</p>`,
+		},
+		{
+			"unsafe scheme",
+			"[x](javascript:alert(1))",
+			"<p>[x](javascript:alert(1))</p>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToHTML(tt.text); got != tt.want {
+				t.Errorf("ToHTML(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
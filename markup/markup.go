@@ -0,0 +1,267 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package markup implements the restricted formatting dialect of message
+// texts. The dialect is a small subset of Markdown:
+//
+//	*emphasis* or _emphasis_
+//	**strong** or __strong__
+//	`inline code`
+//	[link text](https://example.org) and bare http(s) URLs
+//	> quoted lines
+//	```
+//	code blocks
+//	```
+//
+// Blocks are separated by blank lines. Special characters can be escaped with
+// a backslash. Everything else is plain text, HTML is never interpreted.
+package markup
+
+import (
+	"net/url"
+	"strings"
+)
+
+type BlockType int
+
+const (
+	BlockParagraph BlockType = iota
+	BlockQuote
+	BlockCode
+)
+
+// Block is a paragraph, a quote or a code block. Text of the quotes is stored
+// without the quote markers, text of the code blocks is stored without the
+// fences.
+type Block struct {
+	Type BlockType
+	Text string
+}
+
+type SpanType int
+
+const (
+	SpanText SpanType = iota
+	SpanEmphasis
+	SpanStrong
+	SpanCode
+	SpanLink
+)
+
+// Span is a piece of inline text. URL is only defined for links.
+type Span struct {
+	Type SpanType
+	Text string
+	URL  string
+}
+
+const (
+	codeFence   = "```"
+	quoteMarker = ">"
+	escapable   = "\\`*_[]()>"
+)
+
+// Parse splits the text into blocks.
+func Parse(text string) []Block {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	var res []Block
+	var cur []string
+	curType := BlockParagraph
+	flush := func() {
+		if cur != nil {
+			res = append(res, Block{curType, strings.Join(cur, "\n")})
+			cur = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		switch {
+		case strings.HasPrefix(l, codeFence):
+			flush()
+			j := i + 1
+			for j < len(lines) && !strings.HasPrefix(lines[j], codeFence) {
+				j++
+			}
+			// An unclosed code block lasts until the end of the text.
+			res = append(res, Block{BlockCode, strings.Join(lines[i+1:j], "\n")})
+			i = j
+		case strings.HasPrefix(l, quoteMarker):
+			if curType != BlockQuote {
+				flush()
+				curType = BlockQuote
+			}
+			l = strings.TrimPrefix(strings.TrimPrefix(l, quoteMarker), " ")
+			cur = append(cur, l)
+		case strings.TrimSpace(l) == "":
+			flush()
+		default:
+			if curType != BlockParagraph {
+				flush()
+				curType = BlockParagraph
+			}
+			cur = append(cur, l)
+		}
+	}
+	flush()
+	return res
+}
+
+// ParseInline splits text of a paragraph or a quote into spans.
+func ParseInline(text string) []Span {
+	var res []Span
+	var plain []byte
+	add := func(s Span) {
+		if len(plain) != 0 {
+			res = append(res, Span{Type: SpanText, Text: string(plain)})
+			plain = nil
+		}
+		res = append(res, s)
+	}
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && strings.IndexByte(escapable, text[i+1]) >= 0:
+			plain = append(plain, text[i+1])
+			i += 2
+			continue
+		case c == '`':
+			if j := strings.IndexByte(text[i+1:], '`'); j > 0 {
+				add(Span{Type: SpanCode, Text: text[i+1 : i+1+j]})
+				i += j + 2
+				continue
+			}
+		case strings.HasPrefix(text[i:], "**") || strings.HasPrefix(text[i:], "__"):
+			if j := findClosing(text, i, text[i:i+2]); j >= 0 {
+				add(Span{Type: SpanStrong, Text: text[i+2 : j]})
+				i = j + 2
+				continue
+			}
+		case c == '*' || c == '_':
+			if j := findClosing(text, i, string(c)); j >= 0 {
+				add(Span{Type: SpanEmphasis, Text: text[i+1 : j]})
+				i = j + 1
+				continue
+			}
+		case c == '[':
+			if s, n := parseLink(text[i:]); n > 0 {
+				add(s)
+				i += n
+				continue
+			}
+		case c == 'h' && (i == 0 || isSpace(text[i-1]) || text[i-1] == '('):
+			if s, n := parseBareURL(text[i:]); n > 0 {
+				add(s)
+				i += n
+				continue
+			}
+		}
+		plain = append(plain, c)
+		i++
+	}
+	if len(plain) != 0 {
+		res = append(res, Span{Type: SpanText, Text: string(plain)})
+	}
+	return res
+}
+
+// findClosing returns position of the delimiter closing the one at the
+// position i. Delimiters must be adjacent to the enclosed text and must not
+// be inside words (so that snake_case and 2*3*4 remain intact).
+func findClosing(text string, i int, delim string) int {
+	start := i + len(delim)
+	if i > 0 && isWordChar(text[i-1]) {
+		return -1
+	}
+	if start >= len(text) || isSpace(text[start]) {
+		return -1
+	}
+	for j := start + 1; j+len(delim) <= len(text); j++ {
+		if text[j:j+len(delim)] != delim || isSpace(text[j-1]) {
+			continue
+		}
+		after := j + len(delim)
+		if after < len(text) && (isWordChar(text[after]) || strings.IndexByte("*_", text[after]) >= 0) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// parseLink parses [text](url). Returns the number of consumed bytes, zero
+// means that it's not a valid link.
+func parseLink(text string) (Span, int) {
+	te := strings.Index(text, "](")
+	if te < 2 || strings.IndexByte(text[1:te], '\n') >= 0 {
+		return Span{}, 0
+	}
+	ue := strings.IndexByte(text[te+2:], ')')
+	if ue < 1 {
+		return Span{}, 0
+	}
+	u := text[te+2 : te+2+ue]
+	if !IsSafeURL(u) {
+		return Span{}, 0
+	}
+	return Span{Type: SpanLink, Text: text[1:te], URL: u}, te + 3 + ue
+}
+
+func parseBareURL(text string) (Span, int) {
+	if !strings.HasPrefix(text, "http://") && !strings.HasPrefix(text, "https://") {
+		return Span{}, 0
+	}
+	n := 0
+	for n < len(text) && !isSpace(text[n]) {
+		n++
+	}
+	// Trailing punctuation most likely belongs to the sentence.
+	for n > 0 && strings.IndexByte(".,;:!?)'\"", text[n-1]) >= 0 {
+		n--
+	}
+	u := text[:n]
+	if !IsSafeURL(u) {
+		return Span{}, 0
+	}
+	return Span{Type: SpanLink, Text: u, URL: u}, n
+}
+
+// IsSafeURL checks whether the URL can be used as a link target.
+func IsSafeURL(s string) bool {
+	if strings.ContainsAny(s, " \t\n<>\"") {
+		return false
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	default:
+		return false
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
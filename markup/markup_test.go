@@ -0,0 +1,132 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package markup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsSafeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://example.org", true},
+		{"https://example.org/path?q=1#frag", true},
+		{"HTTPS://example.org", true},
+		{"mailto:user@example.org", true},
+		{"javascript:alert(1)", false},
+		{"JavaScript:alert(1)", false},
+		{"data:text/html;base64,PHNjcmlwdD4=", false},
+		{"vbscript:msgbox", false},
+		{"file:///etc/passwd", false},
+		{"//example.org", false},
+		{"/relative/path", false},
+		{"http://", false},
+		{"http:example.org", false},
+		{"mailto:", false},
+		{"https://example.org/a b", false},
+		{"https://example.org/\"onclick", false},
+		{"https://example.org/<script>", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := IsSafeURL(tt.url); got != tt.want {
+				t.Errorf("IsSafeURL(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Block
+	}{
+		{"empty", "", nil},
+		{"paragraphs", "a\nb\n\nc", []Block{{BlockParagraph, "a\nb"}, {BlockParagraph, "c"}}},
+		{"crlf", "a\r\n\r\nb", []Block{{BlockParagraph, "a"}, {BlockParagraph, "b"}}},
+		{"quote", "> a\n>b\nc", []Block{{BlockQuote, "a\nb"}, {BlockParagraph, "c"}}},
+		{"code", "```\n*a*\n\n> b\n```\nc", []Block{{BlockCode, "*a*\n\n> b"}, {BlockParagraph, "c"}}},
+		{"unclosed code", "```\na", []Block{{BlockCode, "a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Span
+	}{
+		{"plain", "a b", []Span{{Type: SpanText, Text: "a b"}}},
+		{"emphasis", "*a*", []Span{{Type: SpanEmphasis, Text: "a"}}},
+		{"underscore emphasis", "_a_", []Span{{Type: SpanEmphasis, Text: "a"}}},
+		{"strong", "**a b**", []Span{{Type: SpanStrong, Text: "a b"}}},
+		{"code", "`*a*`", []Span{{Type: SpanCode, Text: "*a*"}}},
+		{"snake case", "snake_case_name", []Span{{Type: SpanText, Text: "snake_case_name"}}},
+		{"arithmetic", "2*3*4", []Span{{Type: SpanText, Text: "2*3*4"}}},
+		{"spaced delimiters", "* a *", []Span{{Type: SpanText, Text: "* a *"}}},
+		{"escaped", `\*a\*`, []Span{{Type: SpanText, Text: "*a*"}}},
+		{"unknown escape", `\n`, []Span{{Type: SpanText, Text: `\n`}}},
+		{
+			"link",
+			"see [it](https://example.org).",
+			[]Span{
+				{Type: SpanText, Text: "see "},
+				{Type: SpanLink, Text: "it", URL: "https://example.org"},
+				{Type: SpanText, Text: "."},
+			},
+		},
+		{
+			"unsafe link",
+			"[it](javascript:alert(1))",
+			[]Span{{Type: SpanText, Text: "[it](javascript:alert(1))"}},
+		},
+		{
+			"bare url",
+			"at https://example.org/x, ok",
+			[]Span{
+				{Type: SpanText, Text: "at "},
+				{Type: SpanLink, Text: "https://example.org/x", URL: "https://example.org/x"},
+				{Type: SpanText, Text: ", ok"},
+			},
+		},
+		{
+			"url inside word",
+			"xhttps://example.org",
+			[]Span{{Type: SpanText, Text: "xhttps://example.org"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseInline(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseInline(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
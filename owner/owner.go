@@ -20,9 +20,15 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package owner
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
+	"vminko.org/dscuss/blob"
 	"vminko.org/dscuss/crypto"
 	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
@@ -36,18 +42,39 @@ import (
 type Owner struct {
 	User    *entity.User
 	Storage *storage.Storage
+	Blobs   *blob.Store
 	Profile *Profile
 	Signer  *crypto.Signer
 	View    *View
+	dir     string
+	// The private key is encrypted using the passphrase unless it's empty.
+	passphrase string
+	// Signers of the retired keys by the sequence numbers of the keys (nil
+	// if the key is not available).
+	retired   map[uint64]*crypto.Signer
+	retiredMx sync.Mutex
 }
 
 const (
 	privKeyFileName         string = "privkey.pem"
+	newPrivKeyFileName      string = "privkey.pem.new"
+	tmpPrivKeyFileName      string = "privkey.pem.tmp"
+	retiredPrivKeyFileFmt   string = "privkey.%d.pem"
+	revocationFileName      string = "revocation.json"
 	profileDatabaseFileName string = "profile.db"
 	entityDatabaseFileName  string = "entity.db"
+	blobDirName             string = "blobs"
 )
 
-func Register(dir, nickname, info string, subs subs.Subscriptions) error {
+// Register creates a new user in the dir. The difficulty of the user's
+// proof-of-work is proofBits. The progress of the proof-of-work search is
+// reported via the progress function every second (unless it's nil).
+func Register(
+	dir, nickname, info, passphrase string,
+	proofBits int,
+	subs subs.Subscriptions,
+	progress func(crypto.Progress),
+) error {
 	log.Debugf("Registering user %s", nickname)
 	// Nickname will be validated via regexp later during EmergeUser
 	if nickname == "" {
@@ -67,29 +94,50 @@ func Register(dir, nickname, info string, subs subs.Subscriptions) error {
 		}
 	}
 
-	privKey, err := crypto.NewPrivateKey()
+	privKey, err := crypto.NewPrivateKey(crypto.DefaultAlgorithm)
 	if err != nil {
 		log.Errorf("Can't generate new private key: %v", err)
 		return errors.Internal
 	}
-	privKeyPEM := privKey.EncodeToPEM()
-	privKeyPath := filepath.Join(userDir, privKeyFileName)
-	err = ioutil.WriteFile(privKeyPath, privKeyPEM, 0600)
+	err = writePrivateKey(filepath.Join(userDir, privKeyFileName), privKey, passphrase)
 	if err != nil {
-		log.Errorf("Can't save private key as file %s: %v", privKeyPath, err)
-		return errors.Filesystem
+		return err
 	}
 
-	pow := crypto.NewPowFinder(privKey.Public().EncodeToDER())
+	pow := crypto.NewPowFinder(privKey.Public().EncodeToDER(), proofBits)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	if progress != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					progress(pow.Progress())
+				}
+			}
+		}()
+	}
 	proof := pow.Find()
+	close(done)
+	wg.Wait()
 
-	u, err := entity.EmergeUser(nickname, info, proof, crypto.NewSigner(privKey))
+	u, err := entity.EmergeUser(nickname, info, proof, proofBits, crypto.NewSigner(privKey))
 	if err != nil {
 		log.Errorf("Can't create user '%s': %v", nickname, err)
 		return err
 	}
 	log.Debugf("Dumping emerged User %s:", nickname)
 	log.Debug(u.Dump())
+	err = writeRevocation(userDir, u.ID(), 0, crypto.NewSigner(privKey))
+	if err != nil {
+		return err
+	}
 
 	entityDatabasePath := filepath.Join(userDir, entityDatabaseFileName)
 	sDB, err := sqlite.OpenEntityDatabase(entityDatabasePath)
@@ -132,7 +180,9 @@ func Register(dir, nickname, info string, subs subs.Subscriptions) error {
 	return nil
 }
 
-func New(dir, nickname string) (*Owner, error) {
+// New opens the data of the registered user. The total size of the stored
+// blobs is limited by blobQuota.
+func New(dir, nickname, passphrase string, blobQuota int64, trust TrustPolicy) (*Owner, error) {
 	userDir := filepath.Join(dir, nickname)
 	log.Debugf("Owner uses the following user directory: %s", userDir)
 	if _, err := os.Stat(userDir); os.IsNotExist(err) {
@@ -141,15 +191,8 @@ func New(dir, nickname string) (*Owner, error) {
 	}
 
 	privKeyPath := filepath.Join(userDir, privKeyFileName)
-	privKeyPem, err := ioutil.ReadFile(privKeyPath)
+	privKey, err := readPrivateKey(privKeyPath, passphrase)
 	if err != nil {
-		log.Errorf("Can't read private key from file %s: %v", privKeyPath, err)
-		return nil, errors.Filesystem
-	}
-
-	privKey, err := crypto.ParsePrivateKeyFromPEM(privKeyPem)
-	if err != nil {
-		log.Errorf("Error parsing private key from file %s: %v", privKeyPath, err)
 		return nil, err
 	}
 
@@ -161,14 +204,22 @@ func New(dir, nickname string) (*Owner, error) {
 	}
 	s := storage.New(sDB)
 
-	eid := entity.NewID(privKey.Public().EncodeToDER())
-	u, err := s.GetUser(&eid)
+	eid, err := s.GetUserIDByKey(privKey.Public())
 	if err != nil {
-		log.Errorf("Can't fetch the user with id '%x' from the storage: %v", eid, err)
+		log.Errorf("Can't find the owner of the private key %s: %v", privKeyPath, err)
+		return nil, err
+	}
+	u, err := s.GetUser(eid)
+	if err != nil {
+		log.Errorf("Can't fetch the user with id '%s' from the storage: %v", eid, err)
 		return nil, err
 	}
 	log.Debug("Dumping fetched User:")
 	log.Debug(u.Dump())
+	privKey, err = finishKeyRotation(userDir, s, u, privKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
 
 	profileDatabasePath := filepath.Join(userDir, profileDatabaseFileName)
 	pDB, err := sqlite.OpenProfileDatabase(profileDatabasePath)
@@ -178,12 +229,22 @@ func New(dir, nickname string) (*Owner, error) {
 	}
 	p := NewProfile(pDB, u.ID())
 
+	b, err := blob.OpenStore(filepath.Join(userDir, blobDirName), blobQuota)
+	if err != nil {
+		log.Errorf("Can't open blob store: %v", err)
+		return nil, err
+	}
+
 	return &Owner{
-		User:    u,
-		Storage: s,
-		Profile: p,
-		Signer:  crypto.NewSigner(privKey),
-		View:    NewView(p, s),
+		User:       u,
+		Storage:    s,
+		Blobs:      b,
+		Profile:    p,
+		Signer:     crypto.NewSigner(privKey),
+		View:       NewView(p, s, trust),
+		dir:        userDir,
+		passphrase: passphrase,
+		retired:    make(map[uint64]*crypto.Signer),
 	}, nil
 }
 
@@ -197,3 +258,341 @@ func (o *Owner) Close() {
 		log.Errorf("Error closing owner's profile: %v", err)
 	}
 }
+
+// writePrivateKey saves the key to the file. The key is encrypted unless the
+// passphrase is empty.
+func writePrivateKey(path string, key *crypto.PrivateKey, passphrase string) error {
+	pemKey := key.EncodeToPEM()
+	if passphrase != "" {
+		var err error
+		pemKey, err = key.EncodeToEncryptedPEM([]byte(passphrase))
+		if err != nil {
+			log.Errorf("Can't encrypt private key: %v", err)
+			return err
+		}
+	}
+	err := ioutil.WriteFile(path, pemKey, 0600)
+	if err != nil {
+		log.Errorf("Can't save private key as file %s: %v", path, err)
+		return errors.Filesystem
+	}
+	return nil
+}
+
+func readPrivateKey(path string, passphrase string) (*crypto.PrivateKey, error) {
+	pemKey, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Errorf("Can't read private key from file %s: %v", path, err)
+		return nil, errors.Filesystem
+	}
+	var key *crypto.PrivateKey
+	if crypto.IsPEMEncrypted(pemKey) {
+		if passphrase == "" {
+			log.Infof("Private key %s is encrypted, but no passphrase is provided", path)
+			return nil, errors.PassphraseRequired
+		}
+		key, err = crypto.ParsePrivateKeyFromEncryptedPEM(pemKey, []byte(passphrase))
+	} else {
+		key, err = crypto.ParsePrivateKeyFromPEM(pemKey)
+	}
+	if err != nil {
+		log.Errorf("Error parsing private key from file %s: %v", path, err)
+		return nil, err
+	}
+	return key, nil
+}
+
+// writeRevocation pre-generates the revocation certificate for the key. The
+// certificate can be published later, if the key gets compromised. Unlike the
+// private key, the certificate is not encrypted: anyone who can read it is able
+// to revoke the key (but not to sign anything else).
+func writeRevocation(dir string, uid *entity.ID, keySeq uint64, signer *crypto.Signer) error {
+	kr, err := entity.EmergeKeyRevocation(uid, keySeq, signer)
+	if err != nil {
+		log.Errorf("Can't create key revocation: %v", err)
+		return err
+	}
+	jkr, err := json.Marshal(kr)
+	if err != nil {
+		log.Fatal("Can't marshal KeyRevocation: " + err.Error())
+	}
+	path := filepath.Join(dir, revocationFileName)
+	err = ioutil.WriteFile(path, jkr, 0600)
+	if err != nil {
+		log.Errorf("Can't save key revocation as file %s: %v", path, err)
+		return errors.Filesystem
+	}
+	return nil
+}
+
+// finishKeyRotation replaces the private key with the new one in case the
+// previous rotation was interrupted after publishing the new key.
+func finishKeyRotation(
+	dir string,
+	s *storage.Storage,
+	u *entity.User,
+	privKey *crypto.PrivateKey,
+	passphrase string,
+) (*crypto.PrivateKey, error) {
+	kc, err := s.GetKeyChain(u.ID())
+	if err != nil {
+		log.Errorf("Can't fetch the key chain of %s: %v", u.ID().Shorten(), err)
+		return nil, err
+	}
+	cur := kc.CurrentKey().EncodeToDER()
+	if bytes.Equal(cur, privKey.Public().EncodeToDER()) {
+		return privKey, nil
+	}
+	newPrivKeyPath := filepath.Join(dir, newPrivKeyFileName)
+	if _, err := os.Stat(newPrivKeyPath); os.IsNotExist(err) {
+		log.Warningf("The private key of %s is not the current one", u.ID().Shorten())
+		return privKey, nil
+	}
+	newPrivKey, err := readPrivateKey(newPrivKeyPath, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(cur, newPrivKey.Public().EncodeToDER()) {
+		log.Warningf("The private key of %s is not the current one", u.ID().Shorten())
+		return privKey, nil
+	}
+	log.Infof("Finishing the interrupted key rotation of %s", u.ID().Shorten())
+	return newPrivKey, installNewKey(dir, u.ID(), kc.CurrentSeq(), newPrivKey)
+}
+
+// retiredPrivKeyPath returns the path to the copy of the retired key with the
+// sequence number seq.
+func retiredPrivKeyPath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf(retiredPrivKeyFileFmt, seq))
+}
+
+// retirePrivateKey keeps a copy of the current private key file (encrypted
+// the same way), so that the private messages sent to the key could be read
+// after the rotation.
+func retirePrivateKey(dir string, seq uint64) error {
+	path := retiredPrivKeyPath(dir, seq)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	privKeyPath := filepath.Join(dir, privKeyFileName)
+	pemKey, err := ioutil.ReadFile(privKeyPath)
+	if err != nil {
+		log.Errorf("Can't read private key from file %s: %v", privKeyPath, err)
+		return errors.Filesystem
+	}
+	err = ioutil.WriteFile(path, pemKey, 0600)
+	if err != nil {
+		log.Errorf("Can't save retired private key as file %s: %v", path, err)
+		return errors.Filesystem
+	}
+	return nil
+}
+
+// installNewKey replaces the private key file with the new key and generates
+// a new revocation certificate for it. The replaced key is retired.
+func installNewKey(dir string, uid *entity.ID, seq uint64, key *crypto.PrivateKey) error {
+	err := retirePrivateKey(dir, seq-1)
+	if err != nil {
+		return err
+	}
+	newPrivKeyPath := filepath.Join(dir, newPrivKeyFileName)
+	privKeyPath := filepath.Join(dir, privKeyFileName)
+	err = os.Rename(newPrivKeyPath, privKeyPath)
+	if err != nil {
+		log.Errorf("Can't rename %s to %s: %v", newPrivKeyPath, privKeyPath, err)
+		return errors.Filesystem
+	}
+	return writeRevocation(dir, uid, seq, crypto.NewSigner(key))
+}
+
+// RotateKey replaces the owner's key with a newly generated one. The new key is
+// endorsed by the current one, so the ID of the user is preserved. Signer is
+// read by the peers concurrently, so it keeps the previous key: the new key is
+// used once the owner is opened again (the network must be stopped before
+// that).
+func (o *Owner) RotateKey() (*entity.KeyRotation, error) {
+	kc, err := o.Storage.GetKeyChain(o.User.ID())
+	if err != nil {
+		log.Errorf("Can't fetch the owner's key chain: %v", err)
+		return nil, err
+	}
+	if kc.IsCompromised() {
+		return nil, errors.KeyRevoked
+	}
+	privKey, err := crypto.NewPrivateKey(crypto.DefaultAlgorithm)
+	if err != nil {
+		log.Errorf("Can't generate new private key: %v", err)
+		return nil, errors.Internal
+	}
+	seq := kc.CurrentSeq() + 1
+	kr, err := entity.EmergeKeyRotation(o.User.ID(), seq, privKey.Public(), o.Signer)
+	if err != nil {
+		log.Errorf("Can't create key rotation: %v", err)
+		return nil, err
+	}
+	// The new key is saved before publishing the rotation, otherwise it may
+	// get lost.
+	err = writePrivateKey(filepath.Join(o.dir, newPrivKeyFileName), privKey, o.passphrase)
+	if err != nil {
+		return nil, err
+	}
+	err = o.Storage.PutEntity(kr, nil)
+	if err != nil {
+		log.Errorf("Can't add key rotation %s to the storage: %v", kr.ShortID(), err)
+		return nil, err
+	}
+	err = installNewKey(o.dir, o.User.ID(), seq, privKey)
+	if err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// ChangePassphrase re-encrypts the private key and the retired keys using the
+// new passphrase. The old passphrase is required to decrypt the keys. If the
+// new passphrase is empty, the keys will be stored unencrypted.
+func (o *Owner) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	privKeyPath := filepath.Join(o.dir, privKeyFileName)
+	privKey, err := readPrivateKey(privKeyPath, oldPassphrase)
+	if err == errors.PassphraseRequired {
+		return errors.WrongPassphrase
+	} else if err != nil {
+		return err
+	}
+	if oldPassphrase != o.passphrase {
+		return errors.WrongPassphrase
+	}
+	kc, err := o.Storage.GetKeyChain(o.User.ID())
+	if err != nil {
+		log.Errorf("Can't fetch the owner's key chain: %v", err)
+		return err
+	}
+	o.retiredMx.Lock()
+	defer o.retiredMx.Unlock()
+	for seq := uint64(0); seq < kc.CurrentSeq(); seq++ {
+		path := retiredPrivKeyPath(o.dir, seq)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		key, err := readPrivateKey(path, oldPassphrase)
+		if err != nil {
+			log.Warningf("Can't re-encrypt retired key %d: %v", seq, err)
+			continue
+		}
+		err = o.replacePrivateKey(path, key, newPassphrase)
+		if err != nil {
+			return err
+		}
+	}
+	err = o.replacePrivateKey(privKeyPath, privKey, newPassphrase)
+	if err != nil {
+		return err
+	}
+	o.passphrase = newPassphrase
+	return nil
+}
+
+// replacePrivateKey overwrites the private key file at the path.
+func (o *Owner) replacePrivateKey(path string, key *crypto.PrivateKey, passphrase string) error {
+	// The key is replaced atomically, otherwise it may get lost.
+	tmpPrivKeyPath := filepath.Join(o.dir, tmpPrivKeyFileName)
+	err := writePrivateKey(tmpPrivKeyPath, key, passphrase)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPrivKeyPath, path)
+	if err != nil {
+		log.Errorf("Can't rename %s to %s: %v", tmpPrivKeyPath, path, err)
+		return errors.Filesystem
+	}
+	return nil
+}
+
+// ReadPrivateMessage decrypts the text of the private message sent to the
+// owner. If the message is not encrypted to the current key, the retired keys
+// are tried starting from the one, which was current when the message was
+// written.
+func (o *Owner) ReadPrivateMessage(pm *entity.PrivateMessage) (string, error) {
+	text, err := pm.Decrypt(o.Signer)
+	if err != errors.CantDecrypt {
+		return text, err
+	}
+	kc, err := o.Storage.GetKeyChain(o.User.ID())
+	if err != nil {
+		log.Errorf("Can't fetch the owner's key chain: %v", err)
+		return "", err
+	}
+	seqs := []uint64{kc.KeySeqAt(pm.DateWritten)}
+	for seq := kc.CurrentSeq(); seq > 0; seq-- {
+		if seq-1 != seqs[0] {
+			seqs = append(seqs, seq-1)
+		}
+	}
+	for _, seq := range seqs {
+		if seq >= kc.CurrentSeq() {
+			continue
+		}
+		s := o.retiredSigner(kc, seq)
+		if s == nil {
+			continue
+		}
+		text, err := pm.Decrypt(s)
+		if err != errors.CantDecrypt {
+			return text, err
+		}
+	}
+	return "", errors.CantDecrypt
+}
+
+// retiredSigner loads the retired key with the sequence number seq. Returns
+// nil if the key is not available.
+func (o *Owner) retiredSigner(kc *entity.KeyChain, seq uint64) *crypto.Signer {
+	o.retiredMx.Lock()
+	defer o.retiredMx.Unlock()
+	if s, ok := o.retired[seq]; ok {
+		return s
+	}
+	o.retired[seq] = nil
+	path := retiredPrivKeyPath(o.dir, seq)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		log.Debugf("Retired key %d is not kept", seq)
+		return nil
+	}
+	key, err := readPrivateKey(path, o.passphrase)
+	if err != nil {
+		log.Warningf("Can't load retired key %d: %v", seq, err)
+		return nil
+	}
+	if !bytes.Equal(key.Public().EncodeToDER(), kc.Key(seq).EncodeToDER()) {
+		log.Warningf("The private key %s does not match the key %d", path, seq)
+		return nil
+	}
+	o.retired[seq] = crypto.NewSigner(key)
+	return o.retired[seq]
+}
+
+// LoadKeyRevocation reads the revocation certificate pre-generated for the
+// current key of the owner.
+func (o *Owner) LoadKeyRevocation() (*entity.KeyRevocation, error) {
+	return ReadKeyRevocation(filepath.Join(o.dir, revocationFileName))
+}
+
+// ReadKeyRevocation reads a revocation certificate from the file.
+func ReadKeyRevocation(path string) (*entity.KeyRevocation, error) {
+	jkr, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Errorf("Can't read key revocation from file %s: %v", path, err)
+		return nil, errors.Filesystem
+	}
+	var kr entity.KeyRevocation
+	err = json.Unmarshal(jkr, &kr)
+	if err != nil {
+		log.Errorf("Error parsing key revocation from file %s: %v", path, err)
+		return nil, errors.Parsing
+	}
+	if !kr.IsUnsignedPartValid() {
+		log.Errorf("Key revocation from file %s is malformed", path)
+		return nil, errors.Parsing
+	}
+	return &kr, nil
+}
@@ -30,10 +30,12 @@ import (
 // provides few additional functions for managing owner's settings.
 type Profile struct {
 	db         *sqlite.ProfileDatabase
-	moderators []*entity.ID
+	moderators []*entity.Moderator
 	modersMx   sync.Mutex
 	subs       subs.Subscriptions
 	subsMx     sync.Mutex
+	quorums    map[entity.OperationType]entity.Quorum
+	quorumsMx  sync.Mutex
 	selfID     *entity.ID
 }
 
@@ -45,14 +47,16 @@ func (p *Profile) Close() error {
 	return p.db.Close()
 }
 
-func (p *Profile) PutModerator(id *entity.ID) error {
+// PutModerator makes the user a moderator of the threads in the scope (nil
+// scope means all threads).
+func (p *Profile) PutModerator(id *entity.ID, scope subs.Topic) error {
 	if *id == *p.selfID {
 		return errors.AlreadyModerator
 	}
 	p.modersMx.Lock()
 	defer p.modersMx.Unlock()
 	p.moderators = nil
-	return p.db.PutModerator(id)
+	return p.db.PutModerator(&entity.Moderator{ID: *id, Scope: scope})
 }
 
 func (p *Profile) RemoveModerator(id *entity.ID) error {
@@ -65,6 +69,8 @@ func (p *Profile) RemoveModerator(id *entity.ID) error {
 	return p.db.RemoveModerator(id)
 }
 
+// HasModerator checks whether the user is one of the owner's moderators.
+// Moderators are identified by user IDs, which survive key rotations.
 func (p *Profile) HasModerator(id *entity.ID) (bool, error) {
 	if *id == *p.selfID {
 		return true, nil
@@ -79,22 +85,77 @@ func (p *Profile) HasModerator(id *entity.ID) (bool, error) {
 }
 
 func (p *Profile) GetModerators() []*entity.ID {
+	mm := p.GetScopedModerators()
+	res := make([]*entity.ID, len(mm))
+	for i, m := range mm {
+		res[i] = &m.ID
+	}
+	return res
+}
+
+// GetScopedModerators returns the owner's moderators along with their scopes.
+// The owner is a moderator of all threads.
+func (p *Profile) GetScopedModerators() []*entity.Moderator {
 	p.modersMx.Lock()
 	defer p.modersMx.Unlock()
 	if p.moderators == nil {
 		var err error
 		p.moderators, err = p.db.GetModerators()
 		if err != nil {
-			log.Fatalf("Failed to fetch owner's subscriptions from "+
+			log.Fatalf("Failed to fetch owner's moderators from "+
 				"the profile database: %v", err)
 		}
-		p.moderators = append(p.moderators, p.selfID)
+		p.moderators = append(p.moderators, &entity.Moderator{ID: *p.selfID})
+	}
+	res := make([]*entity.Moderator, len(p.moderators))
+	for i, m := range p.moderators {
+		mc := *m
+		res[i] = &mc
 	}
-	res := make([]*entity.ID, len(p.moderators))
-	copy(res, p.moderators)
 	return res
 }
 
+// PutQuorum sets the number of moderators, who must agree on operations of
+// the type. Revocations require the quorum of the revoked operations, so their
+// quorum can't be set.
+func (p *Profile) PutQuorum(t entity.OperationType, q *entity.Quorum) error {
+	isSupported := false
+	for _, st := range entity.QuorumOperationTypes {
+		isSupported = isSupported || st == t
+	}
+	if !isSupported || !q.IsValid() {
+		return errors.WrongArguments
+	}
+	p.quorumsMx.Lock()
+	defer p.quorumsMx.Unlock()
+	p.quorums = nil
+	return p.db.PutQuorum(t, q)
+}
+
+// GetQuorum returns the quorum for operations of the type.
+func (p *Profile) GetQuorum(t entity.OperationType) entity.Quorum {
+	p.quorumsMx.Lock()
+	defer p.quorumsMx.Unlock()
+	if p.quorums == nil {
+		var err error
+		p.quorums, err = p.db.GetQuorums()
+		if err != nil {
+			log.Fatalf("Failed to fetch owner's quorums from "+
+				"the profile database: %v", err)
+		}
+	}
+	q, ok := p.quorums[t]
+	if !ok {
+		return entity.DefaultQuorum
+	}
+	return q
+}
+
+// IsSelf checks whether the user is the owner.
+func (p *Profile) IsSelf(id *entity.ID) bool {
+	return *id == *p.selfID
+}
+
 func (p *Profile) PutSubscription(t subs.Topic) error {
 	p.subsMx.Lock()
 	defer p.subsMx.Unlock()
@@ -18,9 +18,13 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package owner
 
 import (
+	"sort"
+	"time"
 	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
 	"vminko.org/dscuss/storage"
+	"vminko.org/dscuss/subs"
 	"vminko.org/dscuss/thread"
 )
 
@@ -29,41 +33,410 @@ import (
 type View struct {
 	profile *Profile
 	storage *storage.Storage
+	trust   TrustPolicy
 }
 
-func NewView(profile *Profile, storage *storage.Storage) *View {
-	return &View{profile, storage}
+// TrustPolicy defines whether the owner trusts moderators of the moderators.
+type TrustPolicy struct {
+	// Depth is the maximum length of the chain of moderators starting from
+	// the owner. 1 means that only the owner's own moderators are trusted.
+	Depth int
+	// HopWeight is the factor the trust is multiplied by on each hop of the
+	// chain.
+	HopWeight float64
+	// MinTrust is the minimal trust making operations of a moderator
+	// effective.
+	MinTrust float64
 }
 
+const (
+	MaxTrustDepth int = 8
+)
+
+func NewView(profile *Profile, storage *storage.Storage, trust TrustPolicy) *View {
+	return &View{profile, storage, trust}
+}
+
+// ModeratorTrust computes the trust of the owner to the user as a moderator.
+// The owner's own moderators are trusted fully (1). Moderators of a trusted
+// moderator are trusted HopWeight times less than the moderator, up to Depth
+// hops from the owner. Moderators are learned from the published moderator
+// lists.
+func (v *View) ModeratorTrust(uid *entity.ID) (float64, error) {
+	tm, err := v.newTrustGraph().moderator(uid)
+	if err != nil || tm == nil {
+		return 0, err
+	}
+	return tm.trust, nil
+}
+
+// trustGraph is the graph of the moderators trusted by the owner. Building the
+// graph takes a database query per moderator, so it's built on the first use
+// and shared by all the checks made during a single call of the View.
+type trustGraph struct {
+	v     *View
+	nodes map[entity.ID]*trustedModerator
+}
+
+func (v *View) newTrustGraph() *trustGraph {
+	return &trustGraph{v: v}
+}
+
+func (g *trustGraph) moderators() (map[entity.ID]*trustedModerator, error) {
+	if g.nodes == nil {
+		nodes, err := g.v.moderatorGraph()
+		if err != nil {
+			return nil, err
+		}
+		g.nodes = nodes
+	}
+	return g.nodes, nil
+}
+
+// moderator returns the trust and the scopes of the user (nil if the user is
+// not reachable via the moderator lists).
+func (g *trustGraph) moderator(uid *entity.ID) (*trustedModerator, error) {
+	nodes, err := g.moderators()
+	if err != nil {
+		return nil, err
+	}
+	return nodes[*uid], nil
+}
+
+// count returns the number of the moderators, whose operations count towards
+// agreement: the trusted ones except the owner.
+func (g *trustGraph) count() (int, error) {
+	nodes, err := g.moderators()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for id, tm := range nodes {
+		if tm.trust >= g.v.trust.MinTrust && !g.v.profile.IsSelf(&id) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// trustedModerator is a moderator reachable from the owner via the moderator
+// lists.
+type trustedModerator struct {
+	trust float64
+	// Moderators of moderators inherit the scopes of the owner's
+	// moderators starting the chains, so a moderator reachable via several
+	// chains has several scopes. Nil scope covers all threads.
+	scopes []subs.Topic
+}
+
+// addScope extends the scopes of the moderator. Returns false if the scope is
+// already covered.
+func (tm *trustedModerator) addScope(scope subs.Topic) bool {
+	for _, s := range tm.scopes {
+		if s == nil || (scope != nil && s.ContainsTopic(scope)) {
+			return false
+		}
+	}
+	tm.scopes = append(tm.scopes, scope)
+	return true
+}
+
+// covers checks whether any of the scopes covers the topic.
+func (tm *trustedModerator) covers(topic subs.Topic) bool {
+	for _, s := range tm.scopes {
+		m := entity.Moderator{Scope: s}
+		if m.Covers(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// moderatorGraph finds all the moderators reachable via the moderator lists
+// (see ModeratorTrust). The trust is defined by the shortest chain, the scopes
+// are collected from all the chains.
+func (v *View) moderatorGraph() (map[entity.ID]*trustedModerator, error) {
+	res := make(map[entity.ID]*trustedModerator)
+	// The moderators, whose scopes were extended on the previous hop.
+	var level []entity.ID
+	for _, m := range v.profile.GetScopedModerators() {
+		tm, ok := res[m.ID]
+		if !ok {
+			tm = &trustedModerator{trust: 1}
+			res[m.ID] = tm
+			level = append(level, m.ID)
+		}
+		tm.addScope(m.Scope)
+	}
+	weight := 1.0
+	for depth := 2; depth <= v.trust.Depth && len(level) != 0; depth++ {
+		weight *= v.trust.HopWeight
+		var next []entity.ID
+		isNext := make(map[entity.ID]bool)
+		for i := range level {
+			ml, err := v.storage.GetLatestModeratorList(&level[i])
+			if err == errors.NoSuchEntity {
+				continue
+			} else if err != nil {
+				log.Errorf("Failed to get moderator list of %s: %v", level[i].Shorten(), err)
+				return nil, err
+			}
+			parent := res[level[i]]
+			for _, id := range ml.Moderators {
+				tm, ok := res[id]
+				if !ok {
+					tm = &trustedModerator{trust: weight}
+					res[id] = tm
+				}
+				isExtended := false
+				for _, s := range parent.scopes {
+					if tm.addScope(s) {
+						isExtended = true
+					}
+				}
+				if isExtended && !isNext[id] {
+					isNext[id] = true
+					next = append(next, id)
+				}
+			}
+		}
+		level = next
+	}
+	return res, nil
+}
+
+// isInScope checks whether the author of the operation is allowed to moderate
+// threads in the topic.
+func (v *View) isInScope(o *entity.Operation, topic subs.Topic, g *trustGraph) (bool, error) {
+	tm, err := g.moderator(&o.AuthorID)
+	if err != nil {
+		return false, err
+	}
+	return tm != nil && tm.covers(topic), nil
+}
+
+// rootTopic returns the topic of the thread the message belongs to. The
+// original topic of the thread is used, since moderators may disagree on
+// changing it.
+func (v *View) rootTopic(m *entity.Message) (subs.Topic, error) {
+	root, err := v.storage.GetRoot(m)
+	if err != nil {
+		log.Errorf("Failed to get root of message %s: %v", m.ID().Shorten(), err)
+		return nil, err
+	}
+	return root.Topic, nil
+}
+
+// effectiveMessageOperations filters the operations on the message performed
+// by trusted moderators, whose scopes cover the thread.
+func (v *View) effectiveMessageOperations(
+	m *entity.Message,
+	g *trustGraph,
+) ([]*entity.Operation, error) {
+	msgOps, err := v.storage.GetOperationsOnMessage(m.ID())
+	if err != nil {
+		log.Errorf("Failed to get operations on message %s: %v", m.ID().Shorten(), err)
+		return nil, err
+	}
+	if len(msgOps) == 0 {
+		return nil, nil
+	}
+	topic, err := v.rootTopic(m)
+	if err != nil {
+		return nil, err
+	}
+	var res []*entity.Operation
+	for _, o := range msgOps {
+		isEffective, err := v.isOperationEffective(o, g)
+		if err != nil {
+			return nil, err
+		}
+		if !isEffective {
+			continue
+		}
+		isInScope, err := v.isInScope(o, topic, g)
+		if err != nil {
+			return nil, err
+		}
+		if !isInScope {
+			log.Debugf("Operation %s is out of scope of its author", o.ShortID())
+			continue
+		}
+		res = append(res, o)
+	}
+	return res, nil
+}
+
+// isOperationEffective checks whether the operation is performed by a trusted
+// moderator (see ModeratorTrust) with a key, which is not revoked, and whether the
+// operation itself is not revoked. Revoking an operation requires the same
+// agreement of moderators as performing it, otherwise a single moderator could
+// undo any agreed operation. Revocations can also be revoked, so the check is
+// applied recursively; revoking a revocation requires the agreement for the
+// original operation. The order of the revocations doesn't matter. Revocations
+// dated before the operation are ignored.
+func (v *View) isOperationEffective(o *entity.Operation, g *trustGraph) (bool, error) {
+	return v.isOperationEffectiveAs(o, o.OperationType(), g)
+}
+
+// isOperationEffectiveAs checks whether the operation is effective (see
+// isOperationEffective) provided that revoking it requires the agreement for
+// operations of the type t.
+func (v *View) isOperationEffectiveAs(
+	o *entity.Operation,
+	t entity.OperationType,
+	g *trustGraph,
+) (bool, error) {
+	tm, err := g.moderator(&o.AuthorID)
+	if err != nil {
+		return false, err
+	}
+	if tm == nil || tm.trust < v.trust.MinTrust {
+		return false, nil
+	}
+	kc, err := v.storage.GetKeyChain(&o.AuthorID)
+	if err != nil {
+		log.Errorf("Failed to get key chain of %s: %v", o.AuthorID.Shorten(), err)
+		return false, err
+	}
+	if kc.KeyAt(o.DatePerformed) == nil {
+		log.Debugf("Operation %s is signed by a revoked key", o.ShortID())
+		return false, nil
+	}
+	revs, err := v.storage.GetOperationsOnOperation(o.ID())
+	if err != nil {
+		log.Errorf("Failed to get operations on operation %s: %v", o.ShortID(), err)
+		return false, err
+	}
+	revokers := make(map[entity.ID]bool)
+	for _, r := range revs {
+		if r.OperationType() != entity.OperationTypeRevokeOperation {
+			log.Fatalf("BUG: unexpected operation %s on operation %s", r, o)
+		}
+		if r.DatePerformed.Before(o.DatePerformed) {
+			log.Debugf("Revocation %s is dated before operation %s", r.ShortID(), o.ShortID())
+			continue
+		}
+		isEffective, err := v.isOperationEffectiveAs(r, t, g)
+		if err != nil {
+			return false, err
+		}
+		if isEffective {
+			revokers[r.AuthorID] = true
+		}
+	}
+	if len(revokers) == 0 {
+		return true, nil
+	}
+	n, err := g.count()
+	if err != nil {
+		return false, err
+	}
+	if v.isAgreed(t, revokers, n) {
+		log.Debugf("Operation %s is revoked by %d moderators", o.ShortID(), len(revokers))
+		return false, nil
+	}
+	return true, nil
+}
+
+// isAgreed checks whether enough of moderatorsNum moderators agreed on an
+// operation of the type. Operations performed by the owner don't need any
+// agreement.
+func (v *View) isAgreed(t entity.OperationType, authors map[entity.ID]bool, moderatorsNum int) bool {
+	for a := range authors {
+		if v.profile.IsSelf(&a) {
+			return true
+		}
+	}
+	q := v.profile.GetQuorum(t)
+	return len(authors) >= q.Required(moderatorsNum)
+}
+
+// RequiredAgreement returns the number of distinct moderators, who must agree
+// on an operation of the type in order to make it effective. The quorum is
+// computed of the same moderators, whose operations count towards agreement
+// (see trustGraph.count).
+func (v *View) RequiredAgreement(t entity.OperationType) (int, error) {
+	return v.requiredAgreement(t, v.newTrustGraph())
+}
+
+func (v *View) requiredAgreement(t entity.OperationType, g *trustGraph) (int, error) {
+	n, err := g.count()
+	if err != nil {
+		return 0, err
+	}
+	q := v.profile.GetQuorum(t)
+	return q.Required(n), nil
+}
+
+// IsUserBanned checks whether enough moderators banned the user. Permanent
+// bans also count as agreement on temporary ones.
 func (v *View) IsUserBanned(uid *entity.ID) (bool, error) {
+	return v.isUserBanned(uid, v.newTrustGraph())
+}
+
+func (v *View) isUserBanned(uid *entity.ID, g *trustGraph) (bool, error) {
 	authOps, err := v.storage.GetOperationsOnUser(uid)
 	if err != nil {
 		log.Errorf("Failed to get operations on user %s: %v", uid.Shorten(), err)
 		return false, err
 	}
+	permanent := make(map[entity.ID]bool)
+	temporary := make(map[entity.ID]bool)
 	for _, o := range authOps {
-		isModer, err := v.profile.HasModerator(&o.AuthorID)
+		isEffective, err := v.isOperationEffective(o, g)
 		if err != nil {
-			log.Errorf("Failed to check whether %s is a moderator: %v",
-				&o.AuthorID, err)
 			return false, err
 		}
-		if isModer {
+		if isEffective {
 			switch o.OperationType() {
 			case entity.OperationTypeBanUser:
-				return true, nil
+				permanent[o.AuthorID] = true
+				temporary[o.AuthorID] = true
+			case entity.OperationTypeBanUserTemporarily:
+				if time.Now().Before(*o.DateExpires) {
+					temporary[o.AuthorID] = true
+				}
 			default:
 				log.Fatal("BUG: unknown entity type %T.")
 			}
 		}
 	}
-	return false, nil
+	if len(temporary) == 0 {
+		return false, nil
+	}
+	n, err := g.count()
+	if err != nil {
+		return false, err
+	}
+	return v.isAgreed(entity.OperationTypeBanUser, permanent, n) ||
+		v.isAgreed(entity.OperationTypeBanUserTemporarily, temporary, n), nil
 }
 
 func (v *View) applyOperationToMessage(m *entity.Message, op *entity.Operation) *entity.Message {
 	switch op.OperationType() {
 	case entity.OperationTypeRemoveMessage:
 		return nil
+	case entity.OperationTypeEditMessageTopic:
+		if m.IsReply() {
+			log.Debugf("Ignoring operation %s: replies don't have topics", op.ShortID())
+			return m
+		}
+		t, err := subs.NewTopic(op.Replacement)
+		if err != nil {
+			log.Fatalf("BUG: operation %s with invalid topic passed validation", op.ShortID())
+		}
+		res := m.Copy()
+		res.Topic = t
+		return res
+	case entity.OperationTypeEditMessageSubject:
+		res := m.Copy()
+		res.Subject = op.Replacement
+		return res
+	case entity.OperationTypeEditMessageText:
+		res := m.Copy()
+		res.Text = op.Replacement
+		return res
 	default:
 		log.Fatal("BUG: unknown entity type %T.")
 	}
@@ -71,7 +444,11 @@ func (v *View) applyOperationToMessage(m *entity.Message, op *entity.Operation)
 }
 
 func (v *View) ModerateMessage(m *entity.Message) (*entity.Message, error) {
-	isBanned, err := v.IsUserBanned(&m.AuthorID)
+	return v.moderateMessage(m, v.newTrustGraph())
+}
+
+func (v *View) moderateMessage(m *entity.Message, g *trustGraph) (*entity.Message, error) {
+	isBanned, err := v.isUserBanned(&m.AuthorID, g)
 	if err != nil {
 		log.Errorf("Failed check whether %s is banned: %v", m.AuthorID.Shorten(), err)
 		return nil, err
@@ -81,19 +458,34 @@ func (v *View) ModerateMessage(m *entity.Message) (*entity.Message, error) {
 			m.ID().Shorten(), m.AuthorID.Shorten())
 		return nil, nil
 	}
-	msgOps, err := v.storage.GetOperationsOnMessage(m.ID())
+	msgOps, err := v.effectiveMessageOperations(m, g)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgOps) == 0 {
+		return m, nil
+	}
+	n, err := g.count()
 	if err != nil {
-		log.Errorf("Failed to get operations on message %s: %v", m.ID().Shorten(), err)
 		return nil, err
 	}
+	// Operations are applied when enough moderators agree on them. Edits are
+	// agreed on when the replacements match. So the edit which is the last to
+	// get enough agreement wins.
+	sort.SliceStable(msgOps, func(i, j int) bool {
+		return msgOps[i].DatePerformed.Before(msgOps[j].DatePerformed)
+	})
+	agreements := make(map[string]map[entity.ID]bool)
 	for _, o := range msgOps {
-		isModer, err := v.profile.HasModerator(&o.AuthorID)
-		if err != nil {
-			log.Errorf("Failed to check whether %s is a moderator: %v",
-				&o.AuthorID, err)
-			return nil, err
+		key := o.OperationType().String() + "\x00" + o.Replacement
+		authors, ok := agreements[key]
+		if !ok {
+			authors = make(map[entity.ID]bool)
+			agreements[key] = authors
 		}
-		if isModer {
+		wasAgreed := v.isAgreed(o.OperationType(), authors, n)
+		authors[o.AuthorID] = true
+		if !wasAgreed && v.isAgreed(o.OperationType(), authors, n) {
 			m = v.applyOperationToMessage(m, o)
 			if m == nil {
 				break
@@ -103,9 +495,31 @@ func (v *View) ModerateMessage(m *entity.Message) (*entity.Message, error) {
 	return m, nil
 }
 
+// CountRemovalVotes returns the number of distinct moderators, who removed the
+// message, and the number of moderators required to hide the message.
+func (v *View) CountRemovalVotes(m *entity.Message) (votes, required int, err error) {
+	g := v.newTrustGraph()
+	msgOps, err := v.effectiveMessageOperations(m, g)
+	if err != nil {
+		return 0, 0, err
+	}
+	authors := make(map[entity.ID]bool)
+	for _, o := range msgOps {
+		if o.OperationType() == entity.OperationTypeRemoveMessage {
+			authors[o.AuthorID] = true
+		}
+	}
+	required, err = v.requiredAgreement(entity.OperationTypeRemoveMessage, g)
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(authors), required, nil
+}
+
 func (v *View) ModerateMessages(brd []*entity.Message) (res []*entity.Message, err error) {
+	g := v.newTrustGraph()
 	for _, m := range brd {
-		mm, err := v.ModerateMessage(m)
+		mm, err := v.moderateMessage(m, g)
 		if err != nil {
 			log.Errorf("Error moderating message %s: %v", m.ID().Shorten(), err)
 			return nil, err
@@ -117,8 +531,87 @@ func (v *View) ModerateMessages(brd []*entity.Message) (res []*entity.Message, e
 	return res, nil
 }
 
+// SummarizeReactions aggregates the reactions to the message. Reactions of
+// banned users and the ones signed by revoked keys are ignored.
+func (v *View) SummarizeReactions(mid *entity.ID) (*entity.ReactionSummary, error) {
+	rr, err := v.storage.GetReactionsOnMessage(mid)
+	if err != nil {
+		log.Errorf("Failed to get reactions to message %s: %v", mid.Shorten(), err)
+		return nil, err
+	}
+	g := v.newTrustGraph()
+	var effective []*entity.Reaction
+	for _, r := range rr {
+		ok, err := v.isAuthorEffective(r, &r.AuthorID, r.DateReacted, g)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			effective = append(effective, r)
+		}
+	}
+	return entity.SummarizeReactions(effective), nil
+}
+
+// isAuthorEffective checks whether the entity e created by the user aid at the
+// time t counts: the author is not banned and the key the entity is signed by
+// is not revoked.
+func (v *View) isAuthorEffective(
+	e entity.Entity,
+	aid *entity.ID,
+	t time.Time,
+	g *trustGraph,
+) (bool, error) {
+	isBanned, err := v.isUserBanned(aid, g)
+	if err != nil {
+		log.Errorf("Failed check whether %s is banned: %v", aid.Shorten(), err)
+		return false, err
+	}
+	if isBanned {
+		log.Debugf("Author of %s (user %s) is banned", e.ShortID(), aid.Shorten())
+		return false, nil
+	}
+	kc, err := v.storage.GetKeyChain(aid)
+	if err != nil {
+		log.Errorf("Failed to get key chain of %s: %v", aid.Shorten(), err)
+		return false, err
+	}
+	if kc.KeyAt(t) == nil {
+		log.Debugf("%s is signed by a revoked key", e.ShortID())
+		return false, nil
+	}
+	return true, nil
+}
+
+// TallyPoll counts the votes on the poll of the message. Votes of banned users
+// and the ones signed by revoked keys are ignored (see also TallyVotes).
+func (v *View) TallyPoll(m *entity.Message) (*entity.PollTally, error) {
+	if m.Poll == nil {
+		log.Errorf("Message %s has no poll", m.ShortID())
+		return nil, errors.WrongArguments
+	}
+	vv, err := v.storage.GetVotesOnPoll(m.ID())
+	if err != nil {
+		log.Errorf("Failed to get votes on poll %s: %v", m.ShortID(), err)
+		return nil, err
+	}
+	g := v.newTrustGraph()
+	var effective []*entity.Vote
+	for _, vt := range vv {
+		ok, err := v.isAuthorEffective(vt, &vt.AuthorID, vt.DateVoted, g)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			effective = append(effective, vt)
+		}
+	}
+	return entity.TallyVotes(m.Poll, effective), nil
+}
+
 type ThreadModerator struct {
 	v *View
+	g *trustGraph
 }
 
 func (tm *ThreadModerator) Handle(n *thread.Node) (*entity.Message, error) {
@@ -126,7 +619,7 @@ func (tm *ThreadModerator) Handle(n *thread.Node) (*entity.Message, error) {
 	if m == nil {
 		log.Fatal("BUG: thread node with nil message")
 	}
-	mm, err := tm.v.ModerateMessage(m)
+	mm, err := tm.v.moderateMessage(m, tm.g)
 	if err != nil {
 		log.Errorf("Error moderating message %s: %v", m.ID().Shorten(), err)
 		return nil, err
@@ -135,7 +628,7 @@ func (tm *ThreadModerator) Handle(n *thread.Node) (*entity.Message, error) {
 }
 
 func (v *View) ModerateThread(t *thread.Node) (*thread.Node, error) {
-	tm := ThreadModerator{v}
+	tm := ThreadModerator{v, v.newTrustGraph()}
 	tvis := thread.NewModeratingVisitor(&tm)
 	return t.Moderate(tvis)
 }
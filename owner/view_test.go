@@ -0,0 +1,174 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package owner
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/sqlite"
+	"vminko.org/dscuss/storage"
+	"vminko.org/dscuss/subs"
+)
+
+type testUser struct {
+	*entity.User
+	signer *crypto.Signer
+}
+
+// sign returns a signature, which is parsable, but not valid for any entity.
+// Signatures are not checked by the View.
+func (u *testUser) sign(t *testing.T) crypto.Signature {
+	sig, err := u.signer.Sign([]byte("test"))
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return sig
+}
+
+func newTestUser(t *testing.T, s *storage.Storage, nickname string) *testUser {
+	priv, err := crypto.NewPrivateKey(crypto.DefaultAlgorithm)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	pow := crypto.NewPowFinder(priv.Public().EncodeToDER(), 1)
+	signer := crypto.NewSigner(priv)
+	u, err := entity.EmergeUser(nickname, "", pow.Find(), 1, signer)
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	err = s.PutEntity(u, nil)
+	if err != nil {
+		t.Fatalf("Failed to store user: %v", err)
+	}
+	return &testUser{u, signer}
+}
+
+func newTestView(t *testing.T, self *entity.ID, s *storage.Storage) *View {
+	pDB, err := sqlite.OpenProfileDatabase(filepath.Join(t.TempDir(), profileDatabaseFileName))
+	if err != nil {
+		t.Fatalf("Failed to open profile database: %v", err)
+	}
+	t.Cleanup(func() { pDB.Close() })
+	return NewView(NewProfile(pDB, self), s, TrustPolicy{Depth: 1, HopWeight: 1, MinTrust: 1})
+}
+
+func putTestOperation(
+	t *testing.T,
+	s *storage.Storage,
+	typ entity.OperationType,
+	author *testUser,
+	object *entity.ID,
+	date time.Time,
+) *entity.Operation {
+	o, err := entity.NewOperation(typ, entity.OperationReasonSpam, "", "", nil,
+		author.ID(), object, date, author.sign(t), entity.DefaultEncoding)
+	if err != nil {
+		t.Fatalf("Failed to create operation: %v", err)
+	}
+	err = s.PutEntity(o, nil)
+	if err != nil {
+		t.Fatalf("Failed to store operation: %v", err)
+	}
+	return o
+}
+
+func TestRevocationQuorum(t *testing.T) {
+	type revocation struct {
+		author string
+		// The revocation with this index or -1 for the removal by A.
+		target int
+	}
+	tests := []struct {
+		name        string
+		revocations []revocation
+		isRemoved   bool
+	}{
+		{"no revocations", nil, true},
+		{"single revocation", []revocation{{"B", -1}}, true},
+		{"same revoker twice", []revocation{{"B", -1}, {"B", -1}}, true},
+		{"agreed revocation", []revocation{{"B", -1}, {"C", -1}}, false},
+		{"revocation by owner", []revocation{{"owner", -1}}, false},
+		{
+			"single revocation of agreed revocation",
+			[]revocation{{"B", -1}, {"C", -1}, {"A", 0}},
+			false,
+		},
+		{
+			"agreed revocation of revocation",
+			[]revocation{{"B", -1}, {"C", -1}, {"A", 0}, {"D", 0}},
+			true,
+		},
+	}
+	eDB, err := sqlite.OpenEntityDatabase(filepath.Join(t.TempDir(), entityDatabaseFileName))
+	if err != nil {
+		t.Fatalf("Failed to open entity database: %v", err)
+	}
+	s := storage.New(eDB)
+	defer s.Close()
+	users := make(map[string]*testUser)
+	for _, n := range []string{"owner", "A", "B", "C", "D", "author"} {
+		users[n] = newTestUser(t, s, n)
+	}
+	v := newTestView(t, users["owner"].ID(), s)
+	for _, n := range []string{"A", "B", "C", "D"} {
+		err := v.profile.PutModerator(users[n].ID(), nil)
+		if err != nil {
+			t.Fatalf("Failed to add moderator: %v", err)
+		}
+	}
+	err = v.profile.PutQuorum(entity.OperationTypeRemoveMessage, &entity.Quorum{Count: 2})
+	if err != nil {
+		t.Fatalf("Failed to set quorum: %v", err)
+	}
+	for _, test := range tests {
+		date := time.Now().Add(-time.Hour)
+		var root entity.ID
+		m, err := entity.NewMessage(test.name, "text", users["author"].ID(), &root, date,
+			users["author"].sign(t), subs.Topic{"test"}, nil, nil, nil, entity.DefaultEncoding)
+		if err != nil {
+			t.Fatalf("Failed to create message: %v", err)
+		}
+		err = s.PutEntity(m, nil)
+		if err != nil {
+			t.Fatalf("Failed to store message: %v", err)
+		}
+		date = date.Add(time.Minute)
+		removal := putTestOperation(t, s, entity.OperationTypeRemoveMessage, users["A"], m.ID(), date)
+		putTestOperation(t, s, entity.OperationTypeRemoveMessage, users["C"], m.ID(), date)
+		var revs []*entity.Operation
+		for _, r := range test.revocations {
+			target := removal
+			if r.target >= 0 {
+				target = revs[r.target]
+			}
+			date = date.Add(time.Minute)
+			revs = append(revs, putTestOperation(t, s, entity.OperationTypeRevokeOperation,
+				users[r.author], target.ID(), date))
+		}
+		mm, err := v.ModerateMessage(m)
+		if err != nil {
+			t.Fatalf("%s: failed to moderate message: %v", test.name, err)
+		}
+		if (mm == nil) != test.isRemoved {
+			t.Errorf("%s: expected removed %t, got %t", test.name, test.isRemoved, mm == nil)
+		}
+	}
+}
@@ -20,18 +20,22 @@ package p2p
 import (
 	"bufio"
 	"os"
+	"strings"
 	"vminko.org/dscuss/address"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
 )
 
 // AddressList provider node addresses by reading them from a text file.
+// Lines starting with 'relay ' specify addresses of relay servers.
 // Implements AddressProvider interface
 type AddressList struct {
 	filepath string
 	ac       AddressConsumer
 }
 
+const relayLinePrefix string = "relay "
+
 func NewAddressList(filepath string) *AddressList {
 	return &AddressList{filepath: filepath}
 }
@@ -61,12 +65,21 @@ func (al *AddressList) readAddresses() {
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
+		isRelay := strings.HasPrefix(line, relayLinePrefix)
+		if isRelay {
+			line = strings.TrimPrefix(line, relayLinePrefix)
+		}
 		if !address.IsValid(line) {
 			log.Warningf("'%s' is not a valid peer address, ignoring it.", line)
-			log.Warning("Valid peer address is either host:port or ip:port.")
+			log.Warning("Valid peer address is either host:port, ip:port or [ipv6]:port.")
 			al.ac.ErrorFindingAddresses(errors.Parsing)
 			continue
 		}
+		if isRelay {
+			log.Debugf("Found relay address %s", line)
+			al.ac.RelayFound(line)
+			continue
+		}
 		log.Debugf("Found peer address %s", line)
 		al.ac.AddressFound(line)
 	}
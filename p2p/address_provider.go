@@ -19,6 +19,8 @@ package p2p
 
 type AddressConsumer interface {
 	AddressFound(a string)
+	// RelayFound is called when a relay server is found.
+	RelayFound(a string)
 	ErrorFindingAddresses(err error)
 }
 
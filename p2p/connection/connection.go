@@ -18,8 +18,14 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package connection
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"sync"
 	"time"
@@ -33,20 +39,55 @@ const (
 	// Limits the size of a packet. Anything larger will cause
 	// a decoding error.
 	MaxPacketSize int = 10 * 1024
+	// CompressionFlate is the name of the DEFLATE compression (RFC 1951).
+	CompressionFlate string = "flate"
+)
+
+// Framing defines the way packets are delimited in the stream.
+type Framing int
+
+const (
+	// FramingJSON means that each JSON-encoded packet is terminated by a
+	// newline.
+	FramingJSON Framing = iota
+	// FramingBinary means that each packet is preceded by a header
+	// containing the length of the packet and the flags.
+	FramingBinary
+)
+
+const (
+	// The header consists of the length (4 bytes, big-endian) and the
+	// flags (1 byte).
+	frameHeaderSize int  = 5
+	frameFlagFlate  byte = 1 << 0
 )
 
 // Connection is responsible for transferring packets via the network.
 type Connection struct {
 	conn         net.Conn
+	rw           io.ReadWriter // The network connection or the encrypted channel.
 	addresses    []string
 	addrMx       sync.RWMutex
 	isIncoming   bool
 	closeHandler func(*Connection)
+	framing      Framing
+	compress     bool
+	// Keeps the partially read packet between the reads. It reads from a
+	// buffer over rw, which is never read beyond the packet being read,
+	// so the framing can be switched between any two packets.
+	frames partialReader
+	// The binding of the encrypted channel, nil if the connection is not
+	// encrypted.
+	binding           []byte
+	noEncryption      bool
+	encryptionRefused bool
+	isRelayed         bool
 }
 
 func New(conn net.Conn, isIncoming bool) *Connection {
 	return &Connection{
 		conn:       conn,
+		rw:         conn,
 		addresses:  []string{conn.RemoteAddr().String()},
 		isIncoming: isIncoming,
 	}
@@ -62,17 +103,79 @@ func fixErrClosedConnection(err error) error {
 	return err
 }
 
+// SetFraming switches the connection to the framing f starting from the next
+// packet. If compress is true, the packets are compressed before sending.
+func (c *Connection) SetFraming(f Framing, compress bool) {
+	c.framing = f
+	c.compress = compress
+}
+
 func (c *Connection) ReadFull(timeout time.Duration) (*packet.Packet, error) {
 	c.conn.SetDeadline(time.Now().Add(timeout))
-	d := json.NewDecoder(limitReader(c.conn, MaxPacketSize))
-	d.DisallowUnknownFields()
-	var p packet.Packet
-	err := d.Decode(&p)
+	// The channel is secured before reading any packets.
+	if c.frames.r == nil {
+		c.frames.r = bufio.NewReader(c.rw)
+	}
+	if c.framing == FramingBinary {
+		return c.readFrame()
+	}
+	return c.readLine()
+}
+
+// readLine reads a JSON-encoded packet terminated by a newline (that's how
+// json.Encoder writes it).
+func (c *Connection) readLine() (*packet.Packet, error) {
+	err := c.frames.fillLine(MaxPacketSize)
 	if err != nil {
 		return nil, fixErrClosedConnection(err)
 	}
+	data := make([]byte, len(c.frames.buf))
+	copy(data, c.frames.buf)
+	c.frames.reset()
+	p, err := packet.Decode(data)
+	if err != nil {
+		return nil, err
+	}
 	log.Debugf("Received this packet from %s: %s", c.RemoteAddr(), p.Dump())
-	return &p, nil
+	return p, nil
+}
+
+func (c *Connection) readFrame() (*packet.Packet, error) {
+	err := c.frames.fill(frameHeaderSize)
+	if err != nil {
+		return nil, fixErrClosedConnection(err)
+	}
+	size := binary.BigEndian.Uint32(c.frames.buf[:4])
+	flags := c.frames.buf[4]
+	if size > uint32(MaxPacketSize) {
+		log.Debugf("Peer %s sent a frame of %d bytes", c.RemoteAddr(), size)
+		return nil, errors.PacketSizeExceeded
+	}
+	err = c.frames.fill(frameHeaderSize + int(size))
+	if err != nil {
+		return nil, fixErrClosedConnection(err)
+	}
+	data := make([]byte, size)
+	copy(data, c.frames.buf[frameHeaderSize:])
+	c.frames.reset()
+	if flags&frameFlagFlate != 0 {
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		data, err = ioutil.ReadAll(io.LimitReader(r, int64(MaxPacketSize)+1))
+		if err != nil {
+			log.Debugf("Can't decompress frame from %s: %v", c.RemoteAddr(), err)
+			return nil, errors.Parsing
+		}
+		if len(data) > MaxPacketSize {
+			return nil, errors.PacketSizeExceeded
+		}
+	}
+	p, err := packet.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Received this packet from %s: %s", c.RemoteAddr(), p.Dump())
+	return p, nil
 }
 
 func (c *Connection) Read() (*packet.Packet, error) {
@@ -82,10 +185,40 @@ func (c *Connection) Read() (*packet.Packet, error) {
 func (c *Connection) WriteFull(p *packet.Packet, timeout time.Duration) error {
 	log.Debugf("Sending this packet to %s: %s", c.RemoteAddr(), p.Dump())
 	c.conn.SetDeadline(time.Now().Add(timeout))
-	e := json.NewEncoder(limitWriter(c.conn, MaxPacketSize))
+	if c.framing == FramingBinary {
+		return c.writeFrame(p)
+	}
+	e := json.NewEncoder(limitWriter(c.rw, MaxPacketSize))
 	return fixErrClosedConnection(e.Encode(p))
 }
 
+func (c *Connection) writeFrame(p *packet.Packet) error {
+	data := p.Encode()
+	if len(data) > MaxPacketSize {
+		return errors.PacketSizeExceeded
+	}
+	var flags byte
+	if c.compress {
+		var b bytes.Buffer
+		w, err := flate.NewWriter(&b, flate.DefaultCompression)
+		if err != nil {
+			log.Fatal("Can't create flate writer: " + err.Error())
+		}
+		w.Write(data)
+		w.Close()
+		if b.Len() < len(data) {
+			data = b.Bytes()
+			flags |= frameFlagFlate
+		}
+	}
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(data))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(data)))
+	frame[4] = flags
+	frame = append(frame, data...)
+	_, err := c.rw.Write(frame)
+	return fixErrClosedConnection(err)
+}
+
 func (c *Connection) Write(p *packet.Packet) error {
 	return c.WriteFull(p, DefaultTimeout)
 }
@@ -0,0 +1,259 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package connection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/packet"
+)
+
+func newTestSigner(t *testing.T) *crypto.Signer {
+	priv, err := crypto.NewPrivateKey(crypto.DefaultAlgorithm)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return crypto.NewSigner(priv)
+}
+
+// TestFramingSwitch checks that a packet in the new framing sent right after
+// a JSON-encoded packet (in the same write) is not lost.
+func TestFramingSwitch(t *testing.T) {
+	signer := newTestSigner(t)
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{"plain", false},
+		{"compressed", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := net.Pipe()
+			defer a.Close()
+			defer b.Close()
+			var buf bytes.Buffer
+			w := New(a, false)
+			w.rw = &buf
+			first := packet.New(packet.TypeDone, &entity.ZeroID, packet.NewPayloadDone(), signer)
+			second := packet.New(packet.TypeAck, &entity.ZeroID, packet.NewPayloadAck(), signer)
+			if err := w.Write(first); err != nil {
+				t.Fatalf("Failed to write JSON packet: %v", err)
+			}
+			w.SetFraming(FramingBinary, tt.compress)
+			if err := w.Write(second); err != nil {
+				t.Fatalf("Failed to write frame: %v", err)
+			}
+			go func() {
+				a.Write(buf.Bytes())
+			}()
+			r := New(b, true)
+			p, err := r.Read()
+			if err != nil {
+				t.Fatalf("Failed to read JSON packet: %v", err)
+			}
+			if !bytes.Equal(p.Encode(), first.Encode()) {
+				t.Errorf("JSON packet differs from the sent one")
+			}
+			r.SetFraming(FramingBinary, tt.compress)
+			p, err = r.Read()
+			if err != nil {
+				t.Fatalf("Failed to read frame: %v", err)
+			}
+			if !bytes.Equal(p.Encode(), second.Encode()) {
+				t.Errorf("Frame differs from the sent one")
+			}
+		})
+	}
+}
+
+// newTestSecureStreams returns the ends of a channel writing the records to
+// the buffer.
+func newTestSecureStreams(buf *bytes.Buffer) (initiator, responder *secureStream) {
+	shared := bytes.Repeat([]byte{1}, 32)
+	binding := bytes.Repeat([]byte{2}, 32)
+	return newSecureStream(buf, shared, binding, true), newSecureStream(buf, shared, binding, false)
+}
+
+func TestSecureStream(t *testing.T) {
+	var buf bytes.Buffer
+	w, r := newTestSecureStreams(&buf)
+	data := make([]byte, 2*maxRecordSize+1)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	n, err := w.Write(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("Failed to write %d bytes: %d, %v", len(data), n, err)
+	}
+	overhead := w.send.Overhead()
+	if buf.Len() != len(data)+3*(recordHeaderSize+overhead) {
+		t.Errorf("Expected 3 records, got %d bytes", buf.Len())
+	}
+	res := make([]byte, len(data))
+	_, err = io.ReadFull(r, res)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if !bytes.Equal(res, data) {
+		t.Errorf("Read data differs from the written one")
+	}
+
+	tests := []struct {
+		name     string
+		corrupt  func(records []byte) []byte
+		expected error
+	}{
+		{
+			"oversized record",
+			func(records []byte) []byte {
+				size := uint32(maxRecordSize + overhead + 1)
+				binary.BigEndian.PutUint32(records[:recordHeaderSize], size)
+				return records
+			},
+			errors.PacketSizeExceeded,
+		},
+		{
+			"tampered record",
+			func(records []byte) []byte {
+				records[recordHeaderSize] ^= 1
+				return records
+			},
+			errors.CantDecrypt,
+		},
+		{
+			"reordered records",
+			func(records []byte) []byte {
+				half := len(records) / 2
+				return append(append([]byte{}, records[half:]...), records[:half]...)
+			},
+			errors.CantDecrypt,
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w, r := newTestSecureStreams(&buf)
+		// Two records of the same size.
+		w.Write([]byte("first"))
+		w.Write([]byte("again"))
+		records := tt.corrupt(buf.Bytes())
+		buf.Reset()
+		buf.Write(records)
+		_, err := r.Read(make([]byte, 16))
+		if err != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestSecureChannel(t *testing.T) {
+	signer := newTestSigner(t)
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	active, passive := New(a, false), New(b, true)
+	done := make(chan error)
+	go func() {
+		done <- active.SecureActive()
+	}()
+	err := passive.SecurePassive()
+	if err != nil {
+		t.Fatalf("Passive side failed to secure the connection: %v", err)
+	}
+	err = <-done
+	if err != nil {
+		t.Fatalf("Active side failed to secure the connection: %v", err)
+	}
+	if !active.IsSecure() || !passive.IsSecure() {
+		t.Fatalf("Connection is not secure")
+	}
+	if len(active.Binding()) == 0 || !bytes.Equal(active.Binding(), passive.Binding()) {
+		t.Errorf("Bindings differ: %x vs %x", active.Binding(), passive.Binding())
+	}
+	sent := packet.New(packet.TypeDone, &entity.ZeroID, packet.NewPayloadDone(), signer)
+	go func() {
+		done <- active.Write(sent)
+	}()
+	p, err := passive.Read()
+	if err != nil {
+		t.Fatalf("Failed to read packet: %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatalf("Failed to write packet: %v", err)
+	}
+	if !bytes.Equal(p.Encode(), sent.Encode()) {
+		t.Errorf("Packet differs from the sent one")
+	}
+}
+
+// TestSecurePlaintextPeer checks the connections with the peers, which don't
+// support encryption.
+func TestSecurePlaintextPeer(t *testing.T) {
+	signer := newTestSigner(t)
+	sent := packet.New(packet.TypeDone, &entity.ZeroID, packet.NewPayloadDone(), signer)
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	plain, passive := New(a, false), New(b, true)
+	done := make(chan error)
+	go func() {
+		done <- plain.Write(sent)
+	}()
+	err := passive.SecurePassive()
+	if err != nil {
+		t.Fatalf("Failed to accept plaintext connection: %v", err)
+	}
+	if passive.IsSecure() {
+		t.Errorf("Plaintext connection is considered secure")
+	}
+	// The byte peeked by SecurePassive must not be lost.
+	p, err := passive.Read()
+	if err != nil {
+		t.Fatalf("Failed to read packet: %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatalf("Failed to write packet: %v", err)
+	}
+	if !bytes.Equal(p.Encode(), sent.Encode()) {
+		t.Errorf("Packet differs from the sent one")
+	}
+
+	c, d := net.Pipe()
+	defer c.Close()
+	active := New(c, false)
+	go func() {
+		// Peers not supporting encryption drop the connection on the
+		// malformed packet.
+		io.ReadFull(d, make([]byte, len(secureMagic)+32))
+		d.Close()
+	}()
+	err = active.SecureActive()
+	if err == nil {
+		t.Fatalf("Connection is secured with plaintext peer")
+	}
+	if !active.EncryptionRefused() || active.IsSecure() {
+		t.Errorf("Refused encryption is not detected")
+	}
+}
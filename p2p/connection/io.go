@@ -22,24 +22,6 @@ import (
 	"vminko.org/dscuss/errors"
 )
 
-// limitReader returns a Reader that reads from r
-// but stops with PacketSizeExceeded after n bytes.
-func limitReader(r io.Reader, n int) io.Reader { return &limitedReader{r, n} }
-
-type limitedReader struct {
-	R io.Reader // underlying reader
-	N int       // max bytes remaining
-}
-
-func (l *limitedReader) Read(p []byte) (n int, err error) {
-	if (l.N <= 0) || (len(p) > l.N) {
-		return 0, errors.PacketSizeExceeded
-	}
-	n, err = l.R.Read(p)
-	l.N -= n
-	return
-}
-
 // limitWriter returns a Writer that writes to w
 // but stops with PacketSizeExceeded after n bytes.
 type limitedWriter struct {
@@ -57,3 +39,54 @@ func (l *limitedWriter) Write(p []byte) (n int, err error) {
 	l.N -= n
 	return
 }
+
+// partialReader reads data of the requested size from r. The data read before
+// an error (like a timeout) is kept, so the next call continues reading.
+type partialReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+// fill reads until the buffer contains n bytes.
+func (p *partialReader) fill(n int) error {
+	if cap(p.buf) < n {
+		b := make([]byte, len(p.buf), n)
+		copy(b, p.buf)
+		p.buf = b
+	}
+	for len(p.buf) < n {
+		m, err := p.r.Read(p.buf[len(p.buf):n])
+		p.buf = p.buf[:len(p.buf)+m]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillLine reads until the buffer ends with a newline, one byte at a time, so
+// nothing after the newline is consumed. Returns PacketSizeExceeded if the line
+// is longer than max bytes.
+func (p *partialReader) fillLine(max int) error {
+	for len(p.buf) == 0 || p.buf[len(p.buf)-1] != '\n' {
+		if len(p.buf) >= max {
+			return errors.PacketSizeExceeded
+		}
+		if cap(p.buf) == len(p.buf) {
+			b := make([]byte, len(p.buf), 2*len(p.buf)+64)
+			copy(b, p.buf)
+			p.buf = b
+		}
+		m, err := p.r.Read(p.buf[len(p.buf) : len(p.buf)+1])
+		p.buf = p.buf[:len(p.buf)+m]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reset discards the data read.
+func (p *partialReader) reset() {
+	p.buf = p.buf[:0]
+}
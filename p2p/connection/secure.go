@@ -0,0 +1,310 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package connection
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"golang.org/x/crypto/curve25519"
+	"io"
+	"net"
+	"time"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// The encrypted channel is established by exchanging ephemeral X25519 keys.
+// The initiator sends the magic followed by its key, the responder replies
+// the same way. Each direction is encrypted with its own AES-256-GCM key
+// derived from the shared secret. The channel is bound to the identities of
+// the users by the binding (the hash of both ephemeral keys), which the
+// users sign during the handshake.
+
+const (
+	// The first byte of a JSON-encoded packet is '{', so the magic
+	// distinguishes the encrypted connections from the plaintext ones.
+	secureMagic    string = "DSC\x01"
+	secureKDFLabel string = "dscuss-channel"
+	// The maximum size of the plaintext of a record.
+	maxRecordSize int = 16 * 1024
+	// Records are preceded by the length of the ciphertext (4 bytes,
+	// big-endian).
+	recordHeaderSize int = 4
+)
+
+// secureStream encrypts the data written to the underlying stream and
+// decrypts the data read from it.
+type secureStream struct {
+	rw      io.ReadWriter
+	send    cipher.AEAD
+	recv    cipher.AEAD
+	sendSeq uint64
+	recvSeq uint64
+	records partialReader
+	plain   []byte
+}
+
+func newAEAD(shared, binding []byte, direction string) cipher.AEAD {
+	h := sha256.New()
+	h.Write([]byte(secureKDFLabel))
+	h.Write([]byte(direction))
+	h.Write(shared)
+	h.Write(binding)
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		log.Fatalf("Can't create AES cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		log.Fatalf("Can't create GCM cipher: %v", err)
+	}
+	return aead
+}
+
+func newSecureStream(rw io.ReadWriter, shared, binding []byte, isInitiator bool) *secureStream {
+	i2r := newAEAD(shared, binding, "i2r")
+	r2i := newAEAD(shared, binding, "r2i")
+	s := &secureStream{rw: rw, send: i2r, recv: r2i}
+	if !isInitiator {
+		s.send, s.recv = r2i, i2r
+	}
+	s.records.r = rw
+	return s
+}
+
+func recordNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+func (s *secureStream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > maxRecordSize {
+			n = maxRecordSize
+		}
+		record := make([]byte, recordHeaderSize, recordHeaderSize+n+s.send.Overhead())
+		record = s.send.Seal(record, recordNonce(s.send, s.sendSeq), p[:n], nil)
+		binary.BigEndian.PutUint32(record[:recordHeaderSize], uint32(len(record)-recordHeaderSize))
+		s.sendSeq++
+		_, err := s.rw.Write(record)
+		if err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (s *secureStream) Read(p []byte) (int, error) {
+	if len(s.plain) == 0 {
+		err := s.readRecord()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+func (s *secureStream) readRecord() error {
+	err := s.records.fill(recordHeaderSize)
+	if err != nil {
+		return err
+	}
+	size := int(binary.BigEndian.Uint32(s.records.buf[:recordHeaderSize]))
+	if size > maxRecordSize+s.recv.Overhead() {
+		log.Debugf("Got a record of %d bytes", size)
+		return errors.PacketSizeExceeded
+	}
+	err = s.records.fill(recordHeaderSize + size)
+	if err != nil {
+		return err
+	}
+	plain, err := s.recv.Open(nil, recordNonce(s.recv, s.recvSeq),
+		s.records.buf[recordHeaderSize:], nil)
+	if err != nil {
+		log.Debugf("Can't decrypt a record: %v", err)
+		return errors.CantDecrypt
+	}
+	s.recvSeq++
+	s.records.reset()
+	s.plain = plain
+	return nil
+}
+
+func newEphemeralKey() (scalar, public []byte) {
+	scalar = make([]byte, curve25519.ScalarSize)
+	_, err := rand.Read(scalar)
+	if err != nil {
+		log.Fatalf("Can't generate ephemeral key: %v", err)
+	}
+	public, err = curve25519.X25519(scalar, curve25519.Basepoint)
+	if err != nil {
+		log.Fatalf("Can't compute ephemeral public key: %v", err)
+	}
+	return scalar, public
+}
+
+func (c *Connection) readEphemeralKey() ([]byte, error) {
+	key := make([]byte, curve25519.PointSize)
+	_, err := io.ReadFull(c.conn, key)
+	if err != nil {
+		return nil, fixErrClosedConnection(err)
+	}
+	return key, nil
+}
+
+// establish computes the keys of the channel and switches the connection to
+// it.
+func (c *Connection) establish(scalar, initiatorKey, responderKey []byte) error {
+	peerKey := responderKey
+	if c.isIncoming {
+		peerKey = initiatorKey
+	}
+	shared, err := curve25519.X25519(scalar, peerKey)
+	if err != nil {
+		log.Infof("Peer %s sent invalid ephemeral key: %v", c.RemoteAddr(), err)
+		return errors.ProtocolViolation
+	}
+	h := sha256.New()
+	h.Write([]byte(secureKDFLabel))
+	h.Write(initiatorKey)
+	h.Write(responderKey)
+	c.binding = h.Sum(nil)
+	c.rw = newSecureStream(c.conn, shared, c.binding, !c.isIncoming)
+	log.Debugf("Established encrypted channel with %s", c.RemoteAddr())
+	return nil
+}
+
+// SecureActive establishes the encrypted channel with the remote peer. If the
+// remote peer closes the connection instead of replying, the connection is
+// marked as refused (see EncryptionRefused).
+func (c *Connection) SecureActive() error {
+	c.conn.SetDeadline(time.Now().Add(DefaultTimeout))
+	scalar, public := newEphemeralKey()
+	_, err := c.conn.Write(append([]byte(secureMagic), public...))
+	if err != nil {
+		return fixErrClosedConnection(err)
+	}
+	magic := make([]byte, len(secureMagic))
+	_, err = io.ReadFull(c.conn, magic)
+	if err != nil {
+		if neterr, ok := err.(net.Error); !(ok && neterr.Timeout()) {
+			log.Infof("Peer %s refused to encrypt the connection: %v", c.RemoteAddr(), err)
+			c.encryptionRefused = true
+		}
+		return fixErrClosedConnection(err)
+	}
+	if string(magic) != secureMagic {
+		log.Infof("Peer %s replied with wrong magic", c.RemoteAddr())
+		return errors.ProtocolViolation
+	}
+	peerKey, err := c.readEphemeralKey()
+	if err != nil {
+		return err
+	}
+	return c.establish(scalar, public, peerKey)
+}
+
+// SecurePassive establishes the encrypted channel if the remote peer starts
+// it. Otherwise the connection remains unencrypted.
+func (c *Connection) SecurePassive() error {
+	c.conn.SetDeadline(time.Now().Add(DefaultTimeout))
+	first := make([]byte, 1)
+	_, err := io.ReadFull(c.conn, first)
+	if err != nil {
+		return fixErrClosedConnection(err)
+	}
+	if first[0] != secureMagic[0] {
+		// Return the byte back to the stream.
+		c.rw = &prefixedStream{io.MultiReader(bytes.NewReader(first), c.conn), c.conn}
+		return nil
+	}
+	magic := make([]byte, len(secureMagic)-1)
+	_, err = io.ReadFull(c.conn, magic)
+	if err != nil {
+		return fixErrClosedConnection(err)
+	}
+	if string(first)+string(magic) != secureMagic {
+		log.Infof("Peer %s sent wrong magic", c.RemoteAddr())
+		return errors.ProtocolViolation
+	}
+	peerKey, err := c.readEphemeralKey()
+	if err != nil {
+		return err
+	}
+	scalar, public := newEphemeralKey()
+	_, err = c.conn.Write(append([]byte(secureMagic), public...))
+	if err != nil {
+		return fixErrClosedConnection(err)
+	}
+	return c.establish(scalar, peerKey, public)
+}
+
+// prefixedStream reads the data, which was read from the network in advance,
+// before reading from the network.
+type prefixedStream struct {
+	io.Reader
+	io.Writer
+}
+
+// IsSecure returns true if the connection is encrypted.
+func (c *Connection) IsSecure() bool {
+	return c.binding != nil
+}
+
+// Binding returns the value identifying the encrypted channel. Peers sign it
+// to prove that they are the endpoints of the channel.
+func (c *Connection) Binding() []byte {
+	return c.binding
+}
+
+// SetRelayed marks the connection as established through a relay. Such
+// connections must be encrypted.
+func (c *Connection) SetRelayed() {
+	c.isRelayed = true
+}
+
+func (c *Connection) IsRelayed() bool {
+	return c.isRelayed
+}
+
+// DisableEncryption makes the connection skip establishing the encrypted
+// channel, because the remote peer refused it before.
+func (c *Connection) DisableEncryption() {
+	c.noEncryption = true
+}
+
+func (c *Connection) IsEncryptionDisabled() bool {
+	return c.noEncryption
+}
+
+// EncryptionRefused returns true if the remote peer refused to establish the
+// encrypted channel.
+func (c *Connection) EncryptionRefused() bool {
+	return c.encryptionRefused
+}
@@ -20,6 +20,7 @@ package p2p
 import (
 	"context"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -91,11 +92,23 @@ type ConnectionProvider struct {
 	maxOutConnCount uint32
 	inConnCount     uint32
 	outConnCount    uint32
+	// Addresses of the peers, which refused to encrypt connections.
+	plainAddrs  sync.Map
+	relayServer *RelayServer
+	// useRelay makes the provider accept connections through relays.
+	useRelay  bool
+	relays    []string
+	relayMx   sync.RWMutex
+	relayConn net.Conn // The control connection with the relay
 }
 
+// NewConnectionProvider creates a new provider. The relay server is started
+// unless relayHostport is empty.
 func NewConnectionProvider(
 	aps []AddressProvider,
 	hostport string,
+	relayHostport string,
+	useRelay bool,
 	maxInConnCount uint32,
 	maxOutConnCount uint32,
 ) *ConnectionProvider {
@@ -109,6 +122,10 @@ func NewConnectionProvider(
 		outAddrs:        &addressMap{m: make(map[string]bool)},
 		inConnCount:     0,
 		outConnCount:    0,
+		useRelay:        useRelay,
+	}
+	if relayHostport != "" {
+		cp.relayServer = NewRelayServer(relayHostport)
 	}
 	setDefaultBootstrapAddresses(cp.outAddrs)
 	return cp
@@ -120,9 +137,16 @@ func setDefaultBootstrapAddresses(outAddrs *addressMap) {
 
 func (cp *ConnectionProvider) Start() {
 	log.Debugf("Starting ConnectionProvider")
+	if cp.relayServer != nil {
+		cp.relayServer.Start()
+	}
 	cp.wg.Add(2)
 	go cp.listenIncomingConnections()
 	go cp.establishOutgoingConnections()
+	if cp.useRelay {
+		cp.wg.Add(1)
+		go cp.keepRelayRegistration()
+	}
 	for _, ap := range cp.aps {
 		ap.RegisterAddressConsumer(cp)
 		ap.Start()
@@ -138,6 +162,14 @@ func (cp *ConnectionProvider) Stop() {
 	if cp.listener != nil {
 		cp.listener.Close()
 	}
+	cp.relayMx.Lock()
+	if cp.relayConn != nil {
+		cp.relayConn.Close()
+	}
+	cp.relayMx.Unlock()
+	if cp.relayServer != nil {
+		cp.relayServer.Stop()
+	}
 	cp.wg.Wait()
 	close(cp.outChan)
 	log.Debugf("ConnectionProvider stopped")
@@ -151,13 +183,34 @@ func (cp *ConnectionProvider) AddressFound(a string) {
 	cp.outAddrs.Add(a, false)
 }
 
+func (cp *ConnectionProvider) RelayFound(a string) {
+	cp.relayMx.Lock()
+	defer cp.relayMx.Unlock()
+	for _, r := range cp.relays {
+		if r == a {
+			return
+		}
+	}
+	log.Debugf("Found relay %s", a)
+	cp.relays = append(cp.relays, a)
+}
+
+func (cp *ConnectionProvider) listRelays() []string {
+	cp.relayMx.RLock()
+	defer cp.relayMx.RUnlock()
+	res := make([]string, len(cp.relays))
+	copy(res, cp.relays)
+	return res
+}
+
 func (cp *ConnectionProvider) ErrorFindingAddresses(err error) {
 	log.Fatalf("AddressProvider failure: %v", err)
 }
 
 func (cp *ConnectionProvider) listenIncomingConnections() {
 	defer cp.wg.Done()
-	tcpAddr, err := net.ResolveTCPAddr("tcp4", cp.hostport)
+	// Listens on both IPv4 and IPv6 unless the address is specified.
+	tcpAddr, err := net.ResolveTCPAddr("tcp", cp.hostport)
 	if err != nil {
 		log.Fatalf("Can't resolve %s: %v", cp.hostport, err)
 	}
@@ -202,14 +255,29 @@ func (cp *ConnectionProvider) tryToConnect(addr string, isUsed bool) bool {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*ConnectionProviderLatency)
 	defer cancel()
 	conn, err := d.DialContext(ctx, "tcp", addr)
+	isRelayed := false
 	if err != nil {
 		log.Infof("Can't establish TCP connection with %s: %v", addr, err)
-		return true
+		conn = cp.dialViaRelay(addr)
+		if conn == nil {
+			return true
+		}
+		isRelayed = true
 	}
 	log.Infof("Established new connection with %s", conn.RemoteAddr().String())
 	atomic.AddUint32(&cp.outConnCount, 1)
 	cp.outAddrs.Change(addr, true)
 	dconn := connection.New(conn, false)
+	if isRelayed {
+		dconn.SetRelayed()
+		dconn.ClearAddresses()
+		dconn.AddAddresses([]string{addr})
+	}
+	_, isPlain := cp.plainAddrs.Load(addr)
+	_, isPlainRemote := cp.plainAddrs.Load(dconn.RemoteAddr())
+	if isPlain || isPlainRemote {
+		dconn.DisableEncryption()
+	}
 	dconn.RegisterCloseHandler(cp.createCloseConnHandler())
 	cp.outChan <- dconn
 	if atomic.LoadUint32(&cp.outConnCount) == cp.maxOutConnCount {
@@ -219,6 +287,136 @@ func (cp *ConnectionProvider) tryToConnect(addr string, isUsed bool) bool {
 	return true
 }
 
+// dialViaRelay asks the known relays to connect to the address. Returns nil if
+// none of them succeeded.
+func (cp *ConnectionProvider) dialViaRelay(addr string) net.Conn {
+	for _, r := range cp.listRelays() {
+		conn, err := net.DialTimeout("tcp", r, time.Second*ConnectionProviderLatency)
+		if err != nil {
+			log.Debugf("Can't connect to relay %s: %v", r, err)
+			continue
+		}
+		// The relay waits for the peer to accept the connection.
+		err = relayRequest(conn, &relayMessage{Cmd: relayCmdConnect, Addr: addr},
+			2*connection.DefaultTimeout)
+		if err != nil {
+			log.Debugf("Relay %s failed to connect to %s: %v", r, addr, err)
+			conn.Close()
+			continue
+		}
+		log.Infof("Connected to %s via relay %s", addr, r)
+		return conn
+	}
+	return nil
+}
+
+// keepRelayRegistration keeps the owner registered at one of the known relays
+// and accepts the connections the relay forwards.
+func (cp *ConnectionProvider) keepRelayRegistration() {
+	defer cp.wg.Done()
+	_, portStr, err := net.SplitHostPort(cp.hostport)
+	if err != nil {
+		log.Fatalf("Can't parse %s: %v", cp.hostport, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		log.Fatalf("Can't parse port %s: %v", portStr, err)
+	}
+	for {
+		for _, r := range cp.listRelays() {
+			select {
+			case <-cp.stopChan:
+				log.Debug("Stop requested")
+				return
+			default:
+			}
+			cp.serveRelayRegistration(r, port)
+		}
+		select {
+		case <-cp.stopChan:
+			log.Debug("Stop requested")
+			return
+		case <-time.After(time.Second * ConnectionProviderLatency):
+		}
+	}
+}
+
+// serveRelayRegistration registers at the relay and accepts connections until
+// the control connection is closed.
+func (cp *ConnectionProvider) serveRelayRegistration(relay string, port int) {
+	conn, err := net.DialTimeout("tcp", relay, time.Second*ConnectionProviderLatency)
+	if err != nil {
+		log.Debugf("Can't connect to relay %s: %v", relay, err)
+		return
+	}
+	cp.relayMx.Lock()
+	select {
+	case <-cp.stopChan:
+		cp.relayMx.Unlock()
+		conn.Close()
+		return
+	default:
+	}
+	cp.relayConn = conn
+	cp.relayMx.Unlock()
+	defer func() {
+		cp.relayMx.Lock()
+		cp.relayConn = nil
+		cp.relayMx.Unlock()
+		conn.Close()
+	}()
+	err = relayRequest(conn, &relayMessage{Cmd: relayCmdRegister, Port: port},
+		connection.DefaultTimeout)
+	if err != nil {
+		log.Infof("Failed to register at relay %s: %v", relay, err)
+		return
+	}
+	log.Infof("Registered at relay %s", relay)
+	for {
+		m, err := readRelayMessage(conn, 0)
+		if err != nil {
+			log.Infof("Lost connection with relay %s: %v", relay, err)
+			return
+		}
+		if m.Cmd != relayCmdIncoming {
+			log.Infof("Relay %s sent unexpected message '%s'", relay, m.Cmd)
+			return
+		}
+		cp.wg.Add(1)
+		go cp.acceptViaRelay(relay, m.Token)
+	}
+}
+
+func (cp *ConnectionProvider) acceptViaRelay(relay, token string) {
+	defer cp.wg.Done()
+	if atomic.LoadUint32(&cp.inConnCount) >= cp.maxInConnCount {
+		log.Debug("Reached maxInConnCount, ignoring relayed connection")
+		return
+	}
+	conn, err := net.DialTimeout("tcp", relay, time.Second*ConnectionProviderLatency)
+	if err != nil {
+		log.Debugf("Can't connect to relay %s: %v", relay, err)
+		return
+	}
+	err = relayRequest(conn, &relayMessage{Cmd: relayCmdAccept, Token: token},
+		connection.DefaultTimeout)
+	if err != nil {
+		log.Infof("Failed to accept connection via relay %s: %v", relay, err)
+		conn.Close()
+		return
+	}
+	log.Infof("Accepted new connection via relay %s", relay)
+	atomic.AddUint32(&cp.inConnCount, 1)
+	dconn := connection.New(conn, true)
+	dconn.SetRelayed()
+	dconn.RegisterCloseHandler(cp.createCloseConnHandler())
+	select {
+	case cp.outChan <- dconn:
+	case <-cp.stopChan:
+		dconn.Close()
+	}
+}
+
 func (cp *ConnectionProvider) establishOutgoingConnections() {
 	defer cp.wg.Done()
 	for {
@@ -256,6 +454,10 @@ func (cp *ConnectionProvider) createCloseConnHandler() func(*connection.Connecti
 			atomic.AddUint32(&cp.outConnCount, ^uint32(0))
 		}
 		for _, addr := range conn.Addresses() {
+			if conn.EncryptionRefused() {
+				log.Debugf("CP won't encrypt connections with %s", addr)
+				cp.plainAddrs.Store(addr, struct{}{})
+			}
 			log.Debug("CP is releasing address " + addr)
 			isUsed, ok := cp.outAddrs.Load(addr)
 			if ok {
@@ -19,9 +19,11 @@ package p2p
 
 import (
 	"crypto/sha1"
+	"encoding/binary"
 	"fmt"
 	"github.com/nictuku/dht"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 	"vminko.org/dscuss/address"
@@ -32,27 +34,37 @@ import (
 // DHTCrawler discovers new peers via DHT.
 // Implements AddressProvider interface
 type DHTCrawler struct {
-	dht       *dht.DHT
+	dhts      []*dht.DHT // One node per network protocol
 	addr      string
 	port      int
 	bootstrap string
 	advPort   int
+	relayPort int
 	subs      subs.Subscriptions
 	ac        AddressConsumer
 	stopChan  chan struct{}
 	wg        sync.WaitGroup
+	mx        sync.Mutex
 	processed map[string]struct{}
 }
 
+// dhtProtocols are the network protocols DHT nodes use.
+var dhtProtocols = []string{"udp4", "udp6"}
+
 const (
 	DHTCrawlerTimeout time.Duration = 30 * time.Second
+	// Relay servers announce themselves under this key.
+	relayInfoHashKey string = "dscuss-relays"
 )
 
+// NewDHTCrawler creates a new crawler. Unless relayPort is zero, the relay
+// server listening on this port is announced.
 func NewDHTCrawler(
 	addr string,
 	port int,
 	bootstrap string,
 	advPort int,
+	relayPort int,
 	s subs.Subscriptions,
 ) *DHTCrawler {
 	return &DHTCrawler{
@@ -60,6 +72,7 @@ func NewDHTCrawler(
 		port:      port,
 		bootstrap: bootstrap,
 		advPort:   advPort,
+		relayPort: relayPort,
 		subs:      s.ToCombinations(),
 		stopChan:  make(chan struct{}),
 		processed: make(map[string]struct{}),
@@ -75,38 +88,59 @@ func (dc *DHTCrawler) Start() {
 	if dc.ac == nil {
 		log.Fatal("Attempt to start providing addresses when AddressConsumer is not set")
 	}
+	// IPv6 peers are discovered by a separate node (BEP-32). The crawler
+	// works as long as at least one of the nodes starts.
+	for _, proto := range dhtProtocols {
+		d := dc.startNode(proto)
+		if d != nil {
+			dc.dhts = append(dc.dhts, d)
+		}
+	}
+	if len(dc.dhts) == 0 {
+		log.Fatal("Failed to start any DHT node")
+	}
+	dc.wg.Add(1 + len(dc.dhts))
+	go dc.requestAddresses()
+	for _, d := range dc.dhts {
+		go dc.drainAddresses(d)
+	}
+}
+
+func (dc *DHTCrawler) startNode(proto string) *dht.DHT {
 	cfg := dht.NewConfig()
 	cfg.Address = dc.addr
 	cfg.Port = dc.port
+	cfg.UDPProto = proto
 	cfg.RateLimit = 10000
 	cfg.ClientPerMinuteLimit = 1000
 	cfg.DHTRouters = dc.bootstrap
 	cfg.SaveRoutingTable = false
 	log.Debugf("Using these DHTRouters: %s", cfg.DHTRouters)
 
-	var err error
-	dc.dht, err = dht.New(cfg)
+	d, err := dht.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create a DHT node: %v", err)
+		log.Warningf("Failed to create a DHT node (%s): %v", proto, err)
+		return nil
 	}
 	//if log.IsDebugEnabled() {
 	//	dl := &dhtLogger{}
-	//	dc.dht.DebugLogger = dl
+	//	d.DebugLogger = dl
 	//}
-	err = dc.dht.Start()
+	err = d.Start()
 	if err != nil {
-		log.Fatalf("Failed to start DHT node: %v", err)
+		log.Warningf("Failed to start DHT node (%s): %v", proto, err)
+		return nil
 	}
-	log.Debugf("DHTCrawler started on port: %d", dc.dht.Port())
-	dc.wg.Add(2)
-	go dc.requestAddresses()
-	go dc.drainAddresses()
+	log.Debugf("DHT node (%s) started on port: %d", proto, d.Port())
+	return d
 }
 
 func (dc *DHTCrawler) Stop() {
 	log.Debug("Stopping DHTCrawler")
 	close(dc.stopChan)
-	dc.dht.Stop()
+	for _, d := range dc.dhts {
+		d.Stop()
+	}
 	log.Debug("DHT stopped")
 	dc.wg.Wait()
 	log.Debug("DHTCrawler stopped")
@@ -120,7 +154,17 @@ func (dc *DHTCrawler) requestAddresses() {
 		for _, t := range dc.subs {
 			ih := calcInfoHash(t.String())
 			log.Debugf("Requesting addresses for topic %s", t)
-			dc.dht.PeersRequestPort(string(ih), true, dc.advPort)
+			for _, d := range dc.dhts {
+				d.PeersRequestPort(string(ih), true, dc.advPort)
+			}
+		}
+		rih := calcInfoHash(relayInfoHashKey)
+		for _, d := range dc.dhts {
+			if dc.relayPort != 0 {
+				d.PeersRequestPort(string(rih), true, dc.relayPort)
+			} else {
+				d.PeersRequest(string(rih), false)
+			}
 		}
 		select {
 		case <-tick:
@@ -132,19 +176,24 @@ func (dc *DHTCrawler) requestAddresses() {
 	}
 }
 
-func (dc *DHTCrawler) drainAddresses() {
+func (dc *DHTCrawler) drainAddresses(d *dht.DHT) {
 	defer dc.wg.Done()
 	for {
 		select {
 		case <-dc.stopChan:
 			log.Debug("Leaving drainAddresses")
 			return
-		case r := <-dc.dht.PeersRequestResults:
+		case r := <-d.PeersRequestResults:
 			log.Debug("Draining addresses...")
-			for _, peers := range r {
+			rih := calcInfoHash(relayInfoHashKey)
+			for ih, peers := range r {
 				for _, x := range peers {
-					a := dht.DecodePeerAddress(x)
-					dc.handleNewAddress(a)
+					a := decodePeerAddress(x)
+					if ih == rih {
+						dc.handleNewRelay(a)
+					} else {
+						dc.handleNewAddress(a)
+					}
 				}
 			}
 		}
@@ -157,6 +206,8 @@ func (dc *DHTCrawler) handleNewAddress(a string) {
 		log.Warningf("DHT is poisoned, found malformed address %s", a)
 		return
 	}
+	dc.mx.Lock()
+	defer dc.mx.Unlock()
 	if _, ok := dc.processed[a]; ok {
 		log.Debugf("Address '%s' has already been processed, skipping it", a)
 		return
@@ -169,6 +220,31 @@ func (dc *DHTCrawler) handleNewAddress(a string) {
 	dc.processed[a] = struct{}{}
 }
 
+// decodePeerAddress decodes the compact peer info: the IP address (4 bytes or
+// 16 bytes for IPv6 according to BEP-32) followed by the port (2 bytes).
+// Returns an empty string if the info is malformed.
+func decodePeerAddress(x string) string {
+	if len(x) != net.IPv4len+2 && len(x) != net.IPv6len+2 {
+		return ""
+	}
+	ip := net.IP([]byte(x[:len(x)-2]))
+	port := binary.BigEndian.Uint16([]byte(x[len(x)-2:]))
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+}
+
+func (dc *DHTCrawler) handleNewRelay(a string) {
+	log.Debugf("Found new relay: %s", a)
+	if !address.IsValid(a) {
+		log.Warningf("DHT is poisoned, found malformed relay address %s", a)
+		return
+	}
+	if isAddressLocal(a, dc.relayPort) {
+		log.Debugf("Skipping local relay %s", a)
+		return
+	}
+	dc.ac.RelayFound(a)
+}
+
 func localIPs() []string {
 	var res []string
 	ifaces, err := net.Interfaces()
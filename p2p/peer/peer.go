@@ -22,6 +22,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"vminko.org/dscuss/crypto"
 	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
@@ -40,6 +41,8 @@ type Peer struct {
 	conn          *connection.Connection
 	owner         *owner.Owner
 	validator     Validator
+	book          AddressBook
+	policy        *Policy
 	goneChan      chan *Peer
 	goneFlag      uint32
 	stopChan      chan struct{}
@@ -47,6 +50,8 @@ type Peer struct {
 	wg            sync.WaitGroup
 	State         State
 	User          *entity.User
+	key           *crypto.PublicKey
+	proto         int
 	Subs          subs.Subscriptions
 	hist          *entity.UserHistory
 }
@@ -67,6 +72,28 @@ type Validator interface {
 	ValidatePeer(*Peer) bool
 }
 
+// AddressBook provides addresses of other peers to share via PEX and handles
+// the addresses received from peers.
+type AddressBook interface {
+	// ListPexAddresses returns reachable addresses of the peers interested in
+	// the subscriptions s except the peer pid.
+	ListPexAddresses(s subs.Subscriptions, pid *ID) []string
+	PexAddressesReceived(aa []string)
+}
+
+// Policy defines the requirements for the entities received from peers and
+// the way of communicating with them.
+type Policy struct {
+	// MinMessageStampBits is the minimal difficulty of message stamps.
+	MinMessageStampBits int
+	// MinUserProofBits is the minimal difficulty of users' proofs-of-work.
+	MinUserProofBits int
+	// Compression allows to compress packets exchanged with peers.
+	Compression bool
+	// RequireEncryption forbids unencrypted connections.
+	RequireEncryption bool
+}
+
 const (
 	outEntityQueueCapacity int    = 100
 	unknownValue           string = "[unknown]"
@@ -85,11 +112,15 @@ func New(
 	conn *connection.Connection,
 	owner *owner.Owner,
 	validator Validator,
+	book AddressBook,
+	policy *Policy,
 ) *Peer {
 	p := &Peer{
 		conn:          conn,
 		owner:         owner,
 		validator:     validator,
+		book:          book,
+		policy:        policy,
 		stopChan:      make(chan struct{}),
 		outEntityChan: make(chan entity.Entity, outEntityQueueCapacity),
 	}
@@ -192,7 +223,125 @@ func (p *Peer) isInterestedInMessage(s subs.Subscriptions, m *entity.Message) bo
 	return s.Covers(t)
 }
 
+func (p *Peer) isInterestedInOperation(s subs.Subscriptions, o *entity.Operation) bool {
+	switch o.OperationType().ObjectType() {
+	case entity.TypeUser:
+		return true
+	case entity.TypeOperation:
+		t, err := p.owner.Storage.GetOperation(&o.ObjectID)
+		if err != nil {
+			log.Fatalf("Got an error while fetching oper %s from DB: %v",
+				o.ObjectID.Shorten(), err)
+		}
+		return p.isInterestedInOperation(s, t)
+	default:
+		m, err := p.owner.Storage.GetMessage(&o.ObjectID)
+		if err != nil {
+			log.Fatalf("Got an error while fetching msg %s from DB: %v",
+				o.ObjectID.Shorten(), err)
+		}
+		return p.isInterestedInMessage(s, m)
+	}
+}
+
+// followKeyChange updates the key of the peer if the entity e changes the key
+// chain of the peer's user. Returns errors.KeyRevoked if the current key of the
+// peer is revoked, the peer must be disconnected then.
+func (p *Peer) followKeyChange(e entity.Entity) error {
+	var uid *entity.ID
+	switch e := e.(type) {
+	case *entity.KeyRotation:
+		uid = &e.UserID
+	case *entity.KeyRevocation:
+		uid = &e.UserID
+	default:
+		return nil
+	}
+	if p.User == nil || *uid != *p.User.ID() {
+		return nil
+	}
+	kc, err := p.owner.Storage.GetKeyChain(uid)
+	if err != nil {
+		log.Errorf("Failed to get key chain of peer %s: %v", p, err)
+		return err
+	}
+	if kc.IsCompromised() {
+		log.Infof("The key of peer %s is revoked", p)
+		return errors.KeyRevoked
+	}
+	p.key = kc.CurrentKey()
+	return nil
+}
+
+// canAccept checks whether the version of the protocol negotiated with the peer
+// allows sending the entity.
+func (p *Peer) canAccept(ent entity.Entity) bool {
+	if p.proto < protoCanonicalEncoding && !isLegacyEntity(ent) {
+		return false
+	}
+	switch ent.(type) {
+	case *entity.UserUpdate, *entity.KeyRotation, *entity.KeyRevocation:
+		if p.proto < protoKeyManagement {
+			return false
+		}
+	}
+	if m, ok := ent.(*entity.Message); ok && len(m.Attachments) != 0 && p.proto < protoBlobs {
+		return false
+	}
+	if m, ok := ent.(*entity.Message); ok && m.Poll != nil && p.proto < protoPolls {
+		return false
+	}
+	if m, ok := ent.(*entity.Message); ok && len(m.References) != 0 && p.proto < protoReferences {
+		return false
+	}
+	if m, ok := ent.(*entity.Message); ok && len(m.Text) > entity.MaxShortMessageTextLen &&
+		p.proto < protoLongMessages {
+		return false
+	}
+	if o, ok := ent.(*entity.Operation); ok && len(o.Replacement) > entity.MaxShortMessageTextLen &&
+		p.proto < protoLongMessages {
+		return false
+	}
+	if _, ok := ent.(*entity.Reaction); ok && p.proto < protoReactions {
+		return false
+	}
+	if _, ok := ent.(*entity.ModeratorList); ok && p.proto < protoModeratorLists {
+		return false
+	}
+	if _, ok := ent.(*entity.PrivateMessage); ok && p.proto < protoPrivateMessages {
+		return false
+	}
+	if _, ok := ent.(*entity.Vote); ok && p.proto < protoPolls {
+		return false
+	}
+	return ent.Encoding() == entity.EncodingJSON || p.proto >= protoCanonicalEncoding
+}
+
+// isLegacyEntity checks whether the peers supporting only the first version of
+// the protocol can verify the entity. They only know users, messages and
+// operations without the fields added later, signed by P-224 keys.
+func isLegacyEntity(ent entity.Entity) bool {
+	switch e := ent.(type) {
+	case *entity.User:
+		return e.ProofBits == 0 && e.PubKey.Algorithm() == crypto.AlgorithmP224 &&
+			e.Sig.Algorithm == crypto.AlgorithmP224
+	case *entity.Message:
+		return e.Stamp == 0 && len(e.Attachments) == 0 && e.Poll == nil &&
+			len(e.References) == 0 && e.Sig.Algorithm == crypto.AlgorithmP224
+	case *entity.Operation:
+		t := e.OperationType()
+		return (t == entity.OperationTypeRemoveMessage || t == entity.OperationTypeBanUser) &&
+			e.Reason <= entity.OperationReasonDuplicate && e.Replacement == "" &&
+			e.DateExpires == nil && e.Sig.Algorithm == crypto.AlgorithmP224
+	default:
+		return false
+	}
+}
+
 func (p *Peer) isInterestedInEntity(ent entity.Entity, stored time.Time) bool {
+	if !p.canAccept(ent) {
+		return false
+	}
 	subs := p.Subs
 	if p.hist != nil && stored.Before(p.hist.Disconnected) {
 		subs = p.Subs.Diff(p.hist.Subs)
@@ -204,17 +353,29 @@ func (p *Peer) isInterestedInEntity(ent entity.Entity, stored time.Time) bool {
 	case *entity.Message:
 		return p.isInterestedInMessage(subs, e)
 	case *entity.Operation:
-		if e.OperationType() == entity.OperationTypeBanUser {
-			return true
+		return p.isInterestedInOperation(subs, e)
+	case *entity.Reaction:
+		m, err := p.owner.Storage.GetMessage(&e.MessageID)
+		if err != nil {
+			log.Fatalf("Got an error while fetching msg %s from DB: %v",
+				e.MessageID.Shorten(), err)
 		}
-		m, err := p.owner.Storage.GetMessage(&e.ObjectID)
+		return p.isInterestedInMessage(subs, m)
+	case *entity.Vote:
+		m, err := p.owner.Storage.GetMessage(&e.PollID)
 		if err != nil {
 			log.Fatalf("Got an error while fetching msg %s from DB: %v",
-				e.ObjectID.Shorten(), err)
+				e.PollID.Shorten(), err)
 		}
 		return p.isInterestedInMessage(subs, m)
 	case *entity.User:
 		return false
+	case *entity.UserUpdate, *entity.KeyRotation, *entity.KeyRevocation, *entity.ModeratorList:
+		return true
+	case *entity.PrivateMessage:
+		// Private messages are forwarded by all peers (store-and-forward),
+		// so that they could reach the recipient regardless of the topics.
+		return true
 	default:
 		log.Fatalf("BUG: unknown entity type: %T", ent)
 	}
@@ -246,6 +407,11 @@ func (p *Peer) Addresses() []string {
 	return p.conn.Addresses()
 }
 
+// IsIncoming tells whether the peer connected to us.
+func (p *Peer) IsIncoming() bool {
+	return p.conn.IsIncoming()
+}
+
 func (p *Peer) AddAddresses(new []string) {
 	p.conn.AddAddresses(new)
 }
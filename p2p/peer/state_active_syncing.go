@@ -29,16 +29,30 @@ import (
 // passive connections) or StatePassiveSyncing (for peers connected via active
 // connections).
 type StateActiveSyncing struct {
-	p                *Peer
-	messagesToSync   []*entity.StoredMessage
-	operationsToSync []*entity.StoredOperation
-	startTime        time.Time
+	p                 *Peer
+	rotationsToSync   []*entity.StoredKeyRotation
+	revocationsToSync []*entity.StoredKeyRevocation
+	messagesToSync    []*entity.StoredMessage
+	operationsToSync  []*entity.StoredOperation
+	updatesToSync     []*entity.StoredUserUpdate
+	reactionsToSync   []*entity.StoredReaction
+	listsToSync       []*entity.StoredModeratorList
+	privMsgsToSync    []*entity.StoredPrivateMessage
+	votesToSync       []*entity.StoredVote
+	startTime         time.Time
 }
 
 const (
-	MaxSyncDuration           time.Duration = time.Hour * 24 * 30 // a month
-	MaxSyncNumberOfMessages   int           = 1000
-	MaxSyncNumberOfOperations int           = 1000
+	MaxSyncDuration            time.Duration = time.Hour * 24 * 30 // a month
+	MaxSyncNumberOfMessages    int           = 1000
+	MaxSyncNumberOfOperations  int           = 1000
+	MaxSyncNumberOfUpdates     int           = 1000
+	MaxSyncNumberOfRotations   int           = 1000
+	MaxSyncNumberOfRevocations int           = 1000
+	MaxSyncNumberOfReactions   int           = 1000
+	MaxSyncNumberOfModerLists  int           = 1000
+	MaxSyncNumberOfPrivMsgs    int           = 1000
+	MaxSyncNumberOfVotes       int           = 1000
 )
 
 func newStateActiveSyncing(p *Peer) *StateActiveSyncing {
@@ -49,6 +63,21 @@ func (s *StateActiveSyncing) perform() (nextState State, err error) {
 	if s.startTime.IsZero() {
 		s.startTime = s.getStartTime()
 	}
+	// Keys go first, because the signatures of other entities depend on them.
+	rotSynced, err := s.rotationsSynced()
+	if err != nil {
+		return nil, err
+	}
+	if !rotSynced {
+		return s.syncRotation()
+	}
+	revSynced, err := s.revocationsSynced()
+	if err != nil {
+		return nil, err
+	}
+	if !revSynced {
+		return s.syncRevocation()
+	}
 	msgSynced, err := s.messagesSynced()
 	if err != nil {
 		return nil, err
@@ -63,6 +92,48 @@ func (s *StateActiveSyncing) perform() (nextState State, err error) {
 	if !operSynced {
 		return s.syncOperation()
 	}
+	updSynced, err := s.updatesSynced()
+	if err != nil {
+		return nil, err
+	}
+	if !updSynced {
+		return s.syncUpdate()
+	}
+	rctSynced, err := s.reactionsSynced()
+	if err != nil {
+		return nil, err
+	}
+	if !rctSynced {
+		return s.syncReaction()
+	}
+	lstSynced, err := s.listsSynced()
+	if err != nil {
+		return nil, err
+	}
+	if !lstSynced {
+		return s.syncList()
+	}
+	pmSynced, err := s.privMsgsSynced()
+	if err != nil {
+		return nil, err
+	}
+	if !pmSynced {
+		return s.syncPrivMsg()
+	}
+	votSynced, err := s.votesSynced()
+	if err != nil {
+		return nil, err
+	}
+	if !votSynced {
+		return s.syncVote()
+	}
+	if s.p.proto >= protoPex {
+		err = s.sendPex()
+		if err != nil {
+			log.Errorf("Failed to send PEX to the peer %s: %v", s.p, err)
+			return nil, err
+		}
+	}
 	err = s.sendDone()
 	if err != nil {
 		log.Errorf("Failed to send done to the peer %s: %v", s.p, err)
@@ -89,6 +160,54 @@ func (s *StateActiveSyncing) getStartTime() time.Time {
 	return res
 }
 
+func (s *StateActiveSyncing) rotationsSynced() (bool, error) {
+	if s.rotationsToSync == nil {
+		rr, err := s.p.owner.Storage.GetKeyRotationsStoredAfter(s.startTime, MaxSyncNumberOfRotations)
+		if err != nil {
+			log.Errorf("Failed to fetch key rotations since %s", s.startTime.Format(time.RFC3339))
+			return false, err
+		}
+		log.Debugf("Found %d key rotation(s) to synchronize with peer %s", len(rr), s.p)
+		s.rotationsToSync = rr
+	}
+	return len(s.rotationsToSync) == 0, nil
+}
+
+func (s *StateActiveSyncing) syncRotation() (nextState State, err error) {
+	if len(s.rotationsToSync) == 0 {
+		log.Fatal("BUG: syncRotation() is called when rotationsToSync is empty")
+	}
+	log.Debugf("%d key rotation(s) left to synchronize with peer %s", len(s.rotationsToSync), s.p)
+	var r *entity.StoredKeyRotation
+	r, s.rotationsToSync = s.rotationsToSync[0], s.rotationsToSync[1:]
+	log.Debugf("Sending key rotation %s to peer %s", r.R, s.p)
+	return newStateSending(s.p, r.R, r.Stored, s), nil
+}
+
+func (s *StateActiveSyncing) revocationsSynced() (bool, error) {
+	if s.revocationsToSync == nil {
+		rr, err := s.p.owner.Storage.GetKeyRevocationsStoredAfter(s.startTime, MaxSyncNumberOfRevocations)
+		if err != nil {
+			log.Errorf("Failed to fetch key revocations since %s", s.startTime.Format(time.RFC3339))
+			return false, err
+		}
+		log.Debugf("Found %d key revocation(s) to synchronize with peer %s", len(rr), s.p)
+		s.revocationsToSync = rr
+	}
+	return len(s.revocationsToSync) == 0, nil
+}
+
+func (s *StateActiveSyncing) syncRevocation() (nextState State, err error) {
+	if len(s.revocationsToSync) == 0 {
+		log.Fatal("BUG: syncRevocation() is called when revocationsToSync is empty")
+	}
+	log.Debugf("%d key revocation(s) left to synchronize with peer %s", len(s.revocationsToSync), s.p)
+	var r *entity.StoredKeyRevocation
+	r, s.revocationsToSync = s.revocationsToSync[0], s.revocationsToSync[1:]
+	log.Debugf("Sending key revocation %s to peer %s", r.R, s.p)
+	return newStateSending(s.p, r.R, r.Stored, s), nil
+}
+
 func (s *StateActiveSyncing) messagesSynced() (bool, error) {
 	if s.messagesToSync == nil {
 		mm, err := s.p.owner.Storage.GetMessagesStoredAfter(s.startTime, MaxSyncNumberOfMessages)
@@ -137,6 +256,126 @@ func (s *StateActiveSyncing) syncOperation() (nextState State, err error) {
 	return newStateSending(s.p, o.O, o.Stored, s), nil
 }
 
+func (s *StateActiveSyncing) updatesSynced() (bool, error) {
+	if s.updatesToSync == nil {
+		uu, err := s.p.owner.Storage.GetUserUpdatesStoredAfter(s.startTime, MaxSyncNumberOfUpdates)
+		if err != nil {
+			log.Errorf("Failed to fetch user updates since %s", s.startTime.Format(time.RFC3339))
+			return false, err
+		}
+		log.Debugf("Found %d user update(s) to synchronize with peer %s", len(uu), s.p)
+		s.updatesToSync = uu
+	}
+	return len(s.updatesToSync) == 0, nil
+}
+
+func (s *StateActiveSyncing) syncUpdate() (nextState State, err error) {
+	if len(s.updatesToSync) == 0 {
+		log.Fatal("BUG: syncUpdate() is called when updatesToSync is empty")
+	}
+	log.Debugf("%d user update(s) left to synchronize with peer %s", len(s.updatesToSync), s.p)
+	var u *entity.StoredUserUpdate
+	u, s.updatesToSync = s.updatesToSync[0], s.updatesToSync[1:]
+	log.Debugf("Sending user update %s to peer %s", u.U, s.p)
+	return newStateSending(s.p, u.U, u.Stored, s), nil
+}
+
+func (s *StateActiveSyncing) reactionsSynced() (bool, error) {
+	if s.reactionsToSync == nil {
+		rr, err := s.p.owner.Storage.GetReactionsStoredAfter(s.startTime, MaxSyncNumberOfReactions)
+		if err != nil {
+			log.Errorf("Failed to fetch reactions since %s", s.startTime.Format(time.RFC3339))
+			return false, err
+		}
+		log.Debugf("Found %d reaction(s) to synchronize with peer %s", len(rr), s.p)
+		s.reactionsToSync = rr
+	}
+	return len(s.reactionsToSync) == 0, nil
+}
+
+func (s *StateActiveSyncing) syncReaction() (nextState State, err error) {
+	if len(s.reactionsToSync) == 0 {
+		log.Fatal("BUG: syncReaction() is called when reactionsToSync is empty")
+	}
+	log.Debugf("%d reaction(s) left to synchronize with peer %s", len(s.reactionsToSync), s.p)
+	var r *entity.StoredReaction
+	r, s.reactionsToSync = s.reactionsToSync[0], s.reactionsToSync[1:]
+	log.Debugf("Sending reaction %s to peer %s", r.R, s.p)
+	return newStateSending(s.p, r.R, r.Stored, s), nil
+}
+
+func (s *StateActiveSyncing) listsSynced() (bool, error) {
+	if s.listsToSync == nil {
+		ll, err := s.p.owner.Storage.GetModeratorListsStoredAfter(s.startTime, MaxSyncNumberOfModerLists)
+		if err != nil {
+			log.Errorf("Failed to fetch moderator lists since %s", s.startTime.Format(time.RFC3339))
+			return false, err
+		}
+		log.Debugf("Found %d moderator list(s) to synchronize with peer %s", len(ll), s.p)
+		s.listsToSync = ll
+	}
+	return len(s.listsToSync) == 0, nil
+}
+
+func (s *StateActiveSyncing) syncList() (nextState State, err error) {
+	if len(s.listsToSync) == 0 {
+		log.Fatal("BUG: syncList() is called when listsToSync is empty")
+	}
+	log.Debugf("%d moderator list(s) left to synchronize with peer %s", len(s.listsToSync), s.p)
+	var l *entity.StoredModeratorList
+	l, s.listsToSync = s.listsToSync[0], s.listsToSync[1:]
+	log.Debugf("Sending moderator list %s to peer %s", l.L, s.p)
+	return newStateSending(s.p, l.L, l.Stored, s), nil
+}
+
+func (s *StateActiveSyncing) privMsgsSynced() (bool, error) {
+	if s.privMsgsToSync == nil {
+		mm, err := s.p.owner.Storage.GetPrivateMessagesStoredAfter(s.startTime, MaxSyncNumberOfPrivMsgs)
+		if err != nil {
+			log.Errorf("Failed to fetch private messages since %s", s.startTime.Format(time.RFC3339))
+			return false, err
+		}
+		log.Debugf("Found %d private message(s) to synchronize with peer %s", len(mm), s.p)
+		s.privMsgsToSync = mm
+	}
+	return len(s.privMsgsToSync) == 0, nil
+}
+
+func (s *StateActiveSyncing) syncPrivMsg() (nextState State, err error) {
+	if len(s.privMsgsToSync) == 0 {
+		log.Fatal("BUG: syncPrivMsg() is called when privMsgsToSync is empty")
+	}
+	log.Debugf("%d private message(s) left to synchronize with peer %s", len(s.privMsgsToSync), s.p)
+	var m *entity.StoredPrivateMessage
+	m, s.privMsgsToSync = s.privMsgsToSync[0], s.privMsgsToSync[1:]
+	log.Debugf("Sending private message %s to peer %s", m.M, s.p)
+	return newStateSending(s.p, m.M, m.Stored, s), nil
+}
+
+func (s *StateActiveSyncing) votesSynced() (bool, error) {
+	if s.votesToSync == nil {
+		vv, err := s.p.owner.Storage.GetVotesStoredAfter(s.startTime, MaxSyncNumberOfVotes)
+		if err != nil {
+			log.Errorf("Failed to fetch votes since %s", s.startTime.Format(time.RFC3339))
+			return false, err
+		}
+		log.Debugf("Found %d vote(s) to synchronize with peer %s", len(vv), s.p)
+		s.votesToSync = vv
+	}
+	return len(s.votesToSync) == 0, nil
+}
+
+func (s *StateActiveSyncing) syncVote() (nextState State, err error) {
+	if len(s.votesToSync) == 0 {
+		log.Fatal("BUG: syncVote() is called when votesToSync is empty")
+	}
+	log.Debugf("%d vote(s) left to synchronize with peer %s", len(s.votesToSync), s.p)
+	var v *entity.StoredVote
+	v, s.votesToSync = s.votesToSync[0], s.votesToSync[1:]
+	log.Debugf("Sending vote %s to peer %s", v.V, s.p)
+	return newStateSending(s.p, v.V, v.Stored, s), nil
+}
+
 func (s *StateActiveSyncing) sendDone() error {
 	pld := packet.NewPayloadDone()
 	pkt := packet.New(packet.TypeDone, s.p.User.ID(), pld, s.p.owner.Signer)
@@ -148,6 +387,20 @@ func (s *StateActiveSyncing) sendDone() error {
 	return nil
 }
 
+// sendPex shares addresses of other peers with the peer. Like Done, the PEX
+// packet is not acknowledged.
+func (s *StateActiveSyncing) sendPex() error {
+	aa := s.p.book.ListPexAddresses(s.p.Subs, s.p.ID())
+	pld := packet.NewPayloadPex(aa)
+	pkt := packet.New(packet.TypePex, s.p.User.ID(), pld, s.p.owner.Signer)
+	err := s.p.conn.Write(pkt)
+	if err != nil {
+		log.Errorf("Error sending %s to the peer %s: %v", pkt, s.p, err)
+		return err
+	}
+	return nil
+}
+
 func (s *StateActiveSyncing) Name() string {
 	return "StateActiveSyncing"
 }
@@ -18,22 +18,69 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package peer
 
 import (
+	"bytes"
+	"time"
 	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
+	"vminko.org/dscuss/p2p/connection"
 	"vminko.org/dscuss/packet"
 	"vminko.org/dscuss/subs"
 )
 
 const (
-	ProtocolVersion int = 1
+	// ProtocolVersion is the latest version of the protocol this peer
+	// supports.
+	ProtocolVersion int = 11
+	// MinProtocolVersion is the oldest version of the protocol this peer is
+	// still compatible with. Peers of this version only accept users,
+	// messages and operations in their original form (see isLegacyEntity).
+	MinProtocolVersion int = packet.LegacyProto
+	// protoCanonicalEncoding is the first version of the protocol allowing
+	// entities in the canonical encoding.
+	protoCanonicalEncoding int = 2
+	// protoKeyManagement is the first version of the protocol supporting
+	// user updates, key rotations and key revocations.
+	protoKeyManagement int = 2
+	// protoBlobs is the first version of the protocol supporting messages
+	// with attachments and transferring blobs.
+	protoBlobs int = 3
+	// protoReactions is the first version of the protocol supporting
+	// reactions.
+	protoReactions int = 4
+	// protoModeratorLists is the first version of the protocol supporting
+	// moderator lists.
+	protoModeratorLists int = 5
+	// protoPrivateMessages is the first version of the protocol supporting
+	// private messages.
+	protoPrivateMessages int = 6
+	// protoPolls is the first version of the protocol supporting polls and
+	// votes.
+	protoPolls int = 7
+	// protoReferences is the first version of the protocol supporting
+	// references between messages.
+	protoReferences int = 8
+	// protoLongMessages is the first version of the protocol supporting
+	// long messages and transferring packets in parts.
+	protoLongMessages int = 9
+	// protoBinaryFraming is the first version of the protocol using
+	// length-prefixed frames (optionally compressed) after handshake.
+	protoBinaryFraming int = 10
+	// protoPex is the first version of the protocol supporting peer
+	// exchange.
+	protoPex int = 11
 )
 
 // StateHandshaking implements the handshaking protocol.
 type StateHandshaking struct {
-	p *Peer
-	u *entity.User
-	s subs.Subscriptions
+	p     *Peer
+	u     *entity.User
+	uPkt  *packet.Packet
+	kc    *entity.KeyChain
+	s     subs.Subscriptions
+	proto int
+	// compress is true if both peers accept compressed packets.
+	compress bool
 }
 
 func newStateHandshaking(p *Peer) *StateHandshaking {
@@ -48,6 +95,7 @@ func (s *StateHandshaking) perform() (nextState State, err error) {
 		}
 		perfErr = f()
 	}
+	perfUnlessErr(s.secure)
 	if s.p.conn.IsActive() {
 		perfUnlessErr(s.sendUser)
 		perfUnlessErr(s.readAndProcessUser)
@@ -72,6 +120,28 @@ func (s *StateHandshaking) perform() (nextState State, err error) {
 	}
 }
 
+// secure establishes the encrypted channel with the peer. The active peer does
+// not try to encrypt the connection if the peer refused it before, unless
+// encryption is required. Relayed connections are always encrypted.
+func (s *StateHandshaking) secure() error {
+	required := s.p.policy.RequireEncryption || s.p.conn.IsRelayed()
+	if s.p.conn.IsActive() {
+		if s.p.conn.IsEncryptionDisabled() && !required {
+			return nil
+		}
+		return s.p.conn.SecureActive()
+	}
+	err := s.p.conn.SecurePassive()
+	if err != nil {
+		return err
+	}
+	if !s.p.conn.IsSecure() && required {
+		log.Infof("Peer %s did not encrypt the connection", s.p)
+		return errors.NotEncrypted
+	}
+	return nil
+}
+
 func (s *StateHandshaking) sendUser() error {
 	pkt := packet.New(packet.TypeUser, &entity.ZeroID, s.p.owner.User, s.p.owner.Signer)
 	err := s.p.conn.Write(pkt)
@@ -109,9 +179,9 @@ func (s *StateHandshaking) readAndProcessUser() error {
 		log.Infof("Peer %s sent malformed User entity", s.p)
 		return errors.ProtocolViolation
 	}
-	if !pkt.VerifySig(&u.PubKey) {
-		log.Infof("Peer %s sent Hello packet with invalid signature", s.p)
-		return errors.ProtocolViolation
+	if u.ProofDifficulty() < s.p.policy.MinUserProofBits {
+		log.Infof("Peer %s has %d-bit proof-of-work", s.p, u.ProofDifficulty())
+		return errors.WeakProof
 	}
 	isBanned, err := s.p.owner.View.IsUserBanned(u.ID())
 	if err != nil {
@@ -122,13 +192,26 @@ func (s *StateHandshaking) readAndProcessUser() error {
 	}
 
 	s.u = u
+	// The packet may be signed by a rotated key. The rotations are sent in
+	// Hello, so the signature will be checked after receiving it.
+	s.uPkt = pkt
 	return nil
 }
 
 func (s *StateHandshaking) sendHello() error {
-	hPld := packet.NewPayloadHello(ProtocolVersion, s.p.owner.Profile.GetSubscriptions())
+	kc, err := s.p.owner.Storage.GetKeyChain(s.p.owner.User.ID())
+	if err != nil {
+		log.Fatalf("Failed to get the owner's key chain: %v", err)
+	}
+	hPld := packet.NewPayloadHello(
+		ProtocolVersion,
+		s.p.owner.Profile.GetSubscriptions(),
+		kc.Rotations(),
+		s.compressions(),
+		s.p.conn.Binding(),
+	)
 	hPkt := packet.New(packet.TypeHello, s.u.ID(), hPld, s.p.owner.Signer)
-	err := s.p.conn.Write(hPkt)
+	err = s.p.conn.Write(hPkt)
 	if err != nil {
 		log.Errorf("Error sending %s to the peer %s: %v", hPkt, s.p, err)
 		return err
@@ -142,10 +225,6 @@ func (s *StateHandshaking) readAndProcessHello() error {
 		log.Errorf("Error receiving packet from the peer %s: %v", s.p, err)
 		return err
 	}
-	if !pkt.VerifySig(&s.u.PubKey) {
-		log.Infof("Peer %s sent a packet with invalid signature", s.p)
-		return errors.ProtocolViolation
-	}
 	if pkt.VerifyHeader(packet.TypeHello, s.p.owner.User.ID()) != nil {
 		log.Infof("Peer %s sent packet with invalid header", s.p)
 		return errors.ProtocolViolation
@@ -164,12 +243,69 @@ func (s *StateHandshaking) readAndProcessHello() error {
 		log.Infof("Peer %s sent malformed Hello packet", s.p)
 		return errors.ProtocolViolation
 	}
-	if h.Proto != ProtocolVersion {
+	err = s.processKeyChain(h.Rotations)
+	if err != nil {
+		return err
+	}
+	if !s.uPkt.VerifySig(s.kc.CurrentKey()) {
+		log.Infof("Peer %s sent User packet with invalid signature", s.p)
+		return errors.ProtocolViolation
+	}
+	if !pkt.VerifySig(s.kc.CurrentKey()) {
+		log.Infof("Peer %s sent a packet with invalid signature", s.p)
+		return errors.ProtocolViolation
+	}
+	if !bytes.Equal(h.Channel, s.p.conn.Binding()) {
+		log.Infof("Peer %s is not the endpoint of the channel", s.p)
+		return errors.ProtocolViolation
+	}
+	if h.LatestVersion() < MinProtocolVersion {
 		log.Infof("Protocol version of peer %s is unsupported.", s.p)
-		log.Infof("My version is %d, peer's version is %d.", ProtocolVersion, h.Proto)
+		log.Infof("My version is %d, peer's version is %d.", ProtocolVersion, h.LatestVersion())
 		return errors.UnsupportedProtocol
 	}
+	// Both peers use the latest version they both support.
+	s.proto = h.LatestVersion()
+	if s.proto > ProtocolVersion {
+		s.proto = ProtocolVersion
+	}
 	s.s = h.Subs
+	for _, c := range h.Compression {
+		if c == connection.CompressionFlate && s.p.policy.Compression {
+			s.compress = true
+		}
+	}
+	return nil
+}
+
+// compressions returns the list of compression algorithms the owner accepts.
+func (s *StateHandshaking) compressions() []string {
+	if !s.p.policy.Compression {
+		return nil
+	}
+	return []string{connection.CompressionFlate}
+}
+
+// processKeyChain builds the chain of the peer's keys from the rotations known
+// locally and the ones sent by the peer.
+func (s *StateHandshaking) processKeyChain(sent []*entity.KeyRotation) error {
+	rr, err := s.p.owner.Storage.GetKeyRotations(s.u.ID())
+	if err != nil {
+		log.Fatalf("Failed to get key rotations of %s: %v", s.u.ID().Shorten(), err)
+	}
+	vv, err := s.p.owner.Storage.GetKeyRevocations(s.u.ID())
+	if err != nil {
+		log.Fatalf("Failed to get key revocations of %s: %v", s.u.ID().Shorten(), err)
+	}
+	now := time.Now()
+	for _, r := range sent {
+		rr = append(rr, &entity.StoredKeyRotation{R: r, Stored: now})
+	}
+	s.kc = entity.NewKeyChain(s.u, rr, vv)
+	if s.kc.IsCompromised() {
+		log.Infof("The current key of peer %s is revoked", s.p)
+		return errors.KeyRevoked
+	}
 	return nil
 }
 
@@ -184,8 +320,22 @@ func (s *StateHandshaking) finalize() error {
 			log.Fatalf("Failed to put user into the DB: %v", err)
 		}
 	}
+	for _, r := range s.kc.Rotations() {
+		has, err := s.p.owner.Storage.HasEntity(r.ID())
+		if err != nil {
+			log.Fatalf("Unexpected error occurred while checking for entity in the DB: %v", err)
+		}
+		if !has {
+			err = s.p.owner.Storage.PutEntity((entity.Entity)(r), s.p.outEntityChan)
+			if err != nil {
+				log.Fatalf("Failed to put key rotation into the DB: %v", err)
+			}
+		}
+	}
 	s.p.User = s.u
+	s.p.key = s.kc.CurrentKey()
 	s.p.Subs = s.s
+	s.p.proto = s.proto
 	if !s.p.validator.ValidatePeer(s.p) {
 		log.Debugf("Peer validation failed")
 		return errors.InvalidPeer
@@ -194,6 +344,10 @@ func (s *StateHandshaking) finalize() error {
 	if (err != nil) && (err != errors.NoUserHistory) {
 		log.Fatalf("Unexpected error occurred while checking for user in the DB: %v", err)
 	}
+	// Both peers switch the framing right after exchanging Hello packets.
+	if s.proto >= protoBinaryFraming {
+		s.p.conn.SetFraming(connection.FramingBinary, s.compress)
+	}
 	return nil
 }
 
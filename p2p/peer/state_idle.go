@@ -58,6 +58,9 @@ func (s *StateIdle) perform() (nextState State, err error) {
 		case e, ok := <-s.p.outEntityChan:
 			if ok {
 				log.Debugf("Peer %s got new outEntity %s", s.p, e)
+				if err := s.p.followKeyChange(e); err != nil {
+					return nil, err
+				}
 				return newStateSending(s.p, e, time.Now(), s), nil
 			} else {
 				log.Debugf("Peer %s: outEntityChan was closed", s.p)
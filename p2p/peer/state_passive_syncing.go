@@ -43,10 +43,17 @@ func (s *StatePassiveSyncing) perform() (nextState State, err error) {
 		return nil, err
 	}
 	log.Debugf("Peer %s received packet %s", s.p, pkt)
-	if !pkt.VerifySig(&s.p.User.PubKey) {
+	if !pkt.VerifySig(s.p.key) {
 		log.Infof("Peer %s sent a packet with invalid signature", s.p)
 		return nil, errors.ProtocolViolation
 	}
+	if pkt.Body.Type == packet.TypePex && s.p.proto >= protoPex {
+		err = s.processPex(pkt)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
 	err = pkt.VerifyHeader(packet.TypeDone, s.p.owner.User.ID())
 	if err != nil {
 		return newStateReceiving(s.p, pkt, s), nil
@@ -59,6 +66,30 @@ func (s *StatePassiveSyncing) perform() (nextState State, err error) {
 	}
 }
 
+func (s *StatePassiveSyncing) processPex(pkt *packet.Packet) error {
+	err := pkt.VerifyHeader(packet.TypePex, s.p.owner.User.ID())
+	if err != nil {
+		log.Infof("Peer %s sent PEX packet with invalid header", s.p)
+		return errors.ProtocolViolation
+	}
+	i, err := pkt.DecodePayload()
+	if err != nil {
+		log.Infof("Failed to decode payload of a PEX packet '%s': %v", pkt, err)
+		return errors.ProtocolViolation
+	}
+	pex, ok := (i).(*packet.PayloadPex)
+	if !ok {
+		log.Fatal("BUG: packet type does not match type of successfully decoded payload.")
+	}
+	if !pex.IsValid() {
+		log.Infof("Peer %s sent invalid PEX packet", s.p)
+		return errors.ProtocolViolation
+	}
+	log.Debugf("Peer %s shared %d address(es)", s.p, len(pex.Addrs))
+	s.p.book.PexAddressesReceived(pex.Addrs)
+	return nil
+}
+
 func (s *StatePassiveSyncing) Name() string {
 	return "StatePassiveSyncing"
 }
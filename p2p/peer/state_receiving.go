@@ -84,13 +84,30 @@ func (s *StateReceiving) perform() (nextState State, err error) {
 		s.pendingEntities = append(s.pendingEntities, e)
 		err = s.checkPendingEntities()
 		if err == nil {
-			for _, e := range s.pendingEntities {
+			// Attachments are fetched first, so that the peers notified
+			// about the new messages could get them from this peer.
+			err = s.fetchAttachments()
+			if err != nil {
+				log.Errorf("Failed to fetch attachments from peer %s: %v", s.p, err)
+				return nil, err
+			}
+			// Every pending entity depends on the ones requested after it
+			// (e.g. a revocation depends on the revoked operation), so
+			// they are stored in the reverse order.
+			for i := len(s.pendingEntities) - 1; i >= 0; i-- {
+				e := s.pendingEntities[i]
 				err = s.p.owner.Storage.PutEntity(e, s.p.outEntityChan)
 				if err != nil {
 					log.Fatalf("Failed to put entity %s into the DB: %v",
 						e, err)
 				}
 			}
+			for _, e := range s.pendingEntities {
+				err = s.p.followKeyChange(e)
+				if err != nil {
+					return nil, err
+				}
+			}
 			allMatched = true
 		} else {
 			switch e := err.(type) {
@@ -137,6 +154,8 @@ func (s *StateReceiving) banUser(id *entity.ID, comment string) {
 		entity.OperationTypeBanUser,
 		entity.OperationReasonProtocolViolation,
 		comment,
+		"",
+		nil,
 		s.p.owner.User.ID(),
 		id,
 		s.p.owner.Signer,
@@ -163,6 +182,20 @@ func (s *StateReceiving) getEntityAuthor(ent entity.Entity) *entity.ID {
 		return &e.AuthorID
 	case *entity.Operation:
 		return &e.AuthorID
+	case *entity.UserUpdate:
+		return &e.UserID
+	case *entity.KeyRotation:
+		return &e.UserID
+	case *entity.KeyRevocation:
+		return &e.UserID
+	case *entity.Reaction:
+		return &e.AuthorID
+	case *entity.ModeratorList:
+		return &e.UserID
+	case *entity.PrivateMessage:
+		return &e.AuthorID
+	case *entity.Vote:
+		return &e.AuthorID
 	default:
 		log.Fatalf("BUG: unexpected type of entity: %T", e)
 	}
@@ -192,6 +225,18 @@ func (s *StateReceiving) getPendingUser(id *entity.ID) *entity.User {
 	return u
 }
 
+func (s *StateReceiving) getKeyChain(u *entity.User) *entity.KeyChain {
+	rr, err := s.p.owner.Storage.GetKeyRotations(u.ID())
+	if err != nil {
+		log.Fatalf("Failed to get key rotations of %s: %v", u.ID().Shorten(), err)
+	}
+	vv, err := s.p.owner.Storage.GetKeyRevocations(u.ID())
+	if err != nil {
+		log.Fatalf("Failed to get key revocations of %s: %v", u.ID().Shorten(), err)
+	}
+	return entity.NewKeyChain(u, rr, vv)
+}
+
 func (s *StateReceiving) getPendingMessage(id *entity.ID) *entity.Message {
 	e := s.getPendingEntity(id)
 	if e == nil {
@@ -263,7 +308,7 @@ func (s *StateReceiving) sendAck() error {
 
 func (s *StateReceiving) processAnnounce() (*packet.PayloadAnnounce, error) {
 	pkt := s.initialPacket
-	if !pkt.VerifySig(&s.p.User.PubKey) {
+	if !pkt.VerifySig(s.p.key) {
 		log.Infof("Peer %s sent a packet with invalid signature: %s", s.p)
 		return nil, errors.ProtocolViolation
 	}
@@ -292,13 +337,27 @@ func (s *StateReceiving) readEntity() (entity.Entity, error) {
 		log.Errorf("Error receiving packet from the peer %s: %v", s.p, err)
 		return nil, err
 	}
-	if !pkt.VerifySig(&s.p.User.PubKey) {
+	if !pkt.VerifySig(s.p.key) {
 		log.Infof("Peer %s sent a packet with invalid signature", s.p)
 		return nil, errors.ProtocolViolation
 	}
+	if pkt.Body.Type == packet.TypePart && s.p.proto >= protoLongMessages {
+		pkt, err = s.readParts(pkt)
+		if err != nil {
+			return nil, err
+		}
+		if !pkt.VerifySig(s.p.key) {
+			log.Infof("Peer %s sent a packet with invalid signature in parts", s.p)
+			return nil, errors.ProtocolViolation
+		}
+	}
 
 	verifyType := func(t packet.Type) bool {
-		return t == packet.TypeUser || t == packet.TypeMessage || t == packet.TypeOperation
+		return t == packet.TypeUser || t == packet.TypeMessage || t == packet.TypeOperation ||
+			t == packet.TypeUserUpdate || t == packet.TypeKeyRotation ||
+			t == packet.TypeKeyRevocation || t == packet.TypeReaction ||
+			t == packet.TypeModeratorList || t == packet.TypePrivateMessage ||
+			t == packet.TypeVote
 	}
 
 	if pkt.VerifyHeaderFull(verifyType, s.p.owner.User.ID()) != nil {
@@ -322,6 +381,206 @@ func (s *StateReceiving) readEntity() (entity.Entity, error) {
 	return e, nil
 }
 
+// readParts requests the rest of the parts of the packet, which the first part
+// belongs to, and reassembles the packet.
+func (s *StateReceiving) readParts(first *packet.Packet) (*packet.Packet, error) {
+	err := first.VerifyHeader(packet.TypePart, s.p.owner.User.ID())
+	if err != nil {
+		log.Infof("Peer %s sent packet with invalid header: %v", s.p, err)
+		return nil, errors.ProtocolViolation
+	}
+	p, err := decodePart(first)
+	if err != nil {
+		return nil, err
+	}
+	if !p.IsValid() || p.Index != 0 {
+		log.Infof("Peer %s sent invalid first part of packet %s", s.p, p.ID.Shorten())
+		return nil, errors.ProtocolViolation
+	}
+	log.Debugf("Fetching packet %s in %d parts from peer %s", p.ID.Shorten(), p.Total, s.p)
+	data := make([]byte, 0, p.Total*packet.PartSize)
+	data = append(data, p.Data...)
+	for i := 1; i < p.Total; i++ {
+		err := s.sendPartReq(&p.ID, i)
+		if err != nil {
+			return nil, err
+		}
+		next, err := s.readPart()
+		if err != nil {
+			return nil, err
+		}
+		if !next.IsValid() || next.ID != p.ID || next.Index != i || next.Total != p.Total {
+			log.Infof("Peer %s sent unexpected part of packet %s", s.p, p.ID.Shorten())
+			return nil, errors.ProtocolViolation
+		}
+		if len(data)+len(next.Data) > packet.MaxSplitPacketSize {
+			log.Infof("Peer %s sent packet %s exceeding the size limit", s.p, p.ID.Shorten())
+			return nil, errors.ProtocolViolation
+		}
+		data = append(data, next.Data...)
+	}
+	if entity.NewID(data) != p.ID {
+		log.Infof("Peer %s sent packet %s with wrong content", s.p, p.ID.Shorten())
+		return nil, errors.ProtocolViolation
+	}
+	pkt, err := packet.Decode(data)
+	if err != nil {
+		log.Infof("Peer %s sent malformed packet %s in parts", s.p, p.ID.Shorten())
+		return nil, errors.ProtocolViolation
+	}
+	return pkt, nil
+}
+
+func (s *StateReceiving) sendPartReq(id *entity.ID, index int) error {
+	pld := packet.NewPayloadPartReq(id, index)
+	pkt := packet.New(packet.TypePartReq, s.p.User.ID(), pld, s.p.owner.Signer)
+	err := s.p.conn.Write(pkt)
+	if err != nil {
+		log.Errorf("Error sending %s to the peer %s: %v", pkt, s.p, err)
+		return err
+	}
+	return nil
+}
+
+func (s *StateReceiving) readPart() (*packet.PayloadPart, error) {
+	pkt, err := s.p.conn.Read()
+	if err != nil {
+		log.Errorf("Error receiving packet from the peer %s: %v", s.p, err)
+		return nil, err
+	}
+	if !pkt.VerifySig(s.p.key) {
+		log.Infof("Peer %s sent a packet with invalid signature", s.p)
+		return nil, errors.ProtocolViolation
+	}
+	err = pkt.VerifyHeader(packet.TypePart, s.p.owner.User.ID())
+	if err != nil {
+		log.Infof("Peer %s sent packet with invalid header: %v", s.p, err)
+		return nil, errors.ProtocolViolation
+	}
+	return decodePart(pkt)
+}
+
+func decodePart(pkt *packet.Packet) (*packet.PayloadPart, error) {
+	i, err := pkt.DecodePayload()
+	if err != nil {
+		log.Infof("Failed to decode payload of packet '%s': %v", pkt, err)
+		return nil, errors.ProtocolViolation
+	}
+	p, ok := (i).(*packet.PayloadPart)
+	if !ok {
+		log.Fatal("BUG: packet type does not match type of successfully decoded payload.")
+	}
+	return p, nil
+}
+
+// fetchAttachments downloads the blobs attached to the received messages.
+// Missing attachments are tolerated: the peer may not have them either and
+// the store may run out of quota.
+func (s *StateReceiving) fetchAttachments() error {
+	if s.p.proto < protoBlobs {
+		return nil
+	}
+	for _, ent := range s.pendingEntities {
+		m, ok := (ent).(*entity.Message)
+		if !ok {
+			continue
+		}
+		for i := range m.Attachments {
+			a := &m.Attachments[i]
+			if s.p.owner.Blobs.Has(&a.Hash) {
+				continue
+			}
+			if !s.p.owner.Blobs.HasRoom(a.Size) {
+				log.Infof("Skipping attachment %s of %s: quota exceeded", a, m.ShortID())
+				continue
+			}
+			data, err := s.fetchBlob(a)
+			if err != nil {
+				return err
+			}
+			if data == nil {
+				continue
+			}
+			_, err = s.p.owner.Blobs.Put(data)
+			if err != nil {
+				log.Errorf("Failed to put blob %s into the store: %v", a.Hash.Shorten(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// fetchBlob requests the blob chunk by chunk. Returns nil data if the peer
+// does not have the blob.
+func (s *StateReceiving) fetchBlob(a *entity.Attachment) ([]byte, error) {
+	log.Debugf("Fetching blob %s from peer %s", a, s.p)
+	data := make([]byte, 0, a.Size)
+	for int64(len(data)) < a.Size {
+		offset := int64(len(data))
+		err := s.sendBlobReq(&a.Hash, offset)
+		if err != nil {
+			return nil, err
+		}
+		b, err := s.readBlob()
+		if err != nil {
+			return nil, err
+		}
+		if b.ID != a.Hash || b.Offset != offset || len(b.Data) > packet.BlobChunkSize ||
+			offset+int64(len(b.Data)) > a.Size {
+			log.Infof("Peer %s sent unexpected chunk of blob %s", s.p, a.Hash.Shorten())
+			return nil, errors.ProtocolViolation
+		}
+		if len(b.Data) == 0 {
+			log.Debugf("Peer %s does not have blob %s", s.p, a.Hash.Shorten())
+			return nil, nil
+		}
+		data = append(data, b.Data...)
+	}
+	if entity.NewID(data) != a.Hash {
+		log.Infof("Peer %s sent blob %s with wrong content", s.p, a.Hash.Shorten())
+		return nil, errors.ProtocolViolation
+	}
+	return data, nil
+}
+
+func (s *StateReceiving) sendBlobReq(id *entity.ID, offset int64) error {
+	pld := packet.NewPayloadBlobReq(id, offset)
+	pkt := packet.New(packet.TypeBlobReq, s.p.User.ID(), pld, s.p.owner.Signer)
+	err := s.p.conn.Write(pkt)
+	if err != nil {
+		log.Errorf("Error sending %s to the peer %s: %v", pkt, s.p, err)
+		return err
+	}
+	return nil
+}
+
+func (s *StateReceiving) readBlob() (*packet.PayloadBlob, error) {
+	pkt, err := s.p.conn.Read()
+	if err != nil {
+		log.Errorf("Error receiving packet from the peer %s: %v", s.p, err)
+		return nil, err
+	}
+	if !pkt.VerifySig(s.p.key) {
+		log.Infof("Peer %s sent a packet with invalid signature", s.p)
+		return nil, errors.ProtocolViolation
+	}
+	err = pkt.VerifyHeader(packet.TypeBlob, s.p.owner.User.ID())
+	if err != nil {
+		log.Infof("Peer %s sent packet with invalid header: %v", s.p, err)
+		return nil, errors.ProtocolViolation
+	}
+	i, err := pkt.DecodePayload()
+	if err != nil {
+		log.Infof("Failed to decode payload of packet '%s': %v", pkt, err)
+		return nil, errors.ProtocolViolation
+	}
+	b, ok := (i).(*packet.PayloadBlob)
+	if !ok {
+		log.Fatal("BUG: packet type does not match type of successfully decoded payload.")
+	}
+	return b, nil
+}
+
 func (s *StateReceiving) checkPendingEntities() error {
 	e := s.pendingEntities[0]
 	_, ok := (e).(*entity.User)
@@ -338,6 +597,20 @@ func (s *StateReceiving) checkPendingEntities() error {
 			err = s.checkMessage(e)
 		case *entity.Operation:
 			err = s.checkOperation(e)
+		case *entity.UserUpdate:
+			err = s.checkUserUpdate(e)
+		case *entity.KeyRotation:
+			err = s.checkKeyRotation(e)
+		case *entity.KeyRevocation:
+			err = s.checkKeyRevocation(e)
+		case *entity.Reaction:
+			err = s.checkReaction(e)
+		case *entity.ModeratorList:
+			err = s.checkModeratorList(e)
+		case *entity.PrivateMessage:
+			err = s.checkPrivateMessage(e)
+		case *entity.Vote:
+			err = s.checkVote(e)
 		default:
 			log.Fatalf("BUG: unexpected type of entity: %T", e)
 		}
@@ -354,6 +627,10 @@ func (s *StateReceiving) checkUser(u *entity.User) error {
 		log.Infof("Peer %s sent malformed User entity", s.p)
 		return &banSenderError{"peer sent malformed user " + u.ID().Shorten()}
 	}
+	if u.ProofDifficulty() < s.p.policy.MinUserProofBits {
+		log.Debugf("Skipping user %s with %d-bit proof-of-work", u.ID().Shorten(), u.ProofDifficulty())
+		return &skipError{}
+	}
 	isBanned, err := s.p.owner.View.IsUserBanned(u.ID())
 	if err != nil {
 		log.Fatalf("Failed check whether %s is banned: %v", u.ID().Shorten(), err)
@@ -369,6 +646,12 @@ func (s *StateReceiving) checkMessage(m *entity.Message) error {
 		log.Infof("Peer %s sent malformed Message entity", s.p)
 		return &banSenderError{"peer sent malformed message " + m.ID().Shorten()}
 	}
+	// The peer may require easier stamps than this node does, so messages
+	// with insufficient stamps are not considered malicious.
+	if m.StampBits() < s.p.policy.MinMessageStampBits {
+		log.Debugf("Skipping message %s with %d-bit stamp", m.ID().Shorten(), m.StampBits())
+		return &skipError{}
+	}
 	isBanned, err := s.p.owner.View.IsUserBanned(&m.AuthorID)
 	if err != nil {
 		log.Fatalf("Failed check whether %s is banned: %v", m.AuthorID.Shorten(), err)
@@ -388,7 +671,12 @@ func (s *StateReceiving) checkMessage(m *entity.Message) error {
 			log.Fatalf("Unexpected error occurred while getting user from the DB: %v", err)
 		}
 	}
-	if !m.IsSigValid(&u.PubKey) {
+	key := s.getKeyChain(u).KeyFor(m.DateWritten, time.Now())
+	if key == nil {
+		log.Debugf("Skipping message %s signed by a revoked or retired key", m.ID().Shorten())
+		return &skipError{}
+	}
+	if !m.IsSigValid(key) {
 		log.Infof("Peer %s sent Message entity with invalid sig", s.p)
 		comment := "peer sent message " + m.ID().Shorten() + " with invalid signature"
 		return &banSenderError{comment}
@@ -417,7 +705,9 @@ func (s *StateReceiving) checkMessage(m *entity.Message) error {
 		}
 	}
 	if m.ParentID.IsZero() {
-		if !s.p.owner.Profile.GetSubscriptions().Covers(m.Topic) {
+		// Threads referred to by other messages are accepted regardless
+		// of the subscriptions.
+		if !s.p.owner.Profile.GetSubscriptions().Covers(m.Topic) && !s.isReferenced(m.ID()) {
 			log.Infof("Peer %s sent unsolicited Message entity", s.p)
 			return &banSenderError{"peer sent unsolicited message " + m.ID().Shorten()}
 		}
@@ -430,9 +720,41 @@ func (s *StateReceiving) checkMessage(m *entity.Message) error {
 			return &needIDError{&m.ParentID}
 		}
 	}
+	for i := range m.References {
+		rid := &m.References[i].ID
+		has, err := s.p.owner.Storage.HasMessage(rid)
+		if err != nil {
+			log.Fatalf("Unexpected error while looking for a message in the DB: %v", err)
+		}
+		if !has && s.getPendingMessage(rid) == nil {
+			log.Debugf("Need message ID (%s) - referred to by the message %s",
+				rid.Shorten(), m.ID().Shorten())
+			return &needIDError{rid}
+		}
+	}
 	return nil
 }
 
+// isReferenced checks whether any of the pending messages refers to the
+// message or to one of its replies.
+func (s *StateReceiving) isReferenced(id *entity.ID) bool {
+	for _, e := range s.pendingEntities {
+		m, ok := (e).(*entity.Message)
+		if !ok {
+			continue
+		}
+		for i := range m.References {
+			if m.References[i].ID == *id {
+				return true
+			}
+		}
+		if m.ParentID == *id && s.isReferenced(m.ID()) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *StateReceiving) checkOperation(o *entity.Operation) error {
 	if !o.IsUnsignedPartValid() {
 		log.Infof("Peer %s sent malformed Operation entity", s.p)
@@ -458,30 +780,397 @@ func (s *StateReceiving) checkOperation(o *entity.Operation) error {
 				o.AuthorID.Shorten(), err)
 		}
 	}
-	if !o.IsSigValid(&u.PubKey) {
+	key := s.getKeyChain(u).KeyFor(o.DatePerformed, time.Now())
+	if key == nil {
+		log.Debugf("Skipping operation %s signed by a revoked or retired key", o.ID().Shorten())
+		return &skipError{}
+	}
+	if !o.IsSigValid(key) {
 		log.Infof("Peer %s sent Operation with invalid sig", s.p)
 		comment := "peer sent operation " + o.ID().Shorten() + " with invalid signature"
 		return &banSenderError{comment}
 	}
 	// TBD: check rate of operations performed by u
-	if s.getPendingEntity(&o.ObjectID) == nil {
-		has, err := s.p.owner.Storage.HasEntity(&o.ObjectID)
-		if err != nil {
-			log.Fatalf("Unexpected error occurred while checking for entity %s: %v",
-				o.ObjectID.Shorten(), err)
-		}
-		if !has {
-			if o.OperationType() == entity.OperationTypeBanUser {
+	obj := s.getPendingEntity(&o.ObjectID)
+	if obj == nil {
+		var err error
+		obj, err = s.p.owner.Storage.GetEntity(&o.ObjectID)
+		if err == errors.NoSuchEntity {
+			if o.OperationType().ObjectType() == entity.TypeUser {
 				log.Debugf("Skipping operation on unknown user (%s)",
 					o.ObjectID.Shorten())
 				return &skipError{}
 			} else {
-				log.Debugf("Need message ID (%s) - object of the operation %s",
+				log.Debugf("Need entity ID (%s) - object of the operation %s",
 					o.ObjectID.Shorten(), o.ID().Shorten())
 				return &needIDError{&o.ObjectID}
 			}
+		} else if err != nil {
+			log.Fatalf("Unexpected error occurred while getting entity %s: %v",
+				o.ObjectID.Shorten(), err)
+		}
+	}
+	if obj.Type() != o.OperationType().ObjectType() {
+		log.Infof("Peer %s sent Operation %s on entity of wrong type", s.p, o.ID().Shorten())
+		comment := "peer sent operation " + o.ID().Shorten() + " on entity of wrong type"
+		return &banSenderError{comment}
+	}
+	return nil
+}
+
+func (s *StateReceiving) checkUserUpdate(uu *entity.UserUpdate) error {
+	if !uu.IsUnsignedPartValid() {
+		log.Infof("Peer %s sent malformed UserUpdate entity", s.p)
+		return &banSenderError{"peer sent malformed user update " + uu.ID().Shorten()}
+	}
+	isBanned, err := s.p.owner.View.IsUserBanned(&uu.UserID)
+	if err != nil {
+		log.Fatalf("Failed check whether %s is banned: %v", uu.UserID.Shorten(), err)
+	}
+	if isBanned {
+		return &bannedError{}
+	}
+	u := s.getPendingUser(&uu.UserID)
+	if u == nil {
+		var err error
+		u, err = s.p.owner.Storage.GetUser(&uu.UserID)
+		if err == errors.NoSuchEntity {
+			log.Debugf("Skipping update of unknown user (%s)", uu.UserID.Shorten())
+			return &skipError{}
+		} else if err != nil {
+			log.Fatalf("Unexpected error occurred while getting user %s: %v",
+				uu.UserID.Shorten(), err)
+		}
+	}
+	key := s.getKeyChain(u).KeyFor(uu.DateUpdated, time.Now())
+	if key == nil {
+		log.Debugf("Skipping user update %s signed by a revoked or retired key", uu.ID().Shorten())
+		return &skipError{}
+	}
+	if !uu.IsSigValid(key) {
+		log.Infof("Peer %s sent UserUpdate with invalid sig", s.p)
+		comment := "peer sent user update " + uu.ID().Shorten() + " with invalid signature"
+		return &banSenderError{comment}
+	}
+	if u.RegDate.After(uu.DateUpdated) {
+		log.Debugf("RegDate of %s is after than timestamp of his update %s",
+			u.ID().Shorten(), uu.ID().Shorten())
+		comment := "RegDate is less than timestamp of " + uu.ID().String()
+		return &banIDError{u.ID(), comment}
+	}
+	latest, err := s.p.owner.Storage.GetLatestUserUpdate(&uu.UserID)
+	if err != nil && err != errors.NoSuchEntity {
+		log.Fatalf("Unexpected error occurred while getting update of user %s: %v",
+			uu.UserID.Shorten(), err)
+	}
+	if err == nil && uu.Seq <= latest.Seq {
+		log.Debugf("Skipping user update %s, which is not newer than %s",
+			uu.ID().Shorten(), latest.ID().Shorten())
+		return &skipError{}
+	}
+	// TBD: check rate of updates performed by u
+	return nil
+}
+
+func (s *StateReceiving) checkKeyRotation(kr *entity.KeyRotation) error {
+	if !kr.IsUnsignedPartValid() {
+		log.Infof("Peer %s sent malformed KeyRotation entity", s.p)
+		return &banSenderError{"peer sent malformed key rotation " + kr.ID().Shorten()}
+	}
+	isBanned, err := s.p.owner.View.IsUserBanned(&kr.UserID)
+	if err != nil {
+		log.Fatalf("Failed check whether %s is banned: %v", kr.UserID.Shorten(), err)
+	}
+	if isBanned {
+		return &bannedError{}
+	}
+	u := s.getPendingUser(&kr.UserID)
+	if u == nil {
+		var err error
+		u, err = s.p.owner.Storage.GetUser(&kr.UserID)
+		if err == errors.NoSuchEntity {
+			log.Debugf("Skipping key rotation of unknown user (%s)", kr.UserID.Shorten())
+			return &skipError{}
+		} else if err != nil {
+			log.Fatalf("Unexpected error occurred while getting user %s: %v",
+				kr.UserID.Shorten(), err)
+		}
+	}
+	kc := s.getKeyChain(u)
+	prevKey := kc.Key(kr.Seq - 1)
+	if prevKey == nil {
+		log.Debugf("Skipping key rotation %s: previous key is unknown", kr.ID().Shorten())
+		return &skipError{}
+	}
+	if !kr.IsSigValid(prevKey) {
+		log.Infof("Peer %s sent KeyRotation with invalid sig", s.p)
+		comment := "peer sent key rotation " + kr.ID().Shorten() + " with invalid signature"
+		return &banSenderError{comment}
+	}
+	if kc.IsRevoked(kr.Seq - 1) {
+		log.Debugf("Skipping key rotation %s of a revoked key", kr.ID().Shorten())
+		return &skipError{}
+	}
+	if u.RegDate.After(kr.DateRotated) {
+		log.Debugf("RegDate of %s is after than timestamp of his key rotation %s",
+			u.ID().Shorten(), kr.ID().Shorten())
+		comment := "RegDate is less than timestamp of " + kr.ID().String()
+		return &banIDError{u.ID(), comment}
+	}
+	return nil
+}
+
+func (s *StateReceiving) checkKeyRevocation(kr *entity.KeyRevocation) error {
+	if !kr.IsUnsignedPartValid() {
+		log.Infof("Peer %s sent malformed KeyRevocation entity", s.p)
+		return &banSenderError{"peer sent malformed key revocation " + kr.ID().Shorten()}
+	}
+	// Revocations of banned users are accepted as well, since they can only
+	// restrict the user.
+	u := s.getPendingUser(&kr.UserID)
+	if u == nil {
+		var err error
+		u, err = s.p.owner.Storage.GetUser(&kr.UserID)
+		if err == errors.NoSuchEntity {
+			log.Debugf("Skipping key revocation of unknown user (%s)", kr.UserID.Shorten())
+			return &skipError{}
+		} else if err != nil {
+			log.Fatalf("Unexpected error occurred while getting user %s: %v",
+				kr.UserID.Shorten(), err)
+		}
+	}
+	revokedKey := s.getKeyChain(u).Key(kr.KeySeq)
+	if revokedKey == nil {
+		log.Debugf("Skipping key revocation %s: revoked key is unknown", kr.ID().Shorten())
+		return &skipError{}
+	}
+	if !kr.IsSigValid(revokedKey) {
+		log.Infof("Peer %s sent KeyRevocation with invalid sig", s.p)
+		comment := "peer sent key revocation " + kr.ID().Shorten() + " with invalid signature"
+		return &banSenderError{comment}
+	}
+	return nil
+}
+
+func (s *StateReceiving) checkReaction(r *entity.Reaction) error {
+	if !r.IsUnsignedPartValid() {
+		log.Infof("Peer %s sent malformed Reaction entity", s.p)
+		return &banSenderError{"peer sent malformed reaction " + r.ID().Shorten()}
+	}
+	isBanned, err := s.p.owner.View.IsUserBanned(&r.AuthorID)
+	if err != nil {
+		log.Fatalf("Failed check whether %s is banned: %v", r.AuthorID.Shorten(), err)
+	}
+	if isBanned {
+		return &bannedError{}
+	}
+	u := s.getPendingUser(&r.AuthorID)
+	if u == nil {
+		var err error
+		u, err = s.p.owner.Storage.GetUser(&r.AuthorID)
+		if err == errors.NoSuchEntity {
+			log.Debugf("Need user ID (%s) - author of the reaction %s",
+				r.AuthorID.Shorten(), r.ID().Shorten())
+			return &needIDError{&r.AuthorID}
+		} else if err != nil {
+			log.Fatalf("Unexpected error occurred while getting user %s: %v",
+				r.AuthorID.Shorten(), err)
+		}
+	}
+	key := s.getKeyChain(u).KeyFor(r.DateReacted, time.Now())
+	if key == nil {
+		log.Debugf("Skipping reaction %s signed by a revoked or retired key", r.ID().Shorten())
+		return &skipError{}
+	}
+	if !r.IsSigValid(key) {
+		log.Infof("Peer %s sent Reaction with invalid sig", s.p)
+		comment := "peer sent reaction " + r.ID().Shorten() + " with invalid signature"
+		return &banSenderError{comment}
+	}
+	if u.RegDate.After(r.DateReacted) {
+		log.Debugf("RegDate of %s is after than timestamp of his reaction %s",
+			u.ID().Shorten(), r.ID().Shorten())
+		comment := "RegDate is less than timestamp of " + r.ID().String()
+		return &banIDError{u.ID(), comment}
+	}
+	// TBD: check rate of reactions performed by u
+	has, err := s.p.owner.Storage.HasMessage(&r.MessageID)
+	if err != nil {
+		log.Fatalf("Unexpected error while looking for a message in the DB: %v", err)
+	}
+	if !has && s.getPendingMessage(&r.MessageID) == nil {
+		log.Debugf("Need message ID (%s) - target of the reaction %s",
+			r.MessageID.Shorten(), r.ID().Shorten())
+		return &needIDError{&r.MessageID}
+	}
+	return nil
+}
+
+func (s *StateReceiving) checkModeratorList(ml *entity.ModeratorList) error {
+	if !ml.IsUnsignedPartValid() {
+		log.Infof("Peer %s sent malformed ModeratorList entity", s.p)
+		return &banSenderError{"peer sent malformed moderator list " + ml.ID().Shorten()}
+	}
+	isBanned, err := s.p.owner.View.IsUserBanned(&ml.UserID)
+	if err != nil {
+		log.Fatalf("Failed check whether %s is banned: %v", ml.UserID.Shorten(), err)
+	}
+	if isBanned {
+		return &bannedError{}
+	}
+	u := s.getPendingUser(&ml.UserID)
+	if u == nil {
+		var err error
+		u, err = s.p.owner.Storage.GetUser(&ml.UserID)
+		if err == errors.NoSuchEntity {
+			log.Debugf("Skipping moderator list of unknown user (%s)", ml.UserID.Shorten())
+			return &skipError{}
+		} else if err != nil {
+			log.Fatalf("Unexpected error occurred while getting user %s: %v",
+				ml.UserID.Shorten(), err)
 		}
 	}
+	key := s.getKeyChain(u).KeyFor(ml.DateUpdated, time.Now())
+	if key == nil {
+		log.Debugf("Skipping moderator list %s signed by a revoked or retired key", ml.ID().Shorten())
+		return &skipError{}
+	}
+	if !ml.IsSigValid(key) {
+		log.Infof("Peer %s sent ModeratorList with invalid sig", s.p)
+		comment := "peer sent moderator list " + ml.ID().Shorten() + " with invalid signature"
+		return &banSenderError{comment}
+	}
+	if u.RegDate.After(ml.DateUpdated) {
+		log.Debugf("RegDate of %s is after than timestamp of his moderator list %s",
+			u.ID().Shorten(), ml.ID().Shorten())
+		comment := "RegDate is less than timestamp of " + ml.ID().String()
+		return &banIDError{u.ID(), comment}
+	}
+	// TBD: check rate of moderator lists published by u
+	return nil
+}
+
+func (s *StateReceiving) checkPrivateMessage(pm *entity.PrivateMessage) error {
+	if !pm.IsUnsignedPartValid() {
+		log.Infof("Peer %s sent malformed PrivateMessage entity", s.p)
+		return &banSenderError{"peer sent malformed private message " + pm.ID().Shorten()}
+	}
+	isBanned, err := s.p.owner.View.IsUserBanned(&pm.AuthorID)
+	if err != nil {
+		log.Fatalf("Failed check whether %s is banned: %v", pm.AuthorID.Shorten(), err)
+	}
+	if isBanned {
+		return &bannedError{}
+	}
+	u := s.getPendingUser(&pm.AuthorID)
+	if u == nil {
+		var err error
+		u, err = s.p.owner.Storage.GetUser(&pm.AuthorID)
+		if err == errors.NoSuchEntity {
+			log.Debugf("Need user ID (%s) - author of the private message %s",
+				pm.AuthorID.Shorten(), pm.ID().Shorten())
+			return &needIDError{&pm.AuthorID}
+		} else if err != nil {
+			log.Fatalf("Unexpected error occurred while getting user %s: %v",
+				pm.AuthorID.Shorten(), err)
+		}
+	}
+	key := s.getKeyChain(u).KeyFor(pm.DateWritten, time.Now())
+	if key == nil {
+		log.Debugf("Skipping private message %s signed by a revoked or retired key", pm.ID().Shorten())
+		return &skipError{}
+	}
+	if !pm.IsSigValid(key) {
+		log.Infof("Peer %s sent PrivateMessage with invalid sig", s.p)
+		comment := "peer sent private message " + pm.ID().Shorten() + " with invalid signature"
+		return &banSenderError{comment}
+	}
+	if u.RegDate.After(pm.DateWritten) {
+		log.Debugf("RegDate of %s is after than timestamp of his private message %s",
+			u.ID().Shorten(), pm.ID().Shorten())
+		comment := "RegDate is less than timestamp of " + pm.ID().String()
+		return &banIDError{u.ID(), comment}
+	}
+	// TBD: check rate of private messages sent by u
+	if s.getPendingUser(&pm.RecipientID) == nil {
+		has, err := s.p.owner.Storage.HasUser(&pm.RecipientID)
+		if err != nil {
+			log.Fatalf("Unexpected error while looking for a user in the DB: %v", err)
+		}
+		if !has {
+			log.Debugf("Need user ID (%s) - recipient of the private message %s",
+				pm.RecipientID.Shorten(), pm.ID().Shorten())
+			return &needIDError{&pm.RecipientID}
+		}
+	}
+	return nil
+}
+
+func (s *StateReceiving) checkVote(v *entity.Vote) error {
+	if !v.IsUnsignedPartValid() {
+		log.Infof("Peer %s sent malformed Vote entity", s.p)
+		return &banSenderError{"peer sent malformed vote " + v.ID().Shorten()}
+	}
+	isBanned, err := s.p.owner.View.IsUserBanned(&v.AuthorID)
+	if err != nil {
+		log.Fatalf("Failed check whether %s is banned: %v", v.AuthorID.Shorten(), err)
+	}
+	if isBanned {
+		return &bannedError{}
+	}
+	u := s.getPendingUser(&v.AuthorID)
+	if u == nil {
+		var err error
+		u, err = s.p.owner.Storage.GetUser(&v.AuthorID)
+		if err == errors.NoSuchEntity {
+			log.Debugf("Need user ID (%s) - author of the vote %s",
+				v.AuthorID.Shorten(), v.ID().Shorten())
+			return &needIDError{&v.AuthorID}
+		} else if err != nil {
+			log.Fatalf("Unexpected error occurred while getting user %s: %v",
+				v.AuthorID.Shorten(), err)
+		}
+	}
+	key := s.getKeyChain(u).KeyFor(v.DateVoted, time.Now())
+	if key == nil {
+		log.Debugf("Skipping vote %s signed by a revoked or retired key", v.ID().Shorten())
+		return &skipError{}
+	}
+	if !v.IsSigValid(key) {
+		log.Infof("Peer %s sent Vote with invalid sig", s.p)
+		comment := "peer sent vote " + v.ID().Shorten() + " with invalid signature"
+		return &banSenderError{comment}
+	}
+	if u.RegDate.After(v.DateVoted) {
+		log.Debugf("RegDate of %s is after than timestamp of his vote %s",
+			u.ID().Shorten(), v.ID().Shorten())
+		comment := "RegDate is less than timestamp of " + v.ID().String()
+		return &banIDError{u.ID(), comment}
+	}
+	// TBD: check rate of votes performed by u
+	m := s.getPendingMessage(&v.PollID)
+	if m == nil {
+		var err error
+		m, err = s.p.owner.Storage.GetMessage(&v.PollID)
+		if err == errors.NoSuchEntity {
+			log.Debugf("Need message ID (%s) - poll of the vote %s",
+				v.PollID.Shorten(), v.ID().Shorten())
+			return &needIDError{&v.PollID}
+		} else if err != nil {
+			log.Fatalf("Unexpected error occurred while getting message %s: %v",
+				v.PollID.Shorten(), err)
+		}
+	}
+	if m.Poll == nil || v.Choice < 0 || v.Choice >= len(m.Poll.Options) {
+		log.Infof("Peer %s sent Vote for a nonexistent option", s.p)
+		comment := "peer sent vote " + v.ID().Shorten() + " for a nonexistent option"
+		return &banSenderError{comment}
+	}
+	// The date of the vote can be forged, but the time of receipt can't.
+	if !m.Poll.IsAccepting(v.DateVoted, time.Now()) {
+		log.Debugf("Skipping vote %s on the closed poll", v.ID().Shorten())
+		return &skipError{}
+	}
 	return nil
 }
 
@@ -22,6 +22,7 @@ import (
 	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
+	"vminko.org/dscuss/p2p/connection"
 	"vminko.org/dscuss/packet"
 )
 
@@ -31,10 +32,11 @@ type StateSending struct {
 	outgoingEntity entity.Entity
 	stored         time.Time
 	next           State
+	outgoingParts  []*packet.PayloadPart
 }
 
 func newStateSending(p *Peer, e entity.Entity, t time.Time, next State) *StateSending {
-	return &StateSending{p, e, t, next}
+	return &StateSending{p: p, outgoingEntity: e, stored: t, next: next}
 }
 
 func (s *StateSending) perform() (nextState State, err error) {
@@ -57,12 +59,13 @@ func (s *StateSending) perform() (nextState State, err error) {
 			log.Errorf("Error receiving packet from the peer %s: %v", s.p, err)
 			return nil, err
 		}
-		if !pkt.VerifySig(&s.p.User.PubKey) {
+		if !pkt.VerifySig(s.p.key) {
 			log.Infof("Peer %s sent a packet with invalid signature", s.p)
 			return nil, errors.ProtocolViolation
 		}
 		verifyType := func(t packet.Type) bool {
-			return t == packet.TypeAck || t == packet.TypeReq || t == packet.TypeAnnounce
+			return t == packet.TypeAck || t == packet.TypeReq || t == packet.TypeAnnounce ||
+				t == packet.TypeBlobReq || t == packet.TypePartReq
 		}
 		if pkt.VerifyHeaderFull(verifyType, s.p.owner.User.ID()) != nil {
 			log.Infof("Peer %s sent packet with invalid header", s.p)
@@ -85,6 +88,18 @@ func (s *StateSending) perform() (nextState State, err error) {
 				log.Errorf("Error processing req from peer %s: %v", s.p, err)
 				return nil, err
 			}
+		case packet.TypeBlobReq:
+			err = s.processBlobReq(pkt)
+			if err != nil {
+				log.Errorf("Error processing blob req from peer %s: %v", s.p, err)
+				return nil, err
+			}
+		case packet.TypePartReq:
+			err = s.processPartReq(pkt)
+			if err != nil {
+				log.Errorf("Error processing part req from peer %s: %v", s.p, err)
+				return nil, err
+			}
 		default:
 			log.Fatal("BUG: packet type validation failed.")
 		}
@@ -121,6 +136,11 @@ func (s *StateSending) processReq(pkt *packet.Packet) error {
 			return err
 		}
 	}
+	if !s.p.canAccept(e) {
+		log.Infof("Peer %s requested %s, which is not supported by protocol version %d",
+			s.p, e.ShortID(), s.p.proto)
+		return errors.UnsupportedProtocol
+	}
 	err = s.sendEntity(e)
 	if err != nil {
 		log.Infof("Failed to send outgoing entity to '%s': %v", s.p, err)
@@ -129,6 +149,65 @@ func (s *StateSending) processReq(pkt *packet.Packet) error {
 	return nil
 }
 
+// processBlobReq sends the requested chunk of a blob. If the blob is not
+// available, the chunk is empty.
+func (s *StateSending) processBlobReq(pkt *packet.Packet) error {
+	i, err := pkt.DecodePayload()
+	if err != nil {
+		log.Infof("Failed to decode payload of a blob req '%s': %v", pkt, err)
+		return errors.ProtocolViolation
+	}
+	r, ok := (i).(*packet.PayloadBlobReq)
+	if !ok {
+		log.Fatal("BUG: packet type does not match type of successfully decoded payload.")
+	}
+	data, err := s.p.owner.Blobs.GetChunk(&r.ID, r.Offset, packet.BlobChunkSize)
+	switch err {
+	case nil:
+	case errors.NoSuchBlob, errors.Filesystem:
+		log.Debugf("Peer %s requested unavailable blob %s", s.p, r.ID.Shorten())
+		data = nil
+	default:
+		log.Infof("Peer %s requested blob %s at wrong offset %d", s.p, r.ID.Shorten(), r.Offset)
+		return errors.ProtocolViolation
+	}
+	pld := packet.NewPayloadBlob(&r.ID, r.Offset, data)
+	resp := packet.New(packet.TypeBlob, s.p.User.ID(), pld, s.p.owner.Signer)
+	err = s.p.conn.Write(resp)
+	if err != nil {
+		log.Errorf("Error sending %s to the peer %s: %v", resp, s.p, err)
+		return err
+	}
+	return nil
+}
+
+// processPartReq sends the requested part of the packet being transferred in
+// parts.
+func (s *StateSending) processPartReq(pkt *packet.Packet) error {
+	i, err := pkt.DecodePayload()
+	if err != nil {
+		log.Infof("Failed to decode payload of a part req '%s': %v", pkt, err)
+		return errors.ProtocolViolation
+	}
+	r, ok := (i).(*packet.PayloadPartReq)
+	if !ok {
+		log.Fatal("BUG: packet type does not match type of successfully decoded payload.")
+	}
+	if len(s.outgoingParts) == 0 || r.ID != s.outgoingParts[0].ID ||
+		r.Index < 0 || r.Index >= len(s.outgoingParts) {
+		log.Infof("Peer %s requested unexpected part %d of packet %s",
+			s.p, r.Index, r.ID.Shorten())
+		return errors.ProtocolViolation
+	}
+	resp := packet.New(packet.TypePart, s.p.User.ID(), s.outgoingParts[r.Index], s.p.owner.Signer)
+	err = s.p.conn.Write(resp)
+	if err != nil {
+		log.Errorf("Error sending %s to the peer %s: %v", resp, s.p, err)
+		return err
+	}
+	return nil
+}
+
 func (s *StateSending) processAck(pkt *packet.Packet) error {
 	i, err := pkt.DecodePayload()
 	if err != nil {
@@ -151,10 +230,33 @@ func (s *StateSending) sendEntity(e entity.Entity) error {
 		t = packet.TypeOperation
 	case entity.TypeUser:
 		t = packet.TypeUser
+	case entity.TypeUserUpdate:
+		t = packet.TypeUserUpdate
+	case entity.TypeKeyRotation:
+		t = packet.TypeKeyRotation
+	case entity.TypeKeyRevocation:
+		t = packet.TypeKeyRevocation
+	case entity.TypeReaction:
+		t = packet.TypeReaction
+	case entity.TypeModeratorList:
+		t = packet.TypeModeratorList
+	case entity.TypePrivateMessage:
+		t = packet.TypePrivateMessage
+	case entity.TypeVote:
+		t = packet.TypeVote
 	default:
 		log.Fatal("BUG: unknown entity type.")
 	}
 	pkt := packet.New(t, s.p.User.ID(), e, s.p.owner.Signer)
+	if data := pkt.Encode(); len(data) >= connection.MaxPacketSize {
+		if s.p.proto < protoLongMessages {
+			log.Infof("Peer %s can't receive %s, which is too large for protocol version %d",
+				s.p, e.ShortID(), s.p.proto)
+			return errors.UnsupportedProtocol
+		}
+		s.outgoingParts = packet.Split(data)
+		pkt = packet.New(packet.TypePart, s.p.User.ID(), s.outgoingParts[0], s.p.owner.Signer)
+	}
 	err := s.p.conn.Write(pkt)
 	if err != nil {
 		log.Errorf("Error sending %s to the peer %s: %v", pkt, s.p, err)
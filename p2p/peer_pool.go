@@ -23,8 +23,14 @@ import (
 	"vminko.org/dscuss/log"
 	"vminko.org/dscuss/owner"
 	"vminko.org/dscuss/p2p/peer"
+	"vminko.org/dscuss/packet"
+	"vminko.org/dscuss/subs"
 )
 
+// PexAddressMaxAge defines how long addresses of gone peers are shared via
+// PEX and how long addresses received via PEX are not retried.
+const PexAddressMaxAge = time.Hour
+
 type peerList struct {
 	peers []*peer.Peer
 	mx    sync.RWMutex
@@ -70,22 +76,42 @@ func (pl *peerList) Range(f func(i int, p *peer.Peer) bool) {
 	}
 }
 
+// goneRecord describes a recently gone peer connected via an outgoing
+// connection.
+type goneRecord struct {
+	id    peer.ID
+	subs  subs.Subscriptions
+	addrs []string
+	gone  time.Time
+}
+
 // PeerPool is responsible for managing peers. It creates new peers, accounts
 // peers and manages peer life cycle. But it has nothing to do with Entity
 // transferring.
 type PeerPool struct {
 	cp          *ConnectionProvider
 	owner       *owner.Owner
+	policy      *peer.Policy
 	stopWorkers chan bool
 	stopPeers   chan struct{}
 	peers       *peerList
 	wg          sync.WaitGroup
+	pex         *PexProvider
+	gone        []*goneRecord
+	goneMx      sync.Mutex
 }
 
-func NewPeerPool(cp *ConnectionProvider, owner *owner.Owner) *PeerPool {
+func NewPeerPool(
+	cp *ConnectionProvider,
+	owner *owner.Owner,
+	policy *peer.Policy,
+	pex *PexProvider,
+) *PeerPool {
 	return &PeerPool{
 		cp:          cp,
 		owner:       owner,
+		policy:      policy,
+		pex:         pex,
 		stopWorkers: make(chan bool, 1),
 		stopPeers:   make(chan struct{}),
 		peers:       &peerList{},
@@ -137,6 +163,8 @@ func (pp *PeerPool) watchNewConnections() {
 			conn,
 			pp.owner,
 			pp, // Validator
+			pp, // AddressBook
+			pp.policy,
 		)
 		pp.peers.Append(peer)
 	}
@@ -180,6 +208,7 @@ func (pp *PeerPool) watchGonePeers() {
 						log.Errorf("Failed to remove %s from the PeerPool", p)
 					}
 					p.Close()
+					pp.rememberGonePeer(p)
 					log.Debugf("Peer %s is removed from PP", p)
 				}
 				return true
@@ -209,6 +238,90 @@ func (pp *PeerPool) ValidatePeer(newPeer *peer.Peer) bool {
 	return ok
 }
 
+func (pp *PeerPool) rememberGonePeer(p *peer.Peer) {
+	pid := p.ID()
+	if pid == nil || p.Subs == nil || p.IsIncoming() {
+		return
+	}
+	pp.goneMx.Lock()
+	defer pp.goneMx.Unlock()
+	pp.pruneGonePeers()
+	pp.gone = append(pp.gone, &goneRecord{*pid, p.Subs, p.Addresses(), time.Now()})
+}
+
+// pruneGonePeers forgets the peers gone too long ago. goneMx must be locked.
+func (pp *PeerPool) pruneGonePeers() {
+	threshold := time.Now().Add(-PexAddressMaxAge)
+	for len(pp.gone) > 0 && pp.gone[0].gone.Before(threshold) {
+		pp.gone = pp.gone[1:]
+	}
+}
+
+// ListPexAddresses returns the addresses of the connected and recently gone
+// peers, which we connected to and which share some topics with s.
+// Implements peer.AddressBook interface.
+func (pp *PeerPool) ListPexAddresses(s subs.Subscriptions, pid *peer.ID) []string {
+	var res []string
+	added := make(map[string]struct{})
+	add := func(id *peer.ID, ps subs.Subscriptions, aa []string) bool {
+		if *id == *pid || !subsOverlap(s, ps) {
+			return true
+		}
+		for _, a := range aa {
+			if _, ok := added[a]; ok {
+				continue
+			}
+			if len(res) == packet.MaxPexAddresses {
+				return false
+			}
+			added[a] = struct{}{}
+			res = append(res, a)
+		}
+		return true
+	}
+	pp.peers.Range(func(i int, p *peer.Peer) bool {
+		id := p.ID()
+		if id == nil || p.Subs == nil || p.IsIncoming() {
+			return true
+		}
+		return add(id, p.Subs, p.Addresses())
+	})
+
+	pp.goneMx.Lock()
+	defer pp.goneMx.Unlock()
+	pp.pruneGonePeers()
+	for i := len(pp.gone) - 1; i >= 0; i-- {
+		r := pp.gone[i]
+		if !add(&r.id, r.subs, r.addrs) {
+			break
+		}
+	}
+	return res
+}
+
+// PexAddressesReceived passes the addresses received from a peer to the
+// PexProvider.
+// Implements peer.AddressBook interface.
+func (pp *PeerPool) PexAddressesReceived(aa []string) {
+	pp.pex.AddressesReceived(aa)
+}
+
+// subsOverlap tells whether a peer subscribed to a may be interested in the
+// topics of b or vice versa.
+func subsOverlap(a, b subs.Subscriptions) bool {
+	for _, t := range a {
+		if b.Covers(t) {
+			return true
+		}
+	}
+	for _, t := range b {
+		if a.Covers(t) {
+			return true
+		}
+	}
+	return false
+}
+
 func (pp *PeerPool) ListPeers() []*peer.Info {
 	res := make([]*peer.Info, pp.peers.Len())
 	pp.peers.Range(func(i int, p *peer.Peer) bool {
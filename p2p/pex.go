@@ -0,0 +1,106 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package p2p
+
+import (
+	"sync"
+	"time"
+	"vminko.org/dscuss/address"
+	"vminko.org/dscuss/log"
+)
+
+// PexProvider provides node addresses received from other peers via peer
+// exchange (PEX).
+// Implements AddressProvider interface
+type PexProvider struct {
+	advPort   int
+	ac        AddressConsumer
+	processed map[string]time.Time
+	mx        sync.Mutex
+}
+
+// PexMaxAddresses limits the number of addresses accepted via PEX during
+// PexAddressMaxAge.
+const PexMaxAddresses = 1024
+
+func NewPexProvider(advPort int) *PexProvider {
+	return &PexProvider{
+		advPort:   advPort,
+		processed: make(map[string]time.Time),
+	}
+}
+
+func (pp *PexProvider) RegisterAddressConsumer(ac AddressConsumer) {
+	pp.mx.Lock()
+	defer pp.mx.Unlock()
+	pp.ac = ac
+}
+
+func (pp *PexProvider) Start() {
+	pp.mx.Lock()
+	defer pp.mx.Unlock()
+	if pp.ac == nil {
+		log.Fatal("attempt to start providing addresses when AddressConsumer is not set")
+	}
+}
+
+func (pp *PexProvider) Stop() {
+}
+
+// AddressesReceived passes the new addresses received from a peer to the
+// AddressConsumer.
+func (pp *PexProvider) AddressesReceived(aa []string) {
+	pp.mx.Lock()
+	defer pp.mx.Unlock()
+	if pp.ac == nil {
+		log.Debug("PexProvider is not started, ignoring addresses")
+		return
+	}
+	pp.pruneProcessed()
+	for _, a := range aa {
+		if !address.IsValid(a) {
+			log.Warningf("Received malformed address %s via PEX", a)
+			continue
+		}
+		if _, ok := pp.processed[a]; ok {
+			continue
+		}
+		if len(pp.processed) >= PexMaxAddresses {
+			log.Debugf("Too many addresses received via PEX, ignoring %s", a)
+			continue
+		}
+		pp.processed[a] = time.Now()
+		if isAddressLocal(a, pp.advPort) {
+			log.Debugf("Skipping local address %s", a)
+			continue
+		}
+		log.Debugf("Found peer address %s via PEX", a)
+		pp.ac.AddressFound(a)
+	}
+}
+
+// pruneProcessed forgets the addresses processed too long ago, so that they
+// can be retried if received again. mx must be locked.
+func (pp *PexProvider) pruneProcessed() {
+	threshold := time.Now().Add(-PexAddressMaxAge)
+	for a, t := range pp.processed {
+		if t.Before(threshold) {
+			delete(pp.processed, a)
+		}
+	}
+}
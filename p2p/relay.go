@@ -0,0 +1,394 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package p2p
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+	"vminko.org/dscuss/p2p/connection"
+)
+
+// Relays forward connections to the peers, which can't accept incoming
+// connections (e.g. because of NAT). Such a peer registers at a relay by
+// keeping a control connection open. The relay identifies the peer by its
+// address: the IP address the registration comes from and the port the peer
+// listens on. A peer, which fails to connect to the address directly, asks
+// the relay to connect it. The relay notifies the registered peer via the
+// control connection, the peer opens a new connection to the relay and the
+// relay splices both connections. Relayed connections are always encrypted,
+// so the relay can't read the packets.
+
+const (
+	relayCmdRegister string = "register"
+	relayCmdConnect  string = "connect"
+	relayCmdAccept   string = "accept"
+	relayCmdIncoming string = "incoming"
+	relayCmdOK       string = "ok"
+	relayCmdError    string = "error"
+	// Limits the length of a control message.
+	relayMaxMessageLen int = 1024
+	// RelayMaxRegistrations limits the number of peers a relay serves.
+	RelayMaxRegistrations int = 64
+	// RelayMaxConnCount limits the number of connections a relay
+	// forwards simultaneously.
+	RelayMaxConnCount uint32 = 64
+)
+
+// relayMessage is a control message of the relay protocol. Messages are
+// JSON-encoded and terminated by a newline.
+type relayMessage struct {
+	Cmd   string `json:"cmd"`
+	Port  int    `json:"port,omitempty"`  // The port the registering peer listens on
+	Addr  string `json:"addr,omitempty"`  // The address of the peer to connect to
+	Token string `json:"token,omitempty"` // Identifies the connection being forwarded
+	Error string `json:"error,omitempty"`
+}
+
+func writeRelayMessage(conn net.Conn, m *relayMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		log.Fatal("Can't marshal relay message: " + err.Error())
+	}
+	conn.SetWriteDeadline(time.Now().Add(connection.DefaultTimeout))
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
+
+// readRelayMessage reads a control message byte by byte, so that the data
+// following the message is left in the connection. Zero timeout means no
+// timeout.
+func readRelayMessage(conn net.Conn, timeout time.Duration) (*relayMessage, error) {
+	if timeout != 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	} else {
+		conn.SetReadDeadline(time.Time{})
+	}
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		_, err := io.ReadFull(conn, b)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] == '\n' {
+			break
+		}
+		if len(line) >= relayMaxMessageLen {
+			return nil, errors.PacketSizeExceeded
+		}
+		line = append(line, b[0])
+	}
+	var m relayMessage
+	err := json.Unmarshal(line, &m)
+	if err != nil {
+		log.Debugf("Can't unmarshal relay message: %v", err)
+		return nil, errors.Parsing
+	}
+	return &m, nil
+}
+
+// relayRequest sends the request to the relay and reads the reply.
+func relayRequest(conn net.Conn, req *relayMessage, timeout time.Duration) error {
+	err := writeRelayMessage(conn, req)
+	if err != nil {
+		return err
+	}
+	resp, err := readRelayMessage(conn, timeout)
+	if err != nil {
+		return err
+	}
+	if resp.Cmd != relayCmdOK {
+		log.Debugf("Relay %s refused to %s: %s", conn.RemoteAddr(), req.Cmd, resp.Error)
+		return errors.ProtocolViolation
+	}
+	conn.SetDeadline(time.Time{})
+	return nil
+}
+
+type relayRegistration struct {
+	conn net.Conn
+	mx   sync.Mutex
+}
+
+func (r *relayRegistration) notify(m *relayMessage) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return writeRelayMessage(r.conn, m)
+}
+
+// RelayServer forwards connections to the registered peers.
+type RelayServer struct {
+	hostport      string
+	listener      *net.TCPListener
+	wg            sync.WaitGroup
+	stopChan      chan struct{}
+	mx            sync.Mutex
+	registrations map[string]*relayRegistration
+	pending       map[string]chan net.Conn
+	conns         map[net.Conn]struct{}
+	connCount     uint32
+}
+
+func NewRelayServer(hostport string) *RelayServer {
+	return &RelayServer{
+		hostport:      hostport,
+		stopChan:      make(chan struct{}),
+		registrations: make(map[string]*relayRegistration),
+		pending:       make(map[string]chan net.Conn),
+		conns:         make(map[net.Conn]struct{}),
+	}
+}
+
+func (rs *RelayServer) Start() {
+	log.Debugf("Starting RelayServer on %s", rs.hostport)
+	tcpAddr, err := net.ResolveTCPAddr("tcp", rs.hostport)
+	if err != nil {
+		log.Fatalf("Can't resolve %s: %v", rs.hostport, err)
+	}
+	rs.listener, err = net.ListenTCP("tcp", tcpAddr)
+	if err != nil {
+		log.Fatalf("Can't start listening on %s: %v", rs.hostport, err)
+	}
+	rs.wg.Add(1)
+	go rs.serve()
+}
+
+func (rs *RelayServer) Stop() {
+	log.Debugf("Stopping RelayServer")
+	close(rs.stopChan)
+	rs.listener.Close()
+	rs.mx.Lock()
+	for c := range rs.conns {
+		c.Close()
+	}
+	rs.mx.Unlock()
+	rs.wg.Wait()
+	log.Debugf("RelayServer stopped")
+}
+
+func (rs *RelayServer) serve() {
+	defer rs.wg.Done()
+	for {
+		conn, err := rs.listener.Accept()
+		if err != nil {
+			select {
+			case <-rs.stopChan:
+				log.Debug("Stop requested")
+				return
+			default:
+			}
+			log.Warningf("Error accepting relay connection: %v", err)
+			continue
+		}
+		if !rs.track(conn) {
+			conn.Close()
+			continue
+		}
+		rs.wg.Add(1)
+		go rs.handle(conn)
+	}
+}
+
+// track registers the connection, so that it will be closed on stop.
+func (rs *RelayServer) track(conn net.Conn) bool {
+	rs.mx.Lock()
+	defer rs.mx.Unlock()
+	select {
+	case <-rs.stopChan:
+		return false
+	default:
+	}
+	rs.conns[conn] = struct{}{}
+	return true
+}
+
+func (rs *RelayServer) close(conn net.Conn) {
+	rs.mx.Lock()
+	delete(rs.conns, conn)
+	rs.mx.Unlock()
+	conn.Close()
+}
+
+func (rs *RelayServer) handle(conn net.Conn) {
+	defer rs.wg.Done()
+	m, err := readRelayMessage(conn, connection.DefaultTimeout)
+	if err != nil {
+		log.Debugf("Failed to read relay request from %s: %v", conn.RemoteAddr(), err)
+		rs.close(conn)
+		return
+	}
+	switch m.Cmd {
+	case relayCmdRegister:
+		rs.register(conn, m)
+	case relayCmdConnect:
+		rs.connect(conn, m)
+	case relayCmdAccept:
+		rs.accept(conn, m)
+	default:
+		log.Debugf("Got unknown relay request '%s' from %s", m.Cmd, conn.RemoteAddr())
+		rs.close(conn)
+	}
+}
+
+func (rs *RelayServer) refuse(conn net.Conn, reason string) {
+	writeRelayMessage(conn, &relayMessage{Cmd: relayCmdError, Error: reason})
+	rs.close(conn)
+}
+
+// register serves the control connection of the peer until it's closed.
+func (rs *RelayServer) register(conn net.Conn, m *relayMessage) {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil || m.Port <= 0 || m.Port > 65535 {
+		rs.refuse(conn, "invalid address")
+		return
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(m.Port))
+	reg := &relayRegistration{conn: conn}
+	rs.mx.Lock()
+	old, ok := rs.registrations[addr]
+	if !ok && len(rs.registrations) >= RelayMaxRegistrations {
+		rs.mx.Unlock()
+		rs.refuse(conn, "too many registrations")
+		return
+	}
+	rs.registrations[addr] = reg
+	rs.mx.Unlock()
+	if ok {
+		old.conn.Close()
+	}
+	log.Infof("Peer %s registered at the relay", addr)
+	err = reg.notify(&relayMessage{Cmd: relayCmdOK})
+	// The peer is not supposed to send anything, so reading just detects
+	// closing of the connection.
+	for err == nil {
+		_, err = readRelayMessage(conn, 0)
+	}
+	rs.mx.Lock()
+	if rs.registrations[addr] == reg {
+		delete(rs.registrations, addr)
+	}
+	rs.mx.Unlock()
+	log.Infof("Peer %s unregistered from the relay", addr)
+	rs.close(conn)
+}
+
+func newRelayToken() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Fatalf("Can't generate relay token: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// connect asks the registered peer to accept the connection and splices the
+// connections.
+func (rs *RelayServer) connect(conn net.Conn, m *relayMessage) {
+	if atomic.LoadUint32(&rs.connCount) >= RelayMaxConnCount {
+		rs.refuse(conn, "too many connections")
+		return
+	}
+	token := newRelayToken()
+	ch := make(chan net.Conn, 1)
+	rs.mx.Lock()
+	reg, ok := rs.registrations[m.Addr]
+	if ok {
+		rs.pending[token] = ch
+	}
+	rs.mx.Unlock()
+	if !ok {
+		rs.refuse(conn, "unknown peer")
+		return
+	}
+	defer func() {
+		rs.mx.Lock()
+		delete(rs.pending, token)
+		rs.mx.Unlock()
+		// The peer may accept after the timeout.
+		select {
+		case late := <-ch:
+			rs.close(late)
+		default:
+		}
+	}()
+	err := reg.notify(&relayMessage{Cmd: relayCmdIncoming, Token: token})
+	if err != nil {
+		log.Debugf("Failed to notify peer %s: %v", m.Addr, err)
+		rs.refuse(conn, "peer is unavailable")
+		return
+	}
+	var peerConn net.Conn
+	select {
+	case peerConn = <-ch:
+	case <-time.After(connection.DefaultTimeout):
+		rs.refuse(conn, "peer did not accept the connection")
+		return
+	case <-rs.stopChan:
+		rs.close(conn)
+		return
+	}
+	if writeRelayMessage(peerConn, &relayMessage{Cmd: relayCmdOK}) != nil ||
+		writeRelayMessage(conn, &relayMessage{Cmd: relayCmdOK}) != nil {
+		rs.close(peerConn)
+		rs.close(conn)
+		return
+	}
+	log.Debugf("Relaying connection from %s to %s", conn.RemoteAddr(), m.Addr)
+	atomic.AddUint32(&rs.connCount, 1)
+	rs.splice(conn, peerConn)
+	atomic.AddUint32(&rs.connCount, ^uint32(0))
+}
+
+// accept passes the connection opened by the registered peer to the pending
+// connect request.
+func (rs *RelayServer) accept(conn net.Conn, m *relayMessage) {
+	rs.mx.Lock()
+	ch, ok := rs.pending[m.Token]
+	delete(rs.pending, m.Token)
+	rs.mx.Unlock()
+	if !ok {
+		rs.refuse(conn, "unknown token")
+		return
+	}
+	ch <- conn
+}
+
+func (rs *RelayServer) splice(a, b net.Conn) {
+	a.SetDeadline(time.Time{})
+	b.SetDeadline(time.Time{})
+	done := make(chan struct{}, 2)
+	forward := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go forward(a, b)
+	go forward(b, a)
+	<-done
+	rs.close(a)
+	rs.close(b)
+	<-done
+}
@@ -18,6 +18,7 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package packet
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -50,6 +51,20 @@ const (
 	TypeMessage Type = "msg"
 	// Encapsulates an operation entity.
 	TypeOperation Type = "oper"
+	// Encapsulates a user update entity.
+	TypeUserUpdate Type = "upd"
+	// Encapsulates a key rotation entity.
+	TypeKeyRotation Type = "rot"
+	// Encapsulates a key revocation entity.
+	TypeKeyRevocation Type = "rev"
+	// Encapsulates a reaction entity.
+	TypeReaction Type = "rct"
+	// Encapsulates a moderator list entity.
+	TypeModeratorList Type = "mdl"
+	// Encapsulates a private message entity.
+	TypePrivateMessage Type = "pm"
+	// Encapsulates a vote entity.
+	TypeVote Type = "vot"
 	// Used for introducing users during handshake.
 	TypeHello Type = "hello"
 	// Used for advertising new entities.
@@ -60,6 +75,16 @@ const (
 	TypeReq Type = "req"
 	// Done indicated that a complex process (like syncing) is over.
 	TypeDone Type = "done"
+	// Request for a chunk of a blob.
+	TypeBlobReq Type = "breq"
+	// Encapsulates a chunk of a blob.
+	TypeBlob Type = "blob"
+	// Request for a part of a packet.
+	TypePartReq Type = "preq"
+	// Encapsulates a part of a packet.
+	TypePart Type = "part"
+	// Carries addresses of other peers.
+	TypePex Type = "pex"
 )
 
 func New(t Type, rcv *entity.ID, pld interface{}, s *crypto.Signer) *Packet {
@@ -90,6 +115,20 @@ func (p *Packet) DecodePayload() (interface{}, error) {
 		pld = new(entity.Message)
 	case TypeOperation:
 		pld = new(entity.Operation)
+	case TypeUserUpdate:
+		pld = new(entity.UserUpdate)
+	case TypeKeyRotation:
+		pld = new(entity.KeyRotation)
+	case TypeKeyRevocation:
+		pld = new(entity.KeyRevocation)
+	case TypeReaction:
+		pld = new(entity.Reaction)
+	case TypeModeratorList:
+		pld = new(entity.ModeratorList)
+	case TypePrivateMessage:
+		pld = new(entity.PrivateMessage)
+	case TypeVote:
+		pld = new(entity.Vote)
 	case TypeHello:
 		pld = new(PayloadHello)
 	case TypeAnnounce:
@@ -100,6 +139,16 @@ func (p *Packet) DecodePayload() (interface{}, error) {
 		pld = new(PayloadAck)
 	case TypeDone:
 		pld = new(PayloadDone)
+	case TypeBlobReq:
+		pld = new(PayloadBlobReq)
+	case TypeBlob:
+		pld = new(PayloadBlob)
+	case TypePartReq:
+		pld = new(PayloadPartReq)
+	case TypePart:
+		pld = new(PayloadPart)
+	case TypePex:
+		pld = new(PayloadPex)
 	default:
 		log.Error("Unknown payload type: " + string(p.Body.Type))
 		return nil, errors.WrongPacketType
@@ -147,6 +196,28 @@ func (p *Packet) String() string {
 	return fmt.Sprintf("type  %s", p.Body.Type)
 }
 
+// Encode encodes the packet the way it is sent via the network.
+func (p *Packet) Encode() []byte {
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Fatal("Can't marshal packet: " + err.Error())
+	}
+	return data
+}
+
+// Decode decodes a packet reassembled from parts.
+func Decode(data []byte) (*Packet, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	var p Packet
+	err := d.Decode(&p)
+	if err != nil {
+		log.Debugf("Can't decode packet: %v", err)
+		return nil, errors.Parsing
+	}
+	return &p, nil
+}
+
 func (p *Packet) Dump() string {
 	str, err := json.Marshal(p)
 	if err != nil {
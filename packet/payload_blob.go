@@ -0,0 +1,40 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package packet
+
+import (
+	"vminko.org/dscuss/entity"
+)
+
+// PayloadBlob transfers a chunk of a blob. Empty Data means that the sender
+// does not have the requested blob.
+type PayloadBlob struct {
+	ID     entity.ID `json:"id"`     // Hash of the blob
+	Offset int64     `json:"offset"` // Offset of the chunk in the blob
+	Data   []byte    `json:"data"`
+}
+
+// BlobChunkSize is the maximum size of a chunk. Encoded chunks must fit into
+// a packet.
+const BlobChunkSize = 4096
+
+func NewPayloadBlob(id *entity.ID, offset int64, data []byte) *PayloadBlob {
+	p := &PayloadBlob{Offset: offset, Data: data}
+	copy(p.ID[:], id[:])
+	return p
+}
@@ -0,0 +1,34 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package packet
+
+import (
+	"vminko.org/dscuss/entity"
+)
+
+// PayloadBlobReq is a request for a chunk of a blob.
+type PayloadBlobReq struct {
+	ID     entity.ID `json:"id"`     // Hash of the blob being requested
+	Offset int64     `json:"offset"` // Offset of the requested chunk
+}
+
+func NewPayloadBlobReq(id *entity.ID, offset int64) *PayloadBlobReq {
+	p := &PayloadBlobReq{Offset: offset}
+	copy(p.ID[:], id[:])
+	return p
+}
@@ -18,6 +18,7 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 package packet
 
 import (
+	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/subs"
 )
 
@@ -25,14 +26,59 @@ import (
 // When user A sends this packet to user B, he/she
 // notifies user B about topics of A's interests/
 type PayloadHello struct {
-	Proto int                `json:"proto"` // The version of the protocol this peer supports.
-	Subs  subs.Subscriptions `json:"subs"`  // Subscriptions of the author of the payload.
+	// The first version of the protocol. Peers supporting only this
+	// version reject any other value, so it's always LegacyProto.
+	Proto int `json:"proto"`
+	// Subscriptions of the author of the payload.
+	Subs subs.Subscriptions `json:"subs"`
+	// The latest version of the protocol this peer supports. Legacy peers
+	// don't send it.
+	Version int `json:"version,omitempty"`
+	// Chain of key rotations of the author, which allows to verify packets
+	// signed by the current key of the author.
+	Rotations []*entity.KeyRotation `json:"rotations,omitempty"`
+	// Compression algorithms the peer accepts.
+	Compression []string `json:"compression,omitempty"`
+	// Binding of the encrypted channel the packet is sent through. Signing
+	// the packet proves that the author is the endpoint of the channel.
+	Channel []byte `json:"channel,omitempty"`
+}
+
+// LegacyProto is the version of the protocol supported by the first versions of
+// Dscuss.
+const LegacyProto = 1
+
+// LatestVersion returns the latest version of the protocol the author of the
+// payload supports.
+func (p *PayloadHello) LatestVersion() int {
+	if p.Version != 0 {
+		return p.Version
+	}
+	return p.Proto
 }
 
 func (p *PayloadHello) IsValid() bool {
+	for _, r := range p.Rotations {
+		if r == nil || !r.IsUnsignedPartValid() {
+			return false
+		}
+	}
 	return p.Subs.IsValid()
 }
 
-func NewPayloadHello(p int, s subs.Subscriptions) *PayloadHello {
-	return &PayloadHello{Proto: p, Subs: s}
+func NewPayloadHello(
+	p int,
+	s subs.Subscriptions,
+	rr []*entity.KeyRotation,
+	cc []string,
+	ch []byte,
+) *PayloadHello {
+	return &PayloadHello{
+		Proto:       LegacyProto,
+		Subs:        s,
+		Version:     p,
+		Rotations:   rr,
+		Compression: cc,
+		Channel:     ch,
+	}
 }
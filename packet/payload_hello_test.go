@@ -0,0 +1,65 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package packet
+
+import (
+	"encoding/json"
+	"testing"
+	"vminko.org/dscuss/subs"
+)
+
+func TestPayloadHelloVersion(t *testing.T) {
+	s, err := subs.ReadString("dscuss,devel\n")
+	if err != nil {
+		t.Fatalf("Failed to parse subscriptions: %v", err)
+	}
+	tests := []struct {
+		name    string
+		p       *PayloadHello
+		version int
+	}{
+		{"current", NewPayloadHello(11, s, nil, nil, nil), 11},
+		{"legacy", &PayloadHello{Proto: LegacyProto, Subs: s}, LegacyProto},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.p)
+			if err != nil {
+				t.Fatalf("Failed to marshal Hello: %v", err)
+			}
+			// The peers speaking only the first version of the
+			// protocol decode Hello this way and reject any other
+			// version.
+			var legacy struct {
+				Proto int `json:"proto"`
+			}
+			err = json.Unmarshal(data, &legacy)
+			if err != nil || legacy.Proto != LegacyProto {
+				t.Errorf("Hello %s is not accepted by legacy peers", data)
+			}
+			var h PayloadHello
+			err = json.Unmarshal(data, &h)
+			if err != nil {
+				t.Fatalf("Failed to unmarshal Hello: %v", err)
+			}
+			if got := h.LatestVersion(); got != tt.version {
+				t.Errorf("LatestVersion() = %d, want %d", got, tt.version)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package packet
+
+import (
+	"vminko.org/dscuss/entity"
+)
+
+// PayloadPart transfers a part of a packet, which is too large to be sent at
+// once. The first part is sent instead of the packet, the rest are sent on
+// request (see PayloadPartReq).
+type PayloadPart struct {
+	ID    entity.ID `json:"id"`    // Hash of the whole encoded packet
+	Index int       `json:"index"` // Number of the part starting from 0
+	Total int       `json:"total"` // Total number of parts
+	Hash  entity.ID `json:"hash"`  // Hash of Data
+	Data  []byte    `json:"data"`
+}
+
+const (
+	// PartSize is the maximum size of a part. Encoded parts must fit into a
+	// packet.
+	PartSize = 4096
+	// MaxSplitPacketSize limits the size of a packet transferred in parts.
+	MaxSplitPacketSize = 512 * 1024
+)
+
+func NewPayloadPart(id *entity.ID, index, total int, data []byte) *PayloadPart {
+	p := &PayloadPart{Index: index, Total: total, Hash: entity.NewID(data), Data: data}
+	copy(p.ID[:], id[:])
+	return p
+}
+
+// IsValid checks integrity of the part. Total is compared without
+// multiplication, which could overflow.
+func (p *PayloadPart) IsValid() bool {
+	return p.Index >= 0 && p.Index < p.Total && p.Total <= MaxSplitPacketSize/PartSize &&
+		len(p.Data) > 0 && len(p.Data) <= PartSize && entity.NewID(p.Data) == p.Hash
+}
+
+// Split splits the encoded packet into parts.
+func Split(data []byte) []*PayloadPart {
+	id := entity.NewID(data)
+	total := (len(data) + PartSize - 1) / PartSize
+	parts := make([]*PayloadPart, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * PartSize
+		if end > len(data) {
+			end = len(data)
+		}
+		parts = append(parts, NewPayloadPart(&id, i, total, data[i*PartSize:end]))
+	}
+	return parts
+}
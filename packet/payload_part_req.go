@@ -0,0 +1,34 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package packet
+
+import (
+	"vminko.org/dscuss/entity"
+)
+
+// PayloadPartReq is a request for a part of a packet.
+type PayloadPartReq struct {
+	ID    entity.ID `json:"id"`    // Hash of the whole encoded packet
+	Index int       `json:"index"` // Number of the requested part
+}
+
+func NewPayloadPartReq(id *entity.ID, index int) *PayloadPartReq {
+	p := &PayloadPartReq{Index: index}
+	copy(p.ID[:], id[:])
+	return p
+}
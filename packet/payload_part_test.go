@@ -0,0 +1,96 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package packet
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"vminko.org/dscuss/entity"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		total int
+	}{
+		{"one byte", 1, 1},
+		{"one part", PartSize, 1},
+		{"one byte more", PartSize + 1, 2},
+		{"several parts", 3*PartSize - 1, 3},
+		{"max size", MaxSplitPacketSize, MaxSplitPacketSize / PartSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.size)
+			for i := range data {
+				data[i] = byte(i)
+			}
+			parts := Split(data)
+			if len(parts) != tt.total {
+				t.Fatalf("Split() returned %d parts, want %d", len(parts), tt.total)
+			}
+			id := entity.NewID(data)
+			var joined []byte
+			for i, p := range parts {
+				if !p.IsValid() {
+					t.Errorf("Part %d is not valid", i)
+				}
+				if p.ID != id || p.Index != i || p.Total != tt.total {
+					t.Errorf("Part %d has wrong header: %d/%d", i, p.Index, p.Total)
+				}
+				joined = append(joined, p.Data...)
+			}
+			if !bytes.Equal(joined, data) {
+				t.Errorf("Joined parts differ from the data")
+			}
+		})
+	}
+}
+
+func TestPayloadPartIsValid(t *testing.T) {
+	data := []byte("data")
+	var id entity.ID
+	maxTotal := MaxSplitPacketSize / PartSize
+	tests := []struct {
+		name string
+		p    *PayloadPart
+		want bool
+	}{
+		{"valid", NewPayloadPart(&id, 0, 1, data), true},
+		{"last of max parts", NewPayloadPart(&id, maxTotal-1, maxTotal, data), true},
+		{"negative index", NewPayloadPart(&id, -1, 1, data), false},
+		{"index out of range", NewPayloadPart(&id, 1, 1, data), false},
+		{"zero total", NewPayloadPart(&id, 0, 0, data), false},
+		{"too many parts", NewPayloadPart(&id, 0, maxTotal+1, data), false},
+		// Total*PartSize overflows int.
+		{"overflowing total", NewPayloadPart(&id, 0, math.MaxInt/PartSize+1, data), false},
+		{"max total", NewPayloadPart(&id, 0, math.MaxInt, data), false},
+		{"empty data", NewPayloadPart(&id, 0, 1, nil), false},
+		{"data too large", NewPayloadPart(&id, 0, 1, make([]byte, PartSize+1)), false},
+		{"wrong hash", &PayloadPart{Index: 0, Total: 1, Data: data}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.IsValid(); got != tt.want {
+				t.Errorf("IsValid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package packet
+
+import (
+	"vminko.org/dscuss/address"
+)
+
+// PayloadPex carries addresses of other peers (peer exchange).
+type PayloadPex struct {
+	Addrs []string `json:"addrs"`
+}
+
+// MaxPexAddresses limits the number of addresses in one PEX packet.
+const MaxPexAddresses = 32
+
+func NewPayloadPex(aa []string) *PayloadPex {
+	return &PayloadPex{Addrs: aa}
+}
+
+func (p *PayloadPex) IsValid() bool {
+	if len(p.Addrs) > MaxPexAddresses {
+		return false
+	}
+	for _, a := range p.Addrs {
+		if !address.IsValid(a) {
+			return false
+		}
+	}
+	return true
+}
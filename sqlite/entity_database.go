@@ -62,6 +62,29 @@ func OpenEntityDatabase(fileName string) (*EntityDatabase, error) {
 		"  Timestamp       TIMESTAMP NOT NULL," +
 		"  Signature       BLOB NOT NULL," +
 		"  TimeStored      TIMESTAMP NOT NULL)")
+	exec("CREATE TABLE IF NOT EXISTS  User_Updates (" +
+		"  Id              BLOB PRIMARY KEY ON CONFLICT IGNORE," +
+		"  User_id         BLOB NOT NULL REFERENCES Users," +
+		"  Seq             UNSIGNED BIG INT NOT NULL," +
+		"  Info            TEXT," +
+		"  Timestamp       TIMESTAMP NOT NULL," +
+		"  Signature       BLOB NOT NULL," +
+		"  TimeStored      TIMESTAMP NOT NULL)")
+	exec("CREATE TABLE IF NOT EXISTS  Key_Rotations (" +
+		"  Id              BLOB PRIMARY KEY ON CONFLICT IGNORE," +
+		"  User_id         BLOB NOT NULL REFERENCES Users," +
+		"  Seq             UNSIGNED BIG INT NOT NULL," +
+		"  Public_key      BLOB NOT NULL," +
+		"  Timestamp       TIMESTAMP NOT NULL," +
+		"  Signature       BLOB NOT NULL," +
+		"  TimeStored      TIMESTAMP NOT NULL)")
+	exec("CREATE TABLE IF NOT EXISTS  Key_Revocations (" +
+		"  Id              BLOB PRIMARY KEY ON CONFLICT IGNORE," +
+		"  User_id         BLOB NOT NULL REFERENCES Users," +
+		"  Key_seq         UNSIGNED BIG INT NOT NULL," +
+		"  Timestamp       TIMESTAMP NOT NULL," +
+		"  Signature       BLOB NOT NULL," +
+		"  TimeStored      TIMESTAMP NOT NULL)")
 	exec("CREATE TABLE IF NOT EXISTS  Messages (" +
 		"  Id              BLOB PRIMARY KEY ON CONFLICT IGNORE," +
 		"  Subject         TEXT," +
@@ -80,12 +103,56 @@ func OpenEntityDatabase(fileName string) (*EntityDatabase, error) {
 		"  Timestamp       TIMESTAMP NOT NULL," +
 		"  Signature       BLOB NOT NULL," +
 		"  TimeStored      TIMESTAMP NOT NULL)")
+	exec("CREATE TABLE IF NOT EXISTS  Reactions (" +
+		"  Id              BLOB PRIMARY KEY ON CONFLICT IGNORE," +
+		"  Kind            INTEGER NOT NULL," +
+		"  Author_id       BLOB NOT NULL REFERENCES Users," +
+		"  Message_id      BLOB NOT NULL REFERENCES Messages," +
+		"  Timestamp       TIMESTAMP NOT NULL," +
+		"  Signature       BLOB NOT NULL," +
+		"  Encoding        INTEGER NOT NULL," +
+		"  TimeStored      TIMESTAMP NOT NULL)")
+	exec("CREATE TABLE IF NOT EXISTS  Private_Messages (" +
+		"  Id              BLOB PRIMARY KEY ON CONFLICT IGNORE," +
+		"  Author_id       BLOB NOT NULL REFERENCES Users," +
+		"  Recipient_id    BLOB NOT NULL REFERENCES Users," +
+		"  Ciphertext      BLOB NOT NULL," +
+		"  Timestamp       TIMESTAMP NOT NULL," +
+		"  Signature       BLOB NOT NULL," +
+		"  Encoding        INTEGER NOT NULL," +
+		"  TimeStored      TIMESTAMP NOT NULL)")
+	exec("CREATE TABLE IF NOT EXISTS  Votes (" +
+		"  Id              BLOB PRIMARY KEY ON CONFLICT IGNORE," +
+		"  Choice          INTEGER NOT NULL," +
+		"  Author_id       BLOB NOT NULL REFERENCES Users," +
+		"  Poll_id         BLOB NOT NULL REFERENCES Messages," +
+		"  Timestamp       TIMESTAMP NOT NULL," +
+		"  Signature       BLOB NOT NULL," +
+		"  Encoding        INTEGER NOT NULL," +
+		"  TimeStored      TIMESTAMP NOT NULL)")
+	exec("CREATE TABLE IF NOT EXISTS  Moderator_Lists (" +
+		"  Id              BLOB PRIMARY KEY ON CONFLICT IGNORE," +
+		"  User_id         BLOB NOT NULL REFERENCES Users," +
+		"  Seq             UNSIGNED BIG INT NOT NULL," +
+		"  Moderators      BLOB NOT NULL," +
+		"  Timestamp       TIMESTAMP NOT NULL," +
+		"  Signature       BLOB NOT NULL," +
+		"  Encoding        INTEGER NOT NULL," +
+		"  TimeStored      TIMESTAMP NOT NULL)")
 	exec("CREATE TABLE IF NOT EXISTS  Operations_on_Users (" +
 		"  Operation_id    BLOB NOT NULL REFERENCES Operations," +
 		"  User_id         BLOB NOT NULL REFERENCES Users)")
 	exec("CREATE TABLE IF NOT EXISTS  Operations_on_Messages (" +
 		"  Operation_id    BLOB NOT NULL REFERENCES Operations," +
 		"  Message_id      BLOB NOT NULL REFERENCES Messages)")
+	exec("CREATE TABLE IF NOT EXISTS  Operations_on_Operations (" +
+		"  Operation_id    BLOB NOT NULL REFERENCES Operations," +
+		"  Target_id       BLOB NOT NULL REFERENCES Operations)")
+	exec("CREATE TABLE IF NOT EXISTS  Message_References (" +
+		"  Message_id      BLOB NOT NULL REFERENCES Messages," +
+		"  Target_id       BLOB NOT NULL," +
+		"  Type            INTEGER NOT NULL," +
+		"  UNIQUE (Message_id, Target_id) ON CONFLICT IGNORE)")
 	exec("CREATE TABLE IF NOT EXISTS  Tags (" +
 		"  Id              INTEGER PRIMARY KEY AUTOINCREMENT," +
 		"  Name            TEXT NOT NULL UNIQUE ON CONFLICT IGNORE)")
@@ -98,6 +165,36 @@ func OpenEntityDatabase(fileName string) (*EntityDatabase, error) {
 		log.Errorf("Unable to initialize the database: %s", execErr.Error())
 		return nil, errors.DBOperFailed
 	}
+	err = addColumnIfMissing(db, "Operations", "Replacement", "TEXT NOT NULL DEFAULT ''")
+	if err == nil {
+		err = addColumnIfMissing(db, "Operations", "Date_expires", "TIMESTAMP")
+	}
+	for _, table := range []string{
+		"Users", "User_Updates", "Key_Rotations", "Key_Revocations", "Messages", "Operations",
+	} {
+		if err == nil {
+			err = addColumnIfMissing(db, table, "Encoding", "INTEGER NOT NULL DEFAULT 0")
+		}
+	}
+	if err == nil {
+		err = addColumnIfMissing(db, "Messages", "Stamp", "UNSIGNED BIG INT NOT NULL DEFAULT 0")
+	}
+	if err == nil {
+		err = addColumnIfMissing(db, "Users", "Proof_bits", "INTEGER NOT NULL DEFAULT 0")
+	}
+	if err == nil {
+		err = addColumnIfMissing(db, "Messages", "Attachments", "TEXT NOT NULL DEFAULT ''")
+	}
+	if err == nil {
+		err = addColumnIfMissing(db, "Messages", "Poll", "TEXT NOT NULL DEFAULT ''")
+	}
+	if err == nil {
+		err = addColumnIfMissing(db, "Messages", "Refs", "TEXT NOT NULL DEFAULT ''")
+	}
+	if err != nil {
+		log.Errorf("Unable to upgrade the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
 
 	return (*EntityDatabase)(db), nil
 }
@@ -120,12 +217,14 @@ func (d *EntityDatabase) PutUser(user *entity.User, ts time.Time) error {
 	( Id,
 	  Public_key,
 	  Proof,
+	  Proof_bits,
 	  Nickname,
 	  Info,
 	  Timestamp,
 	  Signature,
+	  Encoding,
 	  TimeStored )
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	db := (*sql.DB)(d)
 	pkpem := user.PubKey.EncodeToDER()
@@ -134,10 +233,12 @@ func (d *EntityDatabase) PutUser(user *entity.User, ts time.Time) error {
 		user.ID()[:],
 		pkpem,
 		user.Proof,
+		user.ProofBits,
 		user.Nickname,
 		user.Info,
 		user.RegDate,
 		user.Sig.Encode(),
+		user.Encoding(),
 		ts,
 	)
 	if err != nil {
@@ -154,16 +255,20 @@ func (d *EntityDatabase) GetUser(eid *entity.ID) (*entity.User, error) {
 	var nickname string
 	var info string
 	var proof crypto.ProofOfWork
+	var proofBits int
 	var regdate time.Time
 	var encodedSig []byte
+	var enc entity.Encoding
 	var encodedKey []byte
 	query := `
 	SELECT Public_key,
 	       Proof,
+	       Proof_bits,
 	       Nickname,
 	       Info,
 	       Timestamp,
-	       Signature
+	       Signature,
+	       Encoding
 	FROM Users WHERE Id=?
 	`
 
@@ -171,10 +276,12 @@ func (d *EntityDatabase) GetUser(eid *entity.ID) (*entity.User, error) {
 	err := db.QueryRow(query, eid[:]).Scan(
 		&encodedKey,
 		&proof,
+		&proofBits,
 		&nickname,
 		&info,
 		&regdate,
-		&encodedSig)
+		&encodedSig,
+		&enc)
 	switch {
 	case err == sql.ErrNoRows:
 		log.Debug("No user with that ID.")
@@ -197,7 +304,7 @@ func (d *EntityDatabase) GetUser(eid *entity.ID) (*entity.User, error) {
 		return nil, errors.Parsing
 	}
 
-	u := entity.NewUser(nickname, info, pubkey, proof, regdate, sig)
+	u := entity.NewUser(nickname, info, pubkey, proof, proofBits, regdate, sig, enc)
 	return u, nil
 }
 
@@ -231,11 +338,28 @@ func (d *EntityDatabase) PutMessage(msg *entity.Message, ts time.Time) error {
 	  Author_id,
 	  Parent_id,
 	  Signature,
+	  Encoding,
+	  Stamp,
+	  Attachments,
+	  Poll,
+	  Refs,
 	  TimeStored )
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
+	attachments, err := encodeAttachments(msg.Attachments)
+	if err != nil {
+		return err
+	}
+	poll, err := encodePoll(msg.Poll)
+	if err != nil {
+		return err
+	}
+	refs, err := encodeReferences(msg.References)
+	if err != nil {
+		return err
+	}
 	db := (*sql.DB)(d)
-	_, err := db.Exec(
+	_, err = db.Exec(
 		query,
 		msg.ID()[:],
 		msg.Subject,
@@ -244,6 +368,11 @@ func (d *EntityDatabase) PutMessage(msg *entity.Message, ts time.Time) error {
 		msg.AuthorID[:],
 		msg.ParentID[:],
 		msg.Sig.Encode(),
+		msg.Encoding(),
+		msg.Stamp,
+		attachments,
+		poll,
+		refs,
 		ts,
 	)
 	if err != nil {
@@ -254,6 +383,10 @@ func (d *EntityDatabase) PutMessage(msg *entity.Message, ts time.Time) error {
 		log.Errorf("The DB is corrupted. Message %s is saved without topic", msg)
 		return errors.DBOperFailed
 	}
+	if d.putMessageReferences(msg) != nil {
+		log.Errorf("The DB is corrupted. Message %s is saved without references", msg)
+		return errors.DBOperFailed
+	}
 	return nil
 }
 
@@ -264,6 +397,11 @@ func (d *EntityDatabase) GetMessage(eid *entity.ID) (*entity.Message, error) {
 	var text string
 	var wrdate time.Time
 	var encodedSig []byte
+	var enc entity.Encoding
+	var stamp crypto.Stamp
+	var rawAttachments string
+	var rawPoll string
+	var rawRefs string
 	var rawAuthID []byte
 	var rawParID []byte
 	var topicStr sql.NullString
@@ -274,6 +412,11 @@ func (d *EntityDatabase) GetMessage(eid *entity.ID) (*entity.Message, error) {
 	       Messages.Author_id,
 	       Messages.Parent_id,
 	       Messages.Signature,
+	       Messages.Encoding,
+	       Messages.Stamp,
+	       Messages.Attachments,
+	       Messages.Poll,
+	       Messages.Refs,
 	       GROUP_CONCAT(Tags.Name)
 	FROM Messages
 	LEFT JOIN Message_Tags on Messages.Id=Message_Tags.Message_id
@@ -290,6 +433,11 @@ func (d *EntityDatabase) GetMessage(eid *entity.ID) (*entity.Message, error) {
 		&rawAuthID,
 		&rawParID,
 		&encodedSig,
+		&enc,
+		&stamp,
+		&rawAttachments,
+		&rawPoll,
+		&rawRefs,
 		&topicStr)
 	switch {
 	case err == sql.ErrNoRows:
@@ -321,11 +469,25 @@ func (d *EntityDatabase) GetMessage(eid *entity.ID) (*entity.Message, error) {
 			return nil, errors.InconsistentDB
 		}
 	}
-	m, err := entity.NewMessage(subj, text, &authID, &parID, wrdate, sig, topic)
+	attachments, err := decodeAttachments(rawAttachments)
+	if err != nil {
+		return nil, err
+	}
+	poll, err := decodePoll(rawPoll)
 	if err != nil {
-		log.Errorf("The message '%s' fetched from DB is invalid", m)
+		return nil, err
+	}
+	refs, err := decodeReferences(rawRefs)
+	if err != nil {
+		return nil, err
+	}
+	m, err := entity.NewMessage(subj, text, &authID, &parID, wrdate, sig,
+		topic, attachments, poll, refs, enc)
+	if err != nil {
+		log.Errorf("The message '%s' fetched from DB is invalid", eid.Shorten())
 		return nil, errors.InconsistentDB
 	}
+	m.Stamp = stamp
 	return m, nil
 }
 
@@ -371,6 +533,11 @@ func scanSingleMessageRow(rows *sql.Rows, scanTimeStored bool) (*entity.Message,
 	var text string
 	var wrdate time.Time
 	var encodedSig []byte
+	var enc entity.Encoding
+	var stamp crypto.Stamp
+	var rawAttachments string
+	var rawPoll string
+	var rawRefs string
 	var rawAuthID []byte
 	var rawParID []byte
 	var topicStr sql.NullString
@@ -385,6 +552,11 @@ func scanSingleMessageRow(rows *sql.Rows, scanTimeStored bool) (*entity.Message,
 			&rawAuthID,
 			&rawParID,
 			&encodedSig,
+			&enc,
+			&stamp,
+			&rawAttachments,
+			&rawPoll,
+			&rawRefs,
 			&topicStr,
 			&tmStored)
 	} else {
@@ -396,6 +568,11 @@ func scanSingleMessageRow(rows *sql.Rows, scanTimeStored bool) (*entity.Message,
 			&rawAuthID,
 			&rawParID,
 			&encodedSig,
+			&enc,
+			&stamp,
+			&rawAttachments,
+			&rawPoll,
+			&rawRefs,
 			&topicStr)
 	}
 	if err != nil {
@@ -427,11 +604,25 @@ func scanSingleMessageRow(rows *sql.Rows, scanTimeStored bool) (*entity.Message,
 			return nil, time.Time{}, errors.InconsistentDB
 		}
 	}
-	m, err := entity.NewMessage(subj, text, &authID, &parID, wrdate, sig, topic)
+	attachments, err := decodeAttachments(rawAttachments)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	poll, err := decodePoll(rawPoll)
 	if err != nil {
-		log.Errorf("The message '%s' fetched from DB is invalid", m)
+		return nil, time.Time{}, err
+	}
+	refs, err := decodeReferences(rawRefs)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	m, err := entity.NewMessage(subj, text, &authID, &parID, wrdate, sig,
+		topic, attachments, poll, refs, enc)
+	if err != nil {
+		log.Errorf("The message '%s' fetched from DB is invalid", id.Shorten())
 		return nil, time.Time{}, errors.InconsistentDB
 	}
+	m.Stamp = stamp
 	return m, tmStored, nil
 }
 
@@ -445,6 +636,11 @@ func (d *EntityDatabase) GetRootMessages(offset, limit int) ([]*entity.Message,
 	       Messages.Author_id,
 	       Messages.Parent_id,
 	       Messages.Signature,
+	       Messages.Encoding,
+	       Messages.Stamp,
+	       Messages.Attachments,
+	       Messages.Poll,
+	       Messages.Refs,
 	       GROUP_CONCAT(Tags.Name)
 	FROM Messages
 	INNER JOIN Message_Tags on Messages.Id=Message_Tags.Message_id
@@ -464,6 +660,8 @@ func (d *EntityDatabase) GetRootMessages(offset, limit int) ([]*entity.Message,
 	return scanMessageRows(rows)
 }
 
+// GetTopicMessages fetches the threads started in the topic and the threads,
+// which topic is edited by an operation (so they may be moved to the topic).
 func (d *EntityDatabase) GetTopicMessages(topic subs.Topic, offset, limit int) ([]*entity.Message, error) {
 	log.Debugf("Fetching topic messages from the database")
 	query := `
@@ -474,6 +672,11 @@ func (d *EntityDatabase) GetTopicMessages(topic subs.Topic, offset, limit int) (
 	       Messages.Author_id,
 	       Messages.Parent_id,
 	       Messages.Signature,
+	       Messages.Encoding,
+	       Messages.Stamp,
+	       Messages.Attachments,
+	       Messages.Poll,
+	       Messages.Refs,
 	       GROUP_CONCAT(Tags.Name)
 	FROM Messages
 	INNER JOIN Message_Tags on Messages.Id=Message_Tags.Message_id
@@ -485,6 +688,11 @@ func (d *EntityDatabase) GetTopicMessages(topic subs.Topic, offset, limit int) (
 		WHERE Tags.Name IN (%s)
 		GROUP BY Message_Tags.Message_id
 		HAVING COUNT(DISTINCT Tags.Name) = %d
+	) OR Messages.Id IN (
+		SELECT Operations_on_Messages.Message_id
+		FROM Operations_on_Messages
+		JOIN Operations on Operations_on_Messages.Operation_id = Operations.Id
+		WHERE Operations.Type = ?
 	)
 	GROUP BY Messages.Id
 	ORDER BY Messages.Timestamp ASC
@@ -499,6 +707,7 @@ func (d *EntityDatabase) GetTopicMessages(topic subs.Topic, offset, limit int) (
 		}
 		inCondition += "?"
 	}
+	params = append(params, entity.OperationTypeEditMessageTopic)
 	db := (*sql.DB)(d)
 	query = fmt.Sprintf(query, inCondition, len(topic), limit, offset)
 	rows, err := db.Query(query, params...)
@@ -520,6 +729,11 @@ func (d *EntityDatabase) GetMessagesStoredAfter(ts time.Time, limit int) ([]*ent
 	       Messages.Author_id,
 	       Messages.Parent_id,
 	       Messages.Signature,
+	       Messages.Encoding,
+	       Messages.Stamp,
+	       Messages.Attachments,
+	       Messages.Poll,
+	       Messages.Refs,
 	       GROUP_CONCAT(Tags.Name),
 	       Messages.TimeStored
 	FROM Messages
@@ -550,6 +764,11 @@ func (d *EntityDatabase) GetReplies(eid *entity.ID) ([]*entity.Message, error) {
 	       Messages.Author_id,
 	       Messages.Parent_id,
 	       Messages.Signature,
+	       Messages.Encoding,
+	       Messages.Stamp,
+	       Messages.Attachments,
+	       Messages.Poll,
+	       Messages.Refs,
 	       ''
 	FROM Messages
 	WHERE Messages.Parent_id=?
@@ -565,6 +784,41 @@ func (d *EntityDatabase) GetReplies(eid *entity.ID) ([]*entity.Message, error) {
 	return scanMessageRows(rows)
 }
 
+// GetReferringMessages fetches the messages referring to the message eid.
+func (d *EntityDatabase) GetReferringMessages(eid *entity.ID) ([]*entity.Message, error) {
+	log.Debugf("Fetching messages referring to '%s' from the database", eid.Shorten())
+	query := `
+	SELECT Messages.Id,
+	       Messages.Subject,
+	       Messages.Content,
+	       Messages.Timestamp,
+	       Messages.Author_id,
+	       Messages.Parent_id,
+	       Messages.Signature,
+	       Messages.Encoding,
+	       Messages.Stamp,
+	       Messages.Attachments,
+	       Messages.Poll,
+	       Messages.Refs,
+	       GROUP_CONCAT(Tags.Name)
+	FROM Messages
+	INNER JOIN Message_References on Messages.Id=Message_References.Message_id
+	LEFT JOIN Message_Tags on Messages.Id=Message_Tags.Message_id
+	LEFT JOIN Tags on Tags.Id=Message_Tags.Tag_id
+	WHERE Message_References.Target_id=?
+	GROUP BY Messages.Id
+	ORDER BY Messages.Timestamp ASC
+	`
+	db := (*sql.DB)(d)
+	rows, err := db.Query(query, eid[:])
+	if err != nil {
+		log.Errorf("Error fetching message from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	return scanMessageRows(rows)
+}
+
 func (d *EntityDatabase) fillSubthreads(t *thread.Node) error {
 	eid := t.Msg.ID()
 	replies, err := d.GetReplies(eid)
@@ -695,6 +949,24 @@ func (d *EntityDatabase) putMesageTopic(m *entity.Message) error {
 	return nil
 }
 
+// putMessageReferences fills the reverse index of the references.
+func (d *EntityDatabase) putMessageReferences(m *entity.Message) error {
+	query := `
+	INSERT INTO Message_References
+	( Message_id, Target_id, Type )
+	VALUES (?, ?, ?)
+	`
+	db := (*sql.DB)(d)
+	for _, r := range m.References {
+		_, err := db.Exec(query, m.ID()[:], r.ID[:], r.Type)
+		if err != nil {
+			log.Errorf("Can't execute 'putMessageReferences' statement: %s", err.Error())
+			return errors.DBOperFailed
+		}
+	}
+	return nil
+}
+
 func (d *EntityDatabase) putMessageOperation(operID, msgID *entity.ID) error {
 	log.Debugf("Adding association between operation '%s' and message '%s' to the database",
 		operID.Shorten(), msgID.Shorten())
@@ -729,16 +1001,36 @@ func (d *EntityDatabase) putUserOperation(operID, userID *entity.ID) error {
 	return nil
 }
 
+func (d *EntityDatabase) putOperationOperation(operID, targetID *entity.ID) error {
+	log.Debugf("Adding association between operation '%s' and operation '%s' to the database",
+		operID.Shorten(), targetID.Shorten())
+	query := `
+	INSERT INTO Operations_on_Operations
+        ( Operation_id, Target_id )
+        VALUES (?, ?)
+	`
+	db := (*sql.DB)(d)
+	_, err := db.Exec(query, operID[:], targetID[:])
+	if err != nil {
+		log.Errorf("Can't execute 'putOperationOperation' statement: %s", err.Error())
+		return errors.DBOperFailed
+	}
+	return nil
+}
+
 func (d *EntityDatabase) putOperationObject(o *entity.Operation) error {
 	var hasFunc func(*entity.ID) (bool, error)
 	var putFunc func(op, obj *entity.ID) error
-	switch o.OperationType() {
-	case entity.OperationTypeRemoveMessage:
+	switch o.OperationType().ObjectType() {
+	case entity.TypeMessage:
 		hasFunc = d.HasMessage
 		putFunc = d.putMessageOperation
-	case entity.OperationTypeBanUser:
+	case entity.TypeUser:
 		hasFunc = d.HasUser
 		putFunc = d.putUserOperation
+	case entity.TypeOperation:
+		hasFunc = d.HasOperation
+		putFunc = d.putOperationOperation
 	default:
 		log.Fatalf("BUG: unexpected operation type %d.", o.Type)
 	}
@@ -769,11 +1061,14 @@ func (d *EntityDatabase) PutOperation(oper *entity.Operation, ts time.Time) erro
 	  Type,
 	  Reason,
 	  Comment,
+	  Replacement,
+	  Date_expires,
 	  Author_id,
 	  Timestamp,
 	  Signature,
+	  Encoding,
 	  TimeStored )
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	db := (*sql.DB)(d)
 	_, err := db.Exec(
@@ -782,9 +1077,12 @@ func (d *EntityDatabase) PutOperation(oper *entity.Operation, ts time.Time) erro
 		oper.OperationType(),
 		oper.Reason,
 		oper.Comment,
+		oper.Replacement,
+		oper.DateExpires,
 		oper.AuthorID[:],
 		oper.DatePerformed,
 		oper.Sig.Encode(),
+		oper.Encoding(),
 		ts,
 	)
 	if err != nil {
@@ -848,34 +1146,44 @@ func scanSingleOperationRow(
 	var typ int
 	var reason int
 	var comment string
+	var replacement string
+	var dateExpires *time.Time
 	var rawAuthID []byte
 	var perfDate time.Time
 	var encodedSig []byte
+	var enc entity.Encoding
 	var rawMsgID []byte
 	var rawUserID []byte
+	var rawOperID []byte
 	var tmStored time.Time
 	var err error
 	if objID == nil {
 		if scanTimeStored {
 			err = rows.Scan(
-				&rawID, &typ, &reason, &comment, &rawAuthID, &perfDate, &encodedSig,
+				&rawID, &typ, &reason, &comment, &replacement, &dateExpires,
+				&rawAuthID, &perfDate, &encodedSig, &enc,
 				&rawMsgID,
 				&rawUserID,
+				&rawOperID,
 				&tmStored)
 		} else {
 			err = rows.Scan(
-				&rawID, &typ, &reason, &comment, &rawAuthID, &perfDate, &encodedSig,
+				&rawID, &typ, &reason, &comment, &replacement, &dateExpires,
+				&rawAuthID, &perfDate, &encodedSig, &enc,
 				&rawMsgID,
-				&rawUserID)
+				&rawUserID,
+				&rawOperID)
 		}
 	} else {
 		if scanTimeStored {
 			err = rows.Scan(
-				&rawID, &typ, &reason, &comment, &rawAuthID, &perfDate, &encodedSig,
+				&rawID, &typ, &reason, &comment, &replacement, &dateExpires,
+				&rawAuthID, &perfDate, &encodedSig, &enc,
 				&tmStored)
 		} else {
 			err = rows.Scan(
-				&rawID, &typ, &reason, &comment, &rawAuthID, &perfDate, &encodedSig)
+				&rawID, &typ, &reason, &comment, &replacement, &dateExpires,
+				&rawAuthID, &perfDate, &encodedSig, &enc)
 		}
 	}
 	if err != nil {
@@ -899,6 +1207,8 @@ func scanSingleOperationRow(
 			rawObjID = rawMsgID
 		case len(rawUserID) > 0:
 			rawObjID = rawUserID
+		case len(rawOperID) > 0:
+			rawObjID = rawOperID
 		default:
 			log.Errorf("Failed to fetch object ID of the oper %s", id.Shorten())
 			return nil, time.Time{}, errors.InconsistentDB
@@ -921,10 +1231,13 @@ func scanSingleOperationRow(
 		(entity.OperationType)(typ),
 		(entity.OperationReason)(reason),
 		comment,
+		replacement,
+		dateExpires,
 		&authID,
 		&oID,
 		perfDate,
-		sig)
+		sig,
+		enc)
 	if err != nil {
 		log.Errorf("The operation '%s' fetched from DB is invalid", o)
 		return nil, time.Time{}, errors.InconsistentDB
@@ -939,9 +1252,12 @@ func (d *EntityDatabase) GetOperationsOnUser(uid *entity.ID) ([]*entity.Operatio
 	       Operations.Type,
 	       Operations.Reason,
 	       Operations.Comment,
+	       Operations.Replacement,
+	       Operations.Date_expires,
 	       Operations.Author_id,
 	       Operations.Timestamp,
-	       Operations.Signature
+	       Operations.Signature,
+	       Operations.Encoding
 	FROM Operations
 	INNER JOIN Operations_on_Users on Operations.Id=Operations_on_Users.Operation_id
 	WHERE Operations_on_Users.User_id=?
@@ -964,9 +1280,12 @@ func (d *EntityDatabase) GetOperationsOnMessage(mid *entity.ID) ([]*entity.Opera
 	       Operations.Type,
 	       Operations.Reason,
 	       Operations.Comment,
+	       Operations.Replacement,
+	       Operations.Date_expires,
 	       Operations.Author_id,
 	       Operations.Timestamp,
-	       Operations.Signature
+	       Operations.Signature,
+	       Operations.Encoding
 	FROM Operations
 	INNER JOIN Operations_on_Messages on Operations.Id=Operations_on_Messages.Operation_id
 	WHERE Operations_on_Messages.Message_id=?
@@ -982,6 +1301,34 @@ func (d *EntityDatabase) GetOperationsOnMessage(mid *entity.ID) ([]*entity.Opera
 	return scanOperationRows(rows, mid)
 }
 
+func (d *EntityDatabase) GetOperationsOnOperation(oid *entity.ID) ([]*entity.Operation, error) {
+	log.Debugf("Fetching operations on operation %s from the database", oid.Shorten())
+	query := `
+	SELECT Operations.Id,
+	       Operations.Type,
+	       Operations.Reason,
+	       Operations.Comment,
+	       Operations.Replacement,
+	       Operations.Date_expires,
+	       Operations.Author_id,
+	       Operations.Timestamp,
+	       Operations.Signature,
+	       Operations.Encoding
+	FROM Operations
+	INNER JOIN Operations_on_Operations on Operations.Id=Operations_on_Operations.Operation_id
+	WHERE Operations_on_Operations.Target_id=?
+	GROUP BY Operations.Id
+	`
+	db := (*sql.DB)(d)
+	rows, err := db.Query(query, oid[:])
+	if err != nil {
+		log.Errorf("Error fetching operations from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	return scanOperationRows(rows, oid)
+}
+
 func (d *EntityDatabase) GetOperation(oid *entity.ID) (*entity.Operation, error) {
 	log.Debugf("Fetching operation with id '%s' from the database", oid)
 	query := `
@@ -989,14 +1336,19 @@ func (d *EntityDatabase) GetOperation(oid *entity.ID) (*entity.Operation, error)
 	       Operations.Type,
 	       Operations.Reason,
 	       Operations.Comment,
+	       Operations.Replacement,
+	       Operations.Date_expires,
 	       Operations.Author_id,
 	       Operations.Timestamp,
 	       Operations.Signature,
+	       Operations.Encoding,
 	       Operations_on_Messages.Message_id,
-	       Operations_on_Users.User_id
+	       Operations_on_Users.User_id,
+	       Operations_on_Operations.Target_id
 	FROM Operations
 	LEFT JOIN Operations_on_Messages on Operations.Id=Operations_on_Messages.Operation_id
 	LEFT JOIN Operations_on_Users on Operations.Id=Operations_on_Users.Operation_id
+	LEFT JOIN Operations_on_Operations on Operations.Id=Operations_on_Operations.Operation_id
 	WHERE Operations.Id=?
 	GROUP BY Operations.Id
 	`
@@ -1030,15 +1382,20 @@ func (d *EntityDatabase) GetOperationsStoredAfter(ts time.Time, limit int) ([]*e
 	       Operations.Type,
 	       Operations.Reason,
 	       Operations.Comment,
+	       Operations.Replacement,
+	       Operations.Date_expires,
 	       Operations.Author_id,
 	       Operations.Timestamp,
 	       Operations.Signature,
+	       Operations.Encoding,
 	       Operations_on_Messages.Message_id,
 	       Operations_on_Users.User_id,
+	       Operations_on_Operations.Target_id,
 	       Operations.TimeStored
 	FROM Operations
 	LEFT JOIN Operations_on_Messages on Operations.Id=Operations_on_Messages.Operation_id
 	LEFT JOIN Operations_on_Users on Operations.Id=Operations_on_Users.Operation_id
+	LEFT JOIN Operations_on_Operations on Operations.Id=Operations_on_Operations.Operation_id
 	WHERE Operations.TimeStored>=?
 	GROUP BY Operations.Id
 	LIMIT ?
@@ -0,0 +1,194 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+func (d *EntityDatabase) PutKeyRevocation(kr *entity.KeyRevocation, ts time.Time) error {
+	log.Debugf("Adding key revocation '%s' to the database", kr.ShortID())
+	query := `
+	INSERT INTO Key_Revocations
+	( Id,
+	  User_id,
+	  Key_seq,
+	  Timestamp,
+	  Signature,
+	  Encoding,
+	  TimeStored )
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	db := (*sql.DB)(d)
+	_, err := db.Exec(
+		query,
+		kr.ID()[:],
+		kr.UserID[:],
+		kr.KeySeq,
+		kr.DateCreated,
+		kr.Sig.Encode(),
+		kr.Encoding(),
+		ts,
+	)
+	if err != nil {
+		log.Errorf("Can't execute 'PutKeyRevocation' statement: %s", err.Error())
+		return errors.DBOperFailed
+	}
+	return nil
+}
+
+func scanSingleKeyRevocationRow(rows *sql.Rows) (*entity.KeyRevocation, time.Time, error) {
+	var rawID []byte
+	var rawUserID []byte
+	var keySeq uint64
+	var dateCreated time.Time
+	var encodedSig []byte
+	var enc entity.Encoding
+	var tmStored time.Time
+	err := rows.Scan(&rawID, &rawUserID, &keySeq, &dateCreated, &encodedSig, &enc, &tmStored)
+	if err != nil {
+		log.Errorf("Error scanning key revocation row: %v", err)
+		return nil, time.Time{}, errors.DBOperFailed
+	}
+
+	var id, userID entity.ID
+	parsOK := id.ParseSlice(rawID) == nil && userID.ParseSlice(rawUserID) == nil
+	if !parsOK {
+		log.Error("Can't parse an ID fetched from DB")
+		return nil, time.Time{}, errors.Parsing
+	}
+	sig, err := crypto.ParseSignature(encodedSig)
+	if err != nil {
+		log.Errorf("Can't parse signature fetched from DB: %v", err)
+		return nil, time.Time{}, errors.Parsing
+	}
+	kr, err := entity.NewKeyRevocation(&userID, keySeq, dateCreated, sig, enc)
+	if err != nil {
+		log.Errorf("The key revocation '%s' fetched from DB is invalid", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	if *kr.ID() != id {
+		log.Errorf("The key revocation '%s' fetched from DB has wrong ID", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	return kr, tmStored, nil
+}
+
+func (d *EntityDatabase) getKeyRevocations(query string, args ...interface{}) ([]*entity.StoredKeyRevocation, error) {
+	db := (*sql.DB)(d)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Error fetching key revocations from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	var res []*entity.StoredKeyRevocation
+	for rows.Next() {
+		kr, t, err := scanSingleKeyRevocationRow(rows)
+		if err != nil {
+			log.Errorf("Error scanning single key revocation row: %v", err)
+			return nil, err
+		}
+		res = append(res, &entity.StoredKeyRevocation{R: kr, Stored: t})
+	}
+	err = rows.Err()
+	if err != nil {
+		log.Errorf("Error getting next key revocation row: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	return res, nil
+}
+
+func (d *EntityDatabase) GetKeyRevocation(eid *entity.ID) (*entity.KeyRevocation, error) {
+	log.Debugf("Fetching key revocation with id '%s' from the database", eid.Shorten())
+	query := `
+	SELECT Id,
+	       User_id,
+	       Key_seq,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Key_Revocations WHERE Id=?
+	`
+	rr, err := d.getKeyRevocations(query, eid[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rr) == 0 {
+		return nil, errors.NoSuchEntity
+	}
+	return rr[0].R, nil
+}
+
+// GetKeyRevocations fetches all revocations of the keys of the specified user.
+func (d *EntityDatabase) GetKeyRevocations(uid *entity.ID) ([]*entity.StoredKeyRevocation, error) {
+	log.Debugf("Fetching key revocations of user '%s' from the database", uid.Shorten())
+	query := `
+	SELECT Id,
+	       User_id,
+	       Key_seq,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Key_Revocations WHERE User_id=?
+	ORDER BY TimeStored ASC
+	`
+	return d.getKeyRevocations(query, uid[:])
+}
+
+func (d *EntityDatabase) HasKeyRevocation(eid *entity.ID) (bool, error) {
+	log.Debugf("Checking whether DB contains key revocation with id '%s'", eid.Shorten())
+	var keySeq uint64
+	query := `SELECT Key_seq FROM Key_Revocations WHERE Id=?`
+	db := (*sql.DB)(d)
+	err := db.QueryRow(query, eid[:]).Scan(&keySeq)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		log.Errorf("Error fetching key revocation from the database: %v", err)
+		return false, errors.DBOperFailed
+	default:
+		return true, nil
+	}
+}
+
+func (d *EntityDatabase) GetKeyRevocationsStoredAfter(ts time.Time, limit int) ([]*entity.StoredKeyRevocation, error) {
+	log.Debugf("Fetching key revocations since %s from the database", ts.Format(time.RFC3339))
+	query := `
+	SELECT Id,
+	       User_id,
+	       Key_seq,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Key_Revocations
+	WHERE TimeStored>=?
+	ORDER BY TimeStored ASC
+	LIMIT ?
+	`
+	return d.getKeyRevocations(query, ts, limit)
+}
@@ -0,0 +1,226 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+func (d *EntityDatabase) PutKeyRotation(kr *entity.KeyRotation, ts time.Time) error {
+	log.Debugf("Adding key rotation '%s' to the database", kr.ShortID())
+	query := `
+	INSERT INTO Key_Rotations
+	( Id,
+	  User_id,
+	  Seq,
+	  Public_key,
+	  Timestamp,
+	  Signature,
+	  Encoding,
+	  TimeStored )
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	db := (*sql.DB)(d)
+	_, err := db.Exec(
+		query,
+		kr.ID()[:],
+		kr.UserID[:],
+		kr.Seq,
+		kr.NewPubKey.EncodeToDER(),
+		kr.DateRotated,
+		kr.Sig.Encode(),
+		kr.Encoding(),
+		ts,
+	)
+	if err != nil {
+		log.Errorf("Can't execute 'PutKeyRotation' statement: %s", err.Error())
+		return errors.DBOperFailed
+	}
+	return nil
+}
+
+func scanSingleKeyRotationRow(rows *sql.Rows) (*entity.KeyRotation, time.Time, error) {
+	var rawID []byte
+	var rawUserID []byte
+	var seq uint64
+	var encodedKey []byte
+	var dateRotated time.Time
+	var encodedSig []byte
+	var enc entity.Encoding
+	var tmStored time.Time
+	err := rows.Scan(&rawID, &rawUserID, &seq, &encodedKey, &dateRotated, &encodedSig, &enc, &tmStored)
+	if err != nil {
+		log.Errorf("Error scanning key rotation row: %v", err)
+		return nil, time.Time{}, errors.DBOperFailed
+	}
+
+	var id, userID entity.ID
+	parsOK := id.ParseSlice(rawID) == nil && userID.ParseSlice(rawUserID) == nil
+	if !parsOK {
+		log.Error("Can't parse an ID fetched from DB")
+		return nil, time.Time{}, errors.Parsing
+	}
+	pubkey, err := crypto.ParsePublicKeyFromDER(encodedKey)
+	if err != nil {
+		log.Errorf("Can't parse public key fetched from DB: %v", err)
+		return nil, time.Time{}, errors.Parsing
+	}
+	sig, err := crypto.ParseSignature(encodedSig)
+	if err != nil {
+		log.Errorf("Can't parse signature fetched from DB: %v", err)
+		return nil, time.Time{}, errors.Parsing
+	}
+	kr, err := entity.NewKeyRotation(&userID, seq, pubkey, dateRotated, sig, enc)
+	if err != nil {
+		log.Errorf("The key rotation '%s' fetched from DB is invalid", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	if *kr.ID() != id {
+		log.Errorf("The key rotation '%s' fetched from DB has wrong ID", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	return kr, tmStored, nil
+}
+
+func (d *EntityDatabase) getKeyRotations(query string, args ...interface{}) ([]*entity.StoredKeyRotation, error) {
+	db := (*sql.DB)(d)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Error fetching key rotations from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	var res []*entity.StoredKeyRotation
+	for rows.Next() {
+		kr, t, err := scanSingleKeyRotationRow(rows)
+		if err != nil {
+			log.Errorf("Error scanning single key rotation row: %v", err)
+			return nil, err
+		}
+		res = append(res, &entity.StoredKeyRotation{R: kr, Stored: t})
+	}
+	err = rows.Err()
+	if err != nil {
+		log.Errorf("Error getting next key rotation row: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	return res, nil
+}
+
+func (d *EntityDatabase) GetKeyRotation(eid *entity.ID) (*entity.KeyRotation, error) {
+	log.Debugf("Fetching key rotation with id '%s' from the database", eid.Shorten())
+	query := `
+	SELECT Id,
+	       User_id,
+	       Seq,
+	       Public_key,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Key_Rotations WHERE Id=?
+	`
+	rr, err := d.getKeyRotations(query, eid[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rr) == 0 {
+		return nil, errors.NoSuchEntity
+	}
+	return rr[0].R, nil
+}
+
+// GetKeyRotations fetches all rotations of the keys of the specified user.
+func (d *EntityDatabase) GetKeyRotations(uid *entity.ID) ([]*entity.StoredKeyRotation, error) {
+	log.Debugf("Fetching key rotations of user '%s' from the database", uid.Shorten())
+	query := `
+	SELECT Id,
+	       User_id,
+	       Seq,
+	       Public_key,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Key_Rotations WHERE User_id=?
+	ORDER BY Seq ASC, TimeStored ASC
+	`
+	return d.getKeyRotations(query, uid[:])
+}
+
+// GetUserIDByRotatedKey looks for the user, whose key was rotated to pubkey.
+func (d *EntityDatabase) GetUserIDByRotatedKey(pubkey *crypto.PublicKey) (*entity.ID, error) {
+	var rawUserID []byte
+	query := `SELECT User_id FROM Key_Rotations WHERE Public_key=? LIMIT 1`
+	db := (*sql.DB)(d)
+	err := db.QueryRow(query, pubkey.EncodeToDER()).Scan(&rawUserID)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, errors.NoSuchEntity
+	case err != nil:
+		log.Errorf("Error fetching key rotation from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	var userID entity.ID
+	if userID.ParseSlice(rawUserID) != nil {
+		log.Error("Can't parse an ID fetched from DB")
+		return nil, errors.Parsing
+	}
+	return &userID, nil
+}
+
+func (d *EntityDatabase) HasKeyRotation(eid *entity.ID) (bool, error) {
+	log.Debugf("Checking whether DB contains key rotation with id '%s'", eid.Shorten())
+	var seq uint64
+	query := `SELECT Seq FROM Key_Rotations WHERE Id=?`
+	db := (*sql.DB)(d)
+	err := db.QueryRow(query, eid[:]).Scan(&seq)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		log.Errorf("Error fetching key rotation from the database: %v", err)
+		return false, errors.DBOperFailed
+	default:
+		return true, nil
+	}
+}
+
+func (d *EntityDatabase) GetKeyRotationsStoredAfter(ts time.Time, limit int) ([]*entity.StoredKeyRotation, error) {
+	log.Debugf("Fetching key rotations since %s from the database", ts.Format(time.RFC3339))
+	query := `
+	SELECT Id,
+	       User_id,
+	       Seq,
+	       Public_key,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Key_Rotations
+	WHERE TimeStored>=?
+	ORDER BY Seq ASC
+	LIMIT ?
+	`
+	return d.getKeyRotations(query, ts, limit)
+}
@@ -0,0 +1,234 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// encodeModerators concatenates the IDs of the moderators.
+func encodeModerators(mm []entity.ID) []byte {
+	res := make([]byte, 0, len(mm)*len(entity.ZeroID))
+	for i := range mm {
+		res = append(res, mm[i][:]...)
+	}
+	return res
+}
+
+func decodeModerators(b []byte) ([]*entity.ID, error) {
+	size := len(entity.ZeroID)
+	if len(b)%size != 0 {
+		log.Errorf("Wrong length of encoded moderators (%d)", len(b))
+		return nil, errors.Parsing
+	}
+	res := make([]*entity.ID, len(b)/size)
+	for i := range res {
+		res[i] = new(entity.ID)
+		res[i].ParseSlice(b[i*size : (i+1)*size])
+	}
+	return res, nil
+}
+
+func (d *EntityDatabase) PutModeratorList(ml *entity.ModeratorList, ts time.Time) error {
+	log.Debugf("Adding moderator list '%s' to the database", ml.ShortID())
+	query := `
+	INSERT INTO Moderator_Lists
+	( Id,
+	  User_id,
+	  Seq,
+	  Moderators,
+	  Timestamp,
+	  Signature,
+	  Encoding,
+	  TimeStored )
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	db := (*sql.DB)(d)
+	_, err := db.Exec(
+		query,
+		ml.ID()[:],
+		ml.UserID[:],
+		ml.Seq,
+		encodeModerators(ml.Moderators),
+		ml.DateUpdated,
+		ml.Sig.Encode(),
+		ml.Encoding(),
+		ts,
+	)
+	if err != nil {
+		log.Errorf("Can't execute 'PutModeratorList' statement: %s", err.Error())
+		return errors.DBOperFailed
+	}
+	return nil
+}
+
+func scanSingleModeratorListRow(rows *sql.Rows) (*entity.ModeratorList, time.Time, error) {
+	var rawID []byte
+	var rawUserID []byte
+	var seq uint64
+	var rawModerators []byte
+	var dateUpdated time.Time
+	var encodedSig []byte
+	var enc entity.Encoding
+	var tmStored time.Time
+	err := rows.Scan(&rawID, &rawUserID, &seq, &rawModerators, &dateUpdated, &encodedSig, &enc, &tmStored)
+	if err != nil {
+		log.Errorf("Error scanning moderator list row: %v", err)
+		return nil, time.Time{}, errors.DBOperFailed
+	}
+
+	var id, userID entity.ID
+	parsOK := id.ParseSlice(rawID) == nil && userID.ParseSlice(rawUserID) == nil
+	if !parsOK {
+		log.Error("Can't parse an ID fetched from DB")
+		return nil, time.Time{}, errors.Parsing
+	}
+	moderators, err := decodeModerators(rawModerators)
+	if err != nil {
+		log.Errorf("Can't parse moderators fetched from DB: %v", err)
+		return nil, time.Time{}, errors.Parsing
+	}
+	sig, err := crypto.ParseSignature(encodedSig)
+	if err != nil {
+		log.Errorf("Can't parse signature fetched from DB: %v", err)
+		return nil, time.Time{}, errors.Parsing
+	}
+	ml, err := entity.NewModeratorList(&userID, seq, moderators, dateUpdated, sig, enc)
+	if err != nil {
+		log.Errorf("The moderator list '%s' fetched from DB is invalid", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	if *ml.ID() != id {
+		log.Errorf("The moderator list '%s' fetched from DB has wrong ID", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	return ml, tmStored, nil
+}
+
+func (d *EntityDatabase) getModeratorLists(query string, args ...interface{}) ([]*entity.StoredModeratorList, error) {
+	db := (*sql.DB)(d)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Error fetching moderator lists from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	var res []*entity.StoredModeratorList
+	for rows.Next() {
+		ml, t, err := scanSingleModeratorListRow(rows)
+		if err != nil {
+			log.Errorf("Error scanning single moderator list row: %v", err)
+			return nil, err
+		}
+		res = append(res, &entity.StoredModeratorList{L: ml, Stored: t})
+	}
+	err = rows.Err()
+	if err != nil {
+		log.Errorf("Error getting next moderator list row: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	return res, nil
+}
+
+func (d *EntityDatabase) getSingleModeratorList(query string, args ...interface{}) (*entity.ModeratorList, error) {
+	ll, err := d.getModeratorLists(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(ll) == 0 {
+		return nil, errors.NoSuchEntity
+	}
+	return ll[0].L, nil
+}
+
+func (d *EntityDatabase) GetModeratorList(eid *entity.ID) (*entity.ModeratorList, error) {
+	log.Debugf("Fetching moderator list with id '%s' from the database", eid.Shorten())
+	query := `
+	SELECT Id,
+	       User_id,
+	       Seq,
+	       Moderators,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Moderator_Lists WHERE Id=?
+	`
+	return d.getSingleModeratorList(query, eid[:])
+}
+
+// GetLatestModeratorList fetches the moderator list of the user with the
+// highest sequence number.
+func (d *EntityDatabase) GetLatestModeratorList(uid *entity.ID) (*entity.ModeratorList, error) {
+	log.Debugf("Fetching the latest moderator list of user '%s' from the database", uid.Shorten())
+	query := `
+	SELECT Id,
+	       User_id,
+	       Seq,
+	       Moderators,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Moderator_Lists WHERE User_id=?
+	ORDER BY Seq DESC, Timestamp DESC
+	LIMIT 1
+	`
+	return d.getSingleModeratorList(query, uid[:])
+}
+
+func (d *EntityDatabase) HasModeratorList(eid *entity.ID) (bool, error) {
+	log.Debugf("Checking whether DB contains moderator list with id '%s'", eid.Shorten())
+	var seq uint64
+	query := `SELECT Seq FROM Moderator_Lists WHERE Id=?`
+	db := (*sql.DB)(d)
+	err := db.QueryRow(query, eid[:]).Scan(&seq)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		log.Errorf("Error fetching moderator list from the database: %v", err)
+		return false, errors.DBOperFailed
+	default:
+		return true, nil
+	}
+}
+
+func (d *EntityDatabase) GetModeratorListsStoredAfter(ts time.Time, limit int) ([]*entity.StoredModeratorList, error) {
+	log.Debugf("Fetching moderator lists since %s from the database", ts.Format(time.RFC3339))
+	query := `
+	SELECT Id,
+	       User_id,
+	       Seq,
+	       Moderators,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Moderator_Lists
+	WHERE TimeStored>=?
+	ORDER BY Seq ASC
+	LIMIT ?
+	`
+	return d.getModeratorLists(query, ts, limit)
+}
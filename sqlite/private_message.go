@@ -0,0 +1,220 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+func (d *EntityDatabase) PutPrivateMessage(pm *entity.PrivateMessage, ts time.Time) error {
+	log.Debugf("Adding private message '%s' to the database", pm.ShortID())
+	query := `
+	INSERT INTO Private_Messages
+	( Id,
+	  Author_id,
+	  Recipient_id,
+	  Ciphertext,
+	  Timestamp,
+	  Signature,
+	  Encoding,
+	  TimeStored )
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	db := (*sql.DB)(d)
+	_, err := db.Exec(
+		query,
+		pm.ID()[:],
+		pm.AuthorID[:],
+		pm.RecipientID[:],
+		pm.Ciphertext,
+		pm.DateWritten,
+		pm.Sig.Encode(),
+		pm.Encoding(),
+		ts,
+	)
+	if err != nil {
+		log.Errorf("Can't execute 'PutPrivateMessage' statement: %s", err.Error())
+		return errors.DBOperFailed
+	}
+	return nil
+}
+
+func scanSinglePrivateMessageRow(rows *sql.Rows) (*entity.PrivateMessage, time.Time, error) {
+	var rawID []byte
+	var rawAuthorID []byte
+	var rawRecipientID []byte
+	var ciphertext []byte
+	var dateWritten time.Time
+	var encodedSig []byte
+	var enc entity.Encoding
+	var tmStored time.Time
+	err := rows.Scan(
+		&rawID,
+		&rawAuthorID,
+		&rawRecipientID,
+		&ciphertext,
+		&dateWritten,
+		&encodedSig,
+		&enc,
+		&tmStored,
+	)
+	if err != nil {
+		log.Errorf("Error scanning private message row: %v", err)
+		return nil, time.Time{}, errors.DBOperFailed
+	}
+
+	var id, authorID, recipientID entity.ID
+	parsOK := id.ParseSlice(rawID) == nil && authorID.ParseSlice(rawAuthorID) == nil &&
+		recipientID.ParseSlice(rawRecipientID) == nil
+	if !parsOK {
+		log.Error("Can't parse an ID fetched from DB")
+		return nil, time.Time{}, errors.Parsing
+	}
+	sig, err := crypto.ParseSignature(encodedSig)
+	if err != nil {
+		log.Errorf("Can't parse signature fetched from DB: %v", err)
+		return nil, time.Time{}, errors.Parsing
+	}
+	pm, err := entity.NewPrivateMessage(&authorID, &recipientID, ciphertext, dateWritten, sig, enc)
+	if err != nil {
+		log.Errorf("The private message '%s' fetched from DB is invalid", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	if *pm.ID() != id {
+		log.Errorf("The private message '%s' fetched from DB has wrong ID", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	return pm, tmStored, nil
+}
+
+func (d *EntityDatabase) getPrivateMessages(query string, args ...interface{}) ([]*entity.StoredPrivateMessage, error) {
+	db := (*sql.DB)(d)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Error fetching private messages from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	var res []*entity.StoredPrivateMessage
+	for rows.Next() {
+		pm, t, err := scanSinglePrivateMessageRow(rows)
+		if err != nil {
+			log.Errorf("Error scanning single private message row: %v", err)
+			return nil, err
+		}
+		res = append(res, &entity.StoredPrivateMessage{M: pm, Stored: t})
+	}
+	err = rows.Err()
+	if err != nil {
+		log.Errorf("Error getting next private message row: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	return res, nil
+}
+
+func (d *EntityDatabase) GetPrivateMessage(eid *entity.ID) (*entity.PrivateMessage, error) {
+	log.Debugf("Fetching private message with id '%s' from the database", eid.Shorten())
+	query := `
+	SELECT Id,
+	       Author_id,
+	       Recipient_id,
+	       Ciphertext,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Private_Messages WHERE Id=?
+	`
+	mm, err := d.getPrivateMessages(query, eid[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(mm) == 0 {
+		return nil, errors.NoSuchEntity
+	}
+	return mm[0].M, nil
+}
+
+func (d *EntityDatabase) HasPrivateMessage(eid *entity.ID) (bool, error) {
+	log.Debugf("Checking whether DB contains private message with id '%s'", eid.Shorten())
+	var ts time.Time
+	query := `SELECT Timestamp FROM Private_Messages WHERE Id=?`
+	db := (*sql.DB)(d)
+	err := db.QueryRow(query, eid[:]).Scan(&ts)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		log.Errorf("Error fetching private message from the database: %v", err)
+		return false, errors.DBOperFailed
+	default:
+		return true, nil
+	}
+}
+
+// GetPrivateMessagesTo fetches the private messages sent to the user, the
+// newest first.
+func (d *EntityDatabase) GetPrivateMessagesTo(uid *entity.ID, offset, limit int) ([]*entity.PrivateMessage, error) {
+	log.Debugf("Fetching private messages to user '%s' from the database", uid.Shorten())
+	query := `
+	SELECT Id,
+	       Author_id,
+	       Recipient_id,
+	       Ciphertext,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Private_Messages WHERE Recipient_id=?
+	ORDER BY Timestamp DESC
+	LIMIT ? OFFSET ?
+	`
+	mm, err := d.getPrivateMessages(query, uid[:], limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	var res []*entity.PrivateMessage
+	for _, m := range mm {
+		res = append(res, m.M)
+	}
+	return res, nil
+}
+
+func (d *EntityDatabase) GetPrivateMessagesStoredAfter(ts time.Time, limit int) ([]*entity.StoredPrivateMessage, error) {
+	log.Debugf("Fetching private messages since %s from the database", ts.Format(time.RFC3339))
+	query := `
+	SELECT Id,
+	       Author_id,
+	       Recipient_id,
+	       Ciphertext,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Private_Messages
+	WHERE TimeStored>=?
+	ORDER BY TimeStored ASC
+	LIMIT ?
+	`
+	return d.getPrivateMessages(query, ts, limit)
+}
@@ -54,7 +54,8 @@ func OpenProfileDatabase(fileName string) (*ProfileDatabase, error) {
 	exec("PRAGMA foreign_keys=ON")
 	//exec("PRAGMA journal_mode=WAL")
 	exec("CREATE TABLE IF NOT EXISTS Moderators (" +
-		"  User_id          BLOB PRIMARY KEY)")
+		"  User_id          BLOB PRIMARY KEY," +
+		"  Scope            TEXT NOT NULL DEFAULT '')")
 	exec("CREATE TABLE IF NOT EXISTS Subscriptions (" +
 		"  Id               INTEGER PRIMARY KEY AUTOINCREMENT," +
 		"  Topic            TEXT NOT NULL UNIQUE)")
@@ -64,11 +65,20 @@ func OpenProfileDatabase(fileName string) (*ProfileDatabase, error) {
 	exec("CREATE TABLE IF NOT EXISTS User_Subscriptions (" +
 		"  User_id          BLOB NOT NULL REFERENCES User_Histories ON DELETE CASCADE," +
 		"  Topic            TEXT NOT NULL)")
+	exec("CREATE TABLE IF NOT EXISTS Quorums (" +
+		"  Operation_type   INTEGER PRIMARY KEY," +
+		"  Count            INTEGER NOT NULL," +
+		"  Percent          INTEGER NOT NULL)")
 	// TBD: create indexes?
 	if execErr != nil {
 		log.Errorf("Unable to initialize the profile database: %s", execErr.Error())
 		return nil, errors.DBOperFailed
 	}
+	err = addColumnIfMissing(db, "Moderators", "Scope", "TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		log.Errorf("Unable to upgrade the profile database: %v", err)
+		return nil, errors.DBOperFailed
+	}
 
 	return (*ProfileDatabase)(db), nil
 }
@@ -83,11 +93,11 @@ func (pd *ProfileDatabase) Close() error {
 	return nil
 }
 
-func (pd *ProfileDatabase) PutModerator(id *entity.ID) error {
-	log.Debugf("Adding moderator `%s' to the profile database", id.Shorten())
-	query := `INSERT INTO Moderators ( User_id ) VALUES (?)`
+func (pd *ProfileDatabase) PutModerator(m *entity.Moderator) error {
+	log.Debugf("Adding moderator `%s' to the profile database", m.ID.Shorten())
+	query := `INSERT INTO Moderators ( User_id, Scope ) VALUES (?, ?)`
 	db := (*sql.DB)(pd)
-	_, err := db.Exec(query, id[:])
+	_, err := db.Exec(query, m.ID[:], m.Scope.String())
 	if err != nil {
 		sqliteErr, ok := err.(sqlite3.Error)
 		if ok && sqliteErr.Code == sqlite3.ErrConstraint {
@@ -122,9 +132,9 @@ func (pd *ProfileDatabase) RemoveModerator(id *entity.ID) error {
 	return nil
 }
 
-func (pd *ProfileDatabase) GetModerators() ([]*entity.ID, error) {
+func (pd *ProfileDatabase) GetModerators() ([]*entity.Moderator, error) {
 	log.Debugf("Fetching moderators from the profile database")
-	query := `SELECT User_id FROM Moderators`
+	query := `SELECT User_id, Scope FROM Moderators`
 	db := (*sql.DB)(pd)
 	rows, err := db.Query(query)
 	if err != nil {
@@ -132,22 +142,28 @@ func (pd *ProfileDatabase) GetModerators() ([]*entity.ID, error) {
 		return nil, errors.DBOperFailed
 	}
 	defer rows.Close()
-	var res []*entity.ID
+	var res []*entity.Moderator
 	for rows.Next() {
 		var rawID []byte
-		err := rows.Scan(&rawID)
+		var scopeStr string
+		err := rows.Scan(&rawID, &scopeStr)
 		if err != nil {
 			log.Errorf("Error scanning moderator row: %v", err)
 			return nil, errors.DBOperFailed
 		}
 
-		var id entity.ID
-		if id.ParseSlice(rawID) != nil {
+		var m entity.Moderator
+		if m.ID.ParseSlice(rawID) != nil {
 			log.Error("Can't parse an ID fetched from the profile DB")
 			return nil, errors.Parsing
 		}
-		log.Debugf("Found moderator id %s", id.String())
-		res = append(res, &id)
+		m.Scope, err = subs.NewTopic(scopeStr)
+		if err != nil {
+			log.Errorf("Can't parse a scope fetched from the profile DB: %v", err)
+			return nil, errors.Parsing
+		}
+		log.Debugf("Found moderator id %s", m.ID.String())
+		res = append(res, &m)
 	}
 	err = rows.Err()
 	if err != nil {
@@ -157,6 +173,47 @@ func (pd *ProfileDatabase) GetModerators() ([]*entity.ID, error) {
 	return res, nil
 }
 
+func (pd *ProfileDatabase) PutQuorum(t entity.OperationType, q *entity.Quorum) error {
+	log.Debugf("Setting quorum for %s to %s in the profile database", t, q)
+	query := `INSERT OR REPLACE INTO Quorums ( Operation_type, Count, Percent ) VALUES (?,?,?)`
+	db := (*sql.DB)(pd)
+	_, err := db.Exec(query, t, q.Count, q.Percent)
+	if err != nil {
+		log.Errorf("Can't execute 'PutQuorum' statement: %s", err.Error())
+		return errors.DBOperFailed
+	}
+	return nil
+}
+
+func (pd *ProfileDatabase) GetQuorums() (map[entity.OperationType]entity.Quorum, error) {
+	log.Debugf("Fetching quorums from the profile database")
+	query := `SELECT Operation_type, Count, Percent FROM Quorums`
+	db := (*sql.DB)(pd)
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Errorf("Error fetching quorums from the profile database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	res := make(map[entity.OperationType]entity.Quorum)
+	for rows.Next() {
+		var t entity.OperationType
+		var q entity.Quorum
+		err := rows.Scan(&t, &q.Count, &q.Percent)
+		if err != nil {
+			log.Errorf("Error scanning quorum row: %v", err)
+			return nil, errors.DBOperFailed
+		}
+		res[t] = q
+	}
+	err = rows.Err()
+	if err != nil {
+		log.Errorf("Error getting next quorum row: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	return res, nil
+}
+
 func (pd *ProfileDatabase) PutSubscription(t subs.Topic) error {
 	log.Debugf("Adding subscription `%s' to the profile database", t)
 	query := `INSERT INTO Subscriptions ( Topic ) VALUES (?)`
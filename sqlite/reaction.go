@@ -0,0 +1,219 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+func (d *EntityDatabase) PutReaction(r *entity.Reaction, ts time.Time) error {
+	log.Debugf("Adding reaction '%s' to the database", r.ShortID())
+	query := `
+	INSERT INTO Reactions
+	( Id,
+	  Kind,
+	  Author_id,
+	  Message_id,
+	  Timestamp,
+	  Signature,
+	  Encoding,
+	  TimeStored )
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	db := (*sql.DB)(d)
+	_, err := db.Exec(
+		query,
+		r.ID()[:],
+		r.Kind,
+		r.AuthorID[:],
+		r.MessageID[:],
+		r.DateReacted,
+		r.Sig.Encode(),
+		r.Encoding(),
+		ts,
+	)
+	if err != nil {
+		log.Errorf("Can't execute 'PutReaction' statement: %s", err.Error())
+		return errors.DBOperFailed
+	}
+	return nil
+}
+
+func scanSingleReactionRow(rows *sql.Rows) (*entity.Reaction, time.Time, error) {
+	var rawID []byte
+	var kind entity.ReactionType
+	var rawAuthorID []byte
+	var rawMessageID []byte
+	var dateReacted time.Time
+	var encodedSig []byte
+	var enc entity.Encoding
+	var tmStored time.Time
+	err := rows.Scan(
+		&rawID,
+		&kind,
+		&rawAuthorID,
+		&rawMessageID,
+		&dateReacted,
+		&encodedSig,
+		&enc,
+		&tmStored,
+	)
+	if err != nil {
+		log.Errorf("Error scanning reaction row: %v", err)
+		return nil, time.Time{}, errors.DBOperFailed
+	}
+
+	var id, authorID, messageID entity.ID
+	parsOK := id.ParseSlice(rawID) == nil && authorID.ParseSlice(rawAuthorID) == nil &&
+		messageID.ParseSlice(rawMessageID) == nil
+	if !parsOK {
+		log.Error("Can't parse an ID fetched from DB")
+		return nil, time.Time{}, errors.Parsing
+	}
+	sig, err := crypto.ParseSignature(encodedSig)
+	if err != nil {
+		log.Errorf("Can't parse signature fetched from DB: %v", err)
+		return nil, time.Time{}, errors.Parsing
+	}
+	r, err := entity.NewReaction(kind, &authorID, &messageID, dateReacted, sig, enc)
+	if err != nil {
+		log.Errorf("The reaction '%s' fetched from DB is invalid", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	if *r.ID() != id {
+		log.Errorf("The reaction '%s' fetched from DB has wrong ID", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	return r, tmStored, nil
+}
+
+func (d *EntityDatabase) getReactions(query string, args ...interface{}) ([]*entity.StoredReaction, error) {
+	db := (*sql.DB)(d)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Error fetching reactions from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	var res []*entity.StoredReaction
+	for rows.Next() {
+		r, t, err := scanSingleReactionRow(rows)
+		if err != nil {
+			log.Errorf("Error scanning single reaction row: %v", err)
+			return nil, err
+		}
+		res = append(res, &entity.StoredReaction{R: r, Stored: t})
+	}
+	err = rows.Err()
+	if err != nil {
+		log.Errorf("Error getting next reaction row: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	return res, nil
+}
+
+func (d *EntityDatabase) GetReaction(eid *entity.ID) (*entity.Reaction, error) {
+	log.Debugf("Fetching reaction with id '%s' from the database", eid.Shorten())
+	query := `
+	SELECT Id,
+	       Kind,
+	       Author_id,
+	       Message_id,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Reactions WHERE Id=?
+	`
+	rr, err := d.getReactions(query, eid[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rr) == 0 {
+		return nil, errors.NoSuchEntity
+	}
+	return rr[0].R, nil
+}
+
+func (d *EntityDatabase) HasReaction(eid *entity.ID) (bool, error) {
+	log.Debugf("Checking whether DB contains reaction with id '%s'", eid.Shorten())
+	var kind int
+	query := `SELECT Kind FROM Reactions WHERE Id=?`
+	db := (*sql.DB)(d)
+	err := db.QueryRow(query, eid[:]).Scan(&kind)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		log.Errorf("Error fetching reaction from the database: %v", err)
+		return false, errors.DBOperFailed
+	default:
+		return true, nil
+	}
+}
+
+// GetReactionsOnMessage fetches all reactions to the message, including the
+// ones replaced by later reactions of the same users.
+func (d *EntityDatabase) GetReactionsOnMessage(mid *entity.ID) ([]*entity.Reaction, error) {
+	log.Debugf("Fetching reactions to message '%s' from the database", mid.Shorten())
+	query := `
+	SELECT Id,
+	       Kind,
+	       Author_id,
+	       Message_id,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Reactions WHERE Message_id=?
+	ORDER BY Timestamp ASC
+	`
+	rr, err := d.getReactions(query, mid[:])
+	if err != nil {
+		return nil, err
+	}
+	var res []*entity.Reaction
+	for _, r := range rr {
+		res = append(res, r.R)
+	}
+	return res, nil
+}
+
+func (d *EntityDatabase) GetReactionsStoredAfter(ts time.Time, limit int) ([]*entity.StoredReaction, error) {
+	log.Debugf("Fetching reactions since %s from the database", ts.Format(time.RFC3339))
+	query := `
+	SELECT Id,
+	       Kind,
+	       Author_id,
+	       Message_id,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Reactions
+	WHERE TimeStored>=?
+	ORDER BY TimeStored ASC
+	LIMIT ?
+	`
+	return d.getReactions(query, ts, limit)
+}
@@ -0,0 +1,128 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+// addColumnIfMissing upgrades databases created by older versions of Dscuss.
+// It adds the column to the table unless the table already has it.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?",
+		table,
+		column,
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	log.Debugf("Adding column %s to the table %s", column, table)
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// encodeAttachments serializes attachments of a message for storing in a
+// single column. Messages without attachments are stored as an empty string.
+func encodeAttachments(aa []entity.Attachment) (string, error) {
+	if len(aa) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(aa)
+	if err != nil {
+		log.Errorf("Can't marshal attachments: %v", err)
+		return "", errors.Parsing
+	}
+	return string(b), nil
+}
+
+func decodeAttachments(s string) ([]entity.Attachment, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var aa []entity.Attachment
+	err := json.Unmarshal([]byte(s), &aa)
+	if err != nil {
+		log.Errorf("Can't unmarshal attachments fetched from DB: %v", err)
+		return nil, errors.Parsing
+	}
+	return aa, nil
+}
+
+// encodePoll serializes the poll of a message for storing in a single column.
+// Messages without polls are stored as an empty string.
+func encodePoll(p *entity.Poll) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		log.Errorf("Can't marshal poll: %v", err)
+		return "", errors.Parsing
+	}
+	return string(b), nil
+}
+
+func decodePoll(s string) (*entity.Poll, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var p entity.Poll
+	err := json.Unmarshal([]byte(s), &p)
+	if err != nil {
+		log.Errorf("Can't unmarshal poll fetched from DB: %v", err)
+		return nil, errors.Parsing
+	}
+	return &p, nil
+}
+
+// encodeReferences serializes references of a message for storing in a single
+// column. Messages without references are stored as an empty string.
+func encodeReferences(rr []entity.Reference) (string, error) {
+	if len(rr) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(rr)
+	if err != nil {
+		log.Errorf("Can't marshal references: %v", err)
+		return "", errors.Parsing
+	}
+	return string(b), nil
+}
+
+func decodeReferences(s string) ([]entity.Reference, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var rr []entity.Reference
+	err := json.Unmarshal([]byte(s), &rr)
+	if err != nil {
+		log.Errorf("Can't unmarshal references fetched from DB: %v", err)
+		return nil, errors.Parsing
+	}
+	return rr, nil
+}
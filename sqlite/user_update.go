@@ -0,0 +1,213 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+func (d *EntityDatabase) PutUserUpdate(uu *entity.UserUpdate, ts time.Time) error {
+	log.Debugf("Adding user update '%s' to the database", uu.ShortID())
+	query := `
+	INSERT INTO User_Updates
+	( Id,
+	  User_id,
+	  Seq,
+	  Info,
+	  Timestamp,
+	  Signature,
+	  Encoding,
+	  TimeStored )
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	db := (*sql.DB)(d)
+	_, err := db.Exec(
+		query,
+		uu.ID()[:],
+		uu.UserID[:],
+		uu.Seq,
+		uu.Info,
+		uu.DateUpdated,
+		uu.Sig.Encode(),
+		uu.Encoding(),
+		ts,
+	)
+	if err != nil {
+		log.Errorf("Can't execute 'PutUserUpdate' statement: %s", err.Error())
+		return errors.DBOperFailed
+	}
+	return nil
+}
+
+func scanSingleUserUpdateRow(rows *sql.Rows, scanTimeStored bool) (*entity.UserUpdate, time.Time, error) {
+	var rawID []byte
+	var rawUserID []byte
+	var seq uint64
+	var info string
+	var dateUpdated time.Time
+	var encodedSig []byte
+	var enc entity.Encoding
+	var tmStored time.Time
+	var err error
+	if scanTimeStored {
+		err = rows.Scan(&rawID, &rawUserID, &seq, &info, &dateUpdated, &encodedSig, &enc, &tmStored)
+	} else {
+		err = rows.Scan(&rawID, &rawUserID, &seq, &info, &dateUpdated, &encodedSig, &enc)
+	}
+	if err != nil {
+		log.Errorf("Error scanning user update row: %v", err)
+		return nil, time.Time{}, errors.DBOperFailed
+	}
+
+	var id, userID entity.ID
+	parsOK := id.ParseSlice(rawID) == nil && userID.ParseSlice(rawUserID) == nil
+	if !parsOK {
+		log.Error("Can't parse an ID fetched from DB")
+		return nil, time.Time{}, errors.Parsing
+	}
+	sig, err := crypto.ParseSignature(encodedSig)
+	if err != nil {
+		log.Errorf("Can't parse signature fetched from DB: %v", err)
+		return nil, time.Time{}, errors.Parsing
+	}
+	uu, err := entity.NewUserUpdate(&userID, seq, info, dateUpdated, sig, enc)
+	if err != nil {
+		log.Errorf("The user update '%s' fetched from DB is invalid", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	if *uu.ID() != id {
+		log.Errorf("The user update '%s' fetched from DB has wrong ID", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	return uu, tmStored, nil
+}
+
+func (d *EntityDatabase) getSingleUserUpdate(query string, args ...interface{}) (*entity.UserUpdate, error) {
+	db := (*sql.DB)(d)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Error fetching user update from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			log.Errorf("Error getting next user update row: %v", err)
+			return nil, errors.DBOperFailed
+		}
+		return nil, errors.NoSuchEntity
+	}
+	uu, _, err := scanSingleUserUpdateRow(rows, false)
+	return uu, err
+}
+
+func (d *EntityDatabase) GetUserUpdate(eid *entity.ID) (*entity.UserUpdate, error) {
+	log.Debugf("Fetching user update with id '%s' from the database", eid.Shorten())
+	query := `
+	SELECT Id,
+	       User_id,
+	       Seq,
+	       Info,
+	       Timestamp,
+	       Signature,
+	       Encoding
+	FROM User_Updates WHERE Id=?
+	`
+	return d.getSingleUserUpdate(query, eid[:])
+}
+
+// GetLatestUserUpdate fetches the update of the user with the highest sequence
+// number.
+func (d *EntityDatabase) GetLatestUserUpdate(uid *entity.ID) (*entity.UserUpdate, error) {
+	log.Debugf("Fetching the latest update of user '%s' from the database", uid.Shorten())
+	query := `
+	SELECT Id,
+	       User_id,
+	       Seq,
+	       Info,
+	       Timestamp,
+	       Signature,
+	       Encoding
+	FROM User_Updates WHERE User_id=?
+	ORDER BY Seq DESC, Timestamp DESC
+	LIMIT 1
+	`
+	return d.getSingleUserUpdate(query, uid[:])
+}
+
+func (d *EntityDatabase) HasUserUpdate(eid *entity.ID) (bool, error) {
+	log.Debugf("Checking whether DB contains user update with id '%s'", eid.Shorten())
+	var seq uint64
+	query := `SELECT Seq FROM User_Updates WHERE Id=?`
+	db := (*sql.DB)(d)
+	err := db.QueryRow(query, eid[:]).Scan(&seq)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		log.Errorf("Error fetching user update from the database: %v", err)
+		return false, errors.DBOperFailed
+	default:
+		return true, nil
+	}
+}
+
+func (d *EntityDatabase) GetUserUpdatesStoredAfter(ts time.Time, limit int) ([]*entity.StoredUserUpdate, error) {
+	log.Debugf("Fetching user updates since %s from the database", ts.Format(time.RFC3339))
+	query := `
+	SELECT Id,
+	       User_id,
+	       Seq,
+	       Info,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM User_Updates
+	WHERE TimeStored>=?
+	ORDER BY Seq ASC
+	LIMIT ?
+	`
+	db := (*sql.DB)(d)
+	rows, err := db.Query(query, ts, limit)
+	if err != nil {
+		log.Errorf("Error fetching user updates from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	var res []*entity.StoredUserUpdate
+	for rows.Next() {
+		uu, t, err := scanSingleUserUpdateRow(rows, true)
+		if err != nil {
+			log.Errorf("Error scanning single user update row: %v", err)
+			return nil, err
+		}
+		res = append(res, &entity.StoredUserUpdate{U: uu, Stored: t})
+	}
+	err = rows.Err()
+	if err != nil {
+		log.Errorf("Error getting next user update row: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	return res, nil
+}
@@ -0,0 +1,219 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+)
+
+func (d *EntityDatabase) PutVote(v *entity.Vote, ts time.Time) error {
+	log.Debugf("Adding vote '%s' to the database", v.ShortID())
+	query := `
+	INSERT INTO Votes
+	( Id,
+	  Choice,
+	  Author_id,
+	  Poll_id,
+	  Timestamp,
+	  Signature,
+	  Encoding,
+	  TimeStored )
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	db := (*sql.DB)(d)
+	_, err := db.Exec(
+		query,
+		v.ID()[:],
+		v.Choice,
+		v.AuthorID[:],
+		v.PollID[:],
+		v.DateVoted,
+		v.Sig.Encode(),
+		v.Encoding(),
+		ts,
+	)
+	if err != nil {
+		log.Errorf("Can't execute 'PutVote' statement: %s", err.Error())
+		return errors.DBOperFailed
+	}
+	return nil
+}
+
+func scanSingleVoteRow(rows *sql.Rows) (*entity.Vote, time.Time, error) {
+	var rawID []byte
+	var choice int
+	var rawAuthorID []byte
+	var rawPollID []byte
+	var dateVoted time.Time
+	var encodedSig []byte
+	var enc entity.Encoding
+	var tmStored time.Time
+	err := rows.Scan(
+		&rawID,
+		&choice,
+		&rawAuthorID,
+		&rawPollID,
+		&dateVoted,
+		&encodedSig,
+		&enc,
+		&tmStored,
+	)
+	if err != nil {
+		log.Errorf("Error scanning vote row: %v", err)
+		return nil, time.Time{}, errors.DBOperFailed
+	}
+
+	var id, authorID, pollID entity.ID
+	parsOK := id.ParseSlice(rawID) == nil && authorID.ParseSlice(rawAuthorID) == nil &&
+		pollID.ParseSlice(rawPollID) == nil
+	if !parsOK {
+		log.Error("Can't parse an ID fetched from DB")
+		return nil, time.Time{}, errors.Parsing
+	}
+	sig, err := crypto.ParseSignature(encodedSig)
+	if err != nil {
+		log.Errorf("Can't parse signature fetched from DB: %v", err)
+		return nil, time.Time{}, errors.Parsing
+	}
+	v, err := entity.NewVote(&authorID, &pollID, choice, dateVoted, sig, enc)
+	if err != nil {
+		log.Errorf("The vote '%s' fetched from DB is invalid", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	if *v.ID() != id {
+		log.Errorf("The vote '%s' fetched from DB has wrong ID", id.Shorten())
+		return nil, time.Time{}, errors.InconsistentDB
+	}
+	return v, tmStored, nil
+}
+
+func (d *EntityDatabase) getVotes(query string, args ...interface{}) ([]*entity.StoredVote, error) {
+	db := (*sql.DB)(d)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Errorf("Error fetching votes from the database: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	defer rows.Close()
+	var res []*entity.StoredVote
+	for rows.Next() {
+		v, t, err := scanSingleVoteRow(rows)
+		if err != nil {
+			log.Errorf("Error scanning single vote row: %v", err)
+			return nil, err
+		}
+		res = append(res, &entity.StoredVote{V: v, Stored: t})
+	}
+	err = rows.Err()
+	if err != nil {
+		log.Errorf("Error getting next vote row: %v", err)
+		return nil, errors.DBOperFailed
+	}
+	return res, nil
+}
+
+func (d *EntityDatabase) GetVote(eid *entity.ID) (*entity.Vote, error) {
+	log.Debugf("Fetching vote with id '%s' from the database", eid.Shorten())
+	query := `
+	SELECT Id,
+	       Choice,
+	       Author_id,
+	       Poll_id,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Votes WHERE Id=?
+	`
+	vv, err := d.getVotes(query, eid[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(vv) == 0 {
+		return nil, errors.NoSuchEntity
+	}
+	return vv[0].V, nil
+}
+
+func (d *EntityDatabase) HasVote(eid *entity.ID) (bool, error) {
+	log.Debugf("Checking whether DB contains vote with id '%s'", eid.Shorten())
+	var choice int
+	query := `SELECT Choice FROM Votes WHERE Id=?`
+	db := (*sql.DB)(d)
+	err := db.QueryRow(query, eid[:]).Scan(&choice)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		log.Errorf("Error fetching vote from the database: %v", err)
+		return false, errors.DBOperFailed
+	default:
+		return true, nil
+	}
+}
+
+// GetVotesOnPoll fetches all votes on the poll, including the
+// ones replaced by later votes of the same users.
+func (d *EntityDatabase) GetVotesOnPoll(pid *entity.ID) ([]*entity.Vote, error) {
+	log.Debugf("Fetching votes on poll '%s' from the database", pid.Shorten())
+	query := `
+	SELECT Id,
+	       Choice,
+	       Author_id,
+	       Poll_id,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Votes WHERE Poll_id=?
+	ORDER BY Timestamp ASC
+	`
+	svv, err := d.getVotes(query, pid[:])
+	if err != nil {
+		return nil, err
+	}
+	vv := make([]*entity.Vote, len(svv))
+	for i, sv := range svv {
+		vv[i] = sv.V
+	}
+	return vv, nil
+}
+
+func (d *EntityDatabase) GetVotesStoredAfter(ts time.Time, limit int) ([]*entity.StoredVote, error) {
+	log.Debugf("Fetching votes since %s from the database", ts.Format(time.RFC3339))
+	query := `
+	SELECT Id,
+	       Choice,
+	       Author_id,
+	       Poll_id,
+	       Timestamp,
+	       Signature,
+	       Encoding,
+	       TimeStored
+	FROM Votes
+	WHERE TimeStored>=?
+	ORDER BY TimeStored ASC
+	LIMIT ?
+	`
+	return d.getVotes(query, ts, limit)
+}
@@ -0,0 +1,114 @@
+/*
+This file is part of Dscuss.
+Copyright (C) 2019  Vitaly Minko
+
+This program is free software: you can redistribute it and/or modify it under
+the terms of the GNU General Public License as published by the Free Software
+Foundation, either version 3 of the License, or (at your option) any later
+version.
+
+This program is distributed in the hope that it will be useful, but WITHOUT ANY
+WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS FOR A
+PARTICULAR PURPOSE.  See the GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License along with
+this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package dscuss
+
+import (
+	"sort"
+	"sync"
+	"vminko.org/dscuss/crypto"
+	"vminko.org/dscuss/entity"
+	"vminko.org/dscuss/errors"
+	"vminko.org/dscuss/log"
+	"vminko.org/dscuss/owner"
+)
+
+// PendingMessage is a message waiting for its stamp to be computed.
+type PendingMessage struct {
+	Message  *entity.Message
+	Progress crypto.Progress
+}
+
+type pendingStamp struct {
+	m  *entity.Message
+	sf *crypto.StampFinder
+}
+
+// stamper computes stamps of the owner's messages in background and posts the
+// messages when the stamps are found.
+type stamper struct {
+	owner   *owner.Owner
+	bits    int
+	pending map[entity.ID]*pendingStamp
+	mx      sync.Mutex
+	wg      sync.WaitGroup
+}
+
+func newStamper(owner *owner.Owner, bits int) *stamper {
+	return &stamper{
+		owner:   owner,
+		bits:    bits,
+		pending: make(map[entity.ID]*pendingStamp),
+	}
+}
+
+func (s *stamper) post(m *entity.Message) <-chan error {
+	res := make(chan error, 1)
+	if s.bits == 0 {
+		res <- s.owner.Storage.PutEntity(m, nil)
+		close(res)
+		return res
+	}
+	ps := &pendingStamp{m, crypto.NewStampFinder(m.ID()[:], s.bits)}
+	s.mx.Lock()
+	s.pending[*m.ID()] = ps
+	s.mx.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(res)
+		stamp, ok := ps.sf.Find()
+		s.mx.Lock()
+		delete(s.pending, *m.ID())
+		s.mx.Unlock()
+		if !ok {
+			log.Infof("Posting of message %s is interrupted", m.ShortID())
+			res <- errors.Interrupted
+			return
+		}
+		m.Stamp = stamp
+		err := s.owner.Storage.PutEntity(m, nil)
+		if err != nil {
+			log.Errorf("Failed to post message %s: %v", m.ShortID(), err)
+		}
+		res <- err
+	}()
+	return res
+}
+
+func (s *stamper) list() []*PendingMessage {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	var res []*PendingMessage
+	for _, ps := range s.pending {
+		res = append(res, &PendingMessage{ps.m, ps.sf.Progress()})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Message.DateWritten.Before(res[j].Message.DateWritten)
+	})
+	return res
+}
+
+// stop interrupts computing of all pending stamps.
+func (s *stamper) stop() {
+	s.mx.Lock()
+	for _, ps := range s.pending {
+		ps.sf.Stop()
+	}
+	s.mx.Unlock()
+	s.wg.Wait()
+}
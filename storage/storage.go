@@ -20,6 +20,7 @@ package storage
 import (
 	"sync"
 	"time"
+	"vminko.org/dscuss/crypto"
 	"vminko.org/dscuss/entity"
 	"vminko.org/dscuss/errors"
 	"vminko.org/dscuss/log"
@@ -78,10 +79,83 @@ func (s *Storage) notifyObservers(e entity.Entity, sender chan<- entity.Entity)
 	}
 }
 
+// GetUser returns the original (signed) user entity.
 func (s *Storage) GetUser(eid *entity.ID) (*entity.User, error) {
 	return s.db.GetUser(eid)
 }
 
+// GetProfile returns the latest version of the user's profile. The result is
+// not a valid signed entity if the profile was updated, so it's only suitable
+// for displaying.
+func (s *Storage) GetProfile(eid *entity.ID) (*entity.User, error) {
+	u, err := s.db.GetUser(eid)
+	if err != nil {
+		return nil, err
+	}
+	uu, err := s.db.GetLatestUserUpdate(eid)
+	if err == errors.NoSuchEntity {
+		return u, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return u.ApplyUpdate(uu), nil
+}
+
+func (s *Storage) GetLatestUserUpdate(uid *entity.ID) (*entity.UserUpdate, error) {
+	return s.db.GetLatestUserUpdate(uid)
+}
+
+func (s *Storage) GetUserUpdatesStoredAfter(ts time.Time, limit int) ([]*entity.StoredUserUpdate, error) {
+	return s.db.GetUserUpdatesStoredAfter(ts, limit)
+}
+
+// GetKeyChain returns the chain of keys of the user.
+func (s *Storage) GetKeyChain(uid *entity.ID) (*entity.KeyChain, error) {
+	u, err := s.db.GetUser(uid)
+	if err != nil {
+		return nil, err
+	}
+	rr, err := s.db.GetKeyRotations(uid)
+	if err != nil {
+		return nil, err
+	}
+	vv, err := s.db.GetKeyRevocations(uid)
+	if err != nil {
+		return nil, err
+	}
+	return entity.NewKeyChain(u, rr, vv), nil
+}
+
+// GetUserIDByKey finds the user, who owns the key. The key is either the one
+// the user was registered with or one of the rotated keys.
+func (s *Storage) GetUserIDByKey(pubkey *crypto.PublicKey) (*entity.ID, error) {
+	eid := entity.NewID(pubkey.EncodeToDER())
+	has, err := s.db.HasUser(&eid)
+	if err != nil {
+		return nil, err
+	}
+	if has {
+		return &eid, nil
+	}
+	return s.db.GetUserIDByRotatedKey(pubkey)
+}
+
+func (s *Storage) GetKeyRotations(uid *entity.ID) ([]*entity.StoredKeyRotation, error) {
+	return s.db.GetKeyRotations(uid)
+}
+
+func (s *Storage) GetKeyRevocations(uid *entity.ID) ([]*entity.StoredKeyRevocation, error) {
+	return s.db.GetKeyRevocations(uid)
+}
+
+func (s *Storage) GetKeyRotationsStoredAfter(ts time.Time, limit int) ([]*entity.StoredKeyRotation, error) {
+	return s.db.GetKeyRotationsStoredAfter(ts, limit)
+}
+
+func (s *Storage) GetKeyRevocationsStoredAfter(ts time.Time, limit int) ([]*entity.StoredKeyRevocation, error) {
+	return s.db.GetKeyRevocationsStoredAfter(ts, limit)
+}
+
 func (s *Storage) HasUser(id *entity.ID) (bool, error) {
 	return s.db.HasUser(id)
 }
@@ -90,6 +164,10 @@ func (s *Storage) GetMessage(eid *entity.ID) (*entity.Message, error) {
 	return s.db.GetMessage(eid)
 }
 
+func (s *Storage) GetReferringMessages(eid *entity.ID) ([]*entity.Message, error) {
+	return s.db.GetReferringMessages(eid)
+}
+
 func (s *Storage) GetRootMessages(offset, limit int) ([]*entity.Message, error) {
 	return s.db.GetRootMessages(offset, limit)
 }
@@ -142,10 +220,46 @@ func (s *Storage) GetOperationsOnMessage(mid *entity.ID) ([]*entity.Operation, e
 	return s.db.GetOperationsOnMessage(mid)
 }
 
+func (s *Storage) GetOperationsOnOperation(oid *entity.ID) ([]*entity.Operation, error) {
+	return s.db.GetOperationsOnOperation(oid)
+}
+
 func (s *Storage) GetOperation(oid *entity.ID) (*entity.Operation, error) {
 	return s.db.GetOperation(oid)
 }
 
+func (s *Storage) GetReactionsOnMessage(mid *entity.ID) ([]*entity.Reaction, error) {
+	return s.db.GetReactionsOnMessage(mid)
+}
+
+func (s *Storage) GetReactionsStoredAfter(ts time.Time, limit int) ([]*entity.StoredReaction, error) {
+	return s.db.GetReactionsStoredAfter(ts, limit)
+}
+
+func (s *Storage) GetLatestModeratorList(uid *entity.ID) (*entity.ModeratorList, error) {
+	return s.db.GetLatestModeratorList(uid)
+}
+
+func (s *Storage) GetModeratorListsStoredAfter(ts time.Time, limit int) ([]*entity.StoredModeratorList, error) {
+	return s.db.GetModeratorListsStoredAfter(ts, limit)
+}
+
+func (s *Storage) GetPrivateMessagesTo(uid *entity.ID, offset, limit int) ([]*entity.PrivateMessage, error) {
+	return s.db.GetPrivateMessagesTo(uid, offset, limit)
+}
+
+func (s *Storage) GetPrivateMessagesStoredAfter(ts time.Time, limit int) ([]*entity.StoredPrivateMessage, error) {
+	return s.db.GetPrivateMessagesStoredAfter(ts, limit)
+}
+
+func (s *Storage) GetVotesOnPoll(pid *entity.ID) ([]*entity.Vote, error) {
+	return s.db.GetVotesOnPoll(pid)
+}
+
+func (s *Storage) GetVotesStoredAfter(ts time.Time, limit int) ([]*entity.StoredVote, error) {
+	return s.db.GetVotesStoredAfter(ts, limit)
+}
+
 func (s *Storage) HasEntity(eid *entity.ID) (bool, error) {
 	h, err := s.db.HasUser(eid)
 	if h {
@@ -163,7 +277,63 @@ func (s *Storage) HasEntity(eid *entity.ID) (bool, error) {
 		return false, err
 	}
 
-	return s.db.HasOperation(eid)
+	h, err = s.db.HasOperation(eid)
+	if h {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	h, err = s.db.HasUserUpdate(eid)
+	if h {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	h, err = s.db.HasKeyRotation(eid)
+	if h {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	h, err = s.db.HasKeyRevocation(eid)
+	if h {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	h, err = s.db.HasReaction(eid)
+	if h {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	h, err = s.db.HasModeratorList(eid)
+	if h {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	h, err = s.db.HasPrivateMessage(eid)
+	if h {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return s.db.HasVote(eid)
 }
 
 func (s *Storage) GetEntity(eid *entity.ID) (entity.Entity, error) {
@@ -187,6 +357,62 @@ func (s *Storage) GetEntity(eid *entity.ID) (entity.Entity, error) {
 	if err == nil {
 		return (entity.Entity)(o), nil
 	}
+	if err != errors.NoSuchEntity {
+		return nil, err
+	}
+
+	uu, err := s.db.GetUserUpdate(eid)
+	if err == nil {
+		return (entity.Entity)(uu), nil
+	}
+	if err != errors.NoSuchEntity {
+		return nil, err
+	}
+
+	kr, err := s.db.GetKeyRotation(eid)
+	if err == nil {
+		return (entity.Entity)(kr), nil
+	}
+	if err != errors.NoSuchEntity {
+		return nil, err
+	}
+
+	kv, err := s.db.GetKeyRevocation(eid)
+	if err == nil {
+		return (entity.Entity)(kv), nil
+	}
+	if err != errors.NoSuchEntity {
+		return nil, err
+	}
+
+	r, err := s.db.GetReaction(eid)
+	if err == nil {
+		return (entity.Entity)(r), nil
+	}
+	if err != errors.NoSuchEntity {
+		return nil, err
+	}
+
+	ml, err := s.db.GetModeratorList(eid)
+	if err == nil {
+		return (entity.Entity)(ml), nil
+	}
+	if err != errors.NoSuchEntity {
+		return nil, err
+	}
+
+	pm, err := s.db.GetPrivateMessage(eid)
+	if err == nil {
+		return (entity.Entity)(pm), nil
+	}
+	if err != errors.NoSuchEntity {
+		return nil, err
+	}
+
+	v, err := s.db.GetVote(eid)
+	if err == nil {
+		return (entity.Entity)(v), nil
+	}
 
 	return nil, err
 }
@@ -208,6 +434,20 @@ func (s *Storage) PutEntity(ent entity.Entity, sender chan<- entity.Entity) erro
 		err = s.db.PutMessage(e, time.Now())
 	case *entity.Operation:
 		err = s.db.PutOperation(e, time.Now())
+	case *entity.UserUpdate:
+		err = s.db.PutUserUpdate(e, time.Now())
+	case *entity.KeyRotation:
+		err = s.db.PutKeyRotation(e, time.Now())
+	case *entity.KeyRevocation:
+		err = s.db.PutKeyRevocation(e, time.Now())
+	case *entity.Reaction:
+		err = s.db.PutReaction(e, time.Now())
+	case *entity.ModeratorList:
+		err = s.db.PutModeratorList(e, time.Now())
+	case *entity.PrivateMessage:
+		err = s.db.PutPrivateMessage(e, time.Now())
+	case *entity.Vote:
+		err = s.db.PutVote(e, time.Now())
 	default:
 		log.Fatalf("BUG: unknown entity type %T.", ent)
 	}
@@ -17,9 +17,34 @@ this program.  If not, see <http://www.gnu.org/licenses/>.
 
 package strings
 
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
 func Truncate(s string, n int) string {
 	if len(s) > n {
 		return s[0:n]
 	}
 	return s
 }
+
+const maxDurationDays = int(math.MaxInt64 / int64(24*time.Hour))
+
+// ParseDuration parses a duration accepted by time.ParseDuration or a number
+// of days like "7d".
+func ParseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		if days > maxDurationDays || days < -maxDurationDays {
+			return 0, strconv.ErrRange
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}